@@ -31,17 +31,32 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/shim-loggers-for-containerd/debug"
 	"github.com/aws/shim-loggers-for-containerd/logger"
 	"github.com/aws/shim-loggers-for-containerd/logger/awslogs"
+	"github.com/aws/shim-loggers-for-containerd/logger/firehose"
 	"github.com/aws/shim-loggers-for-containerd/logger/fluentd"
+	"github.com/aws/shim-loggers-for-containerd/logger/gelf"
+	"github.com/aws/shim-loggers-for-containerd/logger/journald"
 	"github.com/aws/shim-loggers-for-containerd/logger/jsonfile"
+	"github.com/aws/shim-loggers-for-containerd/logger/kafka"
+	"github.com/aws/shim-loggers-for-containerd/logger/localfile"
+	"github.com/aws/shim-loggers-for-containerd/logger/loki"
+	"github.com/aws/shim-loggers-for-containerd/logger/opensearch"
+	"github.com/aws/shim-loggers-for-containerd/logger/otlp"
+	"github.com/aws/shim-loggers-for-containerd/logger/s3"
 	"github.com/aws/shim-loggers-for-containerd/logger/splunk"
+	"github.com/aws/shim-loggers-for-containerd/logger/syslog"
+	"github.com/aws/shim-loggers-for-containerd/logger/webhook"
 
 	units "github.com/docker/go-units"
 	"github.com/spf13/pflag"
@@ -49,10 +64,24 @@ import (
 )
 
 const (
-	defaultMaxBufferSize = "1m"
-	defaultCleanupTime   = "5s"
-	blockingMode         = "blocking"
-	nonBlockingMode      = "non-blocking"
+	defaultMaxBufferSize         = "1m"
+	defaultCleanupTime           = "5s"
+	defaultBufferOverflowTimeout = "1s"
+	defaultSpillSegmentSize      = "16m"
+	defaultSpillMaxSize          = "1g"
+	defaultMultilineFlushTimeout = "1s"
+	defaultMultilineMaxLines     = 500
+	defaultMultilineMaxBytes     = "64k"
+	defaultPartialMaxBytes       = "1m"
+	blockingMode                 = "blocking"
+	nonBlockingMode              = "non-blocking"
+	// logDriverSeparator separates the log drivers to send logs to all of them.
+	logDriverSeparator = ","
+	sourceSTDOUT       = "stdout"
+	sourceSTDERR       = "stderr"
+	// maxBufferOverflowTimeout bounds how long a container pipe can be stalled waiting for
+	// available buffer space with the block-with-timeout overflow policy.
+	maxBufferOverflowTimeout = 1 * time.Minute
 	// defaultFluentdWriteTimeout is the default timeout for writing log events to the fluentd socket.
 	// It's being set to a rather conservative value of 5s since the communication is over a unix
 	// domain socket file and 5s is way more than enough for sending a single log event.
@@ -78,6 +107,80 @@ func getGlobalArgs() (*logger.GlobalArgs, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to get value of flag %s and %s: %w", modeKey, maxBufferSizeKey, err)
 	}
+	driverModes, err := getDriverModes(logDriver, mode)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get value of flag %s: %w", driverModesKey, err)
+	}
+	// A single log driver runs in the mode it's given, which may be overridden as well.
+	if len(driverModes) == 1 {
+		for _, m := range driverModes {
+			mode = m
+		}
+	}
+	// The max buffer size is still needed if any log driver is in non-blocking mode.
+	if maxBufferSize == 0 {
+		for _, m := range driverModes {
+			if m != nonBlockingMode {
+				continue
+			}
+			maxBufferSize, err = getMaxBufferSize()
+			if err != nil {
+				return nil, fmt.Errorf("unable to get value of flag %s: %w", maxBufferSizeKey, err)
+			}
+			break
+		}
+	}
+	overflowPolicy, overflowTimeout, err := getBufferOverflowPolicy()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get value of flag %s and %s: %w",
+			bufferOverflowPolicyKey, bufferOverflowTimeoutKey, err)
+	}
+	spillDir, spillSegmentSize, spillMaxSize, err := getSpillQueueArgs()
+	if err != nil {
+		return nil, err
+	}
+	walDir, err := getWriteAheadLogDir(driverModes)
+	if err != nil {
+		return nil, err
+	}
+	var multiline *logger.MultilineArgs
+	if isMultilineEnabled() {
+		if multiline, err = getMultilineArgs(); err != nil {
+			return nil, err
+		}
+	}
+	partialReassemblyMaxBytes, err := getPartialReassemblyMaxBytes()
+	if err != nil {
+		return nil, err
+	}
+	var redactRules *logger.RedactRules
+	if viper.GetString(redactRulesKey) != "" {
+		if redactRules, err = getRedactRules(); err != nil {
+			return nil, err
+		}
+	}
+	var filterRules *logger.FilterRules
+	if viper.GetString(filterRulesKey) != "" {
+		if filterRules, err = getFilterRules(); err != nil {
+			return nil, err
+		}
+	}
+	discardStreams, err := getDiscardStreams(logDriver)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get value of flag %s: %w", discardStreamKey, err)
+	}
+	var rateLimit *logger.RateLimitArgs
+	if isRateLimitEnabled() {
+		if rateLimit, err = getRateLimitArgs(); err != nil {
+			return nil, err
+		}
+	}
+	var timestamp *logger.TimestampArgs
+	if isTimestampExtractionEnabled() {
+		if timestamp, err = getTimestampArgs(); err != nil {
+			return nil, err
+		}
+	}
 	cleanupTime, err := getCleanupTime()
 	if err != nil {
 		return nil, err
@@ -91,14 +194,31 @@ func getGlobalArgs() (*logger.GlobalArgs, error) {
 	}
 
 	args := &logger.GlobalArgs{
-		ContainerID:   containerID,
-		ContainerName: containerName,
-		LogDriver:     logDriver,
-		Mode:          mode,
-		MaxBufferSize: maxBufferSize,
-		UID:           viper.GetInt(uidKey),
-		GID:           viper.GetInt(gidKey),
-		CleanupTime:   cleanupTime,
+		ContainerID:               containerID,
+		ContainerName:             containerName,
+		LogDriver:                 logDriver,
+		Mode:                      mode,
+		DriverModes:               driverModes,
+		MaxBufferSize:             maxBufferSize,
+		BufferOverflowPolicy:      overflowPolicy,
+		BufferOverflowTimeout:     overflowTimeout,
+		BufferDropMarker:          viper.GetBool(bufferDropMarkerKey),
+		SpillDir:                  spillDir,
+		SpillSegmentSize:          spillSegmentSize,
+		SpillMaxSize:              spillMaxSize,
+		WriteAheadLogDir:          walDir,
+		Multiline:                 multiline,
+		PartialReassemblyMaxBytes: partialReassemblyMaxBytes,
+		RedactRules:               redactRules,
+		FilterRules:               filterRules,
+		DiscardStreams:            discardStreams,
+		RateLimit:                 rateLimit,
+		JSONParse:                 getJSONParseArgs(),
+		Timestamp:                 timestamp,
+		MetricsAddress:            viper.GetString(metricsAddressKey),
+		UID:                       viper.GetInt(uidKey),
+		GID:                       viper.GetInt(gidKey),
+		CleanupTime:               cleanupTime,
 	}
 
 	return args, nil
@@ -172,6 +292,45 @@ func getAWSLogsArgs() (*awslogs.Args, error) {
 	}, nil
 }
 
+// getFirehoseArgs gets firehose specified arguments for firehose log driver.
+func getFirehoseArgs() (*firehose.Args, error) {
+	deliveryStream, err := getRequiredValue(firehose.DeliveryStreamKey)
+	if err != nil {
+		return nil, err
+	}
+	region, err := getRequiredValue(firehose.RegionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &firehose.Args{
+		Stream:              deliveryStream,
+		Region:              region,
+		Endpoint:            viper.GetString(firehose.EndpointKey),
+		CredentialsEndpoint: viper.GetString(firehose.CredentialsEndpointKey),
+	}, nil
+}
+
+// getKinesisArgs gets kinesis specified arguments for kinesis log driver.
+func getKinesisArgs() (*firehose.Args, error) {
+	stream, err := getRequiredValue(firehose.KinesisStreamKey)
+	if err != nil {
+		return nil, err
+	}
+	region, err := getRequiredValue(firehose.KinesisRegionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &firehose.Args{
+		Stream:              stream,
+		Region:              region,
+		Endpoint:            viper.GetString(firehose.KinesisEndpointKey),
+		CredentialsEndpoint: viper.GetString(firehose.KinesisCredentialsEndpointKey),
+		PartitionKey:        viper.GetString(firehose.KinesisPartitionKeyKey),
+	}, nil
+}
+
 // getFluentdArgs gets fluentd specified arguments for fluentd log driver.
 func getFluentdArgs() *fluentd.Args {
 	address := viper.GetString(fluentd.AddressKey)
@@ -206,6 +365,29 @@ func getFluentdArgs() *fluentd.Args {
 	}
 }
 
+// getGELFArgs gets gelf specified arguments for gelf log driver. gelf-address is required;
+// everything else is optional and forwarded to moby's gelf driver as-is.
+func getGELFArgs() (*gelf.Args, error) {
+	address, err := getRequiredValue(gelf.AddressKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gelf.Args{
+		Address:           address,
+		CompressionType:   viper.GetString(gelf.CompressionTypeKey),
+		CompressionLevel:  viper.GetString(gelf.CompressionLevelKey),
+		TCPMaxReconnect:   viper.GetString(gelf.TCPMaxReconnectKey),
+		TCPReconnectDelay: viper.GetString(gelf.TCPReconnectDelayKey),
+		Labels:            viper.GetString(gelf.GELFLabelsKey),
+		LabelsRegex:       viper.GetString(gelf.GELFLabelsRegexKey),
+		Env:               viper.GetString(gelf.GELFEnvKey),
+		EnvRegex:          viper.GetString(gelf.GELFEnvRegexKey),
+		Tag:               viper.GetString(gelf.GELFTagKey),
+		TagSpecified:      isFlagPassed(gelf.GELFTagKey),
+	}, nil
+}
+
 // getJSONFileArgs gets json-file specified arguments for the json-file log driver.
 // log-path is required; everything else is optional and forwarded to moby's jsonfilelog
 // as-is. Note that moby validates option *keys* in ValidateLogOpts but defers value
@@ -234,6 +416,249 @@ func getJSONFileArgs() (*jsonfile.Args, error) {
 	}, nil
 }
 
+// getJournaldArgs gets journald specified arguments for journald log driver. All of them are
+// optional.
+func getJournaldArgs() *journald.Args {
+	return &journald.Args{
+		Labels:       viper.GetString(journald.JournaldLabelsKey),
+		LabelsRegex:  viper.GetString(journald.JournaldLabelsRegexKey),
+		Env:          viper.GetString(journald.JournaldEnvKey),
+		EnvRegex:     viper.GetString(journald.JournaldEnvRegexKey),
+		Tag:          viper.GetString(journald.JournaldTagKey),
+		TagSpecified: isFlagPassed(journald.JournaldTagKey),
+	}
+}
+
+// getHTTPArgs gets http specified arguments for http log driver. Values are validated by the
+// driver when the stream is created.
+func getHTTPArgs() (*webhook.Args, error) {
+	url, err := getRequiredValue(webhook.URLKey)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := getHTTPHeaders()
+	if err != nil {
+		return nil, err
+	}
+
+	return &webhook.Args{
+		URL:          url,
+		Format:       viper.GetString(webhook.FormatKey),
+		Template:     viper.GetString(webhook.TemplateKey),
+		Headers:      headers,
+		Gzip:         viper.GetString(webhook.GzipKey),
+		BatchSize:    viper.GetString(webhook.BatchSizeKey),
+		BatchBytes:   viper.GetString(webhook.BatchBytesKey),
+		BatchWait:    viper.GetString(webhook.BatchWaitKey),
+		MaxRetries:   viper.GetString(webhook.MaxRetriesKey),
+		RetryBackoff: viper.GetString(webhook.RetryBackoffKey),
+	}, nil
+}
+
+// getHTTPHeaders merges the headers of the --http-headers argument, of the file of the
+// --http-headers-file argument and of the endpoint of the --http-headers-endpoint argument, in
+// this order, so that secrets can be kept out of the arguments.
+func getHTTPHeaders() (map[string]string, error) {
+	headers := make(map[string]string)
+	if headersString := viper.GetString(webhook.HeadersKey); headersString != "" {
+		if err := json.Unmarshal([]byte(headersString), &headers); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", webhook.HeadersKey, err)
+		}
+	}
+
+	if headersFile := viper.GetString(webhook.HeadersFileKey); headersFile != "" {
+		body, err := os.ReadFile(headersFile) //nolint:gosec // the file is chosen by the operator
+		if err != nil {
+			return nil, fmt.Errorf("unable to read http headers from file: %w", err)
+		}
+		var fileHeaders map[string]string
+		if err := json.Unmarshal(body, &fileHeaders); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", headersFile, err)
+		}
+		for name, value := range fileHeaders {
+			headers[name] = value
+		}
+	}
+
+	if headersEndpoint := viper.GetString(webhook.HeadersEndpointKey); headersEndpoint != "" {
+		body, err := fetchFromEndpoint(headersEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch http headers from endpoint: %w", err)
+		}
+		var resp HTTPHeadersResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, fmt.Errorf("failed to decode response from %s: %w", headersEndpoint, err)
+		}
+		for name, value := range resp.Headers {
+			headers[name] = value
+		}
+	}
+
+	return headers, nil
+}
+
+// getKafkaArgs gets kafka specified arguments for kafka log driver. Values are validated by the
+// driver when the stream is created.
+func getKafkaArgs() (*kafka.Args, error) {
+	brokers, err := getRequiredValue(kafka.BrokersKey)
+	if err != nil {
+		return nil, err
+	}
+	topic, err := getRequiredValue(kafka.TopicKey)
+	if err != nil {
+		return nil, err
+	}
+	saslPassword, err := getSecret(kafka.SASLPasswordKey, kafka.SASLPasswordFileKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Args{
+		Brokers:               brokers,
+		Topic:                 topic,
+		Key:                   viper.GetString(kafka.KeyKey),
+		Acks:                  viper.GetString(kafka.AcksKey),
+		Compression:           viper.GetString(kafka.CompressionKey),
+		TLS:                   viper.GetString(kafka.TLSKey),
+		TLSCAFile:             viper.GetString(kafka.TLSCAFileKey),
+		TLSCertFile:           viper.GetString(kafka.TLSCertFileKey),
+		TLSKeyFile:            viper.GetString(kafka.TLSKeyFileKey),
+		TLSInsecureSkipVerify: viper.GetString(kafka.TLSInsecureSkipVerifyKey),
+		SASLMechanism:         viper.GetString(kafka.SASLMechanismKey),
+		SASLUsername:          viper.GetString(kafka.SASLUsernameKey),
+		SASLPassword:          saslPassword,
+		Labels:                viper.GetString(kafka.KafkaLabelsKey),
+		LabelsRegex:           viper.GetString(kafka.KafkaLabelsRegexKey),
+		Env:                   viper.GetString(kafka.KafkaEnvKey),
+		EnvRegex:              viper.GetString(kafka.KafkaEnvRegexKey),
+	}, nil
+}
+
+// getLocalFileArgs gets local-file specified arguments for local-file log driver. Values are
+// validated by the driver when the stream is created.
+func getLocalFileArgs() (*localfile.Args, error) {
+	path, err := getRequiredValue(localfile.PathKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &localfile.Args{
+		Path:         path,
+		Format:       viper.GetString(localfile.FormatKey),
+		MaxSize:      viper.GetString(localfile.MaxSizeKey),
+		Rotate:       viper.GetString(localfile.RotateKey),
+		MaxFiles:     viper.GetString(localfile.MaxFilesKey),
+		MaxTotalSize: viper.GetString(localfile.MaxTotalSizeKey),
+		Compression:  viper.GetString(localfile.CompressionKey),
+		Fsync:        viper.GetString(localfile.FsyncKey),
+	}, nil
+}
+
+// getLokiArgs gets loki specified arguments for loki log driver. Values are validated by the
+// driver when the stream is created.
+func getLokiArgs() (*loki.Args, error) {
+	url, err := getRequiredValue(loki.URLKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &loki.Args{
+		URL:       url,
+		TenantID:  viper.GetString(loki.TenantIDKey),
+		Format:    viper.GetString(loki.FormatKey),
+		Labels:    viper.GetString(loki.LabelsKey),
+		BatchSize: viper.GetString(loki.BatchSizeKey),
+		BatchWait: viper.GetString(loki.BatchWaitKey),
+	}, nil
+}
+
+// getOpenSearchArgs gets opensearch specified arguments for opensearch log driver. Values are
+// validated by the driver when the stream is created.
+func getOpenSearchArgs() (*opensearch.Args, error) {
+	endpoint, err := getRequiredValue(opensearch.EndpointKey)
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := getSecret(opensearch.PasswordKey, opensearch.PasswordFileKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &opensearch.Args{
+		Endpoint:            endpoint,
+		Index:               viper.GetString(opensearch.IndexKey),
+		IndexDateFormat:     viper.GetString(opensearch.IndexDateFormatKey),
+		Username:            viper.GetString(opensearch.UsernameKey),
+		Password:            password,
+		AWSSigV4:            viper.GetString(opensearch.AWSSigV4Key),
+		Region:              viper.GetString(opensearch.RegionKey),
+		AWSService:          viper.GetString(opensearch.AWSServiceKey),
+		CredentialsEndpoint: viper.GetString(opensearch.CredentialsEndpointKey),
+		Compression:         viper.GetString(opensearch.CompressionKey),
+	}, nil
+}
+
+// getOTLPArgs gets otlp specified arguments for otlp log driver. Values are validated by the
+// driver when the stream is created.
+func getOTLPArgs() (*otlp.Args, error) {
+	endpoint, err := getRequiredValue(otlp.EndpointKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &otlp.Args{
+		Endpoint:           endpoint,
+		Protocol:           viper.GetString(otlp.ProtocolKey),
+		Headers:            viper.GetString(otlp.HeadersKey),
+		Compression:        viper.GetString(otlp.CompressionKey),
+		ResourceAttributes: viper.GetString(otlp.ResourceAttributesKey),
+	}, nil
+}
+
+// getS3Args gets s3 specified arguments for s3 log driver. Optional values are validated by the
+// driver when the stream is created.
+func getS3Args() (*s3.Args, error) {
+	bucket, err := getRequiredValue(s3.BucketKey)
+	if err != nil {
+		return nil, err
+	}
+	region, err := getRequiredValue(s3.RegionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3.Args{
+		Bucket:              bucket,
+		Region:              region,
+		Endpoint:            viper.GetString(s3.EndpointKey),
+		CredentialsEndpoint: viper.GetString(s3.CredentialsEndpointKey),
+		ForcePathStyle:      viper.GetString(s3.ForcePathStyleKey),
+		KeyTemplate:         viper.GetString(s3.KeyTemplateKey),
+		Compression:         viper.GetString(s3.CompressionKey),
+		MaxSize:             viper.GetString(s3.MaxSizeKey),
+		MaxAge:              viper.GetString(s3.MaxAgeKey),
+		StagingDir:          viper.GetString(s3.StagingDirKey),
+	}, nil
+}
+
+// getSyslogArgs gets syslog specified arguments for syslog log driver. All of them are optional
+// and validated by the driver when the stream is created.
+func getSyslogArgs() *syslog.Args {
+	return &syslog.Args{
+		Address:       viper.GetString(syslog.AddressKey),
+		Facility:      viper.GetString(syslog.FacilityKey),
+		Format:        viper.GetString(syslog.FormatKey),
+		Framing:       viper.GetString(syslog.FramingKey),
+		TLSCACert:     viper.GetString(syslog.TLSCACertKey),
+		TLSCert:       viper.GetString(syslog.TLSCertKey),
+		TLSKey:        viper.GetString(syslog.TLSKeyKey),
+		TLSSkipVerify: viper.GetString(syslog.TLSSkipVerifyKey),
+		Tag:           viper.GetString(syslog.SyslogTagKey),
+		TagSpecified:  isFlagPassed(syslog.SyslogTagKey),
+	}
+}
+
 // getSplunkArgs gets Splunk specified arguments for Splunk log driver.
 func getSplunkArgs() (*splunk.Args, error) {
 	token, err := getSplunkToken()
@@ -336,6 +761,22 @@ func getRequiredValue(flag string) (string, error) {
 	return val, nil
 }
 
+// getSecret gets the value of a secret argument, or the content of the file of its file
+// argument if it's set, so that secrets can be kept out of the arguments. A trailing newline of
+// the file is ignored.
+func getSecret(flag, fileFlag string) (string, error) {
+	path := viper.GetString(fileFlag)
+	if path == "" {
+		return viper.GetString(flag), nil
+	}
+	content, err := os.ReadFile(path) //nolint:gosec // the file is chosen by the operator
+	if err != nil {
+		return "", fmt.Errorf("unable to read %s: %w", fileFlag, err)
+	}
+
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
 // getModeAndMaxBufferSize gets mode option and max buffer size if in blocking mode.
 func getModeAndMaxBufferSize() (string, int, error) {
 	var (
@@ -361,6 +802,59 @@ func getModeAndMaxBufferSize() (string, int, error) {
 	return mode, maxBufSize, nil
 }
 
+// getLogDrivers splits the value of the log driver flag, which is either a single log driver or a
+// comma-separated list of log drivers to send logs to all of them.
+func getLogDrivers(logDriver string) ([]string, error) {
+	drivers := strings.Split(logDriver, logDriverSeparator)
+	seen := make(map[string]bool, len(drivers))
+	for i, driver := range drivers {
+		driver = strings.TrimSpace(driver)
+		if driver == "" {
+			return nil, fmt.Errorf("empty log driver in %s", logDriver)
+		}
+		if seen[driver] {
+			return nil, fmt.Errorf("duplicate log driver %s in %s", driver, logDriver)
+		}
+		seen[driver] = true
+		drivers[i] = driver
+	}
+	return drivers, nil
+}
+
+// getDriverModes gets the mode of every log driver, which is either overridden by the driver
+// modes option in the format of `awslogs=non-blocking,json-file=blocking`, or default to the
+// given mode.
+func getDriverModes(logDriver, defaultMode string) (map[string]string, error) {
+	drivers, err := getLogDrivers(logDriver)
+	if err != nil {
+		return nil, err
+	}
+	modes := make(map[string]string, len(drivers))
+	for _, driver := range drivers {
+		modes[driver] = defaultMode
+	}
+
+	driverModes := viper.GetString(driverModesKey)
+	if driverModes == "" {
+		return modes, nil
+	}
+	for _, pair := range strings.Split(driverModes, logDriverSeparator) {
+		driver, mode, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid driver mode %s, expected driver=mode", pair)
+		}
+		if _, ok := modes[driver]; !ok {
+			return nil, fmt.Errorf("driver mode of %s which is not one of the log drivers %s", driver, logDriver)
+		}
+		if mode != blockingMode && mode != nonBlockingMode {
+			return nil, fmt.Errorf("unknown mode type of driver %s: %s", driver, mode)
+		}
+		modes[driver] = mode
+	}
+
+	return modes, nil
+}
+
 // getMaxBufferSize gets either customer asked buffer size or default size 1m.
 func getMaxBufferSize() (int, error) {
 	var (
@@ -381,6 +875,358 @@ func getMaxBufferSize() (int, error) {
 	return int(size), nil
 }
 
+// getBufferOverflowPolicy gets the overflow policy of the intermediate buffer, which is default
+// to drop-newest, and how long to wait for available space with the block-with-timeout policy,
+// which is default to 1s.
+func getBufferOverflowPolicy() (string, time.Duration, error) {
+	policy := viper.GetString(bufferOverflowPolicyKey)
+	switch policy {
+	case "":
+		policy = logger.DropNewestOverflowPolicy
+	case logger.DropNewestOverflowPolicy, logger.DropOldestOverflowPolicy, logger.BlockWithTimeoutOverflowPolicy:
+	default:
+		return "", 0, fmt.Errorf("unknown buffer overflow policy: %s", policy)
+	}
+
+	timeout := viper.GetString(bufferOverflowTimeoutKey)
+	if timeout == "" {
+		timeout = defaultBufferOverflowTimeout
+	}
+	duration, err := time.ParseDuration(timeout)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to parse buffer overflow timeout: %w", err)
+	}
+	if duration <= 0 || duration > maxBufferOverflowTimeout {
+		return "", 0, fmt.Errorf("invalid time %s, buffer overflow timeout must be positive and at most %s",
+			duration.String(), maxBufferOverflowTimeout.String())
+	}
+
+	return policy, duration, nil
+}
+
+// getSpillQueueArgs gets the directory to spill log messages to, if any, along with either customer
+// asked or default size of a single spill file and of all spill files.
+func getSpillQueueArgs() (string, int, int, error) {
+	dir := viper.GetString(spillDirKey)
+	if dir == "" {
+		return "", 0, 0, nil
+	}
+
+	segmentSize, err := getSizeInBytes(spillSegmentSizeKey, defaultSpillSegmentSize)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	maxSize, err := getSizeInBytes(spillMaxSizeKey, defaultSpillMaxSize)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if segmentSize > maxSize {
+		return "", 0, 0, fmt.Errorf("%s must not be larger than %s", spillSegmentSizeKey, spillMaxSizeKey)
+	}
+
+	return dir, segmentSize, maxSize, nil
+}
+
+// getWriteAheadLogDir gets the directory to save the write-ahead log to, if any. When container
+// logs are fanned out, a log message saved to the ring buffer of a log driver in non-blocking mode
+// is not delivered yet, but it would be acked as soon as it's saved, so the write-ahead log can
+// only be used if all the log drivers are in blocking mode.
+func getWriteAheadLogDir(driverModes map[string]string) (string, error) {
+	dir := viper.GetString(writeAheadLogDirKey)
+	if dir == "" || len(driverModes) < 2 {
+		return dir, nil
+	}
+	for driver, mode := range driverModes {
+		if mode == nonBlockingMode {
+			return "", fmt.Errorf("%s is not supported with log driver %s in non-blocking mode along with other log drivers",
+				writeAheadLogDirKey, driver)
+		}
+	}
+	return dir, nil
+}
+
+// isMultilineEnabled determines whether log lines are grouped, i.e. whether either a multiline
+// preset or pattern is set.
+func isMultilineEnabled() bool {
+	return viper.GetString(multilinePresetKey) != "" ||
+		viper.GetString(multilineStartPatternKey) != "" ||
+		viper.GetString(multilineContinuePatternKey) != ""
+}
+
+// getMultilineArgs gets the multiline arguments. The patterns are validated when the logger is
+// created.
+func getMultilineArgs() (*logger.MultilineArgs, error) {
+	args := &logger.MultilineArgs{
+		Preset:          viper.GetString(multilinePresetKey),
+		StartPattern:    viper.GetString(multilineStartPatternKey),
+		ContinuePattern: viper.GetString(multilineContinuePatternKey),
+	}
+	switch args.Preset {
+	case "", logger.JavaMultilinePreset, logger.PythonMultilinePreset, logger.GoMultilinePreset:
+	default:
+		return nil, fmt.Errorf("unknown multiline preset: %s", args.Preset)
+	}
+
+	timeout := viper.GetString(multilineFlushTimeoutKey)
+	if timeout == "" {
+		timeout = defaultMultilineFlushTimeout
+	}
+	duration, err := time.ParseDuration(timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse multiline flush timeout: %w", err)
+	}
+	if duration <= 0 {
+		return nil, fmt.Errorf("invalid time %s, multiline flush timeout must be positive", duration.String())
+	}
+	args.FlushTimeout = duration
+
+	args.MaxLines = defaultMultilineMaxLines
+	if maxLines := viper.GetString(multilineMaxLinesKey); maxLines != "" {
+		if args.MaxLines, err = strconv.Atoi(maxLines); err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", multilineMaxLinesKey, err)
+		}
+		if args.MaxLines <= 0 {
+			return nil, fmt.Errorf("invalid number %s, %s must be positive", maxLines, multilineMaxLinesKey)
+		}
+	}
+	if args.MaxBytes, err = getSizeInBytes(multilineMaxBytesKey, defaultMultilineMaxBytes); err != nil {
+		return nil, err
+	}
+
+	return args, nil
+}
+
+// getPartialReassemblyMaxBytes gets the max size of a log line reassembled from partial log
+// lines, which is 0 if reassembly is disabled. Reassembly is always enabled along with redaction.
+func getPartialReassemblyMaxBytes() (int, error) {
+	if !viper.GetBool(partialReassemblyKey) && viper.GetString(redactRulesKey) == "" {
+		return 0, nil
+	}
+	maxBytes, err := getSizeInBytes(partialReassemblyMaxBytesKey, defaultPartialMaxBytes)
+	if err != nil {
+		return 0, err
+	}
+	if maxBytes <= len(logger.PartialContinuationMarker) {
+		return 0, fmt.Errorf("invalid size %d, %s must be larger than %d bytes",
+			maxBytes, partialReassemblyMaxBytesKey, len(logger.PartialContinuationMarker))
+	}
+
+	return maxBytes, nil
+}
+
+// getRedactRules gets the redaction rules of the --redact-rules argument, which is either inline
+// JSON or the path of a JSON file, so that a salt can be kept out of the arguments. The rules are
+// validated when the logger is created.
+func getRedactRules() (*logger.RedactRules, error) {
+	var rules logger.RedactRules
+	if err := decodeRules(redactRulesKey, &rules); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+// getFilterRules gets the filter rules of the --filter-rules argument, which is either inline
+// JSON or the path of a JSON file. The rules are validated when the logger is created.
+func getFilterRules() (*logger.FilterRules, error) {
+	var rules logger.FilterRules
+	if err := decodeRules(filterRulesKey, &rules); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+// decodeRules decodes the value of the flag, which is either a JSON object or the path of a JSON
+// file, into rules.
+func decodeRules(flag string, rules interface{}) error {
+	rulesString := strings.TrimSpace(viper.GetString(flag))
+	body := []byte(rulesString)
+	if !strings.HasPrefix(rulesString, "{") {
+		var err error
+		body, err = os.ReadFile(rulesString) //nolint:gosec // the file is chosen by the operator
+		if err != nil {
+			return fmt.Errorf("unable to read %s from file: %w", flag, err)
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(rules); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", flag, err)
+	}
+	return nil
+}
+
+// getDiscardStreams gets the container pipe discarded by every log driver which discards one. The
+// discard stream option is a comma-separated list of either `stdout` or `stderr` discarded by all
+// the log drivers, or `driver=source` pairs such as `splunk=stdout` to only send stderr to Splunk.
+func getDiscardStreams(logDriver string) (map[string]string, error) {
+	drivers, err := getLogDrivers(logDriver)
+	if err != nil {
+		return nil, err
+	}
+	streams := make(map[string]string, len(drivers))
+	discardStreams := viper.GetString(discardStreamKey)
+	if discardStreams == "" {
+		return streams, nil
+	}
+	for _, entry := range strings.Split(discardStreams, logDriverSeparator) {
+		entry = strings.TrimSpace(entry)
+		driver, source, ok := strings.Cut(entry, "=")
+		if !ok {
+			source = entry
+		}
+		if source != sourceSTDOUT && source != sourceSTDERR {
+			return nil, fmt.Errorf("invalid discarded stream %s, expected %s or %s", entry, sourceSTDOUT, sourceSTDERR)
+		}
+		if !ok {
+			for _, d := range drivers {
+				streams[d] = source
+			}
+			continue
+		}
+		if !slices.Contains(drivers, driver) {
+			return nil, fmt.Errorf("discarded stream of %s which is not one of the log drivers %s", driver, logDriver)
+		}
+		streams[driver] = source
+	}
+
+	return streams, nil
+}
+
+// isRateLimitEnabled determines whether log lines are rate limited, i.e. whether either a rate of
+// log lines or of bytes is set.
+func isRateLimitEnabled() bool {
+	return viper.GetString(rateLimitLinesKey) != "" || viper.GetString(rateLimitBytesKey) != ""
+}
+
+// getRateLimitArgs gets the rate limit arguments. The bursts default to the rates when the logger
+// is created.
+func getRateLimitArgs() (*logger.RateLimitArgs, error) {
+	args := &logger.RateLimitArgs{Policy: viper.GetString(rateLimitPolicyKey)}
+	switch args.Policy {
+	case "", logger.DropRateLimitPolicy, logger.SampleRateLimitPolicy, logger.DedupeRateLimitPolicy:
+	default:
+		return nil, fmt.Errorf("unknown rate limit policy: %s", args.Policy)
+	}
+
+	var err error
+	for _, number := range []struct {
+		flag  string
+		value *int
+	}{
+		{rateLimitLinesKey, &args.LinesPerSecond},
+		{rateLimitLineBurstKey, &args.LineBurst},
+		{rateLimitSampleRateKey, &args.SampleRate},
+	} {
+		if *number.value, err = getOptionalPositiveInt(number.flag); err != nil {
+			return nil, err
+		}
+	}
+	for _, size := range []struct {
+		flag  string
+		value *int
+	}{
+		{rateLimitBytesKey, &args.BytesPerSecond},
+		{rateLimitByteBurstKey, &args.ByteBurst},
+	} {
+		if viper.GetString(size.flag) == "" {
+			continue
+		}
+		if *size.value, err = getSizeInBytes(size.flag, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return args, nil
+}
+
+// getOptionalPositiveInt gets the positive number of the given flag, which is 0 if it's not set.
+func getOptionalPositiveInt(flag string) (int, error) {
+	value := viper.GetString(flag)
+	if value == "" {
+		return 0, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse %s: %w", flag, err)
+	}
+	if number <= 0 {
+		return 0, fmt.Errorf("invalid number %s, %s must be positive", value, flag)
+	}
+	return number, nil
+}
+
+// getJSONParseArgs gets the JSON parse arguments, which are nil if JSON log lines aren't parsed.
+func getJSONParseArgs() *logger.JSONParseArgs {
+	if !viper.GetBool(jsonParseKey) {
+		return nil
+	}
+	args := &logger.JSONParseArgs{}
+	if fields := viper.GetString(jsonFieldsKey); fields != "" {
+		for _, field := range strings.Split(fields, ",") {
+			args.Fields = append(args.Fields, strings.TrimSpace(field))
+		}
+	}
+	return args
+}
+
+// isTimestampExtractionEnabled determines whether timestamps are extracted from log lines, i.e.
+// whether a timestamp source other than the read time is set.
+func isTimestampExtractionEnabled() bool {
+	source := viper.GetString(timestampSourceKey)
+	return source != "" && source != logger.ReadTimeTimestampSource
+}
+
+// getTimestampArgs gets the timestamp arguments. The regular expression and strftime format are
+// validated when the logger is created.
+func getTimestampArgs() (*logger.TimestampArgs, error) {
+	args := &logger.TimestampArgs{
+		Source:    viper.GetString(timestampSourceKey),
+		Regex:     viper.GetString(timestampRegexKey),
+		Layout:    viper.GetString(timestampLayoutKey),
+		Strftime:  viper.GetString(timestampStrftimeKey),
+		JSONField: viper.GetString(timestampJSONFieldKey),
+	}
+	switch {
+	case args.Source == logger.RegexTimestampSource && args.Regex == "":
+		return nil, fmt.Errorf("%s is required with timestamp source %s", timestampRegexKey, args.Source)
+	case args.Source == logger.StrftimeTimestampSource && args.Strftime == "":
+		return nil, fmt.Errorf("%s is required with timestamp source %s", timestampStrftimeKey, args.Source)
+	case args.Source != logger.RegexTimestampSource && args.Source != logger.StrftimeTimestampSource &&
+		args.Source != logger.JSONTimestampSource:
+		return nil, fmt.Errorf("unknown timestamp source: %s", args.Source)
+	}
+
+	if maxSkew := viper.GetString(timestampMaxSkewKey); maxSkew != "" {
+		duration, err := time.ParseDuration(maxSkew)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", timestampMaxSkewKey, err)
+		}
+		if duration <= 0 {
+			return nil, fmt.Errorf("invalid time %s, %s must be positive", duration.String(), timestampMaxSkewKey)
+		}
+		args.MaxSkew = duration
+	}
+	return args, nil
+}
+
+// getSizeInBytes gets either customer asked size of the given flag or the default size, in bytes.
+func getSizeInBytes(flag, defaultSize string) (int, error) {
+	size := viper.GetString(flag)
+	if size == "" {
+		size = defaultSize
+	}
+	sizeInBytes, err := units.RAMInBytes(size)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse %s to bytes: %w", flag, err)
+	}
+	if sizeInBytes <= 0 {
+		return 0, fmt.Errorf("invalid size %s, %s must be positive", size, flag)
+	}
+
+	return int(sizeInBytes), nil
+}
+
 // getCleanupTime gets either customized cleanup time or default duration of 5s.
 func getCleanupTime() (*time.Duration, error) {
 	cleanupTime := viper.GetString(cleanupTimeKey)
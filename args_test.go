@@ -13,14 +13,19 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
 
+	"github.com/aws/shim-loggers-for-containerd/logger"
 	"github.com/aws/shim-loggers-for-containerd/logger/awslogs"
 	"github.com/aws/shim-loggers-for-containerd/logger/fluentd"
 	"github.com/aws/shim-loggers-for-containerd/logger/jsonfile"
+	"github.com/aws/shim-loggers-for-containerd/logger/kafka"
+	"github.com/aws/shim-loggers-for-containerd/logger/opensearch"
 	"github.com/aws/shim-loggers-for-containerd/logger/splunk"
+	"github.com/aws/shim-loggers-for-containerd/logger/webhook"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -76,6 +81,13 @@ func testGetGlobalArgsNoError(t *testing.T) {
 	assert.Equal(t, args.Mode, blockingMode)
 	assert.Equal(t, args.MaxBufferSize, 0)
 	assert.Equal(t, *args.CleanupTime, 5*time.Second)
+
+	// The mode of a single log driver is overridden by its driver mode.
+	viper.Set(driverModesKey, testLogDriver+"="+nonBlockingMode)
+	args, err = getGlobalArgs()
+	require.NoError(t, err)
+	assert.Equal(t, args.Mode, nonBlockingMode)
+	require.NotZero(t, args.MaxBufferSize)
 }
 
 // testGetGlobalArgsWithError is a sub-test of TestGetGlobalArgs. It tests
@@ -254,6 +266,495 @@ func testGetCleanupTimeWithError(t *testing.T) {
 	}
 }
 
+// TestGetBufferOverflowPolicy tests getBufferOverflowPolicy with/without valid setting buffer
+// overflow options.
+func TestGetBufferOverflowPolicy(t *testing.T) {
+	t.Run("NoError", testGetBufferOverflowPolicyNoError)
+	t.Run("WithError", testGetBufferOverflowPolicyWithError)
+}
+
+// testGetBufferOverflowPolicyNoError is a sub-test of TestGetBufferOverflowPolicy. It tests
+// getBufferOverflowPolicy with multiple valid user-set values.
+func testGetBufferOverflowPolicyNoError(t *testing.T) {
+	// Unset all keys used for this test
+	defer viper.Reset()
+
+	testCasesNoError := []struct {
+		policy          string
+		timeout         string
+		expectedPolicy  string
+		expectedTimeout time.Duration
+	}{
+		{"", "", logger.DropNewestOverflowPolicy, time.Second},
+		{logger.DropNewestOverflowPolicy, "", logger.DropNewestOverflowPolicy, time.Second},
+		{logger.DropOldestOverflowPolicy, "", logger.DropOldestOverflowPolicy, time.Second},
+		{logger.BlockWithTimeoutOverflowPolicy, "500ms", logger.BlockWithTimeoutOverflowPolicy, 500 * time.Millisecond},
+	}
+
+	for _, tc := range testCasesNoError {
+		viper.Set(bufferOverflowPolicyKey, tc.policy)
+		viper.Set(bufferOverflowTimeoutKey, tc.timeout)
+		policy, timeout, err := getBufferOverflowPolicy()
+		require.NoError(t, err)
+		require.Equal(t, tc.expectedPolicy, policy)
+		require.Equal(t, tc.expectedTimeout, timeout)
+	}
+}
+
+// testGetBufferOverflowPolicyWithError is a sub-test of TestGetBufferOverflowPolicy. It tests
+// getBufferOverflowPolicy with multiple invalid user-set values.
+func testGetBufferOverflowPolicyWithError(t *testing.T) {
+	// Unset all keys used for this test
+	defer viper.Reset()
+
+	testCasesWithError := []struct {
+		policy  string
+		timeout string
+	}{
+		{"drop-all", ""},
+		{logger.BlockWithTimeoutOverflowPolicy, "3"},
+		{logger.BlockWithTimeoutOverflowPolicy, "0s"},
+		{logger.BlockWithTimeoutOverflowPolicy, "2m"},
+	}
+
+	for _, tc := range testCasesWithError {
+		viper.Set(bufferOverflowPolicyKey, tc.policy)
+		viper.Set(bufferOverflowTimeoutKey, tc.timeout)
+		_, _, err := getBufferOverflowPolicy()
+		require.Error(t, err)
+	}
+}
+
+// TestGetSpillQueueArgs tests getSpillQueueArgs with/without valid setting spill options.
+func TestGetSpillQueueArgs(t *testing.T) {
+	t.Run("NoError", testGetSpillQueueArgsNoError)
+	t.Run("WithError", testGetSpillQueueArgsWithError)
+}
+
+// testGetSpillQueueArgsNoError is a sub-test of TestGetSpillQueueArgs. It tests getSpillQueueArgs
+// with multiple valid user-set values.
+func testGetSpillQueueArgsNoError(t *testing.T) {
+	// Unset all keys used for this test
+	defer viper.Reset()
+
+	testCasesNoError := []struct {
+		dir                 string
+		segmentSize         string
+		maxSize             string
+		expectedSegmentSize int
+		expectedMaxSize     int
+	}{
+		{"", "", "", 0, 0},
+		{"/tmp/spill", "", "", int(math.Pow(2, 24)), int(math.Pow(2, 30))},
+		{"/tmp/spill", "4k", "1m", int(math.Pow(2, 12)), int(math.Pow(2, 20))},
+	}
+
+	for _, tc := range testCasesNoError {
+		viper.Set(spillDirKey, tc.dir)
+		viper.Set(spillSegmentSizeKey, tc.segmentSize)
+		viper.Set(spillMaxSizeKey, tc.maxSize)
+		dir, segmentSize, maxSize, err := getSpillQueueArgs()
+		require.NoError(t, err)
+		require.Equal(t, tc.dir, dir)
+		require.Equal(t, tc.expectedSegmentSize, segmentSize)
+		require.Equal(t, tc.expectedMaxSize, maxSize)
+	}
+}
+
+// testGetSpillQueueArgsWithError is a sub-test of TestGetSpillQueueArgs. It tests getSpillQueueArgs
+// with multiple invalid user-set values.
+func testGetSpillQueueArgsWithError(t *testing.T) {
+	// Unset all keys used for this test
+	defer viper.Reset()
+
+	testCasesWithError := []struct {
+		segmentSize string
+		maxSize     string
+	}{
+		{"3q", ""},
+		{"", "-1"},
+		{"2m", "1m"},
+	}
+
+	viper.Set(spillDirKey, "/tmp/spill")
+	for _, tc := range testCasesWithError {
+		viper.Set(spillSegmentSizeKey, tc.segmentSize)
+		viper.Set(spillMaxSizeKey, tc.maxSize)
+		_, _, _, err := getSpillQueueArgs()
+		require.Error(t, err)
+	}
+}
+
+// TestGetMultilineArgs tests getMultilineArgs with/without valid multiline options.
+func TestGetMultilineArgs(t *testing.T) {
+	t.Run("NoError", testGetMultilineArgsNoError)
+	t.Run("WithError", testGetMultilineArgsWithError)
+}
+
+// testGetMultilineArgsNoError is a sub-test of TestGetMultilineArgs. It tests getMultilineArgs
+// with multiple valid user-set values.
+func testGetMultilineArgsNoError(t *testing.T) {
+	// Unset all keys used for this test
+	defer viper.Reset()
+
+	require.False(t, isMultilineEnabled())
+	viper.Set(multilinePresetKey, logger.JavaMultilinePreset)
+	require.True(t, isMultilineEnabled())
+	args, err := getMultilineArgs()
+	require.NoError(t, err)
+	require.Equal(t, &logger.MultilineArgs{
+		Preset:       logger.JavaMultilinePreset,
+		FlushTimeout: time.Second,
+		MaxLines:     500,
+		MaxBytes:     int(math.Pow(2, 16)),
+	}, args)
+
+	viper.Set(multilinePresetKey, "")
+	viper.Set(multilineStartPatternKey, "^START")
+	viper.Set(multilineContinuePatternKey, `^\s`)
+	viper.Set(multilineFlushTimeoutKey, "100ms")
+	viper.Set(multilineMaxLinesKey, "10")
+	viper.Set(multilineMaxBytesKey, "4k")
+	require.True(t, isMultilineEnabled())
+	args, err = getMultilineArgs()
+	require.NoError(t, err)
+	require.Equal(t, &logger.MultilineArgs{
+		StartPattern:    "^START",
+		ContinuePattern: `^\s`,
+		FlushTimeout:    100 * time.Millisecond,
+		MaxLines:        10,
+		MaxBytes:        int(math.Pow(2, 12)),
+	}, args)
+}
+
+// testGetMultilineArgsWithError is a sub-test of TestGetMultilineArgs. It tests getMultilineArgs
+// with multiple invalid user-set values.
+func testGetMultilineArgsWithError(t *testing.T) {
+	// Unset all keys used for this test
+	defer viper.Reset()
+
+	testCasesWithError := []struct {
+		preset       string
+		flushTimeout string
+		maxLines     string
+		maxBytes     string
+	}{
+		{"ruby", "", "", ""},
+		{logger.GoMultilinePreset, "1q", "", ""},
+		{logger.GoMultilinePreset, "-1s", "", ""},
+		{logger.GoMultilinePreset, "", "many", ""},
+		{logger.GoMultilinePreset, "", "0", ""},
+		{logger.GoMultilinePreset, "", "", "-1"},
+	}
+
+	for _, tc := range testCasesWithError {
+		viper.Set(multilinePresetKey, tc.preset)
+		viper.Set(multilineFlushTimeoutKey, tc.flushTimeout)
+		viper.Set(multilineMaxLinesKey, tc.maxLines)
+		viper.Set(multilineMaxBytesKey, tc.maxBytes)
+		_, err := getMultilineArgs()
+		require.Error(t, err)
+	}
+}
+
+// TestGetPartialReassemblyMaxBytes tests getPartialReassemblyMaxBytes with/without valid partial
+// reassembly options.
+func TestGetPartialReassemblyMaxBytes(t *testing.T) {
+	// Unset all keys used for this test
+	defer viper.Reset()
+
+	viper.Set(partialReassemblyMaxBytesKey, "4k")
+	maxBytes, err := getPartialReassemblyMaxBytes()
+	require.NoError(t, err)
+	require.Zero(t, maxBytes)
+
+	viper.Set(redactRulesKey, `{"rules": [{"detector": "email"}]}`)
+	maxBytes, err = getPartialReassemblyMaxBytes()
+	require.NoError(t, err)
+	require.Equal(t, int(math.Pow(2, 12)), maxBytes)
+	viper.Set(redactRulesKey, "")
+
+	viper.Set(partialReassemblyKey, true)
+	maxBytes, err = getPartialReassemblyMaxBytes()
+	require.NoError(t, err)
+	require.Equal(t, int(math.Pow(2, 12)), maxBytes)
+
+	viper.Set(partialReassemblyMaxBytesKey, "")
+	maxBytes, err = getPartialReassemblyMaxBytes()
+	require.NoError(t, err)
+	require.Equal(t, int(math.Pow(2, 20)), maxBytes)
+
+	for _, size := range []string{"3q", "-1", "16"} {
+		viper.Set(partialReassemblyMaxBytesKey, size)
+		_, err = getPartialReassemblyMaxBytes()
+		require.Error(t, err)
+	}
+}
+
+// TestGetRedactRules tests getRedactRules with inline JSON, a JSON file and invalid values.
+func TestGetRedactRules(t *testing.T) {
+	// Unset all keys used for this test
+	defer viper.Reset()
+
+	expected := &logger.RedactRules{
+		Rules: []logger.RedactRule{
+			{Detector: logger.EmailDetector, Action: logger.HashRedactAction},
+			{Name: "password", Pattern: `password=(\S+)`},
+		},
+		Salt: "salt",
+	}
+	rulesJSON := `{"rules": [{"detector": "email", "action": "hash"}, {"name": "password", "pattern": "password=(\\S+)"}], "salt": "salt"}`
+	viper.Set(redactRulesKey, rulesJSON)
+	rules, err := getRedactRules()
+	require.NoError(t, err)
+	require.Equal(t, expected, rules)
+
+	rulesFile := filepath.Join(t.TempDir(), "redact-rules.json")
+	require.NoError(t, os.WriteFile(rulesFile, []byte(rulesJSON), 0o600))
+	viper.Set(redactRulesKey, rulesFile)
+	rules, err = getRedactRules()
+	require.NoError(t, err)
+	require.Equal(t, expected, rules)
+
+	for _, value := range []string{
+		`{"rules": [{"detector": "email"}]`,
+		`{"rules": [{"regexp": "@"}]}`,
+		filepath.Join(t.TempDir(), "missing.json"),
+	} {
+		viper.Set(redactRulesKey, value)
+		_, err = getRedactRules()
+		require.Error(t, err)
+	}
+}
+
+// TestGetFilterRules tests that the filter rules are decoded from either inline JSON or a file.
+func TestGetFilterRules(t *testing.T) {
+	// Unset all keys used for this test
+	defer viper.Reset()
+
+	expected := &logger.FilterRules{
+		Rules: []logger.FilterRule{
+			{Action: logger.ExcludeFilterAction, Pattern: "GET /health"},
+			{Action: logger.IncludeFilterAction, Pattern: "ERROR", Source: "stderr"},
+		},
+	}
+	rulesJSON := `{"rules": [{"action": "exclude", "pattern": "GET /health"}, {"action": "include", "pattern": "ERROR", "source": "stderr"}]}`
+	viper.Set(filterRulesKey, rulesJSON)
+	rules, err := getFilterRules()
+	require.NoError(t, err)
+	require.Equal(t, expected, rules)
+
+	rulesFile := filepath.Join(t.TempDir(), "filter-rules.json")
+	require.NoError(t, os.WriteFile(rulesFile, []byte(rulesJSON), 0o600))
+	viper.Set(filterRulesKey, rulesFile)
+	rules, err = getFilterRules()
+	require.NoError(t, err)
+	require.Equal(t, expected, rules)
+
+	for _, value := range []string{
+		`{"rules": [{"action": "exclude", "regexp": "GET"}]}`,
+		filepath.Join(t.TempDir(), "missing.json"),
+	} {
+		viper.Set(filterRulesKey, value)
+		_, err = getFilterRules()
+		require.Error(t, err)
+	}
+}
+
+// TestGetDiscardStreams tests getDiscardStreams with valid and invalid discarded streams.
+func TestGetDiscardStreams(t *testing.T) {
+	// Unset all keys used for this test
+	defer viper.Reset()
+
+	for _, tc := range []struct {
+		logDriver       string
+		discardStream   string
+		expectedStreams map[string]string
+	}{
+		{awslogs.DriverName, "", map[string]string{}},
+		{awslogs.DriverName, "stdout", map[string]string{awslogs.DriverName: "stdout"}},
+		{"awslogs,splunk", "splunk=stdout", map[string]string{splunk.DriverName: "stdout"}},
+		{"awslogs,splunk", "stderr, splunk=stdout", map[string]string{awslogs.DriverName: "stderr", splunk.DriverName: "stdout"}},
+	} {
+		viper.Set(discardStreamKey, tc.discardStream)
+		streams, err := getDiscardStreams(tc.logDriver)
+		require.NoError(t, err)
+		require.Equal(t, tc.expectedStreams, streams)
+	}
+
+	for _, discardStream := range []string{"stdin", "splunk=stdout", "awslogs=", "awslogs=stdin"} {
+		viper.Set(discardStreamKey, discardStream)
+		_, err := getDiscardStreams(awslogs.DriverName)
+		require.Error(t, err)
+	}
+}
+
+// TestGetRateLimitArgs tests getRateLimitArgs with valid and invalid rate limit options.
+func TestGetRateLimitArgs(t *testing.T) {
+	// Unset all keys used for this test
+	defer viper.Reset()
+
+	require.False(t, isRateLimitEnabled())
+	viper.Set(rateLimitLinesKey, "100")
+	viper.Set(rateLimitBytesKey, "1m")
+	viper.Set(rateLimitByteBurstKey, "2m")
+	viper.Set(rateLimitPolicyKey, logger.SampleRateLimitPolicy)
+	viper.Set(rateLimitSampleRateKey, "5")
+	require.True(t, isRateLimitEnabled())
+	args, err := getRateLimitArgs()
+	require.NoError(t, err)
+	require.Equal(t, &logger.RateLimitArgs{
+		LinesPerSecond: 100,
+		BytesPerSecond: 1024 * 1024,
+		ByteBurst:      2 * 1024 * 1024,
+		Policy:         logger.SampleRateLimitPolicy,
+		SampleRate:     5,
+	}, args)
+
+	for key, value := range map[string]string{
+		rateLimitLinesKey:      "0",
+		rateLimitLineBurstKey:  "ten",
+		rateLimitBytesKey:      "1x",
+		rateLimitPolicyKey:     "block",
+		rateLimitSampleRateKey: "-1",
+	} {
+		viper.Set(key, value)
+		_, err = getRateLimitArgs()
+		require.Error(t, err, key)
+		viper.Set(key, "")
+	}
+}
+
+// TestGetJSONParseArgs tests getJSONParseArgs with/without JSON parsing enabled and custom fields.
+func TestGetJSONParseArgs(t *testing.T) {
+	// Unset all keys used for this test
+	defer viper.Reset()
+
+	require.Nil(t, getJSONParseArgs())
+	viper.Set(jsonParseKey, true)
+	require.Equal(t, &logger.JSONParseArgs{}, getJSONParseArgs())
+	viper.Set(jsonFieldsKey, "severity, request_id")
+	require.Equal(t, &logger.JSONParseArgs{Fields: []string{"severity", "request_id"}}, getJSONParseArgs())
+}
+
+// TestGetTimestampArgs tests getTimestampArgs with/without valid timestamp options.
+func TestGetTimestampArgs(t *testing.T) {
+	// Unset all keys used for this test
+	defer viper.Reset()
+
+	require.False(t, isTimestampExtractionEnabled())
+	viper.Set(timestampSourceKey, logger.ReadTimeTimestampSource)
+	require.False(t, isTimestampExtractionEnabled())
+
+	viper.Set(timestampSourceKey, logger.StrftimeTimestampSource)
+	viper.Set(timestampStrftimeKey, "%Y-%m-%d %H:%M:%S")
+	viper.Set(timestampMaxSkewKey, "30m")
+	require.True(t, isTimestampExtractionEnabled())
+	args, err := getTimestampArgs()
+	require.NoError(t, err)
+	require.Equal(t, &logger.TimestampArgs{
+		Source:   logger.StrftimeTimestampSource,
+		Strftime: "%Y-%m-%d %H:%M:%S",
+		MaxSkew:  30 * time.Minute,
+	}, args)
+
+	for _, tc := range []map[string]string{
+		{timestampSourceKey: "syslog"},
+		{timestampSourceKey: logger.RegexTimestampSource},
+		{timestampSourceKey: logger.JSONTimestampSource, timestampMaxSkewKey: "0s"},
+		{timestampSourceKey: logger.JSONTimestampSource, timestampMaxSkewKey: "2 hours"},
+	} {
+		viper.Reset()
+		for key, value := range tc {
+			viper.Set(key, value)
+		}
+		_, err = getTimestampArgs()
+		require.Error(t, err, tc)
+	}
+}
+
+// TestGetWriteAheadLogDir tests that the write-ahead log is rejected when container logs are
+// fanned out to a log driver in non-blocking mode.
+func TestGetWriteAheadLogDir(t *testing.T) {
+	// Unset all keys used for this test
+	defer viper.Reset()
+
+	dir, err := getWriteAheadLogDir(map[string]string{awslogs.DriverName: nonBlockingMode})
+	require.NoError(t, err)
+	require.Empty(t, dir)
+
+	viper.Set(writeAheadLogDirKey, "/var/lib/shim-logger/wal")
+	for _, modes := range []map[string]string{
+		{awslogs.DriverName: nonBlockingMode},
+		{awslogs.DriverName: blockingMode, jsonfile.DriverName: blockingMode},
+	} {
+		dir, err = getWriteAheadLogDir(modes)
+		require.NoError(t, err)
+		require.Equal(t, "/var/lib/shim-logger/wal", dir)
+	}
+	_, err = getWriteAheadLogDir(map[string]string{awslogs.DriverName: nonBlockingMode, jsonfile.DriverName: blockingMode})
+	require.Error(t, err)
+}
+
+// TestGetDriverModes tests getDriverModes with/without valid setting log driver and driver
+// modes options.
+func TestGetDriverModes(t *testing.T) {
+	t.Run("NoError", testGetDriverModesNoError)
+	t.Run("WithError", testGetDriverModesWithError)
+}
+
+// testGetDriverModesNoError is a sub-test of TestGetDriverModes. It tests getDriverModes with
+// multiple valid user-set values.
+func testGetDriverModesNoError(t *testing.T) {
+	// Unset all keys used for this test
+	defer viper.Reset()
+
+	testCasesNoError := []struct {
+		logDriver     string
+		driverModes   string
+		expectedModes map[string]string
+	}{
+		{awslogs.DriverName, "", map[string]string{awslogs.DriverName: blockingMode}},
+		{"awslogs,json-file", "", map[string]string{awslogs.DriverName: blockingMode, jsonfile.DriverName: blockingMode}},
+		{
+			"awslogs, json-file",
+			"awslogs=non-blocking",
+			map[string]string{awslogs.DriverName: nonBlockingMode, jsonfile.DriverName: blockingMode},
+		},
+	}
+
+	for _, tc := range testCasesNoError {
+		viper.Set(driverModesKey, tc.driverModes)
+		modes, err := getDriverModes(tc.logDriver, blockingMode)
+		require.NoError(t, err)
+		require.Equal(t, tc.expectedModes, modes)
+	}
+}
+
+// testGetDriverModesWithError is a sub-test of TestGetDriverModes. It tests getDriverModes with
+// multiple invalid user-set values.
+func testGetDriverModesWithError(t *testing.T) {
+	// Unset all keys used for this test
+	defer viper.Reset()
+
+	testCasesWithError := []struct {
+		logDriver   string
+		driverModes string
+	}{
+		{"awslogs,", ""},
+		{"awslogs,awslogs", ""},
+		{"awslogs,json-file", "awslogs"},
+		{"awslogs,json-file", "splunk=blocking"},
+		{"awslogs,json-file", "awslogs=test-mode"},
+	}
+
+	for _, tc := range testCasesWithError {
+		viper.Set(driverModesKey, tc.driverModes)
+		_, err := getDriverModes(tc.logDriver, blockingMode)
+		require.Error(t, err)
+	}
+}
+
 // TestGetDockerConfigs tests that we can correctly get the docker config input parameters.
 func TestGetDockerConfigs(t *testing.T) {
 	t.Run("NoError", testGetDockerConfigsNoError)
@@ -633,6 +1134,93 @@ func TestGetSplunkArgsWithEndpoint(t *testing.T) {
 	assert.Equal(t, testURL, args.URL)
 }
 
+// TestGetHTTPHeaders tests that getHTTPHeaders merges the headers of the
+// --http-headers argument, of the file and of the endpoint, in this order.
+// Not parallel: tests share viper global state.
+func TestGetHTTPHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		resp := HTTPHeadersResponse{Headers: map[string]string{"Authorization": "Bearer endpoint-token"}}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+	headersFile := filepath.Join(t.TempDir(), "headers.json")
+	require.NoError(t, os.WriteFile(headersFile, []byte(`{"X-Api-Key":"file-key","X-Source":"file"}`), 0o600))
+
+	defer viper.Reset()
+	viper.Set(webhook.URLKey, "https://collector.example.com")
+	viper.Set(webhook.HeadersKey, `{"X-Source":"argument","Authorization":"Bearer argument-token"}`)
+	viper.Set(webhook.HeadersFileKey, headersFile)
+	viper.Set(webhook.HeadersEndpointKey, server.URL)
+
+	args, err := getHTTPArgs()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"Authorization": "Bearer endpoint-token",
+		"X-Api-Key":     "file-key",
+		"X-Source":      "file",
+	}, args.Headers)
+
+	viper.Set(webhook.HeadersKey, "not-json")
+	_, err = getHTTPHeaders()
+	require.ErrorContains(t, err, "failed to decode http-headers")
+
+	viper.Set(webhook.HeadersKey, "")
+	viper.Set(webhook.HeadersFileKey, filepath.Join(t.TempDir(), "missing.json"))
+	_, err = getHTTPHeaders()
+	require.ErrorContains(t, err, "unable to read http headers from file")
+}
+
+// TestGetKafkaArgs tests that the password of the file of the --kafka-sasl-password-file
+// argument overrides the one of the --kafka-sasl-password argument.
+// Not parallel: tests share viper global state.
+func TestGetKafkaArgs(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("file-password\n"), 0o600))
+
+	defer viper.Reset()
+	viper.Set(kafka.BrokersKey, "localhost:9092")
+	viper.Set(kafka.TopicKey, "logs")
+	viper.Set(kafka.SASLPasswordKey, "argument-password")
+
+	args, err := getKafkaArgs()
+	require.NoError(t, err)
+	require.Equal(t, "argument-password", args.SASLPassword)
+
+	viper.Set(kafka.SASLPasswordFileKey, passwordFile)
+	args, err = getKafkaArgs()
+	require.NoError(t, err)
+	require.Equal(t, "file-password", args.SASLPassword)
+
+	viper.Set(kafka.SASLPasswordFileKey, filepath.Join(t.TempDir(), "missing"))
+	_, err = getKafkaArgs()
+	require.ErrorContains(t, err, "unable to read kafka-sasl-password-file")
+}
+
+// TestGetOpenSearchArgs tests that the password of the file of the --opensearch-password-file
+// argument overrides the one of the --opensearch-password argument.
+// Not parallel: tests share viper global state.
+func TestGetOpenSearchArgs(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("file-password\n"), 0o600))
+
+	defer viper.Reset()
+	viper.Set(opensearch.EndpointKey, "https://localhost:9200")
+	viper.Set(opensearch.PasswordKey, "argument-password")
+
+	args, err := getOpenSearchArgs()
+	require.NoError(t, err)
+	require.Equal(t, "argument-password", args.Password)
+
+	viper.Set(opensearch.PasswordFileKey, passwordFile)
+	args, err = getOpenSearchArgs()
+	require.NoError(t, err)
+	require.Equal(t, "file-password", args.Password)
+
+	viper.Set(opensearch.PasswordFileKey, filepath.Join(t.TempDir(), "missing"))
+	_, err = getOpenSearchArgs()
+	require.ErrorContains(t, err, "unable to read opensearch-password-file")
+}
+
 // TestGetContainerEnv tests the getContainerEnv function with endpoint-based
 // fetching and fallback to the direct --container-env argument.
 // Not parallel: tests share viper global state.
@@ -35,7 +35,14 @@ func FlushLog() {}
 // SendEventsToLog dispatches log messages to the system journal based on the given priority.
 func SendEventsToLog(syslogIdentifier string, msg string, msgType string, delay time.Duration) {
 	journalType := journalPriority[msgType]
-	sendEventsToJournal(syslogIdentifier, msg, journalType, delay)
+	sendEventsToJournal(syslogIdentifier, msg, journalType, delay, nil)
+}
+
+// SendEvent dispatches a log message to the system journal based on the given priority, with the
+// given fields saved as journal fields, e.g. `CONTAINER_ID=`, so that it can be filtered by them.
+func SendEvent(syslogIdentifier string, msg string, msgType string, fields ...Field) {
+	journalType := journalPriority[msgType]
+	sendEventsToJournal(syslogIdentifier, msg, journalType, 0, fields)
 }
 
 // StartStackTraceHandler is used when the process catches signals, we will print the stack trace and write
@@ -62,12 +69,27 @@ func StartStackTraceHandler() {
 // This is a temporary solution for logging the shim-loggers-for-containerd package itself. We directly
 // send the events to system journal and they are identified by the package name. Since this process is
 // started by containerd, we can check the logs using `journalctl -u containerd.service`.
-func sendEventsToJournal(syslogIdentifier string, msg string, msgType journal.Priority, delay time.Duration) {
-	vars := map[string]string{"SYSLOG_IDENTIFIER": syslogIdentifier}
+func sendEventsToJournal(
+	syslogIdentifier string,
+	msg string,
+	msgType journal.Priority,
+	delay time.Duration,
+	fields []Field,
+) {
+	vars := journalVars(syslogIdentifier, fields)
 	journal.Send(msg, msgType, vars) //nolint:errcheck,gosec // asynchronous process
 	time.Sleep(delay * time.Second)
 }
 
+// journalVars returns the journal fields of an event, including the default fields.
+func journalVars(syslogIdentifier string, fields []Field) map[string]string {
+	vars := map[string]string{"SYSLOG_IDENTIFIER": syslogIdentifier}
+	for _, f := range withDefaultFields(fields) {
+		vars[f.journalKey] = f.String()
+	}
+	return vars
+}
+
 // SetLogFilePath only supported on Windows
 // For non-Windows logs will be written to journald.
 func SetLogFilePath(_, _ string) error {
@@ -0,0 +1,54 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit && !windows
+// +build unit,!windows
+
+package debug
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestJournalVars tests that the fields of an event are saved as journal fields, following the
+// default fields.
+func TestJournalVars(t *testing.T) {
+	SetDefaultFields(ContainerID("test-container-id"), Driver("awslogs"))
+	defer SetDefaultFields()
+
+	vars := journalVars(daemonName, []Field{Source("stdout"), Bytes(42), Err(errors.New("test error"))})
+	require.Equal(t, map[string]string{
+		"SYSLOG_IDENTIFIER": daemonName,
+		"CONTAINER_ID":      "test-container-id",
+		"SHIM_DRIVER":       "awslogs",
+		"SHIM_SOURCE":       "stdout",
+		"SHIM_BYTES":        "42",
+		"SHIM_ERROR":        "test error",
+	}, vars)
+}
+
+// TestSetDefaultFieldsConcurrently tests that the default fields can be set while events are sent.
+func TestSetDefaultFieldsConcurrently(t *testing.T) {
+	defer SetDefaultFields()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			SetDefaultFields(ContainerID("test-container-id"), Driver("awslogs"))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			vars := journalVars(daemonName, []Field{Source("stdout")})
+			require.Equal(t, "stdout", vars["SHIM_SOURCE"])
+		}
+	}()
+	wg.Wait()
+}
@@ -13,6 +13,9 @@ import (
 // Not implemented.
 func SendEventsToLog(_, _, _ string, _ time.Duration) {}
 
+// Not implemented.
+func SendEvent(_, _, _ string, _ ...Field) {}
+
 // Not implemented.
 func StartStackTraceHandler() {}
 
@@ -7,6 +7,7 @@
 package debug
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -21,7 +22,7 @@ const (
 	MAX_FILE_SIZE float64 = 10
 	// Maximum number of files generated in log rotation
 	MAX_ROLLS int = 24
-	// Messages will be in the format "time=... level=... msg=..."
+	// Messages are JSON lines in the format {"time":"...","level":"...","msg":"...",...}
 	SEE_LOG_CONFIG_TEMPLATE string = `
 <seelog type="asyncloop">
 	<outputs formatid="main">
@@ -29,7 +30,7 @@ const (
 			maxsize="%d" archivetype="none" maxrolls="%d" />
 	</outputs>
 	<formats>
-		<format id="main" format="time=%%Date/%%Time level=%%LEV msg=%%Msg%%n"/>
+		<format id="main" format="%%Msg%%n"/>
 	</formats>
 </seelog>`
 )
@@ -50,6 +51,17 @@ func FlushLog() {
 }
 
 func SendEventsToLog(logfileNameId string, msg string, msgType string, delay time.Duration) {
+	sendEventsToFile(logfileNameId, msg, msgType, delay, nil)
+}
+
+// SendEvent writes a log message to the log file as a JSON line, with the given fields saved as
+// keys of the JSON object, e.g. `container_id`.
+func SendEvent(logfileNameId string, msg string, msgType string, fields ...Field) {
+	sendEventsToFile(logfileNameId, msg, msgType, 0, fields)
+}
+
+func sendEventsToFile(logfileNameId string, msg string, msgType string, delay time.Duration, fields []Field) {
+	line := jsonLine(msg, msgType, fields)
 	filename := fmt.Sprintf("%s-%s.log", containerName, logfileNameId)
 	file := filepath.Join(logFileDir, filename)
 	configStr := fmt.Sprintf(SEE_LOG_CONFIG_TEMPLATE, file, int(MAX_FILE_SIZE*1000000), MAX_ROLLS)
@@ -61,15 +73,32 @@ func SendEventsToLog(logfileNameId string, msg string, msgType string, delay tim
 
 	switch msgType {
 	case "err":
-		logger.Error(msg)
+		logger.Error(line)
 	case "info":
-		logger.Info(msg)
+		logger.Info(line)
 	case "debug":
-		logger.Debug(msg)
+		logger.Debug(line)
 	}
 	time.Sleep(delay * time.Second)
 }
 
+// jsonLine formats an event as a JSON object, including the default fields.
+func jsonLine(msg string, msgType string, fields []Field) string {
+	event := map[string]interface{}{
+		"time":  time.Now().UTC().Format(time.RFC3339Nano),
+		"level": msgType,
+		"msg":   msg,
+	}
+	for _, f := range withDefaultFields(fields) {
+		event[f.jsonKey] = f.value
+	}
+	b, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Sprintf(`{"level":%q,"msg":%q}`, msgType, msg)
+	}
+	return string(b)
+}
+
 func SetLogFilePath(logFlag, contName string) error {
 	containerName = contName
 	logFileDir = logFlag
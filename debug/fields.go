@@ -0,0 +1,98 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package debug
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Field is a typed field attached to an event, so that events can be filtered and aggregated
+// without parsing their messages. It's saved as a journal field on Linux, e.g. `CONTAINER_ID=`,
+// and as a key of the JSON line in the log file on Windows, e.g. `container_id`.
+type Field struct {
+	// journalKey is the name of the field in the system journal.
+	journalKey string
+	// jsonKey is the name of the field in the JSON lines of the log file.
+	jsonKey string
+	// value is either a string or a number.
+	value interface{}
+}
+
+var (
+	// defaultFields are attached to every event sent by this process.
+	defaultFields   []Field
+	defaultFieldsMu sync.RWMutex
+)
+
+// SetDefaultFields sets the fields attached to every event sent by this process, such as the
+// container ID and the log driver. It's expected to be called once before sending any event.
+func SetDefaultFields(fields ...Field) {
+	defaultFieldsMu.Lock()
+	defer defaultFieldsMu.Unlock()
+	defaultFields = fields
+}
+
+// ContainerID returns a field holding the ID of the container.
+func ContainerID(id string) Field {
+	return Field{journalKey: "CONTAINER_ID", jsonKey: "container_id", value: id}
+}
+
+// Driver returns a field holding the name of the log driver.
+func Driver(name string) Field {
+	return Field{journalKey: "SHIM_DRIVER", jsonKey: "driver", value: name}
+}
+
+// Source returns a field holding the container pipe the event is about, i.e. stdout or stderr.
+func Source(source string) Field {
+	return Field{journalKey: "SHIM_SOURCE", jsonKey: "source", value: source}
+}
+
+// Bytes returns a field holding a number of bytes.
+func Bytes(n uint64) Field {
+	return Field{journalKey: "SHIM_BYTES", jsonKey: "bytes", value: n}
+}
+
+// BytesSent returns a field holding a number of bytes sent to the destination, for events which
+// also hold the number of bytes read.
+func BytesSent(n uint64) Field {
+	return Field{journalKey: "SHIM_BYTES_SENT", jsonKey: "bytes_sent", value: n}
+}
+
+// BytesFiltered returns a field holding a number of bytes filtered out before they are sent to
+// the destination, for events which also hold the number of bytes read.
+func BytesFiltered(n uint64) Field {
+	return Field{journalKey: "SHIM_BYTES_FILTERED", jsonKey: "bytes_filtered", value: n}
+}
+
+// Lines returns a field holding a number of log lines.
+func Lines(n uint64) Field {
+	return Field{journalKey: "SHIM_LINES", jsonKey: "lines", value: n}
+}
+
+// Rule returns a field holding the name of the rule of a log line processing stage, such as a
+// redaction rule.
+func Rule(name string) Field {
+	return Field{journalKey: "SHIM_RULE", jsonKey: "rule", value: name}
+}
+
+// Err returns a field holding an error.
+func Err(err error) Field {
+	return Field{journalKey: "SHIM_ERROR", jsonKey: "error", value: err.Error()}
+}
+
+// String returns the value of the field formatted as a string.
+func (f Field) String() string {
+	return fmt.Sprint(f.value)
+}
+
+// withDefaultFields returns the default fields followed by the given ones.
+func withDefaultFields(fields []Field) []Field {
+	defaultFieldsMu.RLock()
+	defer defaultFieldsMu.RUnlock()
+	if len(defaultFields) == 0 {
+		return fields
+	}
+	return append(append(make([]Field, 0, len(defaultFields)+len(fields)), defaultFields...), fields...)
+}
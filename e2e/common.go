@@ -28,6 +28,10 @@ const (
 	FluentdDriverName = "fluentd"
 	// JSONFileDriverName is the name of the json-file driver.
 	JSONFileDriverName = "json-file"
+	// KinesisDriverName is the name of kinesis driver.
+	KinesisDriverName = "kinesis"
+	// S3DriverName is the name of s3 driver.
+	S3DriverName = "s3"
 	// SplunkDriverName is the name of splunk driver.
 	SplunkDriverName = "splunk"
 	// ContainerIDKey is the key of the container id.
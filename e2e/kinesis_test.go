@@ -0,0 +1,142 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/containerd/containerd/cio"
+	"github.com/google/uuid"
+	ginkgo "github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+const (
+	kinesisCredentialsEndpointKey = "--kinesis-credentials-endpoint" //nolint:gosec // not credentials
+	kinesisRegionKey              = "--kinesis-region"
+	kinesisStreamKey              = "--kinesis-stream"
+	kinesisEndpointKey            = "--kinesis-endpoint"
+	testKinesisStream             = "test-shim-logger"
+	// The stream is created by localstack in the same way as the awslogs log groups.
+	testKinesisEndpoint     = testAwslogsEndpoint
+	kinesisStreamWaitPeriod = 30 * time.Second
+)
+
+var testKinesis = func() {
+	// These tests are run in serial because we only define one log driver instance.
+	ginkgo.Describe("kinesis shim logger", ginkgo.Serial, func() {
+		var kinesisClient *kinesis.Client
+		ginkgo.BeforeEach(func() {
+			cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(testAwslogsRegion))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			kinesisClient = kinesis.NewFromConfig(cfg, func(opts *kinesis.Options) {
+				opts.BaseEndpoint = aws.String(testKinesisEndpoint)
+			})
+			deleteKinesisStream(kinesisClient, testKinesisStream)
+			_, err = kinesisClient.CreateStream(context.TODO(), &kinesis.CreateStreamInput{
+				StreamName: aws.String(testKinesisStream),
+				ShardCount: aws.Int32(1),
+			})
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			err = kinesis.NewStreamExistsWaiter(kinesisClient).Wait(context.TODO(), &kinesis.DescribeStreamInput{
+				StreamName: aws.String(testKinesisStream),
+			}, kinesisStreamWaitPeriod)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+		ginkgo.AfterEach(func() {
+			deleteKinesisStream(kinesisClient, testKinesisStream)
+		})
+		ginkgo.It("should send logs to kinesis log driver", func() {
+			testLog := testLogPrefix + uuid.New().String()
+			args := map[string]string{
+				LogDriverTypeKey:              KinesisDriverName,
+				ContainerIDKey:                TestContainerID,
+				ContainerNameKey:              TestContainerName,
+				kinesisCredentialsEndpointKey: testAwslogsCredentialEndpoint,
+				kinesisRegionKey:              testAwslogsRegion,
+				kinesisStreamKey:              testKinesisStream,
+				kinesisEndpointKey:            testKinesisEndpoint,
+			}
+			creator := cio.BinaryIO(*Binary, args)
+			err := SendTestLogByContainerd(creator, testLog)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			err = validateTestLogsInKinesis(kinesisClient, testKinesisStream, []string{testLog})
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+	})
+}
+
+// validateTestLogsInKinesis reads all the records of the single shard of the stream, and checks
+// that their logs match the test logs.
+func validateTestLogsInKinesis(client *kinesis.Client, streamName string, testLogs []string) error {
+	shards, err := client.ListShards(context.TODO(), &kinesis.ListShardsInput{
+		StreamName: aws.String(streamName),
+	})
+	if err != nil {
+		return err
+	}
+	if len(shards.Shards) != 1 {
+		return fmt.Errorf("expected a single shard, got %d", len(shards.Shards))
+	}
+	iterator, err := client.GetShardIterator(context.TODO(), &kinesis.GetShardIteratorInput{
+		StreamName:        aws.String(streamName),
+		ShardId:           shards.Shards[0].ShardId,
+		ShardIteratorType: types.ShardIteratorTypeTrimHorizon,
+	})
+	if err != nil {
+		return err
+	}
+	output, err := client.GetRecords(context.TODO(), &kinesis.GetRecordsInput{
+		ShardIterator: iterator.ShardIterator,
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(output.Records) != len(testLogs) {
+		return fmt.Errorf("the number of test log lines are not matching")
+	}
+	for i, r := range output.Records {
+		var record struct {
+			ContainerID string `json:"container_id"`
+			Log         string `json:"log"`
+		}
+		if err := json.Unmarshal(r.Data, &record); err != nil {
+			return err
+		}
+		if record.Log != testLogs[i] {
+			return fmt.Errorf("test log messages are not matching at %d line", i)
+		}
+		if record.ContainerID != TestContainerID || aws.ToString(r.PartitionKey) != TestContainerID {
+			return fmt.Errorf("container ID is not matching at %d line", i)
+		}
+	}
+	return nil
+}
+
+func deleteKinesisStream(client *kinesis.Client, streamName string) {
+	_, err := client.DeleteStream(context.TODO(), &kinesis.DeleteStreamInput{
+		StreamName:              aws.String(streamName),
+		EnforceConsumerDeletion: aws.Bool(true),
+	})
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return
+	}
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	err = kinesis.NewStreamNotExistsWaiter(client).Wait(context.TODO(), &kinesis.DescribeStreamInput{
+		StreamName: aws.String(streamName),
+	}, kinesisStreamWaitPeriod)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+}
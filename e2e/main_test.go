@@ -35,6 +35,12 @@ func TestShimLoggers(t *testing.T) {
 		if *LogDriver == JSONFileDriverName || *LogDriver == "" {
 			testJSONFile()
 		}
+		if *LogDriver == KinesisDriverName || *LogDriver == "" {
+			testKinesis()
+		}
+		if *LogDriver == S3DriverName || *LogDriver == "" {
+			testS3()
+		}
 		if *LogDriver == SplunkDriverName || *LogDriver == "" {
 			testSplunk(*SplunkToken)
 		}
@@ -0,0 +1,160 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build e2e
+
+package e2e
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/containerd/containerd/cio"
+	"github.com/google/uuid"
+	ginkgo "github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+const (
+	s3CredentialsEndpointKey = "--s3-credentials-endpoint" //nolint:gosec // not credentials
+	s3RegionKey              = "--s3-region"
+	s3BucketKey              = "--s3-bucket"
+	s3EndpointKey            = "--s3-endpoint"
+	s3ForcePathStyleKey      = "--s3-force-path-style"
+	s3StagingDirKey          = "--s3-staging-dir"
+	testS3Bucket             = "test-shim-logger"
+	// The bucket is created by localstack in the same way as the awslogs log groups.
+	testS3Endpoint = testAwslogsEndpoint
+)
+
+var testS3 = func() {
+	// These tests are run in serial because we only define one log driver instance.
+	ginkgo.Describe("s3 shim logger", ginkgo.Serial, func() {
+		var (
+			s3Client   *s3.Client
+			stagingDir string
+		)
+		ginkgo.BeforeEach(func() {
+			cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(testAwslogsRegion))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			s3Client = s3.NewFromConfig(cfg, func(opts *s3.Options) {
+				opts.BaseEndpoint = aws.String(testS3Endpoint)
+				opts.UsePathStyle = true
+			})
+			deleteS3Bucket(s3Client, testS3Bucket)
+			_, err = s3Client.CreateBucket(context.TODO(), &s3.CreateBucketInput{
+				Bucket: aws.String(testS3Bucket),
+			})
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			stagingDir, err = os.MkdirTemp("", "shim-logger-s3-staging-")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+		ginkgo.AfterEach(func() {
+			deleteS3Bucket(s3Client, testS3Bucket)
+			_ = os.RemoveAll(stagingDir)
+		})
+		ginkgo.It("should archive logs to s3 log driver once the container exits", func() {
+			testLog := testLogPrefix + uuid.New().String()
+			args := map[string]string{
+				LogDriverTypeKey:         S3DriverName,
+				ContainerIDKey:           TestContainerID,
+				ContainerNameKey:         TestContainerName,
+				s3CredentialsEndpointKey: testAwslogsCredentialEndpoint,
+				s3RegionKey:              testAwslogsRegion,
+				s3BucketKey:              testS3Bucket,
+				s3EndpointKey:            testS3Endpoint,
+				s3ForcePathStyleKey:      "true",
+				s3StagingDirKey:          stagingDir,
+			}
+			creator := cio.BinaryIO(*Binary, args)
+			err := SendTestLogByContainerd(creator, testLog)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			// The object is uploaded once the shim logger exits after the container.
+			gomega.Eventually(func() error {
+				return validateTestLogsInS3(s3Client, testS3Bucket, []string{testLog})
+			}, "30s", "1s").ShouldNot(gomega.HaveOccurred())
+		})
+	})
+}
+
+// validateTestLogsInS3 checks that the bucket holds a single object of the test container, and
+// that the logs of its records match the test logs.
+func validateTestLogsInS3(client *s3.Client, bucket string, testLogs []string) error {
+	list, err := client.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(TestContainerName + "/" + TestContainerID + "/"),
+	})
+	if err != nil {
+		return err
+	}
+	if len(list.Contents) != 1 {
+		return fmt.Errorf("expected a single object, got %d", len(list.Contents))
+	}
+	object, err := client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    list.Contents[0].Key,
+	})
+	if err != nil {
+		return err
+	}
+	defer object.Body.Close() //nolint:errcheck // testing only
+	zr, err := gzip.NewReader(object.Body)
+	if err != nil {
+		return err
+	}
+
+	var logs []string
+	scanner := bufio.NewScanner(zr)
+	for scanner.Scan() {
+		var record struct {
+			Log string `json:"log"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return err
+		}
+		logs = append(logs, record.Log)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(logs) != len(testLogs) {
+		return fmt.Errorf("the number of test log lines are not matching")
+	}
+	for i := range testLogs {
+		if logs[i] != testLogs[i] {
+			return fmt.Errorf("test log messages are not matching at %d line", i)
+		}
+	}
+	return nil
+}
+
+func deleteS3Bucket(client *s3.Client, bucket string) {
+	list, err := client.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+	})
+	var notFound *types.NoSuchBucket
+	if errors.As(err, &notFound) {
+		return
+	}
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	for _, object := range list.Contents {
+		_, err := client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    object.Key,
+		})
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	}
+	_, err = client.DeleteBucket(context.TODO(), &s3.DeleteBucketInput{
+		Bucket: aws.String(bucket),
+	})
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+}
@@ -20,6 +20,11 @@ type ContainerEnvResponse struct {
 	Env map[string]string `json:"env"`
 }
 
+// HTTPHeadersResponse is the JSON response body returned by the http headers endpoint.
+type HTTPHeadersResponse struct {
+	Headers map[string]string `json:"headers"`
+}
+
 // httpClient is used by fetchFromEndpoint so that requests have a bounded deadline.
 var httpClient = &http.Client{Timeout: 5 * time.Second}
 
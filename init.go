@@ -10,9 +10,20 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/aws/shim-loggers-for-containerd/logger/awslogs"
+	"github.com/aws/shim-loggers-for-containerd/logger/firehose"
 	"github.com/aws/shim-loggers-for-containerd/logger/fluentd"
+	"github.com/aws/shim-loggers-for-containerd/logger/gelf"
+	"github.com/aws/shim-loggers-for-containerd/logger/journald"
 	"github.com/aws/shim-loggers-for-containerd/logger/jsonfile"
+	"github.com/aws/shim-loggers-for-containerd/logger/kafka"
+	"github.com/aws/shim-loggers-for-containerd/logger/localfile"
+	"github.com/aws/shim-loggers-for-containerd/logger/loki"
+	"github.com/aws/shim-loggers-for-containerd/logger/opensearch"
+	"github.com/aws/shim-loggers-for-containerd/logger/otlp"
+	"github.com/aws/shim-loggers-for-containerd/logger/s3"
 	"github.com/aws/shim-loggers-for-containerd/logger/splunk"
+	"github.com/aws/shim-loggers-for-containerd/logger/syslog"
+	"github.com/aws/shim-loggers-for-containerd/logger/webhook"
 )
 
 const (
@@ -21,8 +32,60 @@ const (
 	containerNameKey = "container-name"
 
 	// Mode and buffer size options.
-	modeKey          = "mode"
-	maxBufferSizeKey = "max-buffer-size"
+	modeKey                  = "mode"
+	driverModesKey           = "driver-modes"
+	maxBufferSizeKey         = "max-buffer-size"
+	bufferOverflowPolicyKey  = "buffer-overflow-policy"
+	bufferOverflowTimeoutKey = "buffer-overflow-timeout"
+	bufferDropMarkerKey      = "buffer-drop-marker"
+	spillDirKey              = "buffer-spill-dir"
+	spillSegmentSizeKey      = "buffer-spill-segment-size"
+	spillMaxSizeKey          = "buffer-spill-max-size"
+
+	// Write-ahead log option.
+	writeAheadLogDirKey = "write-ahead-log-dir"
+
+	// Multiline options.
+	multilinePresetKey          = "multiline-preset"
+	multilineStartPatternKey    = "multiline-start-pattern"
+	multilineContinuePatternKey = "multiline-continue-pattern"
+	multilineFlushTimeoutKey    = "multiline-flush-timeout"
+	multilineMaxLinesKey        = "multiline-max-lines"
+	multilineMaxBytesKey        = "multiline-max-bytes"
+
+	// Partial log message reassembly options.
+	partialReassemblyKey         = "partial-reassembly"
+	partialReassemblyMaxBytesKey = "partial-reassembly-max-bytes"
+
+	// Redaction option.
+	redactRulesKey = "redact-rules"
+
+	// Filter options.
+	filterRulesKey   = "filter-rules"
+	discardStreamKey = "discard-stream"
+
+	// Rate limit options.
+	rateLimitLinesKey      = "rate-limit-lines"
+	rateLimitLineBurstKey  = "rate-limit-line-burst"
+	rateLimitBytesKey      = "rate-limit-bytes"
+	rateLimitByteBurstKey  = "rate-limit-byte-burst"
+	rateLimitPolicyKey     = "rate-limit-policy"
+	rateLimitSampleRateKey = "rate-limit-sample-rate"
+
+	// JSON parse options.
+	jsonParseKey  = "json-parse"
+	jsonFieldsKey = "json-fields"
+
+	// Timestamp options.
+	timestampSourceKey    = "timestamp-source"
+	timestampRegexKey     = "timestamp-regex"
+	timestampLayoutKey    = "timestamp-layout"
+	timestampStrftimeKey  = "timestamp-strftime"
+	timestampJSONFieldKey = "timestamp-json-field"
+	timestampMaxSkewKey   = "timestamp-max-skew"
+
+	// Metrics option.
+	metricsAddressKey = "metrics-address"
 
 	// LogDriver options.
 	logDriverTypeKey = "log-driver"
@@ -66,11 +129,68 @@ func initCommonLogOpts() {
 	pflag.String(containerNameKey, "", "Name of the container")
 
 	// log driver options
-	pflag.String(logDriverTypeKey, "", "`awslogs`, `fluentd`, `json-file`, or `splunk`")
+	pflag.String(logDriverTypeKey, "",
+		"`awslogs`, `firehose`, `fluentd`, `gelf`, `http`, `journald`, `json-file`, `kafka`, `kinesis`, `local-file`, `loki`, `opensearch`, `otlp`, `s3`, `splunk`, or `syslog`, "+
+			"or a comma-separated list of them to send logs to all of them")
 
 	// mode options
 	pflag.String(modeKey, "", "Whether the writer is blocked or not blocked")
+	pflag.String(driverModesKey, "",
+		"Comma-separated `driver=mode` pairs to override the mode of each log driver when sending logs to multiple log drivers")
 	pflag.String(maxBufferSizeKey, "", "The size of intermediate buffer for non-blocking mode")
+	pflag.String(bufferOverflowPolicyKey, "",
+		"What to do when the intermediate buffer is full: `drop-newest`, `drop-oldest`, or `block-with-timeout`")
+	pflag.String(bufferOverflowTimeoutKey, "", "How long to wait for available buffer space with the block-with-timeout policy")
+	pflag.Bool(bufferDropMarkerKey, false, "If set, then a log line reporting the dropped log lines is sent to the destination")
+	pflag.String(spillDirKey, "", "Directory to spill log lines to when the intermediate buffer is full for non-blocking mode")
+	pflag.String(spillSegmentSizeKey, "", "The size of a single spill file, default to 16m")
+	pflag.String(spillMaxSizeKey, "", "The total size of all spill files, default to 1g")
+
+	// write-ahead log option
+	pflag.String(writeAheadLogDirKey, "", "Directory to save log lines to until they are delivered, so that they are replayed after a restart")
+
+	// multiline options
+	pflag.String(multilinePresetKey, "", "Built-in patterns to group the log lines of stack traces: `java`, `python`, or `go`")
+	pflag.String(multilineStartPatternKey, "", "Regular expression matching the first log line of a multiline log message")
+	pflag.String(multilineContinuePatternKey, "", "Regular expression matching the following log lines of a multiline log message")
+	pflag.String(multilineFlushTimeoutKey, "", "How long to wait for the next log line of a multiline log message, default to 1s")
+	pflag.String(multilineMaxLinesKey, "", "The max number of log lines of a multiline log message, default to 500")
+	pflag.String(multilineMaxBytesKey, "", "The max size of a multiline log message, default to 64k")
+
+	// partial log message reassembly options
+	pflag.Bool(partialReassemblyKey, false, "If set, then log lines longer than the buffer are reassembled rather than split")
+	pflag.String(partialReassemblyMaxBytesKey, "", "The max size of a reassembled log line, default to 1m")
+
+	// redaction option
+	pflag.String(redactRulesKey, "", "Rules to redact secrets and PII from log lines, either inline JSON or the path of a JSON file")
+
+	// filter options
+	pflag.String(filterRulesKey, "", "Rules to filter out log lines, either inline JSON or the path of a JSON file")
+	pflag.String(discardStreamKey, "",
+		"Container pipe to discard entirely, either stdout or stderr, or comma-separated driver=source pairs")
+
+	// rate limit options
+	pflag.String(rateLimitLinesKey, "", "The max number of log lines sent per second")
+	pflag.String(rateLimitLineBurstKey, "", "The max number of log lines sent at once, default to the rate of log lines")
+	pflag.String(rateLimitBytesKey, "", "The max size of log lines sent per second")
+	pflag.String(rateLimitByteBurstKey, "", "The max size of log lines sent at once, default to the rate of bytes")
+	pflag.String(rateLimitPolicyKey, "", "What happens to log lines over the rate limit, either drop, sample or dedupe, default to drop")
+	pflag.String(rateLimitSampleRateKey, "", "N when one in N log lines over the rate limit are sent with the sample policy, default to 10")
+
+	// JSON parse options
+	pflag.Bool(jsonParseKey, false, "If set, then fields of JSON log lines are promoted to message attributes")
+	pflag.String(jsonFieldsKey, "", "Comma-separated fields of JSON log lines to promote, default to level,timestamp,trace_id")
+
+	// timestamp options
+	pflag.String(timestampSourceKey, "", "Where timestamps of log lines come from: read-time, regex, strftime or json, default to read-time")
+	pflag.String(timestampRegexKey, "", "Regular expression matching the timestamp at the start of log lines with the regex source")
+	pflag.String(timestampLayoutKey, "", "Go time layout of timestamps with the regex and json sources, default to RFC 3339")
+	pflag.String(timestampStrftimeKey, "", "strftime format of the timestamp at the start of log lines with the strftime source")
+	pflag.String(timestampJSONFieldKey, "", "Field of JSON log lines holding the timestamp with the json source, default to timestamp")
+	pflag.String(timestampMaxSkewKey, "", "Max difference between a timestamp and the time it's read, default to 2h")
+
+	// metrics option
+	pflag.String(metricsAddressKey, "", "TCP address or `unix://` socket path to serve Prometheus metrics at")
 
 	// verbose mode option
 	pflag.Bool(verboseKey, false, "If set, then more logs will be printed for debugging")
@@ -124,6 +244,23 @@ func initFluentdOpts() {
 	pflag.Duration(fluentd.WriteTimeoutKey, 5*time.Second, "Write timeout value for Fluentd writes")
 }
 
+// initGELFOpts initialize gelf driver specified options.
+// Argument usage taken from https://docs.docker.com/engine/logging/drivers/gelf/.
+func initGELFOpts() {
+	pflag.String(gelf.AddressKey, "", "Address of the GELF endpoint, e.g. \"udp://graylog:12201\" or \"tcp://graylog:12201\".")
+	pflag.String(gelf.CompressionTypeKey, "", "Compression of the log messages over UDP. Can be gzip, zlib or none. "+
+		"Defaults to gzip.")
+	pflag.String(gelf.CompressionLevelKey, "", "Compression level between -1 and 9 over UDP. Defaults to 1 (best speed).")
+	pflag.String(gelf.TCPMaxReconnectKey, "", "Maximum number of reconnection attempts over TCP. Defaults to 3.")
+	pflag.String(gelf.TCPReconnectDelayKey, "", "Number of seconds to wait between reconnection attempts over TCP. "+
+		"Defaults to 1.")
+	pflag.String(gelf.GELFLabelsKey, "", "Comma-separated list of label keys to include as extra fields.")
+	pflag.String(gelf.GELFLabelsRegexKey, "", "Regex matching label keys to include as extra fields.")
+	pflag.String(gelf.GELFEnvKey, "", "Comma-separated list of env var keys to include as extra fields.")
+	pflag.String(gelf.GELFEnvRegexKey, "", "Regex matching env var keys to include as extra fields.")
+	pflag.String(gelf.GELFTagKey, "", "Tag template of the log messages (e.g., \"{{.ImageName}}/{{.ID}}\").")
+}
+
 // initSplunkOpts initialize splunk driver specified options.
 // Argument usage taken from https://docs.docker.com/config/containers/logging/splunk/.
 func initSplunkOpts() {
@@ -171,3 +308,160 @@ func initJSONFileOpts() {
 	pflag.String(jsonfile.JSONFileEnvRegexKey, "", "Regex matching env var keys to include in the log envelope.")
 	pflag.String(jsonfile.JSONFileTagKey, "", "Tag template for the log envelope (e.g., \"{{.ImageName}}/{{.ID}}\").")
 }
+
+// initFirehoseOpts initialize firehose and kinesis drivers specified options.
+func initFirehoseOpts() {
+	pflag.String(firehose.DeliveryStreamKey, "", "Name of the Firehose delivery stream.")
+	pflag.String(firehose.RegionKey, "", "AWS region of the Firehose delivery stream.")
+	pflag.String(firehose.EndpointKey, "", "Endpoint URL of Firehose, e.g. to send logs to a local stand-in.")
+	pflag.String(firehose.CredentialsEndpointKey, "", "Path of the credentials endpoint on the ECS agent, "+
+		"in the same way as awslogs-credentials-endpoint.")
+	pflag.String(firehose.KinesisStreamKey, "", "Name of the Kinesis data stream.")
+	pflag.String(firehose.KinesisRegionKey, "", "AWS region of the Kinesis data stream.")
+	pflag.String(firehose.KinesisEndpointKey, "", "Endpoint URL of Kinesis, e.g. to send logs to a local stand-in.")
+	pflag.String(firehose.KinesisCredentialsEndpointKey, "", "Path of the credentials endpoint on the ECS agent, "+
+		"in the same way as awslogs-credentials-endpoint.")
+	pflag.String(firehose.KinesisPartitionKeyKey, "", "Partition key of the records. Defaults to the container ID.")
+}
+
+// initS3Opts initialize s3 driver specified options.
+func initS3Opts() {
+	pflag.String(s3.BucketKey, "", "Name of the S3 bucket to archive logs to.")
+	pflag.String(s3.RegionKey, "", "AWS region of the S3 bucket.")
+	pflag.String(s3.EndpointKey, "", "Endpoint URL of S3, e.g. to send logs to a local stand-in.")
+	pflag.String(s3.CredentialsEndpointKey, "", "Path of the credentials endpoint on the ECS agent, "+
+		"in the same way as awslogs-credentials-endpoint.")
+	pflag.String(s3.ForcePathStyleKey, "", "Address the bucket in the path of the URLs instead of the host name. "+
+		"Defaults to false.")
+	pflag.String(s3.KeyTemplateKey, "", "Template of the object keys. Defaults to \""+s3.DefaultKeyTemplate+"\".")
+	pflag.String(s3.CompressionKey, "", "Either \"gzip\", \"zstd\" or \"none\". Defaults to \"gzip\".")
+	pflag.String(s3.MaxSizeKey, "", "Size of the log lines of an object before compression, after which it's rotated. "+
+		"Defaults to 64m.")
+	pflag.String(s3.MaxAgeKey, "", "Age after which an object is rotated. Defaults to 5m.")
+	pflag.String(s3.StagingDirKey, "", "Directory to stage objects in until they are uploaded. "+
+		"Defaults to a directory in the temporary directory.")
+}
+
+// initSyslogOpts initialize syslog driver specified options.
+// Argument usage taken from https://docs.docker.com/engine/logging/drivers/syslog/.
+func initSyslogOpts() {
+	pflag.String(syslog.AddressKey, "", "Address of the syslog server, e.g. \"tcp+tls://192.168.0.42:123\" or "+
+		"\"unix:///dev/log\". Defaults to the local syslog server.")
+	pflag.String(syslog.FacilityKey, "", "Syslog facility, either a name such as \"local0\" or a number between 0 and 23. "+
+		"Defaults to \"daemon\".")
+	pflag.String(syslog.FormatKey, "", "Format of the log messages. Can be rfc3164, rfc5424 or rfc5424micro. "+
+		"Defaults to the format of the local syslog server.")
+	pflag.String(syslog.FramingKey, "", "Framing of the log messages over tcp or tcp+tls. Can be non-transparent or "+
+		"octet-counted. Defaults to octet-counted for rfc5424 over tcp+tls, and non-transparent otherwise.")
+	pflag.String(syslog.TLSCACertKey, "", "Path to the CA certificate to verify the syslog server with.")
+	pflag.String(syslog.TLSCertKey, "", "Path to the TLS client certificate.")
+	pflag.String(syslog.TLSKeyKey, "", "Path to the TLS client key.")
+	pflag.String(syslog.TLSSkipVerifyKey, "", "Ignore server certificate validation. Defaults to false.")
+	pflag.String(syslog.SyslogTagKey, "", "Tag template of the log messages (e.g., \"{{.ImageName}}/{{.ID}}\").")
+}
+
+// initJournaldOpts initialize journald driver specified options.
+// Argument usage taken from https://docs.docker.com/engine/logging/drivers/journald/.
+func initJournaldOpts() {
+	pflag.String(journald.JournaldLabelsKey, "", "Comma-separated list of label keys to include as journal fields.")
+	pflag.String(journald.JournaldLabelsRegexKey, "", "Regex matching label keys to include as journal fields.")
+	pflag.String(journald.JournaldEnvKey, "", "Comma-separated list of env var keys to include as journal fields.")
+	pflag.String(journald.JournaldEnvRegexKey, "", "Regex matching env var keys to include as journal fields.")
+	pflag.String(journald.JournaldTagKey, "", "Tag template of the CONTAINER_TAG and SYSLOG_IDENTIFIER journal fields "+
+		"(e.g., \"{{.ImageName}}/{{.ID}}\").")
+}
+
+// initHTTPOpts initialize http driver specified options.
+func initHTTPOpts() {
+	pflag.String(webhook.URLKey, "", "URL the batches of log messages are POSTed to.")
+	pflag.String(webhook.FormatKey, "", "Either \"ndjson\", \"json\" or \"template\". Defaults to \"ndjson\".")
+	pflag.String(webhook.TemplateKey, "", "Template of the body of the requests, e.g. "+
+		"\"{{range .Records}}{{.Line}}\n{{end}}\".")
+	pflag.String(webhook.HeadersKey, "", "JSON object of the headers of the requests.")
+	pflag.String(webhook.HeadersFileKey, "", "Path of a file holding a JSON object of headers of the requests.")
+	pflag.String(webhook.HeadersEndpointKey, "", "Endpoint returning a JSON object of headers of the requests "+
+		"in its \"headers\" field.")
+	pflag.String(webhook.GzipKey, "", "Whether to compress the body of the requests with gzip.")
+	pflag.String(webhook.BatchSizeKey, "", "Max number of log messages in a batch. Defaults to 500.")
+	pflag.String(webhook.BatchBytesKey, "", "Size of the log lines after which a batch is sent. Defaults to \"1m\".")
+	pflag.String(webhook.BatchWaitKey, "", "How long the first log message of a batch waits before the batch is sent. "+
+		"Defaults to \"1s\".")
+	pflag.String(webhook.MaxRetriesKey, "", "Max number of times a failed batch is sent again. Defaults to 5.")
+	pflag.String(webhook.RetryBackoffKey, "", "How long to wait before sending a failed batch again, "+
+		"doubled after every retry. Defaults to \"1s\".")
+}
+
+// initKafkaOpts initialize kafka driver specified options.
+func initKafkaOpts() {
+	pflag.String(kafka.BrokersKey, "", "Comma-separated list of seed brokers, e.g. \"broker-1:9092,broker-2:9092\".")
+	pflag.String(kafka.TopicKey, "", "Template of the topic, e.g. \"logs-{{index .Labels \\\"team\\\"}}\".")
+	pflag.String(kafka.KeyKey, "", "Template of the message keys. Defaults to \""+kafka.DefaultKey+"\".")
+	pflag.String(kafka.AcksKey, "", "Either \"all\", \"leader\" or \"none\". Defaults to \"all\".")
+	pflag.String(kafka.CompressionKey, "", "Either \"none\", \"gzip\", \"snappy\", \"lz4\" or \"zstd\". "+
+		"Defaults to \"none\".")
+	pflag.String(kafka.TLSKey, "", "Whether to connect to the brokers with TLS.")
+	pflag.String(kafka.TLSCAFileKey, "", "Path of the PEM file of the CA certificates of the brokers.")
+	pflag.String(kafka.TLSCertFileKey, "", "Path of the PEM file of the client certificate.")
+	pflag.String(kafka.TLSKeyFileKey, "", "Path of the PEM file of the key of the client certificate.")
+	pflag.String(kafka.TLSInsecureSkipVerifyKey, "", "Whether to skip the verification of the certificates of the brokers.")
+	pflag.String(kafka.SASLMechanismKey, "", "Either \"PLAIN\", \"SCRAM-SHA-256\" or \"SCRAM-SHA-512\".")
+	pflag.String(kafka.SASLUsernameKey, "", "Username of the SASL authentication.")
+	pflag.String(kafka.SASLPasswordKey, "", "Password of the SASL authentication.")
+	pflag.String(kafka.SASLPasswordFileKey, "", "Path of a file holding the password of the SASL authentication.")
+	pflag.String(kafka.KafkaLabelsKey, "", "Comma-separated list of label keys to include in the attrs of the messages.")
+	pflag.String(kafka.KafkaLabelsRegexKey, "", "Regex matching label keys to include in the attrs of the messages.")
+	pflag.String(kafka.KafkaEnvKey, "", "Comma-separated list of env var keys to include in the attrs of the messages.")
+	pflag.String(kafka.KafkaEnvRegexKey, "", "Regex matching env var keys to include in the attrs of the messages.")
+}
+
+// initLocalFileOpts initialize local-file driver specified options.
+func initLocalFileOpts() {
+	pflag.String(localfile.PathKey, "", "Path of the log file. Its directory is created if it doesn't exist.")
+	pflag.String(localfile.FormatKey, "", "Either \"text\" or \"jsonl\". Defaults to \"text\".")
+	pflag.String(localfile.MaxSizeKey, "", "Size after which the log file is rotated, e.g. \"10m\".")
+	pflag.String(localfile.RotateKey, "", "Either \"hourly\" or \"daily\", to rotate the log file every hour or day.")
+	pflag.String(localfile.MaxFilesKey, "", "Max number of rotated files which are kept.")
+	pflag.String(localfile.MaxTotalSizeKey, "", "Max total size of the rotated files which are kept, e.g. \"1g\".")
+	pflag.String(localfile.CompressionKey, "", "Either \"none\", \"gzip\" or \"zstd\". Defaults to \"none\".")
+	pflag.String(localfile.FsyncKey, "", "Either \"never\", \"always\" or an interval, e.g. \"1s\". "+
+		"Defaults to \"never\".")
+}
+
+// initLokiOpts initialize loki driver specified options.
+func initLokiOpts() {
+	pflag.String(loki.URLKey, "", "URL of Loki, e.g. \"http://localhost:3100\". Defaults the path to the push API.")
+	pflag.String(loki.TenantIDKey, "", "Tenant sent in the X-Scope-OrgID header.")
+	pflag.String(loki.FormatKey, "", "Either \"protobuf\" or \"json\". Defaults to \"protobuf\".")
+	pflag.String(loki.LabelsKey, "", "Comma-separated list of label keys to include in the labels of the streams.")
+	pflag.String(loki.BatchSizeKey, "", "Size of the log lines after which a batch is pushed. Defaults to \"1m\".")
+	pflag.String(loki.BatchWaitKey, "", "How long the first log line of a batch waits before the batch is pushed. "+
+		"Defaults to \"1s\".")
+}
+
+// initOpenSearchOpts initialize opensearch driver specified options.
+func initOpenSearchOpts() {
+	pflag.String(opensearch.EndpointKey, "", "URL of the OpenSearch or Elasticsearch cluster, e.g. \"https://localhost:9200\".")
+	pflag.String(opensearch.IndexKey, "", "Template of the index names, e.g. \"{{.ContainerName}}-{{.Date}}\". "+
+		"Defaults to \""+opensearch.DefaultIndex+"\".")
+	pflag.String(opensearch.IndexDateFormatKey, "", "Go time layout of the date in the index names. "+
+		"Defaults to \""+opensearch.DefaultIndexDateFormat+"\".")
+	pflag.String(opensearch.UsernameKey, "", "Username of the basic authentication.")
+	pflag.String(opensearch.PasswordKey, "", "Password of the basic authentication.")
+	pflag.String(opensearch.PasswordFileKey, "", "Path of a file holding the password of the basic authentication.")
+	pflag.String(opensearch.AWSSigV4Key, "", "Whether to sign the requests with AWS SigV4 for Amazon OpenSearch Service.")
+	pflag.String(opensearch.RegionKey, "", "AWS region of the domain or collection, required with SigV4.")
+	pflag.String(opensearch.AWSServiceKey, "", "Either \"es\" for domains or \"aoss\" for serverless collections. "+
+		"Defaults to \"es\".")
+	pflag.String(opensearch.CredentialsEndpointKey, "", "Path of the credentials endpoint on the ECS agent used with SigV4, "+
+		"in the same way as awslogs-credentials-endpoint.")
+	pflag.String(opensearch.CompressionKey, "", "Either \"gzip\" or \"none\". Defaults to \"none\".")
+}
+
+// initOTLPOpts initialize otlp driver specified options.
+func initOTLPOpts() {
+	pflag.String(otlp.EndpointKey, "", "URL of the OTLP endpoint, e.g. \"http://localhost:4318\". Use https for TLS.")
+	pflag.String(otlp.ProtocolKey, "", "Either \"http/protobuf\" or \"grpc\". Defaults to \"http/protobuf\".")
+	pflag.String(otlp.HeadersKey, "", "Comma-separated list of key=value headers sent with every export request.")
+	pflag.String(otlp.CompressionKey, "", "Either \"gzip\" or \"none\". Defaults to \"none\".")
+	pflag.String(otlp.ResourceAttributesKey, "", "Comma-separated list of key=value resource attributes of every log record.")
+}
@@ -49,9 +49,10 @@ const (
 	// There are 26 bytes additional bytes for each log event:
 	// See more details in: http://docs.aws.amazon.com/AmazonCloudWatchLogs/latest/APIReference/API_PutLogEvents.html
 	perEventBytes = 26
-	// The value of maximumBytesPerEvent is adopted from Docker. Reference:
+	// MaximumBytesPerEvent is the max size of a log line sent as a CloudWatch event. The value is
+	// adopted from Docker. Reference:
 	// https://github.com/moby/moby/blob/19.03/daemon/logger/awslogs/cloudwatchlogs.go#L58
-	maximumBytesPerEvent = 262144 - perEventBytes
+	MaximumBytesPerEvent = 262144 - perEventBytes
 
 	// The max size of CloudWatch events is 256kb.
 	defaultAwsBufSizeInBytes = 256 * 1024
@@ -92,40 +93,21 @@ func InitLogger(globalArgs *logger.GlobalArgs, awslogsArgs *Args) *LoggerArgs {
 func (la *LoggerArgs) RunLogDriver(ctx context.Context, config *logging.Config, ready func() error) error {
 	defer debug.DeferFuncForRunLogDriver()
 
-	loggerConfig, err := getAWSLogsConfig(la.args)
+	info, stream, err := la.newStream()
 	if err != nil {
-		debug.ErrLogger = fmt.Errorf("unable to validate log options: %w", err)
-		return debug.ErrLogger
-	}
-	info := logger.NewInfo(
-		la.globalArgs.ContainerID,
-		la.globalArgs.ContainerName,
-		logger.WithConfig(loggerConfig),
-	)
-	stream, err := dockerawslogs.New(*info)
-	if err != nil {
-		debug.ErrLogger = fmt.Errorf("unable to create stream: %w", err)
+		debug.ErrLogger = err
 		return debug.ErrLogger
 	}
 
-	l, err := logger.NewLogger(
-		logger.WithStdout(config.Stdout),
-		logger.WithStderr(config.Stderr),
-		logger.WithInfo(info),
-		logger.WithStream(stream),
-		logger.WithBufferSizeInBytes(maximumBytesPerEvent),
-	)
+	l, err := logger.NewPipelineLogger(la.globalArgs, config, info, stream,
+		logger.WithMaxBytesPerEvent(MaximumBytesPerEvent),
+		logger.WithBufferSizeInBytes(MaximumBytesPerEvent),
+		logger.WithBufferedReadSizeInBytes(defaultAwsBufSizeInBytes))
 	if err != nil {
 		debug.ErrLogger = fmt.Errorf("unable to create awslogs driver: %w", err)
 		return debug.ErrLogger
 	}
 
-	if la.globalArgs.Mode == logger.NonBlockingMode {
-		debug.SendEventsToLog(logger.DaemonName, "Starting log streaming for non-blocking mode awslogs driver",
-			debug.INFO, 0)
-		l = logger.NewBufferedLogger(l, defaultAwsBufSizeInBytes, la.globalArgs.MaxBufferSize, la.globalArgs.ContainerID)
-	}
-
 	// Start awslogs driver
 	debug.SendEventsToLog(logger.DaemonName, "Starting log streaming for awslogs driver", debug.INFO, 0)
 	err = l.Start(ctx, la.globalArgs.CleanupTime, ready)
@@ -143,6 +125,31 @@ func (la *LoggerArgs) RunLogDriver(ctx context.Context, config *logging.Config,
 	return nil
 }
 
+// NewStream creates the awslogs stream, which is used when fanning out to multiple log drivers.
+func (la *LoggerArgs) NewStream() (logger.Client, error) {
+	_, stream, err := la.newStream()
+	return stream, err
+}
+
+// newStream validates the log options and creates the awslogs stream along with its info.
+func (la *LoggerArgs) newStream() (*dockerlogger.Info, dockerlogger.Logger, error) {
+	loggerConfig, err := getAWSLogsConfig(la.args)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to validate log options: %w", err)
+	}
+	info := logger.NewInfo(
+		la.globalArgs.ContainerID,
+		la.globalArgs.ContainerName,
+		logger.WithConfig(loggerConfig),
+	)
+	stream, err := dockerawslogs.New(*info)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create stream: %w", err)
+	}
+
+	return info, stream, nil
+}
+
 // getAWSLogsConfig sets values for awslogs config.
 func getAWSLogsConfig(args *Args) (map[string]string, error) {
 	config := make(map[string]string)
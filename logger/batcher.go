@@ -0,0 +1,262 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package logger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/shim-loggers-for-containerd/debug"
+)
+
+// defaultBatcherCloseTimeout is how long Close waits for the queued items to be sent if the
+// batcher config doesn't set it.
+const defaultBatcherCloseTimeout = 1 * time.Minute
+
+// ErrBatcherClosed is returned when adding an item after the batcher is closed.
+var ErrBatcherClosed = errors.New("batcher is closed")
+
+// RetryableError is an error after which a batch can be sent again.
+type RetryableError struct {
+	Err error
+}
+
+func (e *RetryableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
+
+// BatcherConfig sets how a batcher batches items and sends them.
+type BatcherConfig[T any] struct {
+	// DriverName and Items are the name of the log driver and what its items are called, such as
+	// "documents", in the debug events of the items which are dropped.
+	DriverName string
+	Items      string
+	// QueueSize is the max number of items queued until they're batched. Add blocks once it's
+	// reached.
+	QueueSize int
+	// MaxItems is the max number of items of a batch, if it's set.
+	MaxItems int
+	// MaxBytes is the max size of the items of a batch, if it's set. A batch is sent before an
+	// item makes it exceed the max size, unless it's the first item of the batch.
+	MaxBytes int64
+	// FlushBytes is the size of the items after which a batch is sent, if it's set.
+	FlushBytes int64
+	// Size returns the size of an item. It's required with either MaxBytes or FlushBytes.
+	Size func(item T) int
+	// Wait is how long the first item of a batch waits before the batch is sent.
+	Wait time.Duration
+	// Send sends a batch within Timeout, and returns the items which failed to be sent but can be
+	// sent again, along with the error. The whole batch is sent again if the error is a
+	// RetryableError and no item is returned, and it's dropped for any other error.
+	Send    func(ctx context.Context, batch []T) ([]T, error)
+	Timeout time.Duration
+	// MaxAttempts is the max number of attempts to send a batch. The first backoff is
+	// InitialBackoff, which is doubled after every attempt, up to MaxBackoff if it's set.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// CloseTimeout bounds how long Close waits for the queued items to be sent. The items which
+	// are not sent by then are dropped.
+	CloseTimeout time.Duration
+}
+
+// Batcher queues items, batches them, and sends the batches one at a time in the background.
+//
+// The queue is read while a batch is sent or waits to be sent again, so that the next batch is
+// ready once it's done. Add blocks while the queue is full, which happens when the destination
+// doesn't keep up, so that the container is slowed down in the blocking mode, and the buffer of
+// the non-blocking mode applies its overflow policy.
+type Batcher[T any] struct {
+	cfg *BatcherConfig[T]
+
+	// lock protects queue, so that no item is added after it's closed. closing is closed first,
+	// so that Add doesn't hold lock while the queue is full and Close is waiting for it.
+	lock      sync.RWMutex
+	queue     chan T
+	closing   chan struct{}
+	closeOnce sync.Once
+	// batches is the batches which are ready to be sent.
+	batches chan []T
+	// ctx is canceled once Close times out, so that the batch which is sent gives up, and the
+	// other ones are dropped.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// done is closed once all the batches are either sent or dropped.
+	done chan struct{}
+}
+
+// NewBatcher creates a batcher and starts sending the items added to it.
+func NewBatcher[T any](cfg *BatcherConfig[T]) *Batcher[T] {
+	if cfg.CloseTimeout == 0 {
+		cfg.CloseTimeout = defaultBatcherCloseTimeout
+	}
+	b := &Batcher[T]{
+		cfg:     cfg,
+		queue:   make(chan T, cfg.QueueSize),
+		closing: make(chan struct{}),
+		batches: make(chan []T),
+		done:    make(chan struct{}),
+	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	go b.batch()
+	go b.send()
+
+	return b
+}
+
+// Add queues an item to be sent. It blocks if the queue is full.
+func (b *Batcher[T]) Add(item T) error {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	select {
+	case <-b.closing:
+		return ErrBatcherClosed
+	default:
+	}
+	select {
+	case b.queue <- item:
+		return nil
+	case <-b.closing:
+		return ErrBatcherClosed
+	}
+}
+
+// Close sends the items which are not sent yet, within the close timeout.
+func (b *Batcher[T]) Close() {
+	b.closeOnce.Do(func() {
+		close(b.closing)
+		b.lock.Lock()
+		close(b.queue)
+		b.lock.Unlock()
+
+		timer := time.NewTimer(b.cfg.CloseTimeout)
+		defer timer.Stop()
+		select {
+		case <-b.done:
+		case <-timer.C:
+			b.cancel()
+			<-b.done
+		}
+		b.cancel()
+	})
+}
+
+// batch batches the queued items, and hands a batch over to be sent once it's full, or once its
+// first item has waited for the batch wait.
+func (b *Batcher[T]) batch() {
+	defer close(b.batches)
+	timer := time.NewTimer(b.cfg.Wait)
+	timer.Stop()
+
+	var (
+		batch      []T
+		batchBytes int64
+		// timeout is only set while the batch isn't empty.
+		timeout <-chan time.Time
+	)
+	flush := func() {
+		if len(batch) > 0 {
+			b.batches <- batch
+		}
+		batch, batchBytes = nil, 0
+		timer.Stop()
+		timeout = nil
+	}
+	for {
+		select {
+		case item, ok := <-b.queue:
+			if !ok {
+				flush()
+				return
+			}
+			var size int64
+			if b.cfg.Size != nil {
+				size = int64(b.cfg.Size(item))
+			}
+			if b.cfg.MaxBytes > 0 && batchBytes+size > b.cfg.MaxBytes {
+				flush()
+			}
+			if len(batch) == 0 {
+				timer.Reset(b.cfg.Wait)
+				timeout = timer.C
+			}
+			batch = append(batch, item)
+			batchBytes += size
+			if (b.cfg.MaxItems > 0 && len(batch) >= b.cfg.MaxItems) ||
+				(b.cfg.FlushBytes > 0 && batchBytes >= b.cfg.FlushBytes) {
+				flush()
+			}
+		case <-timeout:
+			flush()
+		}
+	}
+}
+
+// send sends the batches in order.
+func (b *Batcher[T]) send() {
+	defer close(b.done)
+	for batch := range b.batches {
+		b.sendBatch(batch)
+	}
+}
+
+// sendBatch sends a batch, and sends it again with an exponential backoff if it fails with a
+// retryable error, or only the items which failed if some of them did. The items are dropped if
+// they still can't be sent, or once Close times out.
+func (b *Batcher[T]) sendBatch(batch []T) {
+	backoff := b.cfg.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(b.ctx, b.cfg.Timeout)
+		retry, err := b.cfg.Send(ctx, batch)
+		cancel()
+		if err == nil {
+			return
+		}
+		var retryable *RetryableError
+		if len(retry) > 0 {
+			batch = retry
+		} else if !errors.As(err, &retryable) {
+			b.Drop(len(batch), err)
+			return
+		}
+		if attempt >= b.cfg.MaxAttempts || !b.wait(backoff) {
+			b.Drop(len(batch), err)
+			return
+		}
+		backoff *= 2
+		if b.cfg.MaxBackoff > 0 {
+			backoff = min(backoff, b.cfg.MaxBackoff)
+		}
+	}
+}
+
+// wait waits for the backoff, and returns false if Close times out before.
+func (b *Batcher[T]) wait(backoff time.Duration) bool {
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-b.ctx.Done():
+		return false
+	}
+}
+
+// Drop reports that items are dropped, such as the items of a batch which Send can't send and
+// doesn't return.
+func (b *Batcher[T]) Drop(n int, err error) {
+	debug.SendEvent(DaemonName,
+		fmt.Sprintf("Failed to send %d %s: %s", n, b.cfg.Items, err),
+		debug.ERROR,
+		debug.Driver(b.cfg.DriverName),
+		debug.Lines(uint64(n)), //nolint:gosec // n is not negative
+		debug.Err(err))
+}
@@ -0,0 +1,223 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package logger
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// batchRecorder records the batches sent by a batcher, and fails them with the given errors in
+// order.
+type batchRecorder struct {
+	mu       sync.Mutex
+	batches  [][]string
+	failures []error
+	// retry is the index of the items of a batch returned along with a failure, if any.
+	retry []int
+}
+
+func (r *batchRecorder) send(ctx context.Context, batch []string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, append([]string{}, batch...))
+	if err := ctx.Err(); err != nil {
+		return nil, &RetryableError{Err: err}
+	}
+	if len(r.failures) == 0 {
+		return nil, nil
+	}
+	err := r.failures[0]
+	r.failures = r.failures[1:]
+	var retry []string
+	for _, i := range r.retry {
+		retry = append(retry, batch[i])
+	}
+	return retry, err
+}
+
+func (r *batchRecorder) get() [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.batches
+}
+
+func newTestBatcherConfig(r *batchRecorder) *BatcherConfig[string] {
+	return &BatcherConfig[string]{
+		DriverName:     "test",
+		Items:          "lines",
+		QueueSize:      16,
+		MaxItems:       3,
+		Size:           func(item string) int { return len(item) },
+		Wait:           time.Hour,
+		Send:           r.send,
+		Timeout:        time.Second,
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	}
+}
+
+// TestBatcherBatches tests that items are sent once a batch has the max number of items, once
+// it would exceed the max size, once it reaches the flush size, once the first item has waited
+// for the batch wait, or once the batcher is closed.
+func TestBatcherBatches(t *testing.T) {
+	r := &batchRecorder{}
+	cfg := newTestBatcherConfig(r)
+	cfg.MaxBytes = 8
+	b := NewBatcher(cfg)
+	for _, item := range []string{"a", "b", "c", "dddd", "eeee", "f"} {
+		require.NoError(t, b.Add(item))
+	}
+	b.Close()
+	require.Equal(t, [][]string{{"a", "b", "c"}, {"dddd", "eeee"}, {"f"}}, r.get())
+	require.ErrorIs(t, b.Add("g"), ErrBatcherClosed)
+
+	r = &batchRecorder{}
+	cfg = newTestBatcherConfig(r)
+	cfg.FlushBytes = 4
+	b = NewBatcher(cfg)
+	for _, item := range []string{"aa", "bbb", "c"} {
+		require.NoError(t, b.Add(item))
+	}
+	require.Eventually(t, func() bool { return len(r.get()) == 1 }, time.Second, time.Millisecond)
+	require.Equal(t, [][]string{{"aa", "bbb"}}, r.get())
+	b.Close()
+	require.Equal(t, [][]string{{"aa", "bbb"}, {"c"}}, r.get())
+
+	r = &batchRecorder{}
+	cfg = newTestBatcherConfig(r)
+	cfg.Wait = 10 * time.Millisecond
+	b = NewBatcher(cfg)
+	require.NoError(t, b.Add("a"))
+	require.Eventually(t, func() bool { return len(r.get()) == 1 }, time.Second, time.Millisecond)
+	b.Close()
+	require.Equal(t, [][]string{{"a"}}, r.get())
+}
+
+// TestBatcherRetries tests that a batch is sent again after retryable errors, that only the
+// items which failed are sent again if some of them did, and that the items are dropped after
+// the max number of attempts or after other errors.
+func TestBatcherRetries(t *testing.T) {
+	retryable := &RetryableError{Err: errors.New("unavailable")}
+	testCases := []struct {
+		name     string
+		failures []error
+		retry    []int
+		expected [][]string
+	}{
+		{
+			name:     "retryable",
+			failures: []error{retryable},
+			expected: [][]string{{"a", "b"}, {"a", "b"}},
+		},
+		{
+			name:     "max attempts",
+			failures: []error{retryable, retryable, retryable, retryable},
+			expected: [][]string{{"a", "b"}, {"a", "b"}, {"a", "b"}},
+		},
+		{
+			name:     "failed items",
+			failures: []error{errors.New("rejected")},
+			retry:    []int{1},
+			expected: [][]string{{"a", "b"}, {"b"}},
+		},
+		{
+			name:     "non-retryable",
+			failures: []error{errors.New("bad request")},
+			expected: [][]string{{"a", "b"}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &batchRecorder{failures: tc.failures, retry: tc.retry}
+			b := NewBatcher(newTestBatcherConfig(r))
+			require.NoError(t, b.Add("a"))
+			require.NoError(t, b.Add("b"))
+			b.Close()
+			require.Equal(t, tc.expected, r.get())
+		})
+	}
+}
+
+// TestBatcherBackoff tests that the queue is still read while a batch waits to be sent again,
+// and that Close doesn't wait for the backoff longer than the close timeout.
+func TestBatcherBackoff(t *testing.T) {
+	r := &batchRecorder{failures: []error{&RetryableError{Err: errors.New("unavailable")}}}
+	cfg := newTestBatcherConfig(r)
+	cfg.QueueSize = 1
+	cfg.MaxItems = 2
+	cfg.InitialBackoff = time.Hour
+	cfg.CloseTimeout = 10 * time.Millisecond
+	b := NewBatcher(cfg)
+
+	// The first batch waits to be sent again, the second one waits for it, and the last item is
+	// queued.
+	added := make(chan struct{})
+	go func() {
+		defer close(added)
+		for _, item := range []string{"a", "b", "c", "d", "e"} {
+			require.NoError(t, b.Add(item))
+		}
+	}()
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		require.FailNow(t, "the queue isn't read while a batch waits to be sent again")
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		b.Close()
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		require.FailNow(t, "Close waits for the backoff")
+	}
+	// The batches left fail and are dropped once the close timeout is reached.
+	require.Equal(t, [][]string{{"a", "b"}, {"c", "d"}, {"e"}}, r.get())
+}
+
+// TestBatcherCloseWhileFull tests that Add doesn't block anymore once the batcher is closed.
+func TestBatcherCloseWhileFull(t *testing.T) {
+	release := make(chan struct{})
+	cfg := newTestBatcherConfig(&batchRecorder{})
+	cfg.QueueSize = 1
+	cfg.MaxItems = 1
+	cfg.Send = func(ctx context.Context, _ []string) ([]string, error) {
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil, nil
+	}
+	b := NewBatcher(cfg)
+
+	// The first item is sent, the second one waits for it, and the third one is queued.
+	for _, item := range []string{"a", "b", "c"} {
+		require.NoError(t, b.Add(item))
+	}
+	added := make(chan error)
+	go func() {
+		added <- b.Add("d")
+	}()
+
+	go b.Close()
+	select {
+	case err := <-added:
+		require.ErrorIs(t, err, ErrBatcherClosed)
+	case <-time.After(time.Second):
+		require.FailNow(t, "Add blocks after the batcher is closed")
+	}
+	close(release)
+}
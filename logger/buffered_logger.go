@@ -5,6 +5,7 @@ package logger
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"sync"
@@ -23,6 +24,22 @@ const (
 	// This value is adopted from Docker:
 	// https://github.com/moby/moby/blob/master/daemon/logger/ring.go#L140
 	ringCap = 1000
+	// dropMarkerFormat is the format of the synthetic log message injected into the destination
+	// stream after log messages are dropped from the ring buffer.
+	dropMarkerFormat = "[shim-logger] dropped %d lines (%d bytes)"
+)
+
+// Overflow policies decide what the ring buffer does with a new log message when there is not
+// enough space left to save it.
+const (
+	// DropNewestOverflowPolicy drops the incoming log message. This is the default policy.
+	DropNewestOverflowPolicy = "drop-newest"
+	// DropOldestOverflowPolicy evicts log messages from the head of the ring buffer until the
+	// incoming log message fits.
+	DropOldestOverflowPolicy = "drop-oldest"
+	// BlockWithTimeoutOverflowPolicy waits for the underlying log driver to free up space in the
+	// ring buffer, for at most the overflow timeout, before dropping the incoming log message.
+	BlockWithTimeoutOverflowPolicy = "block-with-timeout"
 )
 
 // bufferedLogger is a wrapper of underlying log driver and an intermediate ring
@@ -34,6 +51,19 @@ type bufferedLogger struct {
 	// sending data to the ringBuffer.
 	bufReadSizeInBytes int
 	containerID        string
+	// dropped counts the log messages dropped from the ring buffer per source pipe.
+	dropped map[string]*droppedCounters
+	// wal is the write-ahead log of the underlying log driver if it's enabled.
+	wal *writeAheadLog
+	// traceReporters are the stages of the log message pipeline of the underlying log driver
+	// reporting counters along with the routing trace.
+	traceReporters []traceReporter
+}
+
+// droppedCounters counts the log messages dropped from a single source pipe.
+type droppedCounters struct {
+	messages uint64
+	bytes    uint64
 }
 
 // Adopted from https://github.com/moby/moby/blob/master/daemon/logger/ring.go#L128
@@ -56,18 +86,96 @@ type ringBuffer struct {
 	closedPipesCount int
 	// isClosed indicates if ring buffer is closed.
 	isClosed bool
+	// driverName is the name of the log driver consuming the buffer, which its metrics are
+	// labeled with.
+	driverName string
+	// overflowPolicy decides what to do with a new log message when the buffer is full.
+	overflowPolicy string
+	// overflowTimeout is how long Enqueue waits for available space under the
+	// block-with-timeout overflow policy.
+	overflowTimeout time.Duration
+	// walSeqs are the write-ahead log sequence numbers of the log messages in queue, in the same
+	// order, so that the write-ahead log knows which ones are dropped.
+	walSeqs []uint64
+	// onDrop is called with every log message dropped from the buffer, along with its write-ahead
+	// log sequence number, if it's set.
+	onDrop func(msg *dockerlogger.Message, walSeq uint64)
+	// dropMarkerEnabled indicates if a synthetic log message reporting the dropped log
+	// messages is injected into the buffer once there is available space again.
+	dropMarkerEnabled bool
+	// pendingDrops counts the dropped log messages per source pipe which are not reported
+	// by a drop marker yet.
+	pendingDrops map[string]*droppedCounters
+	// dropMarkers saves the log messages reporting dropped log messages which are not sent
+	// yet, so that they can be told apart from the log messages read from container pipes.
+	dropMarkers sync.Map
+	// spill saves the log messages which don't fit into the queue to disk if it's set. Once
+	// a log message is spilled, the following log messages are spilled too until the spill
+	// queue is drained, so that log messages are always sent in order.
+	spill *spillQueue
 }
 
 // NewBufferedLogger creates a logger with the provided LoggerOpt,
 // a buffer with customized max size and a channel monitor if stdout
 // and stderr pipes are closed.
-func NewBufferedLogger(l LogDriver, bufferReadSize int, maxBufferSize int, containerID string) LogDriver {
-	return &bufferedLogger{
+func NewBufferedLogger(
+	l LogDriver,
+	bufferReadSize int,
+	maxBufferSize int,
+	containerID string,
+	options ...BufferedOpt,
+) LogDriver {
+	bl := &bufferedLogger{
 		l:                  l,
 		buffer:             newLoggerBuffer(maxBufferSize),
 		bufReadSizeInBytes: bufferReadSize,
 		containerID:        containerID,
+		dropped: map[string]*droppedCounters{
+			sourceSTDOUT: {},
+			sourceSTDERR: {},
+		},
+	}
+	bl.buffer.onDrop = bl.recordDroppedMessage
+	if inner, ok := l.(*Logger); ok {
+		bl.buffer.driverName = inner.driverName
+		bl.wal = inner.wal
+		bl.traceReporters = inner.traceReporters()
+	}
+	for _, opt := range options {
+		opt(bl)
+	}
+	return bl
+}
+
+// recordDroppedMessage counts a log message dropped from the ring buffer against its source pipe.
+func (bl *bufferedLogger) recordDroppedMessage(msg *dockerlogger.Message, walSeq uint64) {
+	counters, ok := bl.dropped[msg.Source]
+	if !ok {
+		return
+	}
+	atomic.AddUint64(&counters.messages, 1)
+	atomic.AddUint64(&counters.bytes, uint64(len(msg.Line)))
+	bufferDroppedLines.WithLabelValues(msg.Source, bl.buffer.driverName).Inc()
+	bufferDroppedBytes.WithLabelValues(msg.Source, bl.buffer.driverName).Add(float64(len(msg.Line)))
+	// A dropped log message won't be sent, so it doesn't need to be replayed either.
+	if bl.wal != nil {
+		bl.wal.drop(msg.Source, walSeq)
+	}
+}
+
+// logAndAck lets underlying log driver send a log message to destination, and then records it as
+// delivered in the write-ahead log if it's enabled, even if it fails to be sent.
+func (bl *bufferedLogger) logAndAck(msg *dockerlogger.Message) error {
+	// The log driver may put the log message back to the pool once it's sent, so take what's
+	// needed to ack it first.
+	source := msg.Source
+	// Log messages reporting dropped log messages are not saved in the write-ahead log.
+	_, isDropMarker := bl.buffer.dropMarkers.LoadAndDelete(msg)
+	err := bl.Log(msg)
+	if bl.wal != nil && !isDropMarker {
+		bl.wal.ack(source)
 	}
+	return err
 }
 
 // newLoggerBuffer creates a buffer that stores messages which are
@@ -76,8 +184,11 @@ func newLoggerBuffer(maxBufferSize int) *ringBuffer {
 	rb := &ringBuffer{
 		maxSizeInBytes:   maxBufferSize,
 		queue:            make([]*dockerlogger.Message, 0, ringCap),
+		walSeqs:          make([]uint64, 0, ringCap),
 		closedPipesCount: 0,
 		isClosed:         false,
+		overflowPolicy:   DropNewestOverflowPolicy,
+		pendingDrops:     make(map[string]*droppedCounters),
 	}
 	rb.wait = sync.NewCond(&rb.lock)
 
@@ -95,14 +206,44 @@ func (bl *bufferedLogger) Start(
 		return err
 	}
 
+	if bl.buffer.spill != nil {
+		// The write-ahead log replays the spilled log messages along with the other undelivered ones.
+		if err := bl.buffer.spill.open(bl.wal == nil); err != nil {
+			return err
+		}
+		if !bl.buffer.spill.isEmpty() {
+			debug.SendEvent(DaemonName,
+				fmt.Sprintf("Replaying %d log messages spilled by a previous run", bl.buffer.spill.len),
+				debug.INFO,
+				debug.Lines(uint64(bl.buffer.spill.len)))
+		}
+		defer func() {
+			if err := bl.buffer.spill.close(); err != nil {
+				debug.SendEvent(DaemonName, fmt.Sprintf("Unable to clean up spill directory: %s", err), debug.ERROR, debug.Err(err))
+			}
+		}()
+	}
+
+	// Replay the log messages left undelivered by a previous run before reading new ones.
+	if bl.wal != nil {
+		if err := bl.wal.open(); err != nil {
+			return err
+		}
+		defer bl.wal.close()
+		if err := bl.wal.replay(bl.Log); err != nil {
+			return err
+		}
+	}
+
 	var logWG sync.WaitGroup
 	logWG.Add(1)
 	stopTracingLogRoutingChan := make(chan bool, 1)
 	atomic.StoreUint64(&bytesReadFromSrc, 0)
 	atomic.StoreUint64(&bytesSentToDst, 0)
+	atomic.StoreUint64(&bytesFiltered, 0)
 	atomic.StoreUint64(&numberOfNewLineChars, 0)
 	go func() {
-		startTracingLogRouting(bl.containerID, stopTracingLogRoutingChan)
+		startTracingLogRouting(bl.containerID, stopTracingLogRoutingChan, bl.dropped, bl.traceReporters)
 		logWG.Done()
 	}()
 	defer func() {
@@ -202,7 +343,11 @@ func (bl *bufferedLogger) saveSingleLogMessageToRingBuffer(
 	if isPartialMsg {
 		message.PLogMetaData = &types.PartialLogMetaData{ID: partialID, Ordinal: partialOrdinal, Last: isLastPartial}
 	}
-	err := bl.buffer.Enqueue(message)
+	walSeq := uint64(noWALSeq)
+	if bl.wal != nil {
+		walSeq = bl.wal.appendedSeq(source)
+	}
+	err := bl.buffer.enqueue(message, walSeq)
 	if err != nil {
 		return fmt.Errorf("failed to save logs to buffer: %w", err)
 	}
@@ -248,13 +393,16 @@ func (bl *bufferedLogger) sendLogMessageToDestination() error {
 		return fmt.Errorf("failed to read logs from buffer: %w", err)
 	}
 
-	err = bl.Log(msg)
+	source := msg.Source
+	err = bl.logAndAck(msg)
 	if err != nil {
 		// If we return a non-empty error here, it will cause the goroutine exits.
 		// As a result, it won't consume logs from the buffer and no more logs will be sent to destination.
-		debug.SendEventsToLog(DaemonName,
+		debug.SendEvent(DaemonName,
 			fmt.Sprintf("[BUFFER] Failed to proxy msg to the log driver : %s", err),
-			debug.ERROR, 0)
+			debug.ERROR,
+			debug.Source(source),
+			debug.Err(err))
 	}
 
 	return nil
@@ -265,12 +413,23 @@ func (bl *bufferedLogger) sendLogMessageToDestination() error {
 func (bl *bufferedLogger) flushMessages() error {
 	messages := bl.buffer.Flush()
 	for _, msg := range messages {
-		err := bl.Log(msg)
+		err := bl.logAndAck(msg)
 		if err != nil {
 			return fmt.Errorf("unable to flush the remaining messages to destination: %w", err)
 		}
 	}
 
+	// The messages spilled to disk are newer than the ones in memory, so replay them after.
+	err := bl.buffer.FlushSpilled(func(msg *dockerlogger.Message) error {
+		if err := bl.logAndAck(msg); err != nil {
+			return fmt.Errorf("unable to flush the remaining spilled messages to destination: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -301,18 +460,55 @@ func (b *ringBuffer) closed() bool {
 // as messageRing struct is not exported.
 // Enqueue adds a single log message to the tail of intermediate buffer.
 func (b *ringBuffer) Enqueue(msg *dockerlogger.Message) error {
+	return b.enqueue(msg, noWALSeq)
+}
+
+// enqueue adds a single log message, which has the given write-ahead log sequence number, to the
+// tail of intermediate buffer.
+func (b *ringBuffer) enqueue(msg *dockerlogger.Message, walSeq uint64) error {
 	b.lock.Lock()
 	defer b.lock.Unlock()
+	defer b.observeOccupancy()
 
 	lineSizeInBytes := len(msg.Line)
-	// If there is already at least one log message in the queue and not enough space left
-	// for the new coming log message to take up, drop this log message. Otherwise, save this
-	// message to ring buffer anyway.
-	if len(b.queue) > 0 &&
-		b.curSizeInBytes+lineSizeInBytes > b.maxSizeInBytes {
+	// If there are spilled log messages not sent yet, or there is not enough space left for
+	// the new coming log message to take up, spill it to disk if possible.
+	if b.spill != nil && (!b.spill.isEmpty() || !b.hasSpaceFor(lineSizeInBytes)) {
+		err := b.spill.push(msg)
+		if err == nil {
+			b.wait.Broadcast()
+			return nil
+		}
+		switch {
+		case !errors.Is(err, errSpillQueueFull):
+			debug.SendEventsToLog(DaemonName,
+				fmt.Sprintf("Unable to spill message to disk: %s", err),
+				debug.ERROR, 0)
+		case debug.Verbose:
+			debug.SendEventsToLog(DaemonName, "spill queue is full", debug.DEBUG, 0)
+		}
+		// Never save this log message to memory ahead of the older spilled ones.
+		if !b.spill.isEmpty() {
+			b.drop(msg, walSeq)
+			b.wait.Broadcast()
+			return nil
+		}
+	}
+	// If there is not enough space left for the new coming log message to take up, make room
+	// for it according to the overflow policy.
+	if !b.hasSpaceFor(lineSizeInBytes) {
+		switch b.overflowPolicy {
+		case DropOldestOverflowPolicy:
+			b.evictOldest(lineSizeInBytes)
+		case BlockWithTimeoutOverflowPolicy:
+			b.waitForSpace(lineSizeInBytes)
+		}
+	}
+	// If there is still not enough space left, drop this log message.
+	if !b.hasSpaceFor(lineSizeInBytes) {
 		if debug.Verbose {
 			debug.SendEventsToLog(DaemonName,
-				"buffer is full/message is too long, waiting for available bytes",
+				"buffer is full/message is too long, dropping message",
 				debug.DEBUG, 0)
 			debug.SendEventsToLog(DaemonName,
 				fmt.Sprintf("message size: %d, current buffer size: %d, max buffer size %d",
@@ -321,32 +517,131 @@ func (b *ringBuffer) Enqueue(msg *dockerlogger.Message) error {
 					b.maxSizeInBytes),
 				debug.DEBUG, 0)
 		}
+		b.drop(msg, walSeq)
 
 		// Wake up "Dequeue" or the other "Enqueue" go routine (called by the other pipe)
 		// waiting on current mutex lock if there's any
-		b.wait.Signal()
+		b.wait.Broadcast()
 		return nil
 	}
 
+	// Report the log messages dropped from the same pipe before this one if there is enough
+	// space left for both, or if the buffer is empty.
+	if marker := b.pendingDropMarker(msg.Source); marker != nil &&
+		(len(b.queue) == 0 || b.curSizeInBytes+len(marker.Line)+lineSizeInBytes <= b.maxSizeInBytes) {
+		b.queue = append(b.queue, marker)
+		b.walSeqs = append(b.walSeqs, noWALSeq)
+		b.curSizeInBytes += len(marker.Line)
+		b.dropMarkers.Store(marker, struct{}{})
+		delete(b.pendingDrops, msg.Source)
+	}
 	b.queue = append(b.queue, msg)
+	b.walSeqs = append(b.walSeqs, walSeq)
 	b.curSizeInBytes += lineSizeInBytes
 	// Wake up "Dequeue" or the other "Enqueue" go routine (called by the other pipe)
 	// waiting on current mutex lock if there's any
-	b.wait.Signal()
+	b.wait.Broadcast()
 
 	return nil
 }
 
+// hasSpaceFor indicates if a log message of the given size can be saved to the buffer. A log
+// message is always saved to an empty buffer, even if it's larger than the max buffer size.
+// The caller must hold the lock.
+func (b *ringBuffer) hasSpaceFor(lineSizeInBytes int) bool {
+	return len(b.queue) == 0 || b.curSizeInBytes+lineSizeInBytes <= b.maxSizeInBytes
+}
+
+// evictOldest removes log messages from the head of the buffer until a log message of the
+// given size fits. The caller must hold the lock.
+func (b *ringBuffer) evictOldest(lineSizeInBytes int) {
+	for !b.hasSpaceFor(lineSizeInBytes) {
+		msg, walSeq := b.queue[0], b.walSeqs[0]
+		b.queue[0] = nil // allow GC to collect the evicted message
+		b.queue = b.queue[1:]
+		b.walSeqs = b.walSeqs[1:]
+		b.curSizeInBytes -= len(msg.Line)
+		if debug.Verbose {
+			debug.SendEventsToLog(DaemonName,
+				fmt.Sprintf("buffer is full, evicted oldest message of size %d", len(msg.Line)),
+				debug.DEBUG, 0)
+		}
+		b.drop(msg, walSeq)
+	}
+}
+
+// observeOccupancy records how much of the buffer is taken up. The caller must hold the lock.
+func (b *ringBuffer) observeOccupancy() {
+	bufferSizeBytes.WithLabelValues(b.driverName).Set(float64(b.curSizeInBytes))
+	bufferLines.WithLabelValues(b.driverName).Set(float64(len(b.queue)))
+}
+
+// drop records a log message, which has the given write-ahead log sequence number, dropped from
+// the buffer. The caller must hold the lock.
+func (b *ringBuffer) drop(msg *dockerlogger.Message, walSeq uint64) {
+	if b.onDrop != nil {
+		b.onDrop(msg, walSeq)
+	}
+	if !b.dropMarkerEnabled {
+		return
+	}
+	pending, ok := b.pendingDrops[msg.Source]
+	if !ok {
+		pending = &droppedCounters{}
+		b.pendingDrops[msg.Source] = pending
+	}
+	pending.messages++
+	pending.bytes += uint64(len(msg.Line))
+}
+
+// pendingDropMarker creates the log message reporting the dropped log messages of the given
+// source pipe which are not reported yet. It returns nil if there is nothing to report. The
+// caller must hold the lock.
+func (b *ringBuffer) pendingDropMarker(source string) *dockerlogger.Message {
+	pending, ok := b.pendingDrops[source]
+	if !ok {
+		return nil
+	}
+	line := fmt.Sprintf(dropMarkerFormat, pending.messages, pending.bytes)
+	return newMessage([]byte(line), source, time.Now().UTC())
+}
+
+// waitForSpace suspends current go routine until a log message of the given size fits, the
+// buffer is closed or the overflow timeout expires, whichever comes first. The caller must
+// hold the lock.
+func (b *ringBuffer) waitForSpace(lineSizeInBytes int) {
+	timedOut := false
+	// sync.Cond doesn't support waiting with a timeout, so wake up all the waiting go routines
+	// once the timeout expires and let them re-check their conditions.
+	timer := time.AfterFunc(b.overflowTimeout, func() {
+		b.lock.Lock()
+		timedOut = true
+		b.wait.Broadcast()
+		b.lock.Unlock()
+	})
+	defer timer.Stop()
+
+	for !b.hasSpaceFor(lineSizeInBytes) && !b.isClosed && !timedOut {
+		if debug.Verbose {
+			debug.SendEventsToLog(DaemonName,
+				"buffer is full/message is too long, waiting for available bytes",
+				debug.DEBUG, 0)
+		}
+		b.wait.Wait()
+	}
+}
+
 // Adopted from https://github.com/moby/moby/blob/master/daemon/logger/ring.go#L179
 // as messageRing struct is not exported.
 // Dequeue gets a line of log message from the head of intermediate buffer.
 func (b *ringBuffer) Dequeue() (*dockerlogger.Message, error) {
 	b.lock.Lock()
 	defer b.lock.Unlock()
+	defer b.observeOccupancy()
 
 	// If there is no log yet in the buffer, and the ring buffer is still open, wait
 	// suspends current go routine.
-	for len(b.queue) == 0 && !b.isClosed {
+	for len(b.queue) == 0 && (b.spill == nil || b.spill.isEmpty()) && !b.isClosed {
 		if debug.Verbose {
 			debug.SendEventsToLog(DaemonName,
 				"No messages in queue, waiting...",
@@ -360,12 +655,25 @@ func (b *ringBuffer) Dequeue() (*dockerlogger.Message, error) {
 		return nil, nil //nolint: nilnil // swallow the error
 	}
 
+	// The log messages in memory are always older than the spilled ones, so only read the
+	// spilled ones once the queue is drained.
+	if len(b.queue) == 0 {
+		msg, err := b.spill.pop()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read spilled logs: %w", err)
+		}
+		return msg, nil
+	}
+
 	// Get and remove the oldest message saved in buffer/queue from head and update
 	// the current used bytes of buffer.
 	msg := b.queue[0]
 	b.queue[0] = nil // allow GC to collect the dequeued message
 	b.queue = b.queue[1:]
+	b.walSeqs = b.walSeqs[1:]
 	b.curSizeInBytes -= len(msg.Line)
+	// Wake up "Enqueue" go routines waiting for available space if there's any.
+	b.wait.Broadcast()
 
 	return msg, nil
 }
@@ -376,6 +684,13 @@ func (b *ringBuffer) Dequeue() (*dockerlogger.Message, error) {
 func (b *ringBuffer) Flush() []*dockerlogger.Message {
 	b.lock.Lock()
 	defer b.lock.Unlock()
+	defer b.observeOccupancy()
+
+	// Report the dropped log messages which are not reported yet at the end. If there are
+	// spilled log messages left, they are reported by FlushSpilled after those instead.
+	if b.spill == nil || b.spill.isEmpty() {
+		b.queue = append(b.queue, b.flushDropMarkers()...)
+	}
 
 	if len(b.queue) == 0 {
 		return make([]*dockerlogger.Message, 0)
@@ -383,6 +698,51 @@ func (b *ringBuffer) Flush() []*dockerlogger.Message {
 
 	messages := b.queue
 	b.queue = make([]*dockerlogger.Message, 0)
+	b.walSeqs = make([]uint64, 0)
+	b.curSizeInBytes = 0
+	// Wake up "Enqueue" go routines waiting for available space if there's any.
+	b.wait.Broadcast()
 
 	return messages
 }
+
+// FlushSpilled reads all the messages left in the spill queue and passes them to the given
+// function in order, followed by the messages reporting dropped messages if there's any.
+func (b *ringBuffer) FlushSpilled(send func(*dockerlogger.Message) error) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.spill == nil {
+		return nil
+	}
+	for !b.spill.isEmpty() {
+		msg, err := b.spill.pop()
+		if err != nil {
+			return fmt.Errorf("failed to read spilled logs: %w", err)
+		}
+		if err := send(msg); err != nil {
+			return err
+		}
+	}
+	for _, marker := range b.flushDropMarkers() {
+		if err := send(marker); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// flushDropMarkers creates the messages reporting the dropped messages of all source pipes which
+// are not reported yet. The caller must hold the lock.
+func (b *ringBuffer) flushDropMarkers() []*dockerlogger.Message {
+	var markers []*dockerlogger.Message
+	for _, source := range []string{sourceSTDOUT, sourceSTDERR} {
+		if marker := b.pendingDropMarker(source); marker != nil {
+			markers = append(markers, marker)
+			b.dropMarkers.Store(marker, struct{}{})
+			delete(b.pendingDrops, source)
+		}
+	}
+	return markers
+}
@@ -9,6 +9,7 @@ package logger
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	dockerlogger "github.com/docker/docker/daemon/logger"
 	"github.com/stretchr/testify/require"
@@ -69,3 +70,107 @@ func TestLogBufferEnqueueFlush(t *testing.T) {
 	require.Len(t, lb.queue, 0)
 	require.Equal(t, messages, flushedMsg)
 }
+
+// TestLogBufferOverflowPolicy tests what the buffer does with a new message when it is full.
+func TestLogBufferOverflowPolicy(t *testing.T) {
+	newMsg := &dockerlogger.Message{Line: []byte("newLine"), Timestamp: dummyTime}
+	for _, tc := range []struct {
+		name             string
+		policy           string
+		expectedMessages []*dockerlogger.Message
+	}{
+		{
+			name:             "drop newest",
+			policy:           DropNewestOverflowPolicy,
+			expectedMessages: messages,
+		},
+		{
+			name:             "drop oldest",
+			policy:           DropOldestOverflowPolicy,
+			expectedMessages: append(append([]*dockerlogger.Message{}, messages[2:]...), newMsg),
+		},
+		{
+			name:             "block with timeout",
+			policy:           BlockWithTimeoutOverflowPolicy,
+			expectedMessages: messages,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			// Only leave enough space for the messages already saved in buffer.
+			lb := newLoggerBuffer(24)
+			lb.overflowPolicy = tc.policy
+			lb.overflowTimeout = 10 * time.Millisecond
+			for _, msg := range messages {
+				require.NoError(t, lb.Enqueue(msg))
+			}
+
+			require.NoError(t, lb.Enqueue(newMsg))
+			require.Equal(t, tc.expectedMessages, lb.Flush())
+		})
+	}
+}
+
+// TestLogBufferBlockWithTimeout tests that a blocked Enqueue saves the new message once
+// Dequeue frees up enough space.
+func TestLogBufferBlockWithTimeout(t *testing.T) {
+	lb := newLoggerBuffer(24)
+	lb.overflowPolicy = BlockWithTimeoutOverflowPolicy
+	lb.overflowTimeout = time.Minute
+	for _, msg := range messages {
+		require.NoError(t, lb.Enqueue(msg))
+	}
+
+	newMsg := &dockerlogger.Message{Line: []byte("newLine"), Timestamp: dummyTime}
+	enqueued := make(chan error, 1)
+	go func() {
+		enqueued <- lb.Enqueue(newMsg)
+	}()
+	for i := 0; i < 2; i++ {
+		msg, err := lb.Dequeue()
+		require.NoError(t, err)
+		require.Equal(t, messages[i], msg)
+	}
+
+	select {
+	case err := <-enqueued:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Enqueue is still blocked after space is available")
+	}
+	require.Equal(t, append(append([]*dockerlogger.Message{}, messages[2:]...), newMsg), lb.Flush())
+}
+
+// TestBufferedLoggerDropAccounting tests that dropped messages are counted per source pipe and
+// reported by a drop marker once there is available space again.
+func TestBufferedLoggerDropAccounting(t *testing.T) {
+	bl, ok := NewBufferedLogger(nil, DefaultBufSizeInBytes, 20, testContainerID, WithDropMarker(true)).(*bufferedLogger)
+	require.True(t, ok)
+
+	first := newMessage([]byte("0123456789"), sourceSTDOUT, dummyTime)
+	require.NoError(t, bl.buffer.Enqueue(first))
+	// Not enough space left for either of them.
+	require.NoError(t, bl.buffer.Enqueue(newMessage([]byte("01234567890123"), sourceSTDOUT, dummyTime)))
+	require.NoError(t, bl.buffer.Enqueue(newMessage([]byte("0123456789012"), sourceSTDERR, dummyTime)))
+
+	require.Equal(t, uint64(1), bl.dropped[sourceSTDOUT].messages)
+	require.Equal(t, uint64(14), bl.dropped[sourceSTDOUT].bytes)
+	require.Equal(t, uint64(1), bl.dropped[sourceSTDERR].messages)
+	require.Equal(t, uint64(13), bl.dropped[sourceSTDERR].bytes)
+
+	msg, err := bl.buffer.Dequeue()
+	require.NoError(t, err)
+	require.Equal(t, first, msg)
+
+	// The marker is saved right before the next message from the same pipe.
+	next := newMessage([]byte("next"), sourceSTDOUT, dummyTime)
+	require.NoError(t, bl.buffer.Enqueue(next))
+	// The marker of stderr is saved at the end when flushing.
+	flushed := bl.buffer.Flush()
+	require.Len(t, flushed, 3)
+	require.Equal(t, "[shim-logger] dropped 1 lines (14 bytes)", string(flushed[0].Line))
+	require.Equal(t, sourceSTDOUT, flushed[0].Source)
+	require.Equal(t, next, flushed[1])
+	require.Equal(t, "[shim-logger] dropped 1 lines (13 bytes)", string(flushed[2].Line))
+	require.Equal(t, sourceSTDERR, flushed[2].Source)
+}
@@ -13,12 +13,14 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/aws/shim-loggers-for-containerd/debug"
 
+	"github.com/containerd/containerd/runtime/v2/logging"
 	types "github.com/docker/docker/api/types/backend"
 	dockerlogger "github.com/docker/docker/daemon/logger"
 	"golang.org/x/sync/errgroup"
@@ -47,15 +49,23 @@ const (
 	// https://github.com/moby/moby/blob/19.03/daemon/logger/copier.go#L21
 	DefaultBufSizeInBytes = 16 * 1024
 
+	// DefaultPartialReassemblyMaxBytes is the max size of a log message reassembled from partial
+	// log messages when reassembly is forced by redaction rather than enabled.
+	DefaultPartialReassemblyMaxBytes = 1024 * 1024
+
 	traceLogRoutingInterval = 1 * time.Minute
 )
 
 var (
 	// bytesReadFromSrc defines the number of bytes we read from the source(all pipes) within given time interval.
 	bytesReadFromSrc uint64
-	// bytesSentToDst defines the number of bytes we send to the destination(the corresponding log driver) within given
-	// time interval.
+	// bytesSentToDst defines the number of bytes the log drivers accept within given time interval, i.e. what's left
+	// once log messages are filtered out, rate limited, grouped and redacted. With multiple log drivers, it's the sum
+	// of the bytes every one of them accepts.
 	bytesSentToDst uint64
+	// bytesFiltered defines the number of bytes from the source which are filtered out and won't be sent to the
+	// destination within given time interval.
+	bytesFiltered uint64
 	// numberOfNewLineChars defines the number of new line characters which are part of bytes from the source but
 	// won't be sent to the destination.
 	numberOfNewLineChars uint64
@@ -69,11 +79,28 @@ type GlobalArgs struct {
 	LogDriver     string
 
 	// Optional arguments
-	Mode          string
-	MaxBufferSize int
-	UID           int
-	GID           int
-	CleanupTime   *time.Duration
+	Mode                      string
+	DriverModes               map[string]string
+	MaxBufferSize             int
+	BufferOverflowPolicy      string
+	BufferOverflowTimeout     time.Duration
+	BufferDropMarker          bool
+	SpillDir                  string
+	SpillSegmentSize          int
+	SpillMaxSize              int
+	WriteAheadLogDir          string
+	Multiline                 *MultilineArgs
+	PartialReassemblyMaxBytes int
+	RedactRules               *RedactRules
+	FilterRules               *FilterRules
+	DiscardStreams            map[string]string
+	RateLimit                 *RateLimitArgs
+	JSONParse                 *JSONParseArgs
+	Timestamp                 *TimestampArgs
+	MetricsAddress            string
+	UID                       int
+	GID                       int
+	CleanupTime               *time.Duration
 }
 
 // DockerConfigs holds optional Docker configuration details.
@@ -95,12 +122,71 @@ type Logger struct {
 	Stdout io.Reader
 	Stderr io.Reader
 
+	// driverName is the name of the log driver the metrics of the stream are
+	// labeled with.
+	driverName string
 	// bufferSizeInBytes defines the size of our own buffer. It's default to
 	// 16 * 1024, but maybe different among log drivers.
 	bufferSizeInBytes int
+	// bufferedReadSizeInBytes is how many bytes the ring buffer of the non-blocking mode reads at
+	// a time from the container pipes. It's default to bufferSizeInBytes.
+	bufferedReadSizeInBytes int
 	// maxReadBytes defines how many bytes we want to read from container pipe
 	// per iteration. It's default to 2 * 1024.
 	maxReadBytes int
+	// walDir is the directory to save the write-ahead log to. The write-ahead log
+	// is disabled if it's empty.
+	walDir string
+	// wal saves every log message read from container pipes before it's sent, so
+	// that undelivered log messages can be replayed after a restart.
+	wal *writeAheadLog
+	// multilineArgs sets how consecutive log lines are grouped into a single log
+	// message. Log lines aren't grouped if it's nil.
+	multilineArgs *MultilineArgs
+	// multiline is the validated multilineArgs.
+	multiline *multiline
+	// partialMaxBytes is the max size of a log message reassembled from partial
+	// log messages. Partial log messages aren't reassembled if it's 0.
+	partialMaxBytes int
+	// maxBytesPerEvent is the max size of a log message accepted by the
+	// destination, which caps partialMaxBytes. There's no limit if it's 0.
+	maxBytesPerEvent int
+	// redactRules are the rules to redact log messages with. Log messages aren't
+	// redacted if it's nil.
+	redactRules *RedactRules
+	// redactor is the compiled redactRules.
+	redactor *redactor
+	// filterRules are the rules to filter out log messages with, and
+	// discardSource is the container pipe which log messages are all filtered
+	// out. Log messages aren't filtered if neither is set.
+	filterRules   *FilterRules
+	discardSource string
+	// filter is the compiled filterRules and discardSource.
+	filter *filter
+	// rateLimitArgs sets how many log messages per second are sent. Log
+	// messages aren't rate limited if it's nil.
+	rateLimitArgs *RateLimitArgs
+	// rateLimiter is the validated rateLimitArgs, shared by all the container
+	// pipes.
+	rateLimiter *rateLimiter
+	// jsonParseArgs sets which fields of JSON log messages are promoted to
+	// message attributes. Log messages aren't parsed if it's nil.
+	jsonParseArgs *JSONParseArgs
+	// jsonParser is the validated jsonParseArgs.
+	jsonParser *jsonParser
+	// timestampArgs sets where the timestamps of log messages come from. Log
+	// messages are stamped with the time they are read if it's nil.
+	timestampArgs *TimestampArgs
+	// timestamper is the validated timestampArgs.
+	timestamper *timestamper
+}
+
+// traceReporter is a stage of the log message pipeline reporting counters of its own along with
+// the routing trace.
+type traceReporter interface {
+	// reportTrace reports the counters since the last report, or in total once the routing trace
+	// is stopped.
+	reportTrace(containerID string, total bool)
 }
 
 // WindowsArgs struct for Windows configuration.
@@ -131,6 +217,65 @@ type LogDriver interface {
 
 // NewLogger creates a LogDriver with the provided LoggerOpt.
 func NewLogger(options ...Opt) (LogDriver, error) {
+	l, err := newLogger(options...)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// NewPipelineLogger creates the log driver sending container logs to the stream through the log
+// message pipeline set up by the global arguments, which saves them to a ring buffer first in
+// non-blocking mode. The options of the log driver itself are applied after the pipeline ones.
+func NewPipelineLogger(
+	globalArgs *GlobalArgs,
+	config *logging.Config,
+	info *dockerlogger.Info,
+	stream Client,
+	options ...Opt,
+) (LogDriver, error) {
+	l, err := newLogger(append(pipelineOptions(globalArgs, config, info, stream), options...)...)
+	if err != nil {
+		return nil, err
+	}
+	if globalArgs.Mode != NonBlockingMode {
+		return l, nil
+	}
+	debug.SendEventsToLog(DaemonName,
+		fmt.Sprintf("Starting log streaming for non-blocking mode %s driver", globalArgs.LogDriver), debug.INFO, 0)
+	readSize := l.bufferSizeInBytes
+	if l.bufferedReadSizeInBytes > 0 {
+		readSize = l.bufferedReadSizeInBytes
+	}
+	return NewBufferedLogger(l, readSize, globalArgs.MaxBufferSize, globalArgs.ContainerID,
+		WithOverflowPolicy(globalArgs.BufferOverflowPolicy, globalArgs.BufferOverflowTimeout),
+		WithDropMarker(globalArgs.BufferDropMarker),
+		WithSpillQueue(globalArgs.SpillDir, globalArgs.SpillSegmentSize, globalArgs.SpillMaxSize)), nil
+}
+
+// pipelineOptions returns the options setting up the log message pipeline from the global
+// arguments.
+func pipelineOptions(globalArgs *GlobalArgs, config *logging.Config, info *dockerlogger.Info, stream Client) []Opt {
+	return []Opt{
+		WithStdout(config.Stdout),
+		WithStderr(config.Stderr),
+		WithInfo(info),
+		WithStream(stream),
+		WithDriverName(globalArgs.LogDriver),
+		WithWriteAheadLog(globalArgs.WriteAheadLogDir),
+		WithMultiline(globalArgs.Multiline),
+		WithPartialReassembly(globalArgs.PartialReassemblyMaxBytes),
+		WithRedaction(globalArgs.RedactRules),
+		WithFilter(globalArgs.FilterRules),
+		WithDiscardSource(globalArgs.DiscardStreams[globalArgs.LogDriver]),
+		WithRateLimit(globalArgs.RateLimit),
+		WithJSONParse(globalArgs.JSONParse),
+		WithTimestamp(globalArgs.Timestamp),
+	}
+}
+
+// newLogger creates a Logger with the provided LoggerOpt.
+func newLogger(options ...Opt) (*Logger, error) {
 	l := &Logger{
 		Info:              &dockerlogger.Info{},
 		bufferSizeInBytes: DefaultBufSizeInBytes,
@@ -139,6 +284,62 @@ func NewLogger(options ...Opt) (LogDriver, error) {
 	for _, opt := range options {
 		opt(l)
 	}
+	if l.walDir != "" {
+		l.wal = newWriteAheadLog(filepath.Join(l.walDir, l.Info.ContainerID))
+	}
+	if l.multilineArgs != nil {
+		m, err := newMultiline(l.multilineArgs)
+		if err != nil {
+			return nil, fmt.Errorf("unable to validate multiline options: %w", err)
+		}
+		l.multiline = m
+	}
+	if l.redactRules != nil {
+		r, err := newRedactor(l.redactRules)
+		if err != nil {
+			return nil, fmt.Errorf("unable to validate redaction rules: %w", err)
+		}
+		l.redactor = r
+	}
+	if l.filterRules != nil || l.discardSource != "" {
+		f, err := newFilter(l.filterRules, l.discardSource)
+		if err != nil {
+			return nil, fmt.Errorf("unable to validate filter rules: %w", err)
+		}
+		l.filter = f
+	}
+	if l.rateLimitArgs != nil {
+		r, err := newRateLimiter(l.rateLimitArgs)
+		if err != nil {
+			return nil, fmt.Errorf("unable to validate rate limit options: %w", err)
+		}
+		l.rateLimiter = r
+	}
+	if l.jsonParseArgs != nil {
+		p, err := newJSONParser(l.jsonParseArgs)
+		if err != nil {
+			return nil, fmt.Errorf("unable to validate JSON parse options: %w", err)
+		}
+		l.jsonParser = p
+	}
+	if l.timestampArgs != nil && l.timestampArgs.Source != "" && l.timestampArgs.Source != ReadTimeTimestampSource {
+		t, err := newTimestamper(l.timestampArgs)
+		if err != nil {
+			return nil, fmt.Errorf("unable to validate timestamp options: %w", err)
+		}
+		l.timestamper = t
+	}
+	// A secret split between partial log messages can only be redacted once they are reassembled.
+	if l.redactor != nil && l.partialMaxBytes == 0 {
+		l.partialMaxBytes = DefaultPartialReassemblyMaxBytes
+	}
+	if l.maxBytesPerEvent > 0 && l.partialMaxBytes > l.maxBytesPerEvent {
+		l.partialMaxBytes = l.maxBytesPerEvent
+	}
+	if l.partialMaxBytes < 0 || (l.partialMaxBytes > 0 && l.partialMaxBytes <= len(PartialContinuationMarker)) {
+		return nil, fmt.Errorf("invalid partial reassembly max bytes %d, must be larger than %d",
+			l.partialMaxBytes, len(PartialContinuationMarker))
+	}
 	return l, nil
 }
 
@@ -183,14 +384,26 @@ func (l *Logger) Start(
 		return err
 	}
 
+	// Replay the log messages left undelivered by a previous run before reading new ones.
+	if l.wal != nil {
+		if err := l.wal.open(); err != nil {
+			return err
+		}
+		defer l.wal.close()
+		if err := l.wal.replay(l.logAndWait); err != nil {
+			return err
+		}
+	}
+
 	var logWG sync.WaitGroup
 	logWG.Add(1)
 	stopTracingLogRoutingChan := make(chan bool, 1)
 	atomic.StoreUint64(&bytesReadFromSrc, 0)
 	atomic.StoreUint64(&bytesSentToDst, 0)
+	atomic.StoreUint64(&bytesFiltered, 0)
 	atomic.StoreUint64(&numberOfNewLineChars, 0)
 	go func() {
-		startTracingLogRouting(l.Info.ContainerID, stopTracingLogRoutingChan)
+		startTracingLogRouting(l.Info.ContainerID, stopTracingLogRoutingChan, nil, l.traceReporters())
 		logWG.Done()
 	}()
 	defer func() {
@@ -240,10 +453,10 @@ func (l *Logger) sendLogs(
 
 	// Sleep sometime to let shim logger clean up, for example, to allow enough time for the last
 	// few log messages be flushed to destination like CloudWatch.
-	debug.SendEventsToLog(DaemonName,
+	debug.SendEvent(DaemonName,
 		fmt.Sprintf("Pipe %s is closed. Sleeping %s for cleanning up.", source, cleanupTime.String()),
 		debug.INFO,
-		0)
+		debug.Source(source))
 	time.Sleep(*cleanupTime)
 	return nil
 }
@@ -261,13 +474,67 @@ type sendLogToDestFunc func(
 
 // Read gets container logs, saves them to our own buffer. Then we will read logs line by line
 // and send them to destination. In non-blocking mode, the destination is the ring buffer. More
-// log messages will be sent in verbose mode for debugging.
+// log messages will be sent in verbose mode for debugging. Log messages are filtered, partial log
+// messages are reassembled, and log messages are redacted, grouped into a single multiline log
+// message and rate limited first if they are enabled.
 func (l *Logger) Read(
 	ctx context.Context,
 	pipe io.Reader,
 	source string,
 	bufferSizeInBytes int,
 	sendLogMsgToDest sendLogToDestFunc,
+) error {
+	// Save every log message to the write-ahead log before it's sent if it's enabled.
+	if l.wal != nil {
+		sendLogMsgToDest = l.wal.wrap(sendLogMsgToDest)
+	}
+	// Rate limit log messages before they are saved to the write-ahead log.
+	var limited *rateLimitedSource
+	if l.rateLimiter != nil {
+		limited = l.rateLimiter.newSource(sendLogMsgToDest)
+		sendLogMsgToDest = limited.add
+	}
+	// Group multiline log messages before they are rate limited, so that a group counts as a
+	// single log message.
+	var group *multilineGroup
+	if l.multiline != nil {
+		group = newMultilineGroup(l.multiline, l.Info.ContainerID, source, sendLogMsgToDest)
+		sendLogMsgToDest = group.add
+	}
+	// Reassemble partial log messages, and redact them as a whole before they are split, grouped,
+	// saved to the write-ahead log or sent. Partial log messages are always reassembled if log
+	// messages are redacted.
+	var reassembler *partialReassembler
+	if l.partialMaxBytes > 0 {
+		var redact func([]byte) []byte
+		if l.redactor != nil {
+			redact = l.redactor.redact
+		}
+		reassembler = newPartialReassembler(l.partialMaxBytes, redact, sendLogMsgToDest)
+		sendLogMsgToDest = reassembler.add
+	}
+
+	err := l.read(ctx, pipe, source, bufferSizeInBytes, sendLogMsgToDest)
+	// Send what's left once the pipe is closed or logging is stopped.
+	if reassembler != nil {
+		err = errors.Join(err, reassembler.flush())
+	}
+	if group != nil {
+		err = errors.Join(err, group.close())
+	}
+	if limited != nil {
+		err = errors.Join(err, limited.close(source))
+	}
+	return err
+}
+
+// read reads log messages from container pipe line by line, and sends them with sendLogMsgToDest.
+func (l *Logger) read(
+	ctx context.Context,
+	pipe io.Reader,
+	source string,
+	bufferSizeInBytes int,
+	sendLogMsgToDest sendLogToDestFunc,
 ) error {
 	var (
 		msgTimestamp  time.Time
@@ -288,6 +555,13 @@ func (l *Logger) Read(
 	partialID := ""
 	// partialOrdinal orders the split messages and count up from 1
 	partialOrdinal := 1
+	linesRead := linesReadFromSrc.WithLabelValues(source)
+	bytesRead := bytesReadFromSrcTotal.WithLabelValues(source)
+	partialLines := partialLinesEmitted.WithLabelValues(source)
+	filteredLines := linesFiltered.WithLabelValues(source)
+	// keep indicates if current message is sent to destination. All the partial log messages of a
+	// log message are either sent or filtered out along with the first one.
+	keep := true
 
 	for {
 		select {
@@ -297,10 +571,12 @@ func (l *Logger) Read(
 				debug.DEBUG, 0)
 			return nil
 		default:
+			bytesInBufferBeforeRead := bytesInBuffer
 			eof, bytesInBuffer, err = readFromContainerPipe(pipe, buf, bytesInBuffer, l.maxReadBytes)
 			if err != nil {
 				return err
 			}
+			bytesRead.Add(float64(bytesInBuffer - bytesInBufferBeforeRead))
 
 			// If container pipe is closed and no bytes left in our buffer, directly return.
 			if eof && bytesInBuffer == 0 {
@@ -317,27 +593,38 @@ func (l *Logger) Read(
 				// use the existing timestamp, so that all
 				// partials split from the same message have the same timestamp
 				// If not, new timestamp.
+				curLine := buf[head : head+lenOfLine]
 				if isPartialMsg {
 					isLastPartial = true
 				} else {
-					msgTimestamp = time.Now().UTC()
+					msgTimestamp = l.timestamp(curLine)
 				}
-				curLine := buf[head : head+lenOfLine]
-				err = sendLogMsgToDest(
-					curLine,
-					source,
-					isPartialMsg,
-					isLastPartial,
-					partialID,
-					partialOrdinal,
-					msgTimestamp,
-				)
-				if err != nil {
-					return err
+				if !isPartialMsg {
+					keep = l.filter == nil || l.filter.keep(source, curLine)
+				}
+				if keep {
+					err = sendLogMsgToDest(
+						curLine,
+						source,
+						isPartialMsg,
+						isLastPartial,
+						partialID,
+						partialOrdinal,
+						msgTimestamp,
+					)
+					if err != nil {
+						return err
+					}
+				} else {
+					atomic.AddUint64(&bytesFiltered, uint64(len(curLine)))
+					filteredLines.Inc()
 				}
 
-				atomic.AddUint64(&bytesSentToDst, uint64(len(curLine)))
 				atomic.AddUint64(&numberOfNewLineChars, 1)
+				linesRead.Inc()
+				if isPartialMsg {
+					partialLines.Inc()
+				}
 				// Since we have found a newline symbol, it means this line has ended.
 				// Reset flags.
 				isFirstPartial = true
@@ -363,27 +650,36 @@ func (l *Logger) Read(
 					// Record as a partial message.
 					isPartialMsg = true
 					if isFirstPartial {
-						msgTimestamp = time.Now().UTC()
+						msgTimestamp = l.timestamp(curLine)
 						partialID, err = generateRandomID()
 					}
 					if err != nil {
 						return err
 					}
 
-					err = sendLogMsgToDest(
-						curLine,
-						source,
-						isPartialMsg,
-						isLastPartial,
-						partialID,
-						partialOrdinal,
-						msgTimestamp,
-					)
-					if err != nil {
-						return err
+					if isFirstPartial {
+						keep = l.filter == nil || l.filter.keep(source, curLine)
+					}
+					if keep {
+						err = sendLogMsgToDest(
+							curLine,
+							source,
+							isPartialMsg,
+							isLastPartial,
+							partialID,
+							partialOrdinal,
+							msgTimestamp,
+						)
+						if err != nil {
+							return err
+						}
+					} else {
+						atomic.AddUint64(&bytesFiltered, uint64(len(curLine)))
+						filteredLines.Inc()
 					}
 
-					atomic.AddUint64(&bytesSentToDst, uint64(len(curLine)))
+					linesRead.Inc()
+					partialLines.Inc()
 					// reset head and bytesInBuffer
 					head = 0
 					bytesInBuffer = 0
@@ -411,11 +707,39 @@ func (l *Logger) Read(
 	}
 }
 
+// traceReporters returns the stages of the log message pipeline which are enabled and report
+// counters along with the routing trace.
+func (l *Logger) traceReporters() []traceReporter {
+	var reporters []traceReporter
+	if l.redactor != nil {
+		reporters = append(reporters, l.redactor)
+	}
+	if l.rateLimiter != nil {
+		reporters = append(reporters, l.rateLimiter)
+	}
+	if l.timestamper != nil {
+		reporters = append(reporters, l.timestamper)
+	}
+	if r, ok := l.Stream.(traceReporter); ok {
+		reporters = append(reporters, r)
+	}
+	return reporters
+}
+
 // startTracingLogRouting will emit logs every 1 minute where it counts how many bytes are read from the source
-// (container pipes) within given interval and how many bytes are sent to the destination (the log driver).
-func startTracingLogRouting(containerID string, stop chan bool) {
+// (container pipes) within given interval and how many bytes are sent to the destination (the log driver). If dropped
+// is not nil, it also reports how many log messages are dropped per source pipe within given interval, and in total
+// when it's stopped.
+func startTracingLogRouting(
+	containerID string,
+	stop chan bool,
+	dropped map[string]*droppedCounters,
+	reporters []traceReporter,
+) {
 	ticker := time.NewTicker(traceLogRoutingInterval)
 	debug.SendEventsToLog(containerID, "Starting the ticker...", debug.DEBUG, 0)
+	// reportedDrops saves the dropped counters reported in the last interval.
+	reportedDrops := make(map[string]droppedCounters, len(dropped))
 	for {
 		select {
 		case <-ticker.C:
@@ -424,23 +748,73 @@ func startTracingLogRouting(containerID string, stop chan bool) {
 			// var. To avoid race conditions between these two, we should use atomic variables.
 			previousBytesReadFromSrc := atomic.SwapUint64(&bytesReadFromSrc, 0)
 			previousBytesSentToDst := atomic.SwapUint64(&bytesSentToDst, 0)
+			previousBytesFiltered := atomic.SwapUint64(&bytesFiltered, 0)
 			previousNumberOfNewLineChars := atomic.SwapUint64(&numberOfNewLineChars, 0)
-			debug.SendEventsToLog(
+			debug.SendEvent(
 				containerID,
 				fmt.Sprintf("Within last minute, reading %d bytes from the source. "+
-					"And %d bytes are sent to the destination and %d new line characters are ignored.",
-					previousBytesReadFromSrc, previousBytesSentToDst, previousNumberOfNewLineChars),
+					"And %d bytes are sent to the destination, %d bytes are filtered out "+
+					"and %d new line characters are ignored.",
+					previousBytesReadFromSrc, previousBytesSentToDst, previousBytesFiltered, previousNumberOfNewLineChars),
 				debug.DEBUG,
-				0)
+				debug.Bytes(previousBytesReadFromSrc),
+				debug.BytesSent(previousBytesSentToDst),
+				debug.BytesFiltered(previousBytesFiltered))
+			for _, source := range []string{sourceSTDOUT, sourceSTDERR} {
+				counters, ok := dropped[source]
+				if !ok {
+					continue
+				}
+				total := droppedCounters{
+					messages: atomic.LoadUint64(&counters.messages),
+					bytes:    atomic.LoadUint64(&counters.bytes),
+				}
+				last := reportedDrops[source]
+				reportedDrops[source] = total
+				if total.messages == last.messages {
+					continue
+				}
+				debug.SendEvent(containerID,
+					fmt.Sprintf("Within last minute, %d messages (%d bytes) from pipe %s are dropped.",
+						total.messages-last.messages, total.bytes-last.bytes, source),
+					debug.INFO,
+					debug.Source(source),
+					debug.Lines(total.messages-last.messages),
+					debug.Bytes(total.bytes-last.bytes))
+			}
+			for _, r := range reporters {
+				r.reportTrace(containerID, false)
+			}
 		case <-stop:
-			debug.SendEventsToLog(containerID,
+			debug.SendEvent(containerID,
 				fmt.Sprintf("Reading %d bytes from the source. "+
-					"And %d bytes are sent to the destination and %d new line characters are ignored.",
+					"And %d bytes are sent to the destination, %d bytes are filtered out "+
+					"and %d new line characters are ignored.",
 					atomic.LoadUint64(&bytesReadFromSrc),
 					atomic.LoadUint64(&bytesSentToDst),
+					atomic.LoadUint64(&bytesFiltered),
 					atomic.LoadUint64(&numberOfNewLineChars),
 				),
-				debug.DEBUG, 0)
+				debug.DEBUG,
+				debug.Bytes(atomic.LoadUint64(&bytesReadFromSrc)),
+				debug.BytesSent(atomic.LoadUint64(&bytesSentToDst)),
+				debug.BytesFiltered(atomic.LoadUint64(&bytesFiltered)))
+			for _, source := range []string{sourceSTDOUT, sourceSTDERR} {
+				counters, ok := dropped[source]
+				if !ok {
+					continue
+				}
+				messages, droppedBytes := atomic.LoadUint64(&counters.messages), atomic.LoadUint64(&counters.bytes)
+				debug.SendEvent(containerID,
+					fmt.Sprintf("In total, %d messages (%d bytes) from pipe %s are dropped.", messages, droppedBytes, source),
+					debug.INFO,
+					debug.Source(source),
+					debug.Lines(messages),
+					debug.Bytes(droppedBytes))
+			}
+			for _, r := range reporters {
+				r.reportTrace(containerID, true)
+			}
 			ticker.Stop()
 			debug.SendEventsToLog(containerID, "Stopped the ticker...", debug.DEBUG, 0)
 			return
@@ -510,13 +884,19 @@ func (l *Logger) sendLogMsgToDest(
 	if isPartialMsg {
 		message.PLogMetaData = &types.PartialLogMetaData{ID: partialID, Ordinal: partialOrdinal, Last: isLastPartial}
 	}
-	err := l.Log(message)
+	var delivered func()
+	if l.wal != nil {
+		delivered = func() { l.wal.ack(source) }
+	}
+	err := l.log(message, delivered)
 	if err != nil {
 		// If we return a non-empty error here, it will cause the goroutine exits. As a result, it won't consume logs from stdout/stderr
 		// and the task container is unable to write logs to stdout/stderr and the application maybe blocked.
-		debug.SendEventsToLog(l.Info.ContainerID,
+		debug.SendEvent(l.Info.ContainerID,
 			fmt.Sprintf("[Pipe %s] Failed to proxy msg to the log driver : %s", source, err),
-			debug.ERROR, 0)
+			debug.ERROR,
+			debug.Source(source),
+			debug.Err(err))
 	}
 
 	return nil
@@ -524,7 +904,40 @@ func (l *Logger) sendLogMsgToDest(
 
 // Log sends logs to destination.
 func (l *Logger) Log(message *dockerlogger.Message) error {
-	return l.Stream.Log(message)
+	return l.log(message, nil)
+}
+
+// logAndWait sends a log message to destination and waits until it's delivered, so that a log
+// message replayed from the write-ahead log is delivered before the write-ahead log is truncated.
+func (l *Logger) logAndWait(message *dockerlogger.Message) error {
+	delivered := make(chan struct{})
+	err := l.log(message, func() { close(delivered) })
+	<-delivered
+	return err
+}
+
+// log sends a log message to destination, and calls delivered once it's delivered, whether or not
+// it fails, if it's set.
+func (l *Logger) log(message *dockerlogger.Message, delivered func()) error {
+	// Parse the log message right before it's sent, so that the attributes are neither saved to
+	// the write-ahead log nor to the ring buffer.
+	if l.jsonParser != nil {
+		l.jsonParser.parse(message)
+	}
+	// The multi client observes the delivery to each of its log drivers, which happens later on.
+	if m, ok := l.Stream.(*multiClient); ok {
+		m.log(message, delivered)
+		return nil
+	}
+	// The log driver may reuse the message once it's logged, so save what's observed beforehand.
+	source, sizeInBytes := message.Source, len(message.Line)
+	start := time.Now()
+	err := l.Stream.Log(message)
+	observeDelivery(l.driverName, source, sizeInBytes, start, err)
+	if delivered != nil {
+		delivered()
+	}
+	return err
 }
 
 // newMessage creates a new logger message.
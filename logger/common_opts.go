@@ -5,6 +5,8 @@ package logger
 
 import (
 	"io"
+	"path/filepath"
+	"time"
 
 	dockerlogger "github.com/docker/docker/daemon/logger"
 )
@@ -14,6 +16,98 @@ import (
 // logger info, stdout and stderr.
 type Opt func(*Logger)
 
+// WithWriteAheadLog sets the directory where every log message read from
+// container pipes is saved, under a sub-directory named by the container ID,
+// until it's delivered. An empty directory disables the write-ahead log.
+func WithWriteAheadLog(dir string) Opt {
+	return func(l *Logger) {
+		l.walDir = dir
+	}
+}
+
+// WithMultiline sets how consecutive log lines read from container pipes
+// are grouped into a single log message, e.g. the lines of a stack trace.
+// Nil arguments disable grouping.
+func WithMultiline(args *MultilineArgs) Opt {
+	return func(l *Logger) {
+		l.multilineArgs = args
+	}
+}
+
+// WithPartialReassembly sets the max size of a log message reassembled from
+// the partial log messages of a log line longer than the buffer. Larger log
+// messages are split, with a continuation marker. 0 disables reassembly, unless
+// log messages are redacted.
+func WithPartialReassembly(maxBytes int) Opt {
+	return func(l *Logger) {
+		l.partialMaxBytes = maxBytes
+	}
+}
+
+// WithMaxBytesPerEvent sets the max size of a log message accepted by the
+// destination, which caps the size of log messages reassembled from partial
+// log messages.
+func WithMaxBytesPerEvent(maxBytes int) Opt {
+	return func(l *Logger) {
+		l.maxBytesPerEvent = maxBytes
+	}
+}
+
+// WithRedaction sets the rules to redact secrets and PII from log messages
+// read from container pipes before they are sent. Nil rules disable redaction.
+func WithRedaction(rules *RedactRules) Opt {
+	return func(l *Logger) {
+		l.redactRules = rules
+	}
+}
+
+// WithFilter sets the rules to filter out log messages read from container
+// pipes before they are sent. Nil rules disable filtering.
+func WithFilter(rules *FilterRules) Opt {
+	return func(l *Logger) {
+		l.filterRules = rules
+	}
+}
+
+// WithDiscardSource sets the container pipe, either stdout or stderr, which
+// log messages are all filtered out. An empty source discards none of them.
+func WithDiscardSource(source string) Opt {
+	return func(l *Logger) {
+		l.discardSource = source
+	}
+}
+
+// WithRateLimit sets how many log messages read from container pipes are
+// sent per second, and what happens to the ones over the rate limit. Nil
+// arguments disable rate limiting.
+func WithRateLimit(args *RateLimitArgs) Opt {
+	return func(l *Logger) {
+		l.rateLimitArgs = args
+	}
+}
+
+// WithJSONParse sets which fields of the log messages which are JSON objects
+// are promoted to message attributes. Nil arguments disable parsing.
+func WithJSONParse(args *JSONParseArgs) Opt {
+	return func(l *Logger) {
+		l.jsonParseArgs = args
+	}
+}
+
+// WithTimestamp sets where the timestamps of log messages come from. Nil
+// arguments or the read-time source stamp log messages with the time they are
+// read.
+func WithTimestamp(args *TimestampArgs) Opt {
+	return func(l *Logger) {
+		l.timestampArgs = args
+	}
+}
+
+// BufferedOpt is a type of function that is used to update the values
+// of fields in the non-blocking mode logger. Fields supported to be
+// modified are the ring buffer settings.
+type BufferedOpt func(*bufferedLogger)
+
 // InfoOpt is a type of function that is used to update the values
 // of fields in logger info for each driver. Field supported to be
 // modified is config.
@@ -63,6 +157,14 @@ func WithStream(stream Client) Opt {
 	}
 }
 
+// WithDriverName sets the name of the log driver the metrics of the stream are
+// labeled with.
+func WithDriverName(name string) Opt {
+	return func(l *Logger) {
+		l.driverName = name
+	}
+}
+
 // WithBufferSizeInBytes sets the buffer size of log driver.
 func WithBufferSizeInBytes(size int) Opt {
 	return func(l *Logger) {
@@ -70,6 +172,14 @@ func WithBufferSizeInBytes(size int) Opt {
 	}
 }
 
+// WithBufferedReadSizeInBytes sets how many bytes the ring buffer of the
+// non-blocking mode reads at a time from the container pipes.
+func WithBufferedReadSizeInBytes(size int) Opt {
+	return func(l *Logger) {
+		l.bufferedReadSizeInBytes = size
+	}
+}
+
 // WithMaxReadBytes sets how many bytes will be read from container
 // pipe per iteration.
 func WithMaxReadBytes(size int) Opt {
@@ -77,3 +187,34 @@ func WithMaxReadBytes(size int) Opt {
 		l.maxReadBytes = size
 	}
 }
+
+// WithOverflowPolicy sets what the ring buffer does with a new log message
+// when it is full. The timeout is only used by the block-with-timeout policy.
+// An empty policy keeps the default drop-newest policy.
+func WithOverflowPolicy(policy string, timeout time.Duration) BufferedOpt {
+	return func(bl *bufferedLogger) {
+		if policy != "" {
+			bl.buffer.overflowPolicy = policy
+		}
+		bl.buffer.overflowTimeout = timeout
+	}
+}
+
+// WithDropMarker sets whether a synthetic log message reporting how many log
+// messages were dropped from the ring buffer is sent to the destination.
+func WithDropMarker(enabled bool) BufferedOpt {
+	return func(bl *bufferedLogger) {
+		bl.buffer.dropMarkerEnabled = enabled
+	}
+}
+
+// WithSpillQueue sets a directory where log messages which don't fit into the
+// ring buffer are saved, in segment files of up to the given segment size and
+// up to the given max size in total. An empty directory disables spilling.
+func WithSpillQueue(dir string, segmentSize, maxSize int) BufferedOpt {
+	return func(bl *bufferedLogger) {
+		if dir != "" {
+			bl.buffer.spill = newSpillQueue(filepath.Join(dir, bl.containerID), segmentSize, maxSize)
+		}
+	}
+}
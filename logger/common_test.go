@@ -18,6 +18,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/containerd/containerd/runtime/v2/logging"
 	dockerlogger "github.com/docker/docker/daemon/logger"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sync/errgroup"
@@ -229,6 +230,46 @@ func TestNewInfo(t *testing.T) {
 	require.Equal(t, config, info.Config)
 }
 
+// TestNewPipelineLogger tests that the log message pipeline is set up from the global arguments,
+// that the options of the log driver override it, and that the ring buffer is used in non-blocking
+// mode, with the read size of the log driver if it has one.
+func TestNewPipelineLogger(t *testing.T) {
+	globalArgs := &GlobalArgs{
+		ContainerID:               testContainerID,
+		LogDriver:                 "awslogs",
+		PartialReassemblyMaxBytes: 1024,
+		DiscardStreams:            map[string]string{"awslogs": sourceSTDERR},
+	}
+	info := NewInfo(testContainerID, testContainerName)
+	l, err := NewPipelineLogger(globalArgs, &logging.Config{}, info, &dummyClient{},
+		WithMaxBytesPerEvent(512), WithBufferSizeInBytes(512))
+	require.NoError(t, err)
+	inner, ok := l.(*Logger)
+	require.True(t, ok)
+	require.Equal(t, info, inner.Info)
+	require.Equal(t, "awslogs", inner.driverName)
+	require.Equal(t, 512, inner.bufferSizeInBytes)
+	require.Equal(t, 512, inner.partialMaxBytes)
+	require.NotNil(t, inner.filter)
+
+	globalArgs.Mode = NonBlockingMode
+	l, err = NewPipelineLogger(globalArgs, &logging.Config{}, info, &dummyClient{}, WithBufferSizeInBytes(512))
+	require.NoError(t, err)
+	bl, ok := l.(*bufferedLogger)
+	require.True(t, ok)
+	require.Equal(t, 512, bl.bufReadSizeInBytes)
+
+	l, err = NewPipelineLogger(globalArgs, &logging.Config{}, info, &dummyClient{},
+		WithBufferSizeInBytes(512), WithBufferedReadSizeInBytes(1024))
+	require.NoError(t, err)
+	bl, ok = l.(*bufferedLogger)
+	require.True(t, ok)
+	require.Equal(t, 1024, bl.bufReadSizeInBytes)
+	inner, ok = bl.l.(*Logger)
+	require.True(t, ok)
+	require.Equal(t, 512, inner.bufferSizeInBytes)
+}
+
 // TestPipeNotBroken verified the pipe will NOT be broken even if sometimes the call
 // to the log driver fails.
 func TestPipeNotBroken(t *testing.T) {
@@ -0,0 +1,124 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// Filter actions.
+const (
+	// IncludeFilterAction keeps the log lines matching the rule.
+	IncludeFilterAction = "include"
+	// ExcludeFilterAction filters out the log lines matching the rule.
+	ExcludeFilterAction = "exclude"
+)
+
+// FilterRules are the rules to filter out log lines before they are sent.
+type FilterRules struct {
+	// Rules are checked in order, and the first one matching a log line decides whether it's
+	// kept. A log line matching no rule is kept, unless an include rule applies to its source.
+	Rules []FilterRule `json:"rules"`
+}
+
+// FilterRule keeps or filters out the log lines matching a regular expression.
+type FilterRule struct {
+	// Action is either include or exclude.
+	Action string `json:"action"`
+	// Pattern is the regular expression log lines are matched against.
+	Pattern string `json:"pattern"`
+	// Source is either stdout or stderr if the rule only applies to the log lines of one of them,
+	// or empty if it applies to both.
+	Source string `json:"source,omitempty"`
+}
+
+// filter decides whether a log line read from a container pipe is sent.
+type filter struct {
+	rules []*filterRule
+	// discardSource is the container pipe which log lines are all filtered out, if it's set.
+	discardSource string
+	// includeSources are the container pipes which an include rule applies to, so that the log
+	// lines matching no rule are filtered out.
+	includeSources map[string]bool
+}
+
+// filterRule is a compiled filter rule.
+type filterRule struct {
+	include bool
+	pattern *regexp.Regexp
+	source  string
+}
+
+// newFilter validates the filter rules and the discarded source, and compiles them.
+func newFilter(rules *FilterRules, discardSource string) (*filter, error) {
+	if err := validateSource(discardSource); err != nil {
+		return nil, fmt.Errorf("invalid discarded source: %w", err)
+	}
+	f := &filter{
+		discardSource:  discardSource,
+		includeSources: make(map[string]bool),
+	}
+	if rules == nil {
+		return f, nil
+	}
+	if len(rules.Rules) == 0 {
+		return nil, errors.New("at least one filter rule is required")
+	}
+	for i, rule := range rules.Rules {
+		if err := validateSource(rule.Source); err != nil {
+			return nil, fmt.Errorf("filter rule %d: %w", i, err)
+		}
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("filter rule %d has no pattern", i)
+		}
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter pattern %s: %w", rule.Pattern, err)
+		}
+		compiled := &filterRule{pattern: pattern, source: rule.Source}
+		switch rule.Action {
+		case IncludeFilterAction:
+			compiled.include = true
+			if rule.Source == "" {
+				f.includeSources[sourceSTDOUT] = true
+				f.includeSources[sourceSTDERR] = true
+			} else {
+				f.includeSources[rule.Source] = true
+			}
+		case ExcludeFilterAction:
+		default:
+			return nil, fmt.Errorf("unknown filter action of rule %d: %s", i, rule.Action)
+		}
+		f.rules = append(f.rules, compiled)
+	}
+	return f, nil
+}
+
+// validateSource returns an error if the source is set but is neither stdout nor stderr.
+func validateSource(source string) error {
+	switch source {
+	case "", sourceSTDOUT, sourceSTDERR:
+		return nil
+	default:
+		return fmt.Errorf("unknown source %s, expected %s or %s", source, sourceSTDOUT, sourceSTDERR)
+	}
+}
+
+// keep returns whether the log line read from the source is sent.
+func (f *filter) keep(source string, line []byte) bool {
+	if source == f.discardSource {
+		return false
+	}
+	for _, rule := range f.rules {
+		if rule.source != "" && rule.source != source {
+			continue
+		}
+		if rule.pattern.Match(line) {
+			return rule.include
+		}
+	}
+	return !f.includeSources[source]
+}
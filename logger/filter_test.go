@@ -0,0 +1,112 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package logger
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestFilterRules tests that the first rule matching a log line decides whether it's kept, and that
+// the log lines matching no rule are filtered out if an include rule applies to their source.
+func TestFilterRules(t *testing.T) {
+	f, err := newFilter(&FilterRules{Rules: []FilterRule{
+		{Action: ExcludeFilterAction, Pattern: "GET /health"},
+		{Action: IncludeFilterAction, Pattern: "ERROR|WARN", Source: sourceSTDERR},
+		{Action: ExcludeFilterAction, Pattern: "^DEBUG", Source: sourceSTDOUT},
+	}}, "")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		source   string
+		line     string
+		expected bool
+	}{
+		{source: sourceSTDOUT, line: "INFO GET /health 200", expected: false},
+		{source: sourceSTDERR, line: "ERROR GET /health 500", expected: false},
+		{source: sourceSTDOUT, line: "DEBUG cache miss", expected: false},
+		{source: sourceSTDOUT, line: "INFO started", expected: true},
+		{source: sourceSTDERR, line: "WARN slow request", expected: true},
+		{source: sourceSTDERR, line: "DEBUG cache miss", expected: false},
+	} {
+		require.Equal(t, tc.expected, f.keep(tc.source, []byte(tc.line)), "%s: %s", tc.source, tc.line)
+	}
+}
+
+// TestFilterDiscardSource tests that all the log lines of the discarded source are filtered out,
+// along with every partial log message of a filtered out log line, and that filtered out bytes
+// aren't counted as sent.
+func TestFilterDiscardSource(t *testing.T) {
+	stream := &fanOutRecorder{}
+	l, err := NewLogger(
+		WithInfo(NewInfo(testContainerID, testContainerName)),
+		WithStream(stream),
+		WithFilter(&FilterRules{Rules: []FilterRule{{Action: ExcludeFilterAction, Pattern: "^skip"}}}),
+		WithDiscardSource(sourceSTDOUT),
+		WithMaxReadBytes(4),
+	)
+	require.NoError(t, err)
+	inner, ok := l.(*Logger)
+	require.True(t, ok)
+	atomic.StoreUint64(&bytesSentToDst, 0)
+	atomic.StoreUint64(&bytesFiltered, 0)
+
+	pipe := strings.NewReader("skip this long line\nkeep\n")
+	require.NoError(t, l.Read(context.Background(), pipe, sourceSTDERR, 8, inner.sendLogMsgToDest))
+	require.Equal(t, []string{"keep"}, stream.lines())
+	require.Equal(t, uint64(len("keep")), atomic.LoadUint64(&bytesSentToDst))
+	require.Equal(t, uint64(len("skip this long line")), atomic.LoadUint64(&bytesFiltered))
+
+	sent := &sentMessages{}
+	require.NoError(t, l.Read(context.Background(), strings.NewReader("keep\n"), sourceSTDOUT, 8, sent.send))
+	require.Empty(t, sent.get())
+}
+
+// TestFilterMultiClient tests that a log driver discarding a source doesn't get its log messages,
+// and that a source is only discarded before the log messages are fanned out if all the log
+// drivers discard it.
+func TestFilterMultiClient(t *testing.T) {
+	all, errorsOnly := &fanOutRecorder{}, &fanOutRecorder{}
+	globalArgs := &GlobalArgs{DiscardStreams: map[string]string{"splunk": sourceSTDOUT}}
+	streams := []*MultiStream{
+		{DriverName: "awslogs", New: func() (Client, error) { return all, nil }},
+		{DriverName: "splunk", New: func() (Client, error) { return errorsOnly, nil }},
+	}
+	m, err := newMultiClient(globalArgs, streams)
+	require.NoError(t, err)
+	m.start()
+	require.NoError(t, m.Log(newMessage([]byte("out"), sourceSTDOUT, dummyTime)))
+	require.NoError(t, m.Log(newMessage([]byte("err"), sourceSTDERR, dummyTime)))
+	m.close()
+	require.Equal(t, []string{"out", "err"}, all.lines())
+	require.Equal(t, []string{"err"}, errorsOnly.lines())
+
+	require.Empty(t, InitMultiLogger(globalArgs, streams).discardSource())
+	globalArgs.DiscardStreams["awslogs"] = sourceSTDOUT
+	require.Equal(t, sourceSTDOUT, InitMultiLogger(globalArgs, streams).discardSource())
+}
+
+// TestNewFilterWithError tests that invalid filter rules are rejected.
+func TestNewFilterWithError(t *testing.T) {
+	for name, opt := range map[string]Opt{
+		"no rule":          WithFilter(&FilterRules{}),
+		"no pattern":       WithFilter(&FilterRules{Rules: []FilterRule{{Action: IncludeFilterAction}}}),
+		"invalid pattern":  WithFilter(&FilterRules{Rules: []FilterRule{{Action: IncludeFilterAction, Pattern: "("}}}),
+		"unknown action":   WithFilter(&FilterRules{Rules: []FilterRule{{Action: "drop", Pattern: "."}}}),
+		"unknown source":   WithFilter(&FilterRules{Rules: []FilterRule{{Action: IncludeFilterAction, Pattern: ".", Source: "stdin"}}}),
+		"discarded source": WithDiscardSource("stdin"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewLogger(opt)
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package firehose
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+const (
+	// maxBatchRecords is the max number of records of a PutRecordBatch or PutRecords request.
+	maxBatchRecords = 500
+	// maxBatchBytes is the max size of the records of a PutRecordBatch request, which is lower
+	// than the one of a PutRecords request.
+	maxBatchBytes = 4 * 1024 * 1024
+	// flushInterval is how long the first record of a batch waits before the batch is sent, if
+	// there are not enough records to fill it.
+	flushInterval = 1 * time.Second
+	// putTimeout bounds how long a single request takes, including the retries of the SDK.
+	putTimeout = 30 * time.Second
+	// maxPutAttempts is the max number of attempts to send the records of a batch which failed
+	// to be sent.
+	maxPutAttempts = 3
+	// initialRetryBackoff is how long to wait before sending the failed records again, which is
+	// doubled after every attempt.
+	initialRetryBackoff = 1 * time.Second
+)
+
+// putter sends a batch of records to the stream.
+type putter interface {
+	// putRecords sends the records, and returns the indexes of the ones which failed to be sent
+	// along with an error. The indexes are nil if the whole request failed.
+	putRecords(ctx context.Context, records [][]byte) ([]int, error)
+}
+
+// record is a log message as it's sent to the stream, as a line of JSON.
+type record struct {
+	ContainerID   string    `json:"container_id"`
+	ContainerName string    `json:"container_name"`
+	Source        string    `json:"source"`
+	Log           string    `json:"log"`
+	Time          time.Time `json:"time"`
+}
+
+// client converts log messages to records, and sends them in batches in the background.
+type client struct {
+	containerID   string
+	containerName string
+	putter        putter
+	batcher       *logger.Batcher[[]byte]
+}
+
+// newClient creates a client sending the records of the container with the given putter.
+func newClient(driverName string, globalArgs *logger.GlobalArgs, p putter) *client {
+	c := &client{
+		containerID:   globalArgs.ContainerID,
+		containerName: globalArgs.ContainerName,
+		putter:        p,
+	}
+	c.batcher = logger.NewBatcher(&logger.BatcherConfig[[]byte]{
+		DriverName:     driverName,
+		Items:          "records",
+		QueueSize:      maxBatchRecords,
+		MaxItems:       maxBatchRecords,
+		MaxBytes:       maxBatchBytes,
+		Size:           func(data []byte) int { return len(data) },
+		Wait:           flushInterval,
+		Send:           c.put,
+		Timeout:        putTimeout,
+		MaxAttempts:    maxPutAttempts,
+		InitialBackoff: initialRetryBackoff,
+	})
+
+	return c
+}
+
+// Log converts a log message to a record and queues it to be sent. It blocks if the queue is full.
+func (c *client) Log(msg *dockerlogger.Message) error {
+	data, err := json.Marshal(&record{
+		ContainerID:   c.containerID,
+		ContainerName: c.containerName,
+		Source:        msg.Source,
+		Log:           string(msg.Line),
+		Time:          msg.Timestamp,
+	})
+	dockerlogger.PutMessage(msg)
+	if err != nil {
+		return fmt.Errorf("unable to encode log message: %w", err)
+	}
+	// Records are separated by new lines, so that they can be told apart once Firehose
+	// concatenates them in the destination.
+	data = append(data, '\n')
+	return c.batcher.Add(data)
+}
+
+// Close sends the records which are not sent yet.
+func (c *client) Close() error {
+	c.batcher.Close()
+	return nil
+}
+
+// put sends a batch of records. Only the records which failed to be sent are sent again by the
+// batcher, so that the other ones are not duplicated in the stream, or all of them if the whole
+// request failed.
+func (c *client) put(ctx context.Context, records [][]byte) ([][]byte, error) {
+	failed, err := c.putter.putRecords(ctx, records)
+	if err == nil {
+		return nil, nil
+	}
+	if failed == nil {
+		return nil, &logger.RetryableError{Err: err}
+	}
+	retry := make([][]byte, 0, len(failed))
+	for _, i := range failed {
+		retry = append(retry, records[i])
+	}
+	return retry, err
+}
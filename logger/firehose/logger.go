@@ -0,0 +1,165 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package firehose provides log drivers sending container logs in batches to either an Amazon
+// Data Firehose delivery stream, or an Amazon Kinesis Data Streams stream, without a FireLens
+// sidecar.
+package firehose
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containerd/containerd/runtime/v2/logging"
+
+	"github.com/aws/shim-loggers-for-containerd/debug"
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+// firehose and kinesis driver argument keys.
+const (
+	// DriverName is the name of the log driver sending logs to Amazon Data Firehose.
+	DriverName = "firehose"
+	// KinesisDriverName is the name of the log driver sending logs to Amazon Kinesis Data Streams.
+	KinesisDriverName = "kinesis"
+
+	// DeliveryStreamKey is the name of the Firehose delivery stream.
+	DeliveryStreamKey = "firehose-delivery-stream"
+	// RegionKey is the AWS region of the Firehose delivery stream.
+	RegionKey = "firehose-region"
+	// EndpointKey overrides the Firehose endpoint, e.g. for a local stand-in.
+	EndpointKey = "firehose-endpoint"
+	// CredentialsEndpointKey is the path of the credentials endpoint on the ECS agent, in the
+	// same way as awslogs-credentials-endpoint.
+	CredentialsEndpointKey = "firehose-credentials-endpoint" //nolint:gosec // not credentials
+
+	// KinesisStreamKey is the name of the Kinesis data stream.
+	KinesisStreamKey = "kinesis-stream"
+	// KinesisRegionKey is the AWS region of the Kinesis data stream.
+	KinesisRegionKey = "kinesis-region"
+	// KinesisEndpointKey overrides the Kinesis endpoint, e.g. for a local stand-in.
+	KinesisEndpointKey = "kinesis-endpoint"
+	// KinesisCredentialsEndpointKey is the path of the credentials endpoint on the ECS agent, in
+	// the same way as awslogs-credentials-endpoint.
+	KinesisCredentialsEndpointKey = "kinesis-credentials-endpoint" //nolint:gosec // not credentials
+	// KinesisPartitionKeyKey is the partition key of the records, which defaults to the
+	// container ID so that the logs of a container stay in order within a shard.
+	KinesisPartitionKeyKey = "kinesis-partition-key"
+)
+
+const (
+	// maxRecordBytes is the max size of a record of both Firehose and Kinesis Data Streams.
+	maxRecordBytes = 1000 * 1024
+	// recordOverheadBytes leaves room in a record for its fields other than the log line.
+	recordOverheadBytes = 1024
+	// MaximumBytesPerEvent is the max size of a log line sent as a record.
+	MaximumBytesPerEvent = maxRecordBytes - recordOverheadBytes
+)
+
+// Args represents firehose and kinesis log driver arguments.
+type Args struct {
+	// Required arguments.
+	Stream string
+	Region string
+
+	// Optional arguments.
+	Endpoint            string
+	CredentialsEndpoint string
+	// PartitionKey is only used by the kinesis log driver.
+	PartitionKey string
+}
+
+// LoggerArgs stores global logger args, the name of the log driver and its specific args.
+type LoggerArgs struct {
+	globalArgs *logger.GlobalArgs
+	driverName string
+	args       *Args
+}
+
+// InitLogger initializes the input arguments of the firehose log driver.
+func InitLogger(globalArgs *logger.GlobalArgs, firehoseArgs *Args) *LoggerArgs {
+	return &LoggerArgs{
+		globalArgs: globalArgs,
+		driverName: DriverName,
+		args:       firehoseArgs,
+	}
+}
+
+// InitKinesisLogger initializes the input arguments of the kinesis log driver.
+func InitKinesisLogger(globalArgs *logger.GlobalArgs, kinesisArgs *Args) *LoggerArgs {
+	return &LoggerArgs{
+		globalArgs: globalArgs,
+		driverName: KinesisDriverName,
+		args:       kinesisArgs,
+	}
+}
+
+// RunLogDriver initiates the firehose or kinesis driver and starts sending container logs to the
+// stream. Errors with the log driver are logged but not returned to prevent container termination.
+func (la *LoggerArgs) RunLogDriver(ctx context.Context, config *logging.Config, ready func() error) error {
+	defer debug.DeferFuncForRunLogDriver()
+
+	stream, err := la.newStream(ctx)
+	if err != nil {
+		debug.ErrLogger = err
+		return debug.ErrLogger
+	}
+	// Send the records which are not sent yet before exiting.
+	defer stream.Close() //nolint:errcheck // errors are already logged
+
+	l, err := logger.NewPipelineLogger(la.globalArgs, config,
+		logger.NewInfo(la.globalArgs.ContainerID, la.globalArgs.ContainerName), stream,
+		logger.WithMaxBytesPerEvent(MaximumBytesPerEvent))
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("unable to create %s driver: %w", la.driverName, err)
+		return debug.ErrLogger
+	}
+
+	debug.SendEventsToLog(logger.DaemonName, "Starting "+la.driverName+" driver", debug.INFO, 0)
+	err = l.Start(ctx, la.globalArgs.CleanupTime, ready)
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("failed to run %s driver: %w", la.driverName, err)
+		// Do not return error if log driver has issue sending logs to destination, because if error
+		// returned here, containerd will identify this error and kill shim process, which will kill
+		// the container process accordingly.
+		// Note: the container will continue to run if shim logger exits after.
+		// Reference: https://github.com/containerd/containerd/blob/release/1.3/runtime/v2/logging/logging.go
+		return nil
+	}
+	debug.SendEventsToLog(logger.DaemonName, "Logging finished", debug.INFO, 1)
+
+	return nil
+}
+
+// NewStream creates the firehose or kinesis stream, which is used when fanning out to multiple
+// log drivers.
+func (la *LoggerArgs) NewStream() (logger.Client, error) {
+	stream, err := la.newStream(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// newStream creates the client of the AWS service and the stream sending records with it.
+func (la *LoggerArgs) newStream(ctx context.Context) (*client, error) {
+	var (
+		p   putter
+		err error
+	)
+	switch la.driverName {
+	case KinesisDriverName:
+		partitionKey := la.args.PartitionKey
+		if partitionKey == "" {
+			partitionKey = la.globalArgs.ContainerID
+		}
+		p, err = newKinesisPutter(ctx, la.args, partitionKey)
+	default:
+		p, err = newFirehosePutter(ctx, la.args)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to create stream: %w", err)
+	}
+
+	return newClient(la.driverName, la.globalArgs, p), nil
+}
@@ -0,0 +1,83 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package firehose
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+const (
+	testContainerID   = "test-container-id"
+	testContainerName = "test-container-name"
+	testStream        = "test-stream"
+	testRegion        = "us-west-2"
+)
+
+// fakePutter records the batches it's given, and fails the records which are listed in fail on
+// the first attempt.
+type fakePutter struct {
+	lock    sync.Mutex
+	batches [][][]byte
+	fail    []int
+}
+
+func (p *fakePutter) putRecords(_ context.Context, records [][]byte) ([]int, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.batches = append(p.batches, records)
+	if len(p.batches) == 1 && len(p.fail) > 0 {
+		return p.fail, errors.New("throttled")
+	}
+	return nil, nil
+}
+
+// TestClientRetriesFailedRecords tests that only the records which failed to be sent are sent
+// again.
+func TestClientRetriesFailedRecords(t *testing.T) {
+	p := &fakePutter{fail: []int{1}}
+	c := newClient(DriverName, &logger.GlobalArgs{
+		ContainerID:   testContainerID,
+		ContainerName: testContainerName,
+	}, p)
+
+	timestamp := time.Date(2020, time.January, 14, 1, 59, 0, 0, time.UTC)
+	for _, line := range []string{"first", "second", "third"} {
+		msg := dockerlogger.NewMessage()
+		msg.Line = append(msg.Line, line...)
+		msg.Source = "stdout"
+		msg.Timestamp = timestamp
+		require.NoError(t, c.Log(msg))
+	}
+	require.NoError(t, c.Close())
+	require.ErrorIs(t, c.Log(dockerlogger.NewMessage()), logger.ErrBatcherClosed)
+
+	require.Len(t, p.batches, 2)
+	require.Len(t, p.batches[0], 3)
+	require.Len(t, p.batches[1], 1)
+	require.Equal(t, p.batches[0][1], p.batches[1][0])
+
+	var r record
+	require.Equal(t, byte('\n'), p.batches[1][0][len(p.batches[1][0])-1])
+	require.NoError(t, json.Unmarshal(p.batches[1][0], &r))
+	require.Equal(t, record{
+		ContainerID:   testContainerID,
+		ContainerName: testContainerName,
+		Source:        "stdout",
+		Log:           "second",
+		Time:          timestamp,
+	}, r)
+}
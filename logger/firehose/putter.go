@@ -0,0 +1,157 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !no_firehose
+
+package firehose
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/endpointcreds"
+	"github.com/aws/aws-sdk-go-v2/service/firehose"
+	firehosetypes "github.com/aws/aws-sdk-go-v2/service/firehose/types"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	kinesistypes "github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+// credentialsEndpointHost is the host of the credentials endpoint on the ECS agent, in the same
+// way as the moby awslogs log driver.
+const credentialsEndpointHost = "http://169.254.170.2"
+
+// newAWSConfig loads the AWS config of the stream in the same way as the moby awslogs log
+// driver, i.e. with the credentials served by the ECS agent if the credentials endpoint is set,
+// or with the default credentials chain otherwise.
+func newAWSConfig(ctx context.Context, args *Args) (aws.Config, error) {
+	opts := []func(*config.LoadOptions) error{config.WithRegion(args.Region)}
+	if args.CredentialsEndpoint != "" {
+		provider := endpointcreds.New(credentialsEndpointHost + args.CredentialsEndpoint)
+		opts = append(opts, config.WithCredentialsProvider(aws.NewCredentialsCache(provider)))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("unable to load AWS config: %w", err)
+	}
+	return cfg, nil
+}
+
+// firehosePutter sends records to a Firehose delivery stream with PutRecordBatch.
+type firehosePutter struct {
+	client         *firehose.Client
+	deliveryStream string
+}
+
+func newFirehosePutter(ctx context.Context, args *Args) (*firehosePutter, error) {
+	cfg, err := newAWSConfig(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return &firehosePutter{
+		client: firehose.NewFromConfig(cfg, func(o *firehose.Options) {
+			if args.Endpoint != "" {
+				o.BaseEndpoint = aws.String(args.Endpoint)
+			}
+		}),
+		deliveryStream: args.Stream,
+	}, nil
+}
+
+func (p *firehosePutter) putRecords(ctx context.Context, records [][]byte) ([]int, error) {
+	input := &firehose.PutRecordBatchInput{
+		DeliveryStreamName: aws.String(p.deliveryStream),
+		Records:            make([]firehosetypes.Record, 0, len(records)),
+	}
+	for _, data := range records {
+		input.Records = append(input.Records, firehosetypes.Record{Data: data})
+	}
+	output, err := p.client.PutRecordBatch(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("unable to put records to delivery stream %s: %w", p.deliveryStream, err)
+	}
+	if aws.ToInt32(output.FailedPutCount) == 0 {
+		return nil, nil
+	}
+
+	failed, err := failedRecords(len(output.RequestResponses), func(i int) (*string, *string) {
+		return output.RequestResponses[i].ErrorCode, output.RequestResponses[i].ErrorMessage
+	})
+	if err != nil {
+		return failed, fmt.Errorf("%d records failed to be put to delivery stream %s: %w",
+			len(failed), p.deliveryStream, err)
+	}
+	return nil, nil
+}
+
+// kinesisPutter sends records to a Kinesis data stream with PutRecords.
+type kinesisPutter struct {
+	client       *kinesis.Client
+	stream       string
+	partitionKey string
+}
+
+func newKinesisPutter(ctx context.Context, args *Args, partitionKey string) (*kinesisPutter, error) {
+	cfg, err := newAWSConfig(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return &kinesisPutter{
+		client: kinesis.NewFromConfig(cfg, func(o *kinesis.Options) {
+			if args.Endpoint != "" {
+				o.BaseEndpoint = aws.String(args.Endpoint)
+			}
+		}),
+		stream:       args.Stream,
+		partitionKey: partitionKey,
+	}, nil
+}
+
+func (p *kinesisPutter) putRecords(ctx context.Context, records [][]byte) ([]int, error) {
+	input := &kinesis.PutRecordsInput{
+		StreamName: aws.String(p.stream),
+		Records:    make([]kinesistypes.PutRecordsRequestEntry, 0, len(records)),
+	}
+	for _, data := range records {
+		input.Records = append(input.Records, kinesistypes.PutRecordsRequestEntry{
+			Data:         data,
+			PartitionKey: aws.String(p.partitionKey),
+		})
+	}
+	output, err := p.client.PutRecords(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("unable to put records to stream %s: %w", p.stream, err)
+	}
+	if aws.ToInt32(output.FailedRecordCount) == 0 {
+		return nil, nil
+	}
+
+	failed, err := failedRecords(len(output.Records), func(i int) (*string, *string) {
+		return output.Records[i].ErrorCode, output.Records[i].ErrorMessage
+	})
+	if err != nil {
+		return failed, fmt.Errorf("%d records failed to be put to stream %s: %w", len(failed), p.stream, err)
+	}
+	return nil, nil
+}
+
+// failedRecords returns the indexes of the records of a response which have an error code, along
+// with the error of the first one. Both are nil if no record has an error code.
+func failedRecords(n int, entry func(i int) (errorCode, errorMessage *string)) ([]int, error) {
+	var (
+		failed   []int
+		firstErr error
+	)
+	for i := 0; i < n; i++ {
+		code, message := entry(i)
+		if code == nil {
+			continue
+		}
+		failed = append(failed, i)
+		if firstErr == nil {
+			firstErr = fmt.Errorf("%s: %s", aws.ToString(code), aws.ToString(message))
+		}
+	}
+	return failed, firstErr
+}
@@ -0,0 +1,25 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build no_firehose
+
+package firehose
+
+import (
+	"context"
+	"errors"
+)
+
+// errNotBuilt is returned when the shim logger is built without the AWS SDK clients of
+// Firehose and Kinesis.
+var errNotBuilt = errors.New("the firehose and kinesis drivers are not built in this shim logger")
+
+// newFirehosePutter fails, since the shim logger is built with the no_firehose build tag.
+func newFirehosePutter(_ context.Context, _ *Args) (putter, error) {
+	return nil, errNotBuilt
+}
+
+// newKinesisPutter fails, since the shim logger is built with the no_firehose build tag.
+func newKinesisPutter(_ context.Context, _ *Args, _ string) (putter, error) {
+	return nil, errNotBuilt
+}
@@ -0,0 +1,98 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit && !no_firehose
+// +build unit,!no_firehose
+
+package firehose
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// setTestCredentials sets static AWS credentials, so that the ones of the host are not used.
+func setTestCredentials(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_ACCESS_KEY_ID", "test-access-key-id")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test-secret-access-key")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+}
+
+// newFakeEndpoint creates a server answering requests of the given target with the response,
+// and records the requests.
+func newFakeEndpoint(t *testing.T, target string, response string) (*httptest.Server, *[]map[string]any) {
+	var requests []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, target, r.Header.Get("X-Amz-Target"))
+		var req map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, req)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		_, _ = w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// TestFirehosePutter tests that records are sent with PutRecordBatch, and that the records
+// which failed to be put are returned.
+func TestFirehosePutter(t *testing.T) {
+	setTestCredentials(t)
+	server, requests := newFakeEndpoint(t, "Firehose_20150804.PutRecordBatch", `{
+		"FailedPutCount": 1,
+		"RequestResponses": [
+			{"RecordId": "1"},
+			{"ErrorCode": "ServiceUnavailableException", "ErrorMessage": "Slow down."}
+		]
+	}`)
+
+	p, err := newFirehosePutter(context.Background(), &Args{
+		Stream:   testStream,
+		Region:   testRegion,
+		Endpoint: server.URL,
+	})
+	require.NoError(t, err)
+	failed, err := p.putRecords(context.Background(), [][]byte{[]byte("first\n"), []byte("second\n")})
+	require.ErrorContains(t, err, "ServiceUnavailableException: Slow down.")
+	require.Equal(t, []int{1}, failed)
+
+	require.Len(t, *requests, 1)
+	require.Equal(t, testStream, (*requests)[0]["DeliveryStreamName"])
+	require.Equal(t, []any{
+		map[string]any{"Data": "Zmlyc3QK"},
+		map[string]any{"Data": "c2Vjb25kCg=="},
+	}, (*requests)[0]["Records"])
+}
+
+// TestKinesisPutter tests that records are sent with PutRecords along with the partition key.
+func TestKinesisPutter(t *testing.T) {
+	setTestCredentials(t)
+	server, requests := newFakeEndpoint(t, "Kinesis_20131202.PutRecords", `{
+		"FailedRecordCount": 0,
+		"Records": [{"SequenceNumber": "1", "ShardId": "shardId-000000000000"}]
+	}`)
+
+	p, err := newKinesisPutter(context.Background(), &Args{
+		Stream:   testStream,
+		Region:   testRegion,
+		Endpoint: server.URL,
+	}, testContainerID)
+	require.NoError(t, err)
+	failed, err := p.putRecords(context.Background(), [][]byte{[]byte("first\n")})
+	require.NoError(t, err)
+	require.Nil(t, failed)
+
+	require.Len(t, *requests, 1)
+	require.Equal(t, testStream, (*requests)[0]["StreamName"])
+	require.Equal(t, []any{
+		map[string]any{"Data": "Zmlyc3QK", "PartitionKey": testContainerID},
+	}, (*requests)[0]["Records"])
+}
@@ -0,0 +1,235 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package fluentd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/docker/docker/daemon/logger/loggerutils"
+	units "github.com/docker/go-units"
+	"github.com/fluent/fluent-logger-golang/fluent"
+)
+
+// The defaults, limits and log options of moby's fluentd driver which the shim logger doesn't
+// have arguments for.
+const (
+	defaultBufferLimit = 1024 * 1024
+	defaultHost        = "127.0.0.1"
+	defaultPort        = 24224
+	defaultProtocol    = "tcp"
+	defaultMaxRetries  = math.MaxInt32
+	defaultRetryWait   = 1000
+
+	minReconnectInterval = 100 * time.Millisecond
+	maxReconnectInterval = 10 * time.Second
+
+	asyncReconnectIntervalKey = "fluentd-async-reconnect-interval"
+	maxRetriesKey             = "fluentd-max-retries"
+	requestAckKey             = "fluentd-request-ack"
+	retryWaitKey              = "fluentd-retry-wait"
+)
+
+// structuredStream sends log messages to fluentd as records like moby's fluentd driver, except
+// that a log line which is a JSON object is sent as an object in the `log` field rather than as
+// a string, and the attributes of every log message, such as the fields promoted from JSON log
+// lines, are sent as fields of the record.
+type structuredStream struct {
+	tag           string
+	containerID   string
+	containerName string
+	writer        *fluent.Fluent
+	extra         map[string]string
+}
+
+// newStructuredStream creates the structured stream from the validated log options of the info.
+func newStructuredStream(info *dockerlogger.Info) (*structuredStream, error) {
+	config, err := getFluentConfig(info.Config)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := loggerutils.ParseLogTag(*info, loggerutils.DefaultTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse tag: %w", err)
+	}
+	extra, err := info.ExtraAttributes(nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get extra attributes: %w", err)
+	}
+	writer, err := fluent.New(config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create fluentd client: %w", err)
+	}
+	return &structuredStream{
+		tag:           tag,
+		containerID:   info.ContainerID,
+		containerName: info.ContainerName,
+		writer:        writer,
+		extra:         extra,
+	}, nil
+}
+
+// Log sends a log message to fluentd.
+func (s *structuredStream) Log(msg *dockerlogger.Message) error {
+	record := make(map[string]interface{}, len(s.extra)+len(msg.Attrs)+4)
+	for k, v := range s.extra {
+		record[k] = v
+	}
+	for _, attr := range msg.Attrs {
+		record[attr.Key] = attr.Value
+	}
+	record["container_id"] = s.containerID
+	record["container_name"] = s.containerName
+	record["source"] = msg.Source
+	record["log"] = string(msg.Line)
+	if msg.PLogMetaData != nil {
+		record["partial_message"] = "true"
+		record["partial_id"] = msg.PLogMetaData.ID
+		record["partial_ordinal"] = strconv.Itoa(msg.PLogMetaData.Ordinal)
+		record["partial_last"] = strconv.FormatBool(msg.PLogMetaData.Last)
+	} else if line := bytes.TrimSpace(msg.Line); len(line) > 0 && line[0] == '{' {
+		var object map[string]interface{}
+		if err := json.Unmarshal(line, &object); err == nil {
+			record["log"] = object
+		}
+	}
+
+	timestamp := msg.Timestamp
+	dockerlogger.PutMessage(msg)
+	return s.writer.PostWithTime(s.tag, timestamp, record)
+}
+
+// Name returns the name of the log driver.
+func (s *structuredStream) Name() string {
+	return DriverName
+}
+
+// Close flushes the records left and closes the connection to fluentd.
+func (s *structuredStream) Close() error {
+	return s.writer.Close()
+}
+
+// getFluentConfig gets the fluentd client config from the validated log options, the same way as
+// moby's fluentd driver.
+func getFluentConfig(config map[string]string) (fluent.Config, error) {
+	fluentConfig := fluent.Config{
+		FluentNetwork: defaultProtocol,
+		FluentHost:    defaultHost,
+		FluentPort:    defaultPort,
+		BufferLimit:   defaultBufferLimit,
+		RetryWait:     defaultRetryWait,
+		MaxRetry:      defaultMaxRetries,
+	}
+	if err := parseFluentAddress(config[AddressKey], &fluentConfig); err != nil {
+		return fluentConfig, fmt.Errorf("invalid %s %s: %w", AddressKey, config[AddressKey], err)
+	}
+	if bufferLimit := config[BufferLimitKey]; bufferLimit != "" {
+		limit, err := units.RAMInBytes(bufferLimit)
+		if err != nil {
+			return fluentConfig, fmt.Errorf("unable to parse %s: %w", BufferLimitKey, err)
+		}
+		fluentConfig.BufferLimit = int(limit)
+	}
+	if retryWait := config[retryWaitKey]; retryWait != "" {
+		wait, err := time.ParseDuration(retryWait)
+		if err != nil {
+			return fluentConfig, fmt.Errorf("unable to parse %s: %w", retryWaitKey, err)
+		}
+		fluentConfig.RetryWait = int(wait.Seconds() * 1000)
+	}
+	if maxRetries := config[maxRetriesKey]; maxRetries != "" {
+		retries, err := strconv.ParseUint(maxRetries, 10, strconv.IntSize)
+		if err != nil {
+			return fluentConfig, fmt.Errorf("unable to parse %s: %w", maxRetriesKey, err)
+		}
+		fluentConfig.MaxRetry = int(retries) //nolint:gosec // parsed with the size of an int
+	}
+	for key, value := range map[string]*bool{
+		AsyncConnectKey:       &fluentConfig.Async,
+		SubsecondPrecisionKey: &fluentConfig.SubSecondPrecision,
+		requestAckKey:         &fluentConfig.RequestAck,
+	} {
+		if config[key] == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(config[key])
+		if err != nil {
+			return fluentConfig, fmt.Errorf("unable to parse %s: %w", key, err)
+		}
+		*value = b
+	}
+	fluentConfig.ForceStopAsyncSend = fluentConfig.Async
+	if reconnectInterval := config[asyncReconnectIntervalKey]; reconnectInterval != "" {
+		interval, err := time.ParseDuration(reconnectInterval)
+		if err != nil {
+			return fluentConfig, fmt.Errorf("unable to parse %s: %w", asyncReconnectIntervalKey, err)
+		}
+		if interval != 0 && (interval < minReconnectInterval || interval > maxReconnectInterval) {
+			return fluentConfig, fmt.Errorf("invalid %s %s, must be between %s and %s",
+				asyncReconnectIntervalKey, interval, minReconnectInterval, maxReconnectInterval)
+		}
+		fluentConfig.AsyncReconnectInterval = int(interval.Milliseconds())
+	}
+	if writeTimeout := config[WriteTimeoutKey]; writeTimeout != "" {
+		timeout, err := time.ParseDuration(writeTimeout)
+		if err != nil {
+			return fluentConfig, fmt.Errorf("unable to parse %s: %w", WriteTimeoutKey, err)
+		}
+		if timeout < 0 {
+			return fluentConfig, fmt.Errorf("invalid %s %s, must not be negative", WriteTimeoutKey, timeout)
+		}
+		fluentConfig.WriteTimeout = timeout
+	}
+	return fluentConfig, nil
+}
+
+// parseFluentAddress sets the network, and either the socket path or the host and port, of the
+// fluentd client config from the address, the same way as moby's fluentd driver.
+func parseFluentAddress(address string, fluentConfig *fluent.Config) error {
+	if address == "" {
+		return nil
+	}
+	if !strings.Contains(address, "://") {
+		address = defaultProtocol + "://" + address
+	}
+	addr, err := url.Parse(address)
+	if err != nil {
+		return err
+	}
+	fluentConfig.FluentNetwork = addr.Scheme
+	switch addr.Scheme {
+	case "unix":
+		if strings.TrimLeft(addr.Path, "/") == "" {
+			return errors.New("path is empty")
+		}
+		fluentConfig.FluentSocketPath = addr.Path
+		fluentConfig.FluentHost, fluentConfig.FluentPort = "", 0
+		return nil
+	case "tcp", "tls":
+	default:
+		return errors.New("unsupported scheme: " + addr.Scheme)
+	}
+	if addr.Path != "" {
+		return errors.New("should not contain a path element")
+	}
+	if host := addr.Hostname(); host != "" {
+		fluentConfig.FluentHost = host
+	}
+	if port := addr.Port(); port != "" {
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid port: %w", err)
+		}
+		fluentConfig.FluentPort = int(p)
+	}
+	return nil
+}
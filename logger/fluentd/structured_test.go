@@ -0,0 +1,136 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package fluentd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	types "github.com/docker/docker/api/types/backend"
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	dockerfluentd "github.com/docker/docker/daemon/logger/fluentd"
+	"github.com/fluent/fluent-logger-golang/fluent"
+	"github.com/stretchr/testify/require"
+	"github.com/tinylib/msgp/msgp"
+
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+// TestGetFluentConfig tests that the fluentd client config is parsed like moby's fluentd driver.
+func TestGetFluentConfig(t *testing.T) {
+	config, err := getFluentConfig(map[string]string{
+		AddressKey:            "fluentd.local:24225",
+		AsyncConnectKey:       "true",
+		SubsecondPrecisionKey: "true",
+		BufferLimitKey:        "2m",
+		WriteTimeoutKey:       "5s",
+	})
+	require.NoError(t, err)
+	require.Equal(t, fluent.Config{
+		FluentNetwork:      "tcp",
+		FluentHost:         "fluentd.local",
+		FluentPort:         24225,
+		BufferLimit:        2 * 1024 * 1024,
+		RetryWait:          defaultRetryWait,
+		MaxRetry:           defaultMaxRetries,
+		Async:              true,
+		ForceStopAsyncSend: true,
+		SubSecondPrecision: true,
+		WriteTimeout:       5 * time.Second,
+	}, config)
+
+	config, err = getFluentConfig(map[string]string{
+		AddressKey:                "tls://fluentd.local",
+		AsyncConnectKey:           "true",
+		asyncReconnectIntervalKey: "500ms",
+		maxRetriesKey:             "3",
+		retryWaitKey:              "2s",
+		requestAckKey:             "true",
+	})
+	require.NoError(t, err)
+	require.Equal(t, fluent.Config{
+		FluentNetwork:          "tls",
+		FluentHost:             "fluentd.local",
+		FluentPort:             defaultPort,
+		BufferLimit:            defaultBufferLimit,
+		RetryWait:              2000,
+		MaxRetry:               3,
+		Async:                  true,
+		ForceStopAsyncSend:     true,
+		AsyncReconnectInterval: 500,
+		RequestAck:             true,
+	}, config)
+
+	config, err = getFluentConfig(map[string]string{AddressKey: "unix:///var/run/fluentd.sock"})
+	require.NoError(t, err)
+	require.Equal(t, "unix", config.FluentNetwork)
+	require.Equal(t, "/var/run/fluentd.sock", config.FluentSocketPath)
+
+	for _, config := range []map[string]string{
+		{AddressKey: "udp://fluentd.local"},
+		{AddressKey: "fluentd.local:port"},
+		{AddressKey: "unix://"},
+		{AddressKey: "tcp://fluentd.local/path"},
+		{asyncReconnectIntervalKey: "1m"},
+		{maxRetriesKey: "-1"},
+		{WriteTimeoutKey: "-1s"},
+	} {
+		_, err = getFluentConfig(config)
+		require.Error(t, err, config)
+		// The log options are rejected by moby's fluentd driver too.
+		require.Error(t, dockerfluentd.ValidateLogOpt(config), config)
+	}
+}
+
+// TestStructuredStream tests that a JSON log line is sent as an object, along with the
+// attributes of the log message as fields of the record.
+func TestStructuredStream(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	records := make(chan interface{}, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		record, _ := msgp.NewReader(conn).ReadIntf()
+		records <- record
+	}()
+
+	info := logger.NewInfo("abc123def4567890", "test",
+		logger.WithConfig(map[string]string{AddressKey: listener.Addr().String()}))
+	stream, err := newStructuredStream(info)
+	require.NoError(t, err)
+	defer stream.Close()
+	require.NoError(t, stream.Log(&dockerlogger.Message{
+		Line:      []byte(`{"level":"error","status":500}`),
+		Source:    "stdout",
+		Timestamp: time.Now(),
+		Attrs:     []types.LogAttr{{Key: "level", Value: "error"}},
+	}))
+
+	var record interface{}
+	select {
+	case record = <-records:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no record is received")
+	}
+	message, ok := record.([]interface{})
+	require.True(t, ok)
+	require.GreaterOrEqual(t, len(message), 3)
+	require.Equal(t, "abc123def456", message[0])
+	require.Equal(t, map[string]interface{}{
+		"container_id":   "abc123def4567890",
+		"container_name": "test",
+		"source":         "stdout",
+		"level":          "error",
+		"log":            map[string]interface{}{"level": "error", "status": 500.0},
+	}, message[2])
+}
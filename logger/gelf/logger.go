@@ -0,0 +1,233 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package gelf provides functionalities for integrating the gelf logging driver
+// with shim-loggers-for-containerd, which sends container logs to Graylog or any
+// other GELF endpoint.
+package gelf
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/containerd/containerd/runtime/v2/logging"
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	dockergelf "github.com/docker/docker/daemon/logger/gelf"
+
+	"github.com/aws/shim-loggers-for-containerd/debug"
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+const (
+	// udpMaxChunks and udpChunkDataBytes are the max number of chunks of a log message over UDP
+	// and the size of the data of each of them, adopted from the GELF library of moby.
+	udpMaxChunks      = 128
+	udpChunkDataBytes = 1420 - 12
+	// udpOverheadBytes leaves room in a log message over UDP for its fields other than the log
+	// line, such as the container labels and env, assuming it's not compressed.
+	udpOverheadBytes = 16 * 1024
+	// MaximumUDPBytesPerEvent is the max size of a log line sent over UDP.
+	MaximumUDPBytesPerEvent = udpMaxChunks*udpChunkDataBytes - udpOverheadBytes
+)
+
+// gelf driver argument keys.
+const (
+	// DriverName is the name of the gelf log driver.
+	DriverName = "gelf"
+
+	// Required.
+
+	// AddressKey is the address of the GELF endpoint, in the format of `udp://host:port` or
+	// `tcp://host:port`. Log messages are sent in chunks over UDP.
+	AddressKey = "gelf-address"
+
+	// Optional.
+
+	// CompressionTypeKey is the compression of the log messages over UDP, either `gzip`, the
+	// default in moby, `zlib` or `none`.
+	CompressionTypeKey = "gelf-compression-type"
+	// CompressionLevelKey is the compression level between -1 and 9 over UDP.
+	CompressionLevelKey = "gelf-compression-level"
+	// TCPMaxReconnectKey is the maximum number of reconnection attempts over TCP.
+	TCPMaxReconnectKey = "gelf-tcp-max-reconnect"
+	// TCPReconnectDelayKey is the number of seconds to wait between reconnection attempts over
+	// TCP.
+	TCPReconnectDelayKey = "gelf-tcp-reconnect-delay"
+
+	// LabelsKey is the moby-side option key for label-based extras (renamed from
+	// GELFLabelsKey on the way into moby).
+	LabelsKey = "labels"
+	// LabelsRegexKey is the moby-side option key for label-regex extras (renamed from
+	// GELFLabelsRegexKey).
+	LabelsRegexKey = "labels-regex"
+	// EnvKey is the moby-side option key for env-based extras (renamed from GELFEnvKey).
+	EnvKey = "env"
+	// EnvRegexKey is the moby-side option key for env-regex extras (renamed from
+	// GELFEnvRegexKey).
+	EnvRegexKey = "env-regex"
+
+	// GELFLabelsKey is the input parameter name for the labels list. The input parameters are
+	// prefixed to avoid collisions with the same-named parameters of the other log drivers.
+	GELFLabelsKey = "gelf-labels"
+	// GELFLabelsRegexKey is the input parameter name for the labels regex.
+	GELFLabelsRegexKey = "gelf-labels-regex"
+	// GELFEnvKey is the input parameter name for the env list.
+	GELFEnvKey = "gelf-env"
+	// GELFEnvRegexKey is the input parameter name for the env regex.
+	GELFEnvRegexKey = "gelf-env-regex"
+	// GELFTagKey is the input parameter name for the gelf tag template.
+	GELFTagKey = "gelf-tag"
+
+	// tagKey is the moby-side option key for tag template (renamed from GELFTagKey).
+	tagKey = "tag"
+)
+
+// Args represents gelf log driver arguments.
+type Args struct {
+	// Required.
+	Address string
+
+	// Optional.
+	CompressionType   string
+	CompressionLevel  string
+	TCPMaxReconnect   string
+	TCPReconnectDelay string
+	Labels            string
+	LabelsRegex       string
+	Env               string
+	EnvRegex          string
+	Tag               string
+	// TagSpecified represents whether a gelf tag was specified. Used to differentiate
+	// between the default empty string and an explicitly-set empty tag, mirroring the splunk
+	// driver's pattern.
+	TagSpecified bool
+}
+
+// LoggerArgs stores global logger args, docker configs and gelf specific args.
+type LoggerArgs struct {
+	globalArgs    *logger.GlobalArgs
+	dockerConfigs *logger.DockerConfigs
+	args          *Args
+}
+
+// InitLogger initializes the input arguments.
+func InitLogger(globalArgs *logger.GlobalArgs, dockerConfigs *logger.DockerConfigs, gelfArgs *Args) *LoggerArgs {
+	return &LoggerArgs{
+		globalArgs:    globalArgs,
+		dockerConfigs: dockerConfigs,
+		args:          gelfArgs,
+	}
+}
+
+// RunLogDriver initializes and starts the gelf logger.
+// Errors with the log driver are logged but not returned to prevent container termination.
+func (la *LoggerArgs) RunLogDriver(ctx context.Context, config *logging.Config, ready func() error) error {
+	defer debug.DeferFuncForRunLogDriver()
+
+	info, stream, err := la.newStream()
+	if err != nil {
+		debug.ErrLogger = err
+		return debug.ErrLogger
+	}
+
+	l, err := logger.NewPipelineLogger(la.globalArgs, config, info, stream,
+		logger.WithMaxBytesPerEvent(la.MaxBytesPerEvent()))
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("unable to create gelf driver: %w", err)
+		return debug.ErrLogger
+	}
+
+	// Start gelf driver
+	debug.SendEventsToLog(logger.DaemonName, "Starting gelf driver", debug.INFO, 0)
+	err = l.Start(ctx, la.globalArgs.CleanupTime, ready)
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("failed to run gelf driver: %w", err)
+		// Do not return error if log driver has issue sending logs to destination, because if error
+		// returned here, containerd will identify this error and kill shim process, which will kill
+		// the container process accordingly.
+		// Note: the container will continue to run if shim logger exits after.
+		// Reference: https://github.com/containerd/containerd/blob/release/1.3/runtime/v2/logging/logging.go
+		return nil
+	}
+	debug.SendEventsToLog(logger.DaemonName, "Logging finished", debug.INFO, 1)
+
+	return nil
+}
+
+// MaxBytesPerEvent returns the max size of a log line sent to the GELF endpoint, which is only
+// limited over UDP.
+func (la *LoggerArgs) MaxBytesPerEvent() int {
+	if strings.HasPrefix(la.args.Address, "udp://") {
+		return MaximumUDPBytesPerEvent
+	}
+	return 0
+}
+
+// NewStream creates the gelf stream, which is used when fanning out to multiple log drivers.
+func (la *LoggerArgs) NewStream() (logger.Client, error) {
+	_, stream, err := la.newStream()
+	return stream, err
+}
+
+// newStream validates the log options and creates the gelf stream along with its info.
+func (la *LoggerArgs) newStream() (*dockerlogger.Info, dockerlogger.Logger, error) {
+	loggerConfig, err := getGELFConfig(la.args)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to validate log options: %w", err)
+	}
+	info := logger.NewInfo(
+		la.globalArgs.ContainerID,
+		la.globalArgs.ContainerName,
+		logger.WithConfig(loggerConfig),
+	)
+	// The image, labels and env of the container are sent as extra fields of every log message.
+	info = logger.UpdateDockerConfigs(info, la.dockerConfigs)
+	stream, err := dockergelf.New(*info)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create stream: %w", err)
+	}
+
+	return info, stream, nil
+}
+
+// getGELFConfig sets values for gelf config and validates them via moby's upstream
+// ValidateLogOpts. Optional fields are only set when non-empty so we don't trigger moby's
+// "unknown log opt" rejection on empty strings.
+func getGELFConfig(arg *Args) (map[string]string, error) {
+	config := make(map[string]string)
+	config[AddressKey] = arg.Address
+	if arg.CompressionType != "" {
+		config[CompressionTypeKey] = arg.CompressionType
+	}
+	if arg.CompressionLevel != "" {
+		config[CompressionLevelKey] = arg.CompressionLevel
+	}
+	if arg.TCPMaxReconnect != "" {
+		config[TCPMaxReconnectKey] = arg.TCPMaxReconnect
+	}
+	if arg.TCPReconnectDelay != "" {
+		config[TCPReconnectDelayKey] = arg.TCPReconnectDelay
+	}
+	if arg.Labels != "" {
+		config[LabelsKey] = arg.Labels
+	}
+	if arg.LabelsRegex != "" {
+		config[LabelsRegexKey] = arg.LabelsRegex
+	}
+	if arg.Env != "" {
+		config[EnvKey] = arg.Env
+	}
+	if arg.EnvRegex != "" {
+		config[EnvRegexKey] = arg.EnvRegex
+	}
+	if arg.TagSpecified {
+		config[tagKey] = arg.Tag
+	}
+
+	err := dockerlogger.ValidateLogOpts(DriverName, config)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
@@ -0,0 +1,144 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package gelf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+const (
+	testAddress           = "udp://localhost:12201"
+	testCompressionType   = "gzip"
+	testCompressionLevel  = "9"
+	testLabels            = "team"
+	testLabelsRegex       = "^app\\..*"
+	testEnv               = "STAGE"
+	testEnvRegex          = "^APP_.*"
+	testTag               = "{{.ImageName}}/{{.ID}}"
+	testContainerID       = "test-container-id"
+	testContainerName     = "test-container-name"
+	testContainerImage    = "test-image-name"
+	testContainerLabelKey = "team"
+	testContainerLabel    = "logging"
+)
+
+// TestGetGELFConfig tests that all set arguments are converted to the moby-side config map.
+func TestGetGELFConfig(t *testing.T) {
+	args := &Args{
+		Address:          testAddress,
+		CompressionType:  testCompressionType,
+		CompressionLevel: testCompressionLevel,
+		Labels:           testLabels,
+		LabelsRegex:      testLabelsRegex,
+		Env:              testEnv,
+		EnvRegex:         testEnvRegex,
+		Tag:              testTag,
+		TagSpecified:     true,
+	}
+
+	expectedConfig := map[string]string{
+		AddressKey:          testAddress,
+		CompressionTypeKey:  testCompressionType,
+		CompressionLevelKey: testCompressionLevel,
+		LabelsKey:           testLabels,
+		LabelsRegexKey:      testLabelsRegex,
+		EnvKey:              testEnv,
+		EnvRegexKey:         testEnvRegex,
+		tagKey:              testTag,
+	}
+
+	config, err := getGELFConfig(args)
+	require.NoError(t, err)
+	require.Equal(t, expectedConfig, config)
+}
+
+// TestGetGELFConfigValidationError tests that getGELFConfig returns an error when moby's
+// ValidateLogOpts fails.
+func TestGetGELFConfigValidationError(t *testing.T) {
+	for _, args := range []*Args{
+		{},
+		{Address: "http://localhost:12201"},
+		{Address: "udp://localhost"},
+		{Address: testAddress, CompressionType: "zstd"},
+		{Address: testAddress, CompressionLevel: "10"},
+		{Address: "tcp://localhost:12201", CompressionType: testCompressionType},
+		{Address: testAddress, TCPMaxReconnect: "3"},
+		{Address: "tcp://localhost:12201", TCPReconnectDelay: "-1"},
+	} {
+		config, err := getGELFConfig(args)
+		require.Error(t, err, "%+v", args)
+		require.Nil(t, config)
+	}
+}
+
+// TestGELFStream tests that log messages are sent over UDP along with the extra fields of the
+// container.
+func TestGELFStream(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	la := InitLogger(
+		&logger.GlobalArgs{ContainerID: testContainerID, ContainerName: testContainerName},
+		&logger.DockerConfigs{
+			ContainerImageName: testContainerImage,
+			ContainerLabels:    map[string]string{testContainerLabelKey: testContainerLabel},
+		},
+		&Args{
+			Address:         "udp://" + conn.LocalAddr().String(),
+			CompressionType: testCompressionType,
+			Labels:          testLabels,
+		},
+	)
+	stream, err := la.NewStream()
+	require.NoError(t, err)
+	defer stream.(dockerlogger.Logger).Close() //nolint:errcheck // test cleanup
+
+	msg := dockerlogger.NewMessage()
+	msg.Line = append(msg.Line, "test line"...)
+	msg.Source = "stderr"
+	msg.Timestamp = time.Now()
+	require.NoError(t, stream.Log(msg))
+
+	buf := make([]byte, 65536)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	zr, err := gzip.NewReader(bytes.NewReader(buf[:n]))
+	require.NoError(t, err)
+	payload, err := io.ReadAll(zr)
+	require.NoError(t, err)
+
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal(payload, &fields))
+	require.Equal(t, "test line", fields["short_message"])
+	require.Equal(t, testContainerID, fields["_container_id"])
+	require.Equal(t, testContainerName, fields["_container_name"])
+	require.Equal(t, testContainerImage, fields["_image_name"])
+	require.Equal(t, testContainerLabel, fields["_"+testContainerLabelKey])
+	// Log messages from stderr have the error level.
+	require.EqualValues(t, 3, fields["level"])
+}
+
+// TestMaxBytesPerEvent tests that the size of log lines is only limited over UDP.
+func TestMaxBytesPerEvent(t *testing.T) {
+	la := InitLogger(&logger.GlobalArgs{}, &logger.DockerConfigs{}, &Args{Address: "udp://127.0.0.1:12201"})
+	require.Equal(t, MaximumUDPBytesPerEvent, la.MaxBytesPerEvent())
+	la = InitLogger(&logger.GlobalArgs{}, &logger.DockerConfigs{}, &Args{Address: "tcp://127.0.0.1:12201"})
+	require.Zero(t, la.MaxBytesPerEvent())
+}
@@ -0,0 +1,165 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package journald
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/coreos/go-systemd/journal"
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/docker/docker/daemon/logger/loggerutils"
+	"github.com/docker/docker/pkg/stringid"
+)
+
+// Well-known user journal fields.
+// https://www.freedesktop.org/software/systemd/man/systemd.journal-fields.html
+const (
+	fieldSyslogIdentifier = "SYSLOG_IDENTIFIER"
+	fieldSyslogTimestamp  = "SYSLOG_TIMESTAMP"
+)
+
+// User journal fields of the moby journald log driver.
+const (
+	fieldContainerID     = "CONTAINER_ID"
+	fieldContainerIDFull = "CONTAINER_ID_FULL"
+	fieldContainerName   = "CONTAINER_NAME"
+	fieldContainerTag    = "CONTAINER_TAG"
+	fieldImageName       = "IMAGE_NAME"
+
+	// Fields used to serialize PLogMetaData.
+	fieldPLogID         = "CONTAINER_PARTIAL_ID"
+	fieldPLogOrdinal    = "CONTAINER_PARTIAL_ORDINAL"
+	fieldPLogLast       = "CONTAINER_PARTIAL_LAST"
+	fieldPartialMessage = "CONTAINER_PARTIAL_MESSAGE"
+
+	fieldLogEpoch   = "CONTAINER_LOG_EPOCH"
+	fieldLogOrdinal = "CONTAINER_LOG_ORDINAL"
+
+	shortContainerIDLength = 12
+	fullIDTemplate         = "{{.FullID}}"
+	sourceSTDERR           = "stderr"
+)
+
+// journald is a dockerlogger.Logger writing log messages to the systemd journal.
+type journald struct {
+	// ordinal is the sequence number of the last log message, which tells apart the log messages
+	// of this instance along with the epoch in vars.
+	ordinal atomic.Uint64
+	// vars are the journal fields saved along with every log message.
+	vars map[string]string
+	// sendToJournal is journal.Send, which is overridden in unit tests.
+	sendToJournal func(message string, priority journal.Priority, vars map[string]string) error
+}
+
+// newJournald creates the journald stream, after checking that the journal is available.
+func newJournald(info dockerlogger.Info) (*journald, error) {
+	if !journal.Enabled() {
+		return nil, errors.New("journald is not enabled on this host")
+	}
+	return newJournaldWithSender(info, journal.Send)
+}
+
+// newJournaldWithSender creates a journald stream sending log messages with the given function.
+func newJournaldWithSender(
+	info dockerlogger.Info,
+	sendToJournal func(string, journal.Priority, map[string]string) error,
+) (*journald, error) {
+	// Container IDs given to the shim logger aren't always as long as the Docker ones, which
+	// the short ID of the default tag template can't be taken from.
+	shortID := info.ContainerID
+	defaultTemplate := loggerutils.DefaultTemplate
+	if len(shortID) > shortContainerIDLength {
+		shortID = shortID[:shortContainerIDLength]
+	} else {
+		defaultTemplate = fullIDTemplate
+	}
+	tag, err := loggerutils.ParseLogTag(info, defaultTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := map[string]string{
+		fieldContainerID:      shortID,
+		fieldContainerIDFull:  info.ContainerID,
+		fieldContainerName:    info.Name(),
+		fieldContainerTag:     tag,
+		fieldImageName:        info.ImageName(),
+		fieldSyslogIdentifier: tag,
+		fieldLogEpoch:         stringid.GenerateRandomID(),
+	}
+	extraAttrs, err := info.ExtraAttributes(sanitizeKeyMod)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range extraAttrs {
+		vars[k] = v
+	}
+
+	return &journald{
+		vars:          vars,
+		sendToJournal: sendToJournal,
+	}, nil
+}
+
+// Log writes the log message to the journal. Log messages from stderr have the error priority,
+// and the other ones the info priority.
+func (s *journald) Log(msg *dockerlogger.Message) error {
+	vars := make(map[string]string, len(s.vars)+6)
+	for k, v := range s.vars {
+		vars[k] = v
+	}
+	if !msg.Timestamp.IsZero() {
+		vars[fieldSyslogTimestamp] = msg.Timestamp.Format(time.RFC3339Nano)
+	}
+	if msg.PLogMetaData != nil {
+		vars[fieldPLogID] = msg.PLogMetaData.ID
+		vars[fieldPLogOrdinal] = strconv.Itoa(msg.PLogMetaData.Ordinal)
+		vars[fieldPLogLast] = strconv.FormatBool(msg.PLogMetaData.Last)
+		if !msg.PLogMetaData.Last {
+			vars[fieldPartialMessage] = "true"
+		}
+	}
+	vars[fieldLogOrdinal] = strconv.FormatUint(s.ordinal.Add(1), 10)
+
+	line := string(msg.Line)
+	source := msg.Source
+	dockerlogger.PutMessage(msg)
+	if source == sourceSTDERR {
+		return s.sendToJournal(line, journal.PriErr, vars)
+	}
+	return s.sendToJournal(line, journal.PriInfo, vars)
+}
+
+// Close does nothing, since every log message is written to the journal once it's logged.
+func (s *journald) Close() error {
+	return nil
+}
+
+// Name returns the name of the log driver.
+func (s *journald) Name() string {
+	return DriverName
+}
+
+// sanitizeKeyMod returns the key of a label or environment variable as a journal field name,
+// which is made of uppercase letters, numbers and underscores, and doesn't start with an
+// underscore.
+func sanitizeKeyMod(s string) string {
+	n := make([]rune, 0, len(s))
+	for _, v := range s {
+		if 'a' <= v && v <= 'z' {
+			v = unicode.ToUpper(v)
+		} else if ('Z' < v || v < 'A') && ('9' < v || v < '0') {
+			v = '_'
+		}
+		if len(n) == 0 && v == '_' {
+			continue
+		}
+		n = append(n, v)
+	}
+	return string(n)
+}
@@ -0,0 +1,101 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package journald
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/journal"
+	types "github.com/docker/docker/api/types/backend"
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+const (
+	testContainerID   = "0123456789abcdef0123"
+	testContainerName = "test-container-name"
+	testImageName     = "test-image-name"
+)
+
+// journalEntry is a log message sent to the journal.
+type journalEntry struct {
+	message  string
+	priority journal.Priority
+	vars     map[string]string
+}
+
+// TestJournaldFields tests that log messages are written with the same journal fields as the
+// moby journald log driver.
+func TestJournaldFields(t *testing.T) {
+	info := logger.NewInfo(testContainerID, testContainerName, logger.WithConfig(getJournaldConfig(&Args{
+		Labels:       "com.example.team",
+		Tag:          "{{.ImageName}}",
+		TagSpecified: true,
+	})))
+	info = logger.UpdateDockerConfigs(info, &logger.DockerConfigs{
+		ContainerImageName: testImageName,
+		ContainerLabels:    map[string]string{"com.example.team": "logging"},
+	})
+	var entries []journalEntry
+	j, err := newJournaldWithSender(*info, func(message string, priority journal.Priority, vars map[string]string) error {
+		entries = append(entries, journalEntry{message, priority, vars})
+		return nil
+	})
+	require.NoError(t, err)
+
+	timestamp := time.Date(2020, time.January, 14, 1, 59, 0, 0, time.UTC)
+	msg := dockerlogger.NewMessage()
+	msg.Line = append(msg.Line, "partial line"...)
+	msg.Source = "stdout"
+	msg.Timestamp = timestamp
+	msg.PLogMetaData = &types.PartialLogMetaData{ID: "partial-id", Ordinal: 1}
+	require.NoError(t, j.Log(msg))
+	msg = dockerlogger.NewMessage()
+	msg.Line = append(msg.Line, "error line"...)
+	msg.Source = sourceSTDERR
+	require.NoError(t, j.Log(msg))
+
+	require.Len(t, entries, 2)
+	require.Equal(t, "partial line", entries[0].message)
+	require.Equal(t, journal.PriInfo, entries[0].priority)
+	epoch := entries[0].vars[fieldLogEpoch]
+	require.NotEmpty(t, epoch)
+	require.Equal(t, map[string]string{
+		fieldContainerID:      testContainerID[:shortContainerIDLength],
+		fieldContainerIDFull:  testContainerID,
+		fieldContainerName:    testContainerName,
+		fieldContainerTag:     testImageName,
+		fieldImageName:        testImageName,
+		fieldSyslogIdentifier: testImageName,
+		fieldSyslogTimestamp:  timestamp.Format(time.RFC3339Nano),
+		fieldPLogID:           "partial-id",
+		fieldPLogOrdinal:      "1",
+		fieldPLogLast:         "false",
+		fieldPartialMessage:   "true",
+		fieldLogEpoch:         epoch,
+		fieldLogOrdinal:       "1",
+		"COM_EXAMPLE_TEAM":    "logging",
+	}, entries[0].vars)
+
+	require.Equal(t, "error line", entries[1].message)
+	require.Equal(t, journal.PriErr, entries[1].priority)
+	require.Equal(t, "2", entries[1].vars[fieldLogOrdinal])
+	require.NotContains(t, entries[1].vars, fieldPLogID)
+}
+
+// TestJournaldShortContainerID tests that container IDs shorter than the Docker ones are used
+// as they are.
+func TestJournaldShortContainerID(t *testing.T) {
+	info := logger.NewInfo("abc", testContainerName)
+	j, err := newJournaldWithSender(*info, nil)
+	require.NoError(t, err)
+	require.Equal(t, "abc", j.vars[fieldContainerID])
+	require.Equal(t, "abc", j.vars[fieldContainerTag])
+}
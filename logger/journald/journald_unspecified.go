@@ -0,0 +1,17 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !linux
+
+package journald
+
+import (
+	"errors"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+)
+
+// newJournald fails, since the journal is only available on Linux.
+func newJournald(_ dockerlogger.Info) (dockerlogger.Logger, error) {
+	return nil, errors.New("journald is only supported on Linux")
+}
@@ -0,0 +1,161 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package journald provides a log driver writing container logs to the systemd journal of the
+// host, with the same journal fields as the moby journald log driver, so that the same tooling
+// can be used to read them, e.g. `journalctl CONTAINER_NAME=web`. It's only supported on Linux.
+package journald
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containerd/containerd/runtime/v2/logging"
+	dockerlogger "github.com/docker/docker/daemon/logger"
+
+	"github.com/aws/shim-loggers-for-containerd/debug"
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+// journald driver argument keys.
+const (
+	// DriverName is the name of the journald log driver.
+	DriverName = "journald"
+
+	// LabelsKey is the moby-side option key for label-based extras (renamed from
+	// JournaldLabelsKey on the way into the driver).
+	LabelsKey = "labels"
+	// LabelsRegexKey is the moby-side option key for label-regex extras (renamed from
+	// JournaldLabelsRegexKey).
+	LabelsRegexKey = "labels-regex"
+	// EnvKey is the moby-side option key for env-based extras (renamed from JournaldEnvKey).
+	EnvKey = "env"
+	// EnvRegexKey is the moby-side option key for env-regex extras (renamed from
+	// JournaldEnvRegexKey).
+	EnvRegexKey = "env-regex"
+
+	// JournaldLabelsKey is the input parameter name for the labels list. The input parameters
+	// are prefixed to avoid collisions with the same-named parameters of the other log drivers.
+	JournaldLabelsKey = "journald-labels"
+	// JournaldLabelsRegexKey is the input parameter name for the labels regex.
+	JournaldLabelsRegexKey = "journald-labels-regex"
+	// JournaldEnvKey is the input parameter name for the env list.
+	JournaldEnvKey = "journald-env"
+	// JournaldEnvRegexKey is the input parameter name for the env regex.
+	JournaldEnvRegexKey = "journald-env-regex"
+	// JournaldTagKey is the input parameter name for the journald tag template, which is saved
+	// as the CONTAINER_TAG and SYSLOG_IDENTIFIER fields.
+	JournaldTagKey = "journald-tag"
+
+	// tagKey is the moby-side option key for tag template (renamed from JournaldTagKey).
+	tagKey = "tag"
+)
+
+// Args represents journald log driver arguments.
+type Args struct {
+	// Optional.
+	Labels      string
+	LabelsRegex string
+	Env         string
+	EnvRegex    string
+	Tag         string
+	// TagSpecified represents whether a journald tag was specified. Used to differentiate
+	// between the default empty string and an explicitly-set empty tag, mirroring the splunk
+	// driver's pattern.
+	TagSpecified bool
+}
+
+// LoggerArgs stores global logger args, docker configs and journald specific args.
+type LoggerArgs struct {
+	globalArgs    *logger.GlobalArgs
+	dockerConfigs *logger.DockerConfigs
+	args          *Args
+}
+
+// InitLogger initializes the input arguments.
+func InitLogger(globalArgs *logger.GlobalArgs, dockerConfigs *logger.DockerConfigs, journaldArgs *Args) *LoggerArgs {
+	return &LoggerArgs{
+		globalArgs:    globalArgs,
+		dockerConfigs: dockerConfigs,
+		args:          journaldArgs,
+	}
+}
+
+// RunLogDriver initializes and starts the journald logger.
+// Errors with the log driver are logged but not returned to prevent container termination.
+func (la *LoggerArgs) RunLogDriver(ctx context.Context, config *logging.Config, ready func() error) error {
+	defer debug.DeferFuncForRunLogDriver()
+
+	info, stream, err := la.newStream()
+	if err != nil {
+		debug.ErrLogger = err
+		return debug.ErrLogger
+	}
+
+	l, err := logger.NewPipelineLogger(la.globalArgs, config, info, stream)
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("unable to create journald driver: %w", err)
+		return debug.ErrLogger
+	}
+
+	// Start journald driver
+	debug.SendEventsToLog(logger.DaemonName, "Starting journald driver", debug.INFO, 0)
+	err = l.Start(ctx, la.globalArgs.CleanupTime, ready)
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("failed to run journald driver: %w", err)
+		// Do not return error if log driver has issue sending logs to destination, because if error
+		// returned here, containerd will identify this error and kill shim process, which will kill
+		// the container process accordingly.
+		// Note: the container will continue to run if shim logger exits after.
+		// Reference: https://github.com/containerd/containerd/blob/release/1.3/runtime/v2/logging/logging.go
+		return nil
+	}
+	debug.SendEventsToLog(logger.DaemonName, "Logging finished", debug.INFO, 1)
+
+	return nil
+}
+
+// NewStream creates the journald stream, which is used when fanning out to multiple log drivers.
+func (la *LoggerArgs) NewStream() (logger.Client, error) {
+	_, stream, err := la.newStream()
+	return stream, err
+}
+
+// newStream validates the log options and creates the journald stream along with its info.
+func (la *LoggerArgs) newStream() (*dockerlogger.Info, dockerlogger.Logger, error) {
+	info := logger.NewInfo(
+		la.globalArgs.ContainerID,
+		la.globalArgs.ContainerName,
+		logger.WithConfig(getJournaldConfig(la.args)),
+	)
+	info = logger.UpdateDockerConfigs(info, la.dockerConfigs)
+	stream, err := newJournald(*info)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create stream: %w", err)
+	}
+
+	return info, stream, nil
+}
+
+// getJournaldConfig sets values for journald config. Optional fields are only set when
+// non-empty, in the same way as the moby journald log driver expects them. The regular
+// expressions are validated when the stream is created.
+func getJournaldConfig(arg *Args) map[string]string {
+	config := make(map[string]string)
+	if arg.Labels != "" {
+		config[LabelsKey] = arg.Labels
+	}
+	if arg.LabelsRegex != "" {
+		config[LabelsRegexKey] = arg.LabelsRegex
+	}
+	if arg.Env != "" {
+		config[EnvKey] = arg.Env
+	}
+	if arg.EnvRegex != "" {
+		config[EnvRegexKey] = arg.EnvRegex
+	}
+	if arg.TagSpecified {
+		config[tagKey] = arg.Tag
+	}
+	return config
+}
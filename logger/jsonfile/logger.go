@@ -124,48 +124,18 @@ func InitLogger(globalArgs *logger.GlobalArgs, jsonFileArgs *Args) *LoggerArgs {
 func (la *LoggerArgs) RunLogDriver(ctx context.Context, config *logging.Config, ready func() error) error {
 	defer debug.DeferFuncForRunLogDriver()
 
-	loggerConfig, err := getJSONFileConfig(la.args)
-	if err != nil {
-		debug.ErrLogger = fmt.Errorf("unable to validate log options: %w", err)
-		return debug.ErrLogger
-	}
-	info := logger.NewInfo(
-		la.globalArgs.ContainerID,
-		la.globalArgs.ContainerName,
-		logger.WithConfig(loggerConfig),
-		logger.WithLogPath(la.args.LogPath),
-	)
-
-	// Create the log file's parent directory if it does not exist.
-	if dir := filepath.Dir(la.args.LogPath); dir != "" {
-		if err := os.MkdirAll(dir, logDirMode); err != nil {
-			debug.ErrLogger = fmt.Errorf("unable to create log directory %s: %w", dir, err)
-			return debug.ErrLogger
-		}
-	}
-
-	stream, err := dockerjsonfilelog.New(*info)
+	info, stream, err := la.newStream()
 	if err != nil {
-		debug.ErrLogger = fmt.Errorf("unable to create stream: %w", err)
+		debug.ErrLogger = err
 		return debug.ErrLogger
 	}
 
-	l, err := logger.NewLogger(
-		logger.WithStdout(config.Stdout),
-		logger.WithStderr(config.Stderr),
-		logger.WithInfo(info),
-		logger.WithStream(stream),
-	)
+	l, err := logger.NewPipelineLogger(la.globalArgs, config, info, stream)
 	if err != nil {
 		debug.ErrLogger = fmt.Errorf("unable to create json-file driver: %w", err)
 		return debug.ErrLogger
 	}
 
-	if la.globalArgs.Mode == logger.NonBlockingMode {
-		debug.SendEventsToLog(logger.DaemonName, "Starting non-blocking mode driver", debug.INFO, 0)
-		l = logger.NewBufferedLogger(l, logger.DefaultBufSizeInBytes, la.globalArgs.MaxBufferSize, la.globalArgs.ContainerID)
-	}
-
 	// Start json-file driver.
 	debug.SendEventsToLog(logger.DaemonName, "Starting json-file driver", debug.INFO, 0)
 	err = l.Start(ctx, la.globalArgs.CleanupTime, ready)
@@ -183,6 +153,46 @@ func (la *LoggerArgs) RunLogDriver(ctx context.Context, config *logging.Config,
 	return nil
 }
 
+// NewStream creates the json-file stream, which is used when fanning out to multiple log drivers.
+func (la *LoggerArgs) NewStream() (logger.Client, error) {
+	_, stream, err := la.newStream()
+	return stream, err
+}
+
+// newStream validates the log options and creates the json-file stream along with its info.
+func (la *LoggerArgs) newStream() (*dockerlogger.Info, dockerlogger.Logger, error) {
+	loggerConfig, err := getJSONFileConfig(la.args)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to validate log options: %w", err)
+	}
+	info := logger.NewInfo(
+		la.globalArgs.ContainerID,
+		la.globalArgs.ContainerName,
+		logger.WithConfig(loggerConfig),
+		logger.WithLogPath(la.args.LogPath),
+	)
+
+	// Create the log file's parent directory if it does not exist.
+	if dir := filepath.Dir(la.args.LogPath); dir != "" {
+		if err := os.MkdirAll(dir, logDirMode); err != nil {
+			return nil, nil, fmt.Errorf("unable to create log directory %s: %w", dir, err)
+		}
+	}
+
+	// Save the fields promoted from JSON log lines to the attributes of every log line.
+	var stream dockerlogger.Logger
+	if la.globalArgs.JSONParse != nil {
+		stream, err = newStructuredStream(info)
+	} else {
+		stream, err = dockerjsonfilelog.New(*info)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create stream: %w", err)
+	}
+
+	return info, stream, nil
+}
+
 // getJSONFileConfig sets values for json-file config and validates them via moby's
 // upstream ValidateLogOpts. Optional fields are only set when non-empty so we don't
 // trigger moby's "unknown log opt" rejection on empty strings.
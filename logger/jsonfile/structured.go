@@ -0,0 +1,120 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package jsonfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strconv"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/docker/docker/daemon/logger/jsonfilelog/jsonlog"
+	"github.com/docker/docker/daemon/logger/loggerutils"
+	units "github.com/docker/go-units"
+)
+
+// logFileMode is the permission mode of the log files, the same as moby's json-file driver.
+const logFileMode = 0o640
+
+// structuredStream writes log messages to the log file in the same format as moby's json-file
+// driver, except that the attributes of every log message, such as the fields promoted from JSON
+// log lines, are saved to `attrs` along with the labels, environment variables and tag.
+type structuredStream struct {
+	writer *loggerutils.LogFile
+	extra  map[string]string
+}
+
+// newStructuredStream creates the structured stream from the validated log options of the info.
+func newStructuredStream(info *dockerlogger.Info) (*structuredStream, error) {
+	var capacity int64 = -1
+	if maxSize, ok := info.Config[MaxSizeKey]; ok {
+		var err error
+		if capacity, err = units.FromHumanSize(maxSize); err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", MaxSizeKey, err)
+		}
+	}
+	maxFiles := 1
+	if maxFile, ok := info.Config[MaxFileKey]; ok {
+		var err error
+		if maxFiles, err = strconv.Atoi(maxFile); err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", MaxFileKey, err)
+		}
+	}
+	var compress bool
+	if compressString, ok := info.Config[CompressKey]; ok {
+		var err error
+		if compress, err = strconv.ParseBool(compressString); err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", CompressKey, err)
+		}
+	}
+
+	extra, err := info.ExtraAttributes(nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get extra attributes: %w", err)
+	}
+	// Like moby's json-file driver, there is no default tag.
+	tag, err := loggerutils.ParseLogTag(*info, "")
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse tag: %w", err)
+	}
+	if tag != "" {
+		extra[tagKey] = tag
+	}
+
+	writer, err := loggerutils.NewLogFile(info.LogPath, capacity, maxFiles, compress, nil, logFileMode, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open log file %s: %w", info.LogPath, err)
+	}
+	return &structuredStream{writer: writer, extra: extra}, nil
+}
+
+// Log writes a log message to the log file.
+func (s *structuredStream) Log(msg *dockerlogger.Message) error {
+	attrs := s.extra
+	if len(msg.Attrs) > 0 {
+		attrs = maps.Clone(s.extra)
+		for _, attr := range msg.Attrs {
+			attrs[attr.Key] = attr.Value
+		}
+	}
+	var rawAttrs json.RawMessage
+	if len(attrs) > 0 {
+		var err error
+		if rawAttrs, err = json.Marshal(attrs); err != nil {
+			return fmt.Errorf("unable to marshal attributes: %w", err)
+		}
+	}
+
+	line := msg.Line
+	if msg.PLogMetaData == nil || msg.PLogMetaData.Last {
+		line = append(line, '\n')
+	}
+	var buf bytes.Buffer
+	err := (&jsonlog.JSONLogs{
+		Log:      line,
+		Stream:   msg.Source,
+		Created:  msg.Timestamp,
+		RawAttrs: rawAttrs,
+	}).MarshalJSONBuf(&buf)
+	if err != nil {
+		return fmt.Errorf("unable to marshal log message: %w", err)
+	}
+	buf.WriteByte('\n')
+
+	timestamp := msg.Timestamp
+	dockerlogger.PutMessage(msg)
+	return s.writer.WriteLogEntry(timestamp, buf.Bytes())
+}
+
+// Name returns the name of the log driver.
+func (s *structuredStream) Name() string {
+	return DriverName
+}
+
+// Close closes the log file.
+func (s *structuredStream) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,69 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package jsonfile
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	types "github.com/docker/docker/api/types/backend"
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+// TestStructuredStream tests that the attributes of every log message are saved along with the
+// extra attributes, in the format of moby's json-file driver.
+func TestStructuredStream(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "container-json.log")
+	info := logger.NewInfo("abc123def4567890", "test",
+		logger.WithConfig(map[string]string{tagKey: "{{.ID}}"}),
+		logger.WithLogPath(logPath))
+	stream, err := newStructuredStream(info)
+	require.NoError(t, err)
+
+	timestamp := time.Date(2020, 1, 14, 1, 59, 0, 0, time.UTC)
+	for _, msg := range []*dockerlogger.Message{
+		{Line: []byte(`{"level":"error"}`), Source: "stdout", Timestamp: timestamp, Attrs: []types.LogAttr{{Key: "level", Value: "error"}}},
+		{Line: []byte("plain"), Source: "stderr", Timestamp: timestamp},
+	} {
+		require.NoError(t, stream.Log(msg))
+	}
+	require.NoError(t, stream.Close())
+
+	content, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	require.Len(t, lines, 2)
+
+	type jsonLog struct {
+		Log    string            `json:"log"`
+		Stream string            `json:"stream"`
+		Attrs  map[string]string `json:"attrs"`
+		Time   time.Time         `json:"time"`
+	}
+	var first, second jsonLog
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &second))
+	require.Equal(t, jsonLog{
+		Log:    `{"level":"error"}` + "\n",
+		Stream: "stdout",
+		Attrs:  map[string]string{"tag": "abc123def456", "level": "error"},
+		Time:   timestamp,
+	}, first)
+	require.Equal(t, jsonLog{
+		Log:    "plain\n",
+		Stream: "stderr",
+		Attrs:  map[string]string{"tag": "abc123def456"},
+		Time:   timestamp,
+	}, second)
+}
@@ -0,0 +1,92 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	types "github.com/docker/docker/api/types/backend"
+	dockerlogger "github.com/docker/docker/daemon/logger"
+)
+
+// DefaultJSONFields are the fields of JSON log lines promoted to message attributes by default.
+var DefaultJSONFields = []string{"level", "timestamp", "trace_id"}
+
+// JSONParseArgs sets which fields of the log lines which are JSON objects are promoted to message
+// attributes, so that log drivers supporting structured payloads can send them natively.
+type JSONParseArgs struct {
+	// Fields are the top-level fields promoted to message attributes, DefaultJSONFields if it's
+	// empty.
+	Fields []string
+}
+
+// jsonParser promotes fields of the log lines which are JSON objects to message attributes.
+type jsonParser struct {
+	fields []string
+}
+
+// newJSONParser validates the JSON parse arguments and creates the parser.
+func newJSONParser(args *JSONParseArgs) (*jsonParser, error) {
+	p := &jsonParser{fields: args.Fields}
+	if len(p.fields) == 0 {
+		p.fields = DefaultJSONFields
+	}
+	seen := make(map[string]bool, len(p.fields))
+	for _, field := range p.fields {
+		if field == "" {
+			return nil, errors.New("empty JSON field")
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("duplicate JSON field %s", field)
+		}
+		seen[field] = true
+	}
+	return p, nil
+}
+
+// parse adds the promoted fields of the log message to its attributes if it's a JSON object.
+// Partial log messages and the log messages which aren't valid JSON objects are left as they are.
+func (p *jsonParser) parse(msg *dockerlogger.Message) {
+	if msg.PLogMetaData != nil {
+		return
+	}
+	object, ok := ParseJSONObject(msg.Line)
+	if !ok {
+		return
+	}
+	for _, field := range p.fields {
+		value, ok := object[field]
+		if !ok {
+			continue
+		}
+		msg.Attrs = append(msg.Attrs, types.LogAttr{Key: field, Value: jsonFieldValue(value)})
+	}
+}
+
+// ParseJSONObject returns the fields of the log line if it's a JSON object, so that log drivers
+// can send it as a structured payload rather than as a string.
+func ParseJSONObject(line []byte) (map[string]json.RawMessage, bool) {
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil, false
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &object); err != nil {
+		return nil, false
+	}
+	return object, true
+}
+
+// jsonFieldValue returns the value of a JSON field as an attribute value, which is the string
+// itself for a JSON string, and the JSON text otherwise.
+func jsonFieldValue(value json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		return s
+	}
+	return string(value)
+}
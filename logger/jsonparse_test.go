@@ -0,0 +1,83 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package logger
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	types "github.com/docker/docker/api/types/backend"
+	"github.com/stretchr/testify/require"
+)
+
+// TestJSONParse tests that the configured fields of JSON log lines are promoted to message
+// attributes, and that the other log lines are sent as they are.
+func TestJSONParse(t *testing.T) {
+	stream := &fanOutRecorder{}
+	l, err := NewLogger(
+		WithInfo(NewInfo(testContainerID, testContainerName)),
+		WithStream(stream),
+		WithJSONParse(&JSONParseArgs{Fields: []string{"level", "trace_id", "status"}}),
+	)
+	require.NoError(t, err)
+	inner, ok := l.(*Logger)
+	require.True(t, ok)
+
+	lines := []string{
+		`{"level":"error","msg":"boom","trace_id":"abc","status":500,"ctx":{"user":1}}`,
+		`{"level":"info"`,
+		`not JSON`,
+		`["level"]`,
+	}
+	pipe := strings.NewReader(strings.Join(lines, "\n") + "\n")
+	require.NoError(t, l.Read(context.Background(), pipe, sourceSTDOUT, DefaultBufSizeInBytes, inner.sendLogMsgToDest))
+	require.Equal(t, lines, stream.lines())
+	require.Equal(t, []types.LogAttr{
+		{Key: "level", Value: "error"},
+		{Key: "trace_id", Value: "abc"},
+		{Key: "status", Value: "500"},
+	}, stream.messages[0].Attrs)
+	for _, msg := range stream.messages[1:] {
+		require.Empty(t, msg.Attrs)
+	}
+}
+
+// TestJSONParsePartialMessages tests that partial log messages aren't parsed.
+func TestJSONParsePartialMessages(t *testing.T) {
+	stream := &fanOutRecorder{}
+	l, err := NewLogger(
+		WithInfo(NewInfo(testContainerID, testContainerName)),
+		WithStream(stream),
+		WithJSONParse(&JSONParseArgs{}),
+		WithMaxReadBytes(4),
+	)
+	require.NoError(t, err)
+	inner, ok := l.(*Logger)
+	require.True(t, ok)
+
+	pipe := strings.NewReader(`{"level":"info"}` + "\n")
+	require.NoError(t, l.Read(context.Background(), pipe, sourceSTDOUT, 8, inner.sendLogMsgToDest))
+	require.NotEmpty(t, stream.messages)
+	for _, msg := range stream.messages {
+		require.NotNil(t, msg.PLogMetaData)
+		require.Empty(t, msg.Attrs)
+	}
+}
+
+// TestNewJSONParserWithError tests that invalid JSON fields are rejected.
+func TestNewJSONParserWithError(t *testing.T) {
+	for name, args := range map[string]*JSONParseArgs{
+		"empty field":     {Fields: []string{"level", ""}},
+		"duplicate field": {Fields: []string{"level", "level"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewLogger(WithJSONParse(args))
+			require.Error(t, err)
+		})
+	}
+}
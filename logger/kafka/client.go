@@ -0,0 +1,186 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !no_kafka
+
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/docker/docker/daemon/logger/jsonfilelog/jsonlog"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+
+	"github.com/aws/shim-loggers-for-containerd/debug"
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+const (
+	// maxBufferedRecords is the max number of messages which are buffered until they're produced.
+	// Log blocks once it's reached.
+	maxBufferedRecords = 10000
+	// flushTimeout bounds how long producing the buffered messages takes when the client is
+	// closed. The messages which are still buffered after are dropped.
+	flushTimeout = 10 * time.Second
+)
+
+// errClientClosed is returned when sending a log message after the client is closed.
+var errClientClosed = errors.New("kafka client is closed")
+
+// client produces log messages to the topic of the container with a Kafka producer, which
+// batches them per partition in the background.
+//
+// Log blocks while the buffer of the producer is full, which happens when the brokers don't keep
+// up, so that the container is slowed down in the blocking mode, and the buffer of the
+// non-blocking mode applies its overflow policy.
+type client struct {
+	producer *kgo.Client
+	topic    string
+	key      []byte
+	// attrs is the JSON of the attrs of every message, if any.
+	attrs json.RawMessage
+	// ctx is canceled once the client is closed, so that Log doesn't block anymore.
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+}
+
+// newClient creates a client producing messages with the given key and attrs to the topic.
+func newClient(cfg *config, topic, key string, attrs map[string]string) (*client, error) {
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(cfg.brokers...),
+		kgo.ClientID(logger.DaemonName),
+		kgo.DefaultProduceTopic(topic),
+		kgo.MaxBufferedRecords(maxBufferedRecords),
+	}
+	switch cfg.acks {
+	case LeaderAcks:
+		// Idempotent writes require the acks of all the in-sync replicas.
+		opts = append(opts, kgo.RequiredAcks(kgo.LeaderAck()), kgo.DisableIdempotentWrite())
+	case NoAcks:
+		opts = append(opts, kgo.RequiredAcks(kgo.NoAck()), kgo.DisableIdempotentWrite())
+	default:
+		opts = append(opts, kgo.RequiredAcks(kgo.AllISRAcks()))
+	}
+	switch cfg.compression {
+	case GzipCompression:
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.GzipCompression()))
+	case SnappyCompression:
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.SnappyCompression()))
+	case LZ4Compression:
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.Lz4Compression()))
+	case ZstdCompression:
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.ZstdCompression()))
+	default:
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.NoCompression()))
+	}
+	if cfg.tls != nil {
+		opts = append(opts, kgo.DialTLSConfig(cfg.tls))
+	}
+	switch cfg.saslMechanism {
+	case PlainMechanism:
+		opts = append(opts, kgo.SASL(plain.Auth{User: cfg.saslUsername, Pass: cfg.saslPassword}.AsMechanism()))
+	case ScramSHA256Mechanism:
+		opts = append(opts, kgo.SASL(scram.Auth{User: cfg.saslUsername, Pass: cfg.saslPassword}.AsSha256Mechanism()))
+	case ScramSHA512Mechanism:
+		opts = append(opts, kgo.SASL(scram.Auth{User: cfg.saslUsername, Pass: cfg.saslPassword}.AsSha512Mechanism()))
+	}
+
+	producer, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create producer: %w", err)
+	}
+
+	c := &client{
+		producer: producer,
+		topic:    topic,
+		key:      []byte(key),
+	}
+	if len(attrs) > 0 {
+		if c.attrs, err = json.Marshal(attrs); err != nil {
+			producer.Close()
+			return nil, fmt.Errorf("unable to encode attrs: %w", err)
+		}
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c, nil
+}
+
+// Log converts a log message to a message holding the same JSON as the json-file log driver, and
+// produces it asynchronously. It blocks if the buffer of the producer is full.
+func (c *client) Log(msg *dockerlogger.Message) error {
+	value, err := c.newValue(msg)
+	timestamp := msg.Timestamp
+	dockerlogger.PutMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	if c.ctx.Err() != nil {
+		return errClientClosed
+	}
+	record := &kgo.Record{Key: c.key, Value: value, Timestamp: timestamp}
+	c.producer.Produce(c.ctx, record, c.produced)
+	return nil
+}
+
+// newValue encodes a log message in the same way as the json-file log driver, i.e. with a
+// trailing newline in the log unless the log message is a partial one which isn't the last.
+func (c *client) newValue(msg *dockerlogger.Message) ([]byte, error) {
+	line := append([]byte{}, msg.Line...)
+	if msg.PLogMetaData == nil || msg.PLogMetaData.Last {
+		line = append(line, '\n')
+	}
+	var buf bytes.Buffer
+	err := (&jsonlog.JSONLogs{
+		Log:      line,
+		Stream:   msg.Source,
+		Created:  msg.Timestamp,
+		RawAttrs: c.attrs,
+	}).MarshalJSONBuf(&buf)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode log message: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// produced reports the messages which can't be produced, either because the brokers reject them
+// or because the client is closed before they're produced.
+func (c *client) produced(_ *kgo.Record, err error) {
+	if err == nil {
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		err = errClientClosed
+	}
+	debug.SendEvent(logger.DaemonName,
+		fmt.Sprintf("Failed to produce a message to topic %s: %s", c.topic, err),
+		debug.ERROR,
+		debug.Driver(DriverName),
+		debug.Lines(1),
+		debug.Err(err))
+}
+
+// Close produces the buffered messages, within the flush timeout, and closes the producer.
+func (c *client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		defer cancel()
+		if flushErr := c.producer.Flush(ctx); flushErr != nil {
+			err = fmt.Errorf("unable to produce the buffered messages: %w", flushErr)
+		}
+		c.cancel()
+		c.producer.Close()
+	})
+	return err
+}
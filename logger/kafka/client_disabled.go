@@ -0,0 +1,13 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build no_kafka
+
+package kafka
+
+import "errors"
+
+// newClient fails, since the shim logger is built with the no_kafka build tag.
+func newClient(_ *config, _, _ string, _ map[string]string) (streamCloser, error) {
+	return nil, errors.New("the kafka driver is not built in this shim logger")
+}
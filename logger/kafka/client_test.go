@@ -0,0 +1,144 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit && !no_kafka
+// +build unit,!no_kafka
+
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	types "github.com/docker/docker/api/types/backend"
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/docker/docker/daemon/logger/jsonfilelog/jsonlog"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+// consume returns the records of the topic.
+func consume(t *testing.T, cluster *kfake.Cluster, n int) []*kgo.Record {
+	consumer, err := kgo.NewClient(
+		kgo.SeedBrokers(cluster.ListenAddrs()...),
+		kgo.ConsumeTopics(testTopic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	require.NoError(t, err)
+	defer consumer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var records []*kgo.Record
+	for len(records) < n {
+		fetches := consumer.PollFetches(ctx)
+		require.NoError(t, ctx.Err())
+		fetches.EachRecord(func(r *kgo.Record) {
+			records = append(records, r)
+		})
+	}
+	return records
+}
+
+// TestClientProducesJSONFileMessages tests that log messages are produced to the rendered topic,
+// with the container ID as the key and the same JSON as the json-file log driver as the value.
+func TestClientProducesJSONFileMessages(t *testing.T) {
+	for _, compression := range []string{NoCompression, GzipCompression, SnappyCompression, LZ4Compression, ZstdCompression} {
+		t.Run(compression, func(t *testing.T) {
+			cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(2, testTopic))
+			require.NoError(t, err)
+			defer cluster.Close()
+
+			la := InitLogger(
+				&logger.GlobalArgs{ContainerID: testContainerID, ContainerName: testContainerName},
+				&logger.DockerConfigs{
+					ContainerImageName: testImageName,
+					ContainerLabels:    map[string]string{"team": "a"},
+				},
+				&Args{
+					Brokers:     strings.Join(cluster.ListenAddrs(), ","),
+					Topic:       `logs-team-{{index .Labels "team"}}`,
+					Compression: compression,
+					Labels:      "team",
+				},
+			)
+			stream, err := la.newStream()
+			require.NoError(t, err)
+
+			timestamp := time.Date(2020, time.January, 14, 1, 59, 0, 0, time.UTC)
+			for _, line := range []string{"first", "<second>"} {
+				msg := dockerlogger.NewMessage()
+				msg.Line = append(msg.Line, line...)
+				msg.Source = "stdout"
+				msg.Timestamp = timestamp
+				require.NoError(t, stream.Log(msg))
+			}
+			msg := dockerlogger.NewMessage()
+			msg.Line = append(msg.Line, "partial"...)
+			msg.Source = "stderr"
+			msg.Timestamp = timestamp
+			msg.PLogMetaData = &types.PartialLogMetaData{ID: "id", Ordinal: 1}
+			require.NoError(t, stream.Log(msg))
+			require.NoError(t, stream.Close())
+			require.ErrorIs(t, stream.Log(dockerlogger.NewMessage()), errClientClosed)
+
+			records := consume(t, cluster, 3)
+			require.Len(t, records, 3)
+			var logs []jsonlog.JSONLog
+			for _, r := range records {
+				require.Equal(t, testTopic, r.Topic)
+				require.Equal(t, testContainerID, string(r.Key))
+				require.True(t, timestamp.Equal(r.Timestamp))
+				var l jsonlog.JSONLog
+				require.NoError(t, json.Unmarshal(r.Value, &l))
+				logs = append(logs, l)
+			}
+			require.Equal(t, []jsonlog.JSONLog{
+				{Log: "first\n", Stream: "stdout", Created: timestamp, Attrs: map[string]string{"team": "a"}},
+				{Log: "<second>\n", Stream: "stdout", Created: timestamp, Attrs: map[string]string{"team": "a"}},
+				{Log: "partial", Stream: "stderr", Created: timestamp, Attrs: map[string]string{"team": "a"}},
+			}, logs)
+			// The value is byte for byte a line of the json-file log driver, without the newline.
+			require.Equal(t, `{"log":"first\n","stream":"stdout","attrs":{"team":"a"},"time":"2020-01-14T01:59:00Z"}`,
+				string(records[0].Value))
+		})
+	}
+}
+
+// TestClientAuthenticatesWithSASL tests that the producer authenticates with SASL.
+func TestClientAuthenticatesWithSASL(t *testing.T) {
+	for _, mechanism := range []string{PlainMechanism, ScramSHA256Mechanism, ScramSHA512Mechanism} {
+		t.Run(mechanism, func(t *testing.T) {
+			cluster, err := kfake.NewCluster(
+				kfake.NumBrokers(1),
+				kfake.SeedTopics(1, testTopic),
+				kfake.EnableSASL(),
+				kfake.Superuser(mechanism, "admin", "secret"),
+			)
+			require.NoError(t, err)
+			defer cluster.Close()
+
+			la := InitLogger(&logger.GlobalArgs{ContainerID: testContainerID}, nil, &Args{
+				Brokers:       strings.Join(cluster.ListenAddrs(), ","),
+				Topic:         testTopic,
+				SASLMechanism: mechanism,
+				SASLUsername:  "admin",
+				SASLPassword:  "secret",
+			})
+			stream, err := la.newStream()
+			require.NoError(t, err)
+			msg := dockerlogger.NewMessage()
+			msg.Line = append(msg.Line, "first"...)
+			msg.Source = "stdout"
+			msg.Timestamp = time.Now()
+			require.NoError(t, stream.Log(msg))
+			require.NoError(t, stream.Close())
+		})
+	}
+}
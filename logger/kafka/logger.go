@@ -0,0 +1,423 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package kafka provides a log driver producing container logs to a Kafka topic, as messages
+// holding the same JSON as the lines of the json-file log driver.
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/containerd/containerd/runtime/v2/logging"
+
+	"github.com/aws/shim-loggers-for-containerd/debug"
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+// kafka driver argument keys.
+const (
+	// DriverName is the name of the kafka log driver.
+	DriverName = "kafka"
+
+	// Required.
+
+	// BrokersKey is a comma-separated list of seed brokers, e.g. `broker-1:9092,broker-2:9092`.
+	BrokersKey = "kafka-brokers"
+	// TopicKey is the template of the topic, rendered once with the metadata of the container.
+	TopicKey = "kafka-topic"
+
+	// Optional.
+
+	// KeyKey is the template of the message keys, rendered once with the metadata of the
+	// container. It defaults to the container ID, so that the messages of a container are
+	// produced to the same partition, in order.
+	KeyKey = "kafka-key"
+	// AcksKey is either `all`, the default, `leader` or `none`.
+	AcksKey = "kafka-acks"
+	// CompressionKey is either `none`, the default, `gzip`, `snappy`, `lz4` or `zstd`.
+	CompressionKey = "kafka-compression"
+	// TLSKey connects to the brokers with TLS. It's implied by the other TLS arguments.
+	TLSKey = "kafka-tls"
+	// TLSCAFileKey is the path of the PEM file holding the CA certificates of the brokers,
+	// instead of the ones of the host.
+	TLSCAFileKey = "kafka-tls-ca-file"
+	// TLSCertFileKey is the path of the PEM file holding the client certificate.
+	TLSCertFileKey = "kafka-tls-cert-file"
+	// TLSKeyFileKey is the path of the PEM file holding the key of the client certificate.
+	TLSKeyFileKey = "kafka-tls-key-file"
+	// TLSInsecureSkipVerifyKey skips the verification of the certificates of the brokers.
+	TLSInsecureSkipVerifyKey = "kafka-tls-insecure-skip-verify"
+	// SASLMechanismKey is either `PLAIN`, `SCRAM-SHA-256` or `SCRAM-SHA-512`.
+	SASLMechanismKey = "kafka-sasl-mechanism"
+	// SASLUsernameKey is the username of the SASL authentication.
+	SASLUsernameKey = "kafka-sasl-username"
+	// SASLPasswordKey is the password of the SASL authentication.
+	SASLPasswordKey = "kafka-sasl-password" //nolint:gosec // not credentials
+	// SASLPasswordFileKey is the path of a file holding the password of the SASL authentication,
+	// which overrides SASLPasswordKey, so that it doesn't show up in the command line.
+	SASLPasswordFileKey = "kafka-sasl-password-file" //nolint:gosec // not credentials
+
+	// LabelsKey is the moby-side option key for label-based attrs (renamed from KafkaLabelsKey).
+	LabelsKey = "labels"
+	// LabelsRegexKey is the moby-side option key for label-regex attrs (renamed from
+	// KafkaLabelsRegexKey).
+	LabelsRegexKey = "labels-regex"
+	// EnvKey is the moby-side option key for env-based attrs (renamed from KafkaEnvKey).
+	EnvKey = "env"
+	// EnvRegexKey is the moby-side option key for env-regex attrs (renamed from KafkaEnvRegexKey).
+	EnvRegexKey = "env-regex"
+
+	// KafkaLabelsKey is the input parameter name for the labels list. The input parameters are
+	// prefixed to avoid collisions with the same options of other drivers.
+	KafkaLabelsKey = "kafka-labels"
+	// KafkaLabelsRegexKey is the input parameter name for the labels regex.
+	KafkaLabelsRegexKey = "kafka-labels-regex"
+	// KafkaEnvKey is the input parameter name for the env list.
+	KafkaEnvKey = "kafka-env"
+	// KafkaEnvRegexKey is the input parameter name for the env regex.
+	KafkaEnvRegexKey = "kafka-env-regex"
+)
+
+// Supported values and default values of the arguments.
+const (
+	AllAcks    = "all"
+	LeaderAcks = "leader"
+	NoAcks     = "none"
+
+	NoCompression     = "none"
+	GzipCompression   = "gzip"
+	SnappyCompression = "snappy"
+	LZ4Compression    = "lz4"
+	ZstdCompression   = "zstd"
+
+	PlainMechanism       = "PLAIN"
+	ScramSHA256Mechanism = "SCRAM-SHA-256"
+	ScramSHA512Mechanism = "SCRAM-SHA-512"
+
+	// DefaultKey is the default template of the message keys.
+	DefaultKey = "{{.ContainerID}}"
+)
+
+// Args represents kafka log driver arguments.
+type Args struct {
+	// Required.
+	Brokers string
+	Topic   string
+
+	// Optional.
+	Key                   string
+	Acks                  string
+	Compression           string
+	TLS                   string
+	TLSCAFile             string
+	TLSCertFile           string
+	TLSKeyFile            string
+	TLSInsecureSkipVerify string
+	SASLMechanism         string
+	SASLUsername          string
+	SASLPassword          string
+	Labels                string
+	LabelsRegex           string
+	Env                   string
+	EnvRegex              string
+}
+
+// LoggerArgs stores global logger args, docker configs and kafka specific args.
+type LoggerArgs struct {
+	globalArgs    *logger.GlobalArgs
+	dockerConfigs *logger.DockerConfigs
+	args          *Args
+}
+
+// InitLogger initializes the input arguments.
+func InitLogger(globalArgs *logger.GlobalArgs, dockerConfigs *logger.DockerConfigs, kafkaArgs *Args) *LoggerArgs {
+	return &LoggerArgs{
+		globalArgs:    globalArgs,
+		dockerConfigs: dockerConfigs,
+		args:          kafkaArgs,
+	}
+}
+
+// RunLogDriver initiates the kafka driver and starts producing container logs to the topic.
+// Errors with the log driver are logged but not returned to prevent container termination.
+func (la *LoggerArgs) RunLogDriver(ctx context.Context, config *logging.Config, ready func() error) error {
+	defer debug.DeferFuncForRunLogDriver()
+
+	stream, err := la.newStream()
+	if err != nil {
+		debug.ErrLogger = err
+		return debug.ErrLogger
+	}
+	// Produce the messages which are not produced yet before exiting.
+	defer stream.Close() //nolint:errcheck // errors are already logged
+
+	l, err := logger.NewPipelineLogger(la.globalArgs, config, logger.NewInfo(la.globalArgs.ContainerID, la.globalArgs.ContainerName), stream)
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("unable to create kafka driver: %w", err)
+		return debug.ErrLogger
+	}
+
+	// Start kafka driver.
+	debug.SendEventsToLog(logger.DaemonName, "Starting kafka driver", debug.INFO, 0)
+	err = l.Start(ctx, la.globalArgs.CleanupTime, ready)
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("failed to run kafka driver: %w", err)
+		// Do not return error if log driver has issue sending logs to destination, because if error
+		// returned here, containerd will identify this error and kill shim process, which will kill
+		// the container process accordingly.
+		// Note: the container will continue to run if shim logger exits after.
+		// Reference: https://github.com/containerd/containerd/blob/release/1.3/runtime/v2/logging/logging.go
+		return nil
+	}
+	debug.SendEventsToLog(logger.DaemonName, "Logging finished", debug.INFO, 1)
+
+	return nil
+}
+
+// NewStream creates the kafka stream, which is used when fanning out to multiple log drivers.
+func (la *LoggerArgs) NewStream() (logger.Client, error) {
+	stream, err := la.newStream()
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// streamCloser is the kafka stream, which produces the messages which are not produced yet once
+// it's closed.
+type streamCloser interface {
+	logger.Client
+	Close() error
+}
+
+// newStream validates the log options and creates the kafka stream, with the topic and the key
+// of the container.
+func (la *LoggerArgs) newStream() (streamCloser, error) {
+	cfg, err := getKafkaConfig(la.args)
+	if err != nil {
+		return nil, fmt.Errorf("unable to validate log options: %w", err)
+	}
+
+	info := logger.NewInfo(la.globalArgs.ContainerID, la.globalArgs.ContainerName,
+		logger.WithConfig(attrsConfig(la.args)))
+	if la.dockerConfigs != nil {
+		info = logger.UpdateDockerConfigs(info, la.dockerConfigs)
+	}
+	fields := templateFields{
+		ContainerID:   info.ContainerID,
+		ContainerName: info.ContainerName,
+		ImageName:     info.ContainerImageName,
+		ImageID:       info.ContainerImageID,
+		Labels:        info.ContainerLabels,
+	}
+	topic, err := render(cfg.topic, fields)
+	if err != nil {
+		return nil, fmt.Errorf("unable to render %s: %w", TopicKey, err)
+	}
+	if topic == "" {
+		return nil, fmt.Errorf("%s is rendered as an empty topic", TopicKey)
+	}
+	key, err := render(cfg.key, fields)
+	if err != nil {
+		return nil, fmt.Errorf("unable to render %s: %w", KeyKey, err)
+	}
+	attrs, err := info.ExtraAttributes(nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get attrs: %w", err)
+	}
+
+	stream, err := newClient(cfg, topic, key, attrs)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create stream: %w", err)
+	}
+
+	return stream, nil
+}
+
+// attrsConfig is the moby-side config of the attrs of the messages, in the same way as the
+// json-file log driver. Options are only set when non-empty.
+func attrsConfig(args *Args) map[string]string {
+	config := make(map[string]string)
+	for key, value := range map[string]string{
+		LabelsKey:      args.Labels,
+		LabelsRegexKey: args.LabelsRegex,
+		EnvKey:         args.Env,
+		EnvRegexKey:    args.EnvRegex,
+	} {
+		if value != "" {
+			config[key] = value
+		}
+	}
+	return config
+}
+
+// templateFields are the fields of the topic and key templates.
+type templateFields struct {
+	ContainerID   string
+	ContainerName string
+	ImageName     string
+	ImageID       string
+	Labels        map[string]string
+}
+
+// config is the validated kafka log driver arguments.
+type config struct {
+	brokers       []string
+	topic         *template.Template
+	key           *template.Template
+	acks          string
+	compression   string
+	tls           *tls.Config
+	saslMechanism string
+	saslUsername  string
+	saslPassword  string
+}
+
+// getKafkaConfig validates the kafka log driver arguments and sets the default values.
+func getKafkaConfig(args *Args) (*config, error) {
+	cfg := &config{
+		acks:          args.Acks,
+		compression:   args.Compression,
+		saslMechanism: args.SASLMechanism,
+		saslUsername:  args.SASLUsername,
+		saslPassword:  args.SASLPassword,
+	}
+
+	for _, broker := range strings.Split(args.Brokers, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			cfg.brokers = append(cfg.brokers, broker)
+		}
+	}
+	if len(cfg.brokers) == 0 {
+		return nil, fmt.Errorf("%s is empty", BrokersKey)
+	}
+
+	var err error
+	if cfg.topic, err = parseTemplate("topic", args.Topic); err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", TopicKey, args.Topic, err)
+	}
+	key := args.Key
+	if key == "" {
+		key = DefaultKey
+	}
+	if cfg.key, err = parseTemplate("key", key); err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", KeyKey, key, err)
+	}
+
+	switch cfg.acks {
+	case "":
+		cfg.acks = AllAcks
+	case AllAcks, LeaderAcks, NoAcks:
+	default:
+		return nil, fmt.Errorf("unknown %s: %s", AcksKey, args.Acks)
+	}
+	switch cfg.compression {
+	case "":
+		cfg.compression = NoCompression
+	case NoCompression, GzipCompression, SnappyCompression, LZ4Compression, ZstdCompression:
+	default:
+		return nil, fmt.Errorf("unknown %s: %s", CompressionKey, args.Compression)
+	}
+
+	if cfg.tls, err = getTLSConfig(args); err != nil {
+		return nil, err
+	}
+
+	switch cfg.saslMechanism {
+	case "":
+		if cfg.saslUsername != "" || cfg.saslPassword != "" {
+			return nil, fmt.Errorf("%s is required with %s and %s", SASLMechanismKey, SASLUsernameKey, SASLPasswordKey)
+		}
+	case PlainMechanism, ScramSHA256Mechanism, ScramSHA512Mechanism:
+		if cfg.saslUsername == "" {
+			return nil, fmt.Errorf("%s is required with %s", SASLUsernameKey, SASLMechanismKey)
+		}
+	default:
+		return nil, fmt.Errorf("unknown %s: %s", SASLMechanismKey, args.SASLMechanism)
+	}
+
+	return cfg, nil
+}
+
+// parseTemplate parses a template, and renders it once so that templates referring to unknown
+// fields are rejected.
+func parseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := render(tmpl, templateFields{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+func render(tmpl *template.Template, fields templateFields) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, fields); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// getTLSConfig returns the TLS config of the connections to the brokers, or nil if TLS is not
+// used.
+func getTLSConfig(args *Args) (*tls.Config, error) {
+	enabled, err := parseOptionalBool(TLSKey, args.TLS)
+	if err != nil {
+		return nil, err
+	}
+	insecureSkipVerify, err := parseOptionalBool(TLSInsecureSkipVerifyKey, args.TLSInsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled && !insecureSkipVerify && args.TLSCAFile == "" && args.TLSCertFile == "" && args.TLSKeyFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: insecureSkipVerify, //nolint:gosec // explicitly opted in
+	}
+	if args.TLSCAFile != "" {
+		pem, err := os.ReadFile(args.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s %s: %w", TLSCAFileKey, args.TLSCAFile, err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("invalid %s %s: no certificate is found", TLSCAFileKey, args.TLSCAFile)
+		}
+	}
+	if (args.TLSCertFile == "") != (args.TLSKeyFile == "") {
+		return nil, fmt.Errorf("%s and %s are required together", TLSCertFileKey, TLSKeyFileKey)
+	}
+	if args.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(args.TLSCertFile, args.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// parseOptionalBool parses the value of a boolean argument, which is false if it's not set.
+func parseOptionalBool(key, value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %s: %w", key, value, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,64 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package kafka
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testContainerID   = "test-container-id"
+	testContainerName = "test-container-name"
+	testImageName     = "test-image-name"
+	testTopic         = "logs-team-a"
+)
+
+// TestGetKafkaConfig tests that the arguments are validated and the default values are set.
+func TestGetKafkaConfig(t *testing.T) {
+	cfg, err := getKafkaConfig(&Args{Brokers: "broker-1:9092, broker-2:9092", Topic: "logs"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"broker-1:9092", "broker-2:9092"}, cfg.brokers)
+	require.Equal(t, AllAcks, cfg.acks)
+	require.Equal(t, NoCompression, cfg.compression)
+	require.Nil(t, cfg.tls)
+	key, err := render(cfg.key, templateFields{ContainerID: testContainerID})
+	require.NoError(t, err)
+	require.Equal(t, testContainerID, key)
+
+	cfg, err = getKafkaConfig(&Args{
+		Brokers:               "broker:9093",
+		Topic:                 "logs",
+		TLSInsecureSkipVerify: "true",
+		SASLMechanism:         ScramSHA512Mechanism,
+		SASLUsername:          "admin",
+	})
+	require.NoError(t, err)
+	require.NotNil(t, cfg.tls)
+	require.True(t, cfg.tls.InsecureSkipVerify)
+
+	for name, args := range map[string]*Args{
+		"brokers":        {Brokers: " , ", Topic: "logs"},
+		"topic":          {Brokers: "broker:9092", Topic: "{{.ContainerName"},
+		"topic field":    {Brokers: "broker:9092", Topic: "{{.Hostname}}"},
+		"key":            {Brokers: "broker:9092", Topic: "logs", Key: "{{.Hostname}}"},
+		"acks":           {Brokers: "broker:9092", Topic: "logs", Acks: "1"},
+		"compression":    {Brokers: "broker:9092", Topic: "logs", Compression: "brotli"},
+		"tls":            {Brokers: "broker:9092", Topic: "logs", TLS: "yes"},
+		"tls ca file":    {Brokers: "broker:9092", Topic: "logs", TLSCAFile: "/nonexistent/ca.pem"},
+		"tls key file":   {Brokers: "broker:9092", Topic: "logs", TLSCertFile: "/nonexistent/cert.pem"},
+		"sasl mechanism": {Brokers: "broker:9092", Topic: "logs", SASLMechanism: "GSSAPI", SASLUsername: "admin"},
+		"sasl username":  {Brokers: "broker:9092", Topic: "logs", SASLMechanism: PlainMechanism},
+		"sasl password":  {Brokers: "broker:9092", Topic: "logs", SASLPassword: "secret"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := getKafkaConfig(args)
+			require.Error(t, err)
+		})
+	}
+}
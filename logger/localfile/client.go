@@ -0,0 +1,120 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package localfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+// jsonLine is a log line with the jsonl format.
+type jsonLine struct {
+	Time          string `json:"time"`
+	Stream        string `json:"stream"`
+	Log           string `json:"log"`
+	ContainerID   string `json:"container_id,omitempty"`
+	ContainerName string `json:"container_name,omitempty"`
+}
+
+// client writes log messages to the log file, and reopens it when the shim logger receives
+// SIGHUP, so that external tools such as logrotate can rotate it too.
+type client struct {
+	file          *rotatingFile
+	format        string
+	containerID   string
+	containerName string
+
+	// signals receives the signals after which the log file is reopened.
+	signals chan os.Signal
+	// done is closed once signals aren't handled anymore after the client is closed.
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newClient creates a client writing the log messages of the container to the log file.
+func newClient(cfg *config, globalArgs *logger.GlobalArgs) (*client, error) {
+	file, err := newRotatingFile(cfg, time.Now)
+	if err != nil {
+		return nil, err
+	}
+	c := &client{
+		file:          file,
+		format:        cfg.format,
+		containerID:   globalArgs.ContainerID,
+		containerName: globalArgs.ContainerName,
+		signals:       make(chan os.Signal, 1),
+		done:          make(chan struct{}),
+	}
+	notifyReopen(c.signals)
+	go c.handleSignals()
+
+	return c, nil
+}
+
+// handleSignals reopens the log file every time a signal is received.
+func (c *client) handleSignals() {
+	defer close(c.done)
+	for range c.signals {
+		if err := c.file.Reopen(); err != nil {
+			report("Failed to reopen log file", err)
+		}
+	}
+}
+
+// Log writes a log message to the log file. Partial log messages are written without a trailing
+// newline with the text format, except for the last one, so that they're reassembled.
+func (c *client) Log(msg *dockerlogger.Message) error {
+	line, err := c.encode(msg)
+	dockerlogger.PutMessage(msg)
+	if err != nil {
+		return err
+	}
+	_, err = c.file.Write(line)
+	return err
+}
+
+// encode encodes a log message with the format of the log file.
+func (c *client) encode(msg *dockerlogger.Message) ([]byte, error) {
+	if c.format == TextFormat {
+		line := append([]byte{}, msg.Line...)
+		if msg.PLogMetaData == nil || msg.PLogMetaData.Last {
+			line = append(line, '\n')
+		}
+		return line, nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	// Keep the log lines as they are rather than escaping HTML characters.
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(jsonLine{
+		Time:          msg.Timestamp.UTC().Format(time.RFC3339Nano),
+		Stream:        msg.Source,
+		Log:           string(msg.Line),
+		ContainerID:   c.containerID,
+		ContainerName: c.containerName,
+	}); err != nil {
+		return nil, fmt.Errorf("unable to encode log message: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Close stops handling signals, and syncs and closes the log file.
+func (c *client) Close() error {
+	c.closeOnce.Do(func() {
+		signal.Stop(c.signals)
+		close(c.signals)
+		<-c.done
+	})
+	return c.file.Close()
+}
@@ -0,0 +1,431 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package localfile
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/aws/shim-loggers-for-containerd/debug"
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+const (
+	// logDirMode is the permission mode of the directory of the log file, in the same way as the
+	// json-file log driver. Setgid ensures new files inherit the group of the directory.
+	logDirMode = os.FileMode(02750)
+	// logFileMode is the permission mode of the log file and the rotated files.
+	logFileMode = os.FileMode(0o640)
+	// rotatedTimeLayout is the layout of the time of the rotation in the names of the rotated
+	// files, e.g. `app.log.20200114T015900.000000000Z`, which sorts them in rotation order.
+	rotatedTimeLayout = "20060102T150405.000000000Z"
+	// tmpExt is the extension of a rotated file while it's compressed.
+	tmpExt = ".tmp"
+)
+
+// errFileClosed is returned when writing to the log file after it's closed.
+var errFileClosed = errors.New("log file is closed")
+
+// compressionExts are the extensions of the rotated files by compression.
+var compressionExts = map[string]string{
+	GzipCompression: ".gz",
+	ZstdCompression: ".zst",
+}
+
+// rotatingFile is a log file which is rotated by size or time. Rotated files are compressed and
+// pruned in the background, so that writes aren't blocked by them.
+type rotatingFile struct {
+	cfg *config
+	now func() time.Time
+
+	// lock protects the fields below, and serializes the writes to the log file.
+	lock sync.Mutex
+	file *os.File
+	size int64
+	// dirty is whether log lines are written since the log file was last synced.
+	dirty bool
+	// nextRotation is when the log file is rotated with hourly and daily rotation.
+	nextRotation time.Time
+	closed       bool
+
+	// rotated triggers the compression and pruning of the rotated files.
+	rotated chan struct{}
+	// stopSync stops syncing the log file at the fsync interval.
+	stopSync chan struct{}
+	// wg waits for the background goroutines once the file is closed.
+	wg sync.WaitGroup
+}
+
+// newRotatingFile opens the log file, creating it along with its directory if they don't exist.
+// Rotated files from previous runs are compressed and pruned too.
+func newRotatingFile(cfg *config, now func() time.Time) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.path), logDirMode); err != nil {
+		return nil, fmt.Errorf("unable to create log directory %s: %w", filepath.Dir(cfg.path), err)
+	}
+	f := &rotatingFile{
+		cfg:      cfg,
+		now:      now,
+		rotated:  make(chan struct{}, 1),
+		stopSync: make(chan struct{}),
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	f.rotated <- struct{}{}
+	f.wg.Add(1)
+	go f.maintain()
+	if cfg.fsyncInterval > 0 {
+		f.wg.Add(1)
+		go f.syncPeriodically()
+	}
+	return f, nil
+}
+
+// open opens the log file in append mode. With hourly and daily rotation, a log file which
+// already has log lines is rotated at the end of the hour or day it was last modified.
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.cfg.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, logFileMode)
+	if err != nil {
+		return fmt.Errorf("unable to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close() //nolint:errcheck,gosec // nothing to do
+		return fmt.Errorf("unable to stat log file: %w", err)
+	}
+	f.file, f.size, f.dirty = file, info.Size(), false
+	if f.size > 0 {
+		f.nextRotation = f.nextBoundary(info.ModTime())
+	} else {
+		f.nextRotation = f.nextBoundary(f.now())
+	}
+	return nil
+}
+
+// nextBoundary returns the start of the hour or day after t, in local time.
+func (f *rotatingFile) nextBoundary(t time.Time) time.Time {
+	t = t.Local()
+	switch f.cfg.rotate {
+	case HourlyRotation:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, time.Local)
+	case DailyRotation:
+		return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.Local)
+	default:
+		return time.Time{}
+	}
+}
+
+// Write writes log lines to the log file, after rotating it if it's due. The log file is only
+// rotated if it has log lines, so that no empty rotated file is left behind.
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return 0, errFileClosed
+	}
+
+	dueByTime := !f.nextRotation.IsZero() && !f.now().Before(f.nextRotation)
+	dueBySize := f.cfg.maxSize > 0 && f.size+int64(len(p)) > f.cfg.maxSize
+	if f.size > 0 && (dueByTime || dueBySize) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	} else if dueByTime {
+		f.nextRotation = f.nextBoundary(f.now())
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	f.dirty = true
+	if err != nil {
+		return n, fmt.Errorf("unable to write to log file: %w", err)
+	}
+	if f.cfg.fsync == AlwaysFsync {
+		if err := f.sync(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// rotate renames the log file with the time of the rotation, and opens a new one. The log file is
+// opened again even if it can't be renamed, so that log lines keep being written.
+func (f *rotatingFile) rotate() error {
+	closeErr := f.closeFile()
+	renameErr := os.Rename(f.cfg.path, f.rotatedName(f.now()))
+	if err := f.open(); err != nil {
+		return err
+	}
+	if err := errors.Join(closeErr, renameErr); err != nil {
+		return fmt.Errorf("unable to rotate log file: %w", err)
+	}
+
+	select {
+	case f.rotated <- struct{}{}:
+	default:
+		// The rotated files are going to be compressed and pruned already.
+	}
+	return nil
+}
+
+// rotatedName returns the name of a rotated file with the time of the rotation, which is moved
+// forward if a rotated file already has the name, e.g. with a coarse clock.
+func (f *rotatingFile) rotatedName(t time.Time) string {
+	for {
+		name := f.cfg.path + "." + t.UTC().Format(rotatedTimeLayout)
+		if !exists(name) && !exists(name+compressionExts[f.cfg.compression]) {
+			return name
+		}
+		t = t.Add(time.Nanosecond)
+	}
+}
+
+// exists returns whether a file exists.
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// Reopen closes the log file and opens it again, so that a new log file is created once an
+// external tool such as logrotate has moved it.
+func (f *rotatingFile) Reopen() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return errFileClosed
+	}
+	closeErr := f.closeFile()
+	if err := f.open(); err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// sync syncs the log file to disk if log lines are written since it was last synced.
+func (f *rotatingFile) sync() error {
+	if !f.dirty {
+		return nil
+	}
+	if err := f.file.Sync(); err != nil {
+		return fmt.Errorf("unable to sync log file: %w", err)
+	}
+	f.dirty = false
+	return nil
+}
+
+// closeFile syncs and closes the log file.
+func (f *rotatingFile) closeFile() error {
+	syncErr := f.sync()
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("unable to close log file: %w", err)
+	}
+	return syncErr
+}
+
+// syncPeriodically syncs the log file at the fsync interval until the file is closed.
+func (f *rotatingFile) syncPeriodically() {
+	defer f.wg.Done()
+	ticker := time.NewTicker(f.cfg.fsyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			f.lock.Lock()
+			var err error
+			if !f.closed {
+				err = f.sync()
+			}
+			f.lock.Unlock()
+			if err != nil {
+				report("Failed to sync log file", err)
+			}
+		case <-f.stopSync:
+			return
+		}
+	}
+}
+
+// Close syncs and closes the log file, and waits for the rotated files to be compressed and
+// pruned.
+func (f *rotatingFile) Close() error {
+	f.lock.Lock()
+	if f.closed {
+		f.lock.Unlock()
+		return nil
+	}
+	f.closed = true
+	err := f.closeFile()
+	f.lock.Unlock()
+
+	close(f.stopSync)
+	close(f.rotated)
+	f.wg.Wait()
+	return err
+}
+
+// maintain compresses and prunes the rotated files every time the log file is rotated.
+func (f *rotatingFile) maintain() {
+	defer f.wg.Done()
+	for range f.rotated {
+		f.compressRotated()
+		f.prune()
+	}
+}
+
+// rotatedFile is a rotated file of the log file.
+type rotatedFile struct {
+	path       string
+	compressed bool
+}
+
+// rotatedFiles returns the rotated files of the log file, from the oldest to the newest.
+func (f *rotatingFile) rotatedFiles() ([]rotatedFile, error) {
+	entries, err := os.ReadDir(filepath.Dir(f.cfg.path))
+	if err != nil {
+		return nil, fmt.Errorf("unable to list rotated files: %w", err)
+	}
+	prefix := filepath.Base(f.cfg.path) + "."
+	var files []rotatedFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		suffix := strings.TrimPrefix(name, prefix)
+		compressed := false
+		for _, ext := range compressionExts {
+			if strings.HasSuffix(suffix, ext) {
+				suffix, compressed = strings.TrimSuffix(suffix, ext), true
+				break
+			}
+		}
+		if _, err := time.Parse(rotatedTimeLayout, suffix); err != nil {
+			// Not a rotated file, or a rotated file which is being compressed.
+			continue
+		}
+		files = append(files, rotatedFile{path: filepath.Join(filepath.Dir(f.cfg.path), name), compressed: compressed})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files, nil
+}
+
+// compressRotated compresses the rotated files which aren't compressed yet.
+func (f *rotatingFile) compressRotated() {
+	if f.cfg.compression == NoCompression {
+		return
+	}
+	files, err := f.rotatedFiles()
+	if err != nil {
+		report("Failed to compress rotated files", err)
+		return
+	}
+	for _, file := range files {
+		if file.compressed {
+			continue
+		}
+		if err := compressFile(file.path, f.cfg.compression); err != nil {
+			report("Failed to compress rotated file "+file.path, err)
+		}
+	}
+}
+
+// compressFile compresses a rotated file into a file with the extension of the compression, and
+// removes it. The compressed file is written under a temporary name until it's complete.
+func compressFile(path, compression string) (err error) {
+	src, err := os.Open(path) //nolint:gosec // the rotated files are in the directory of the log file
+	if err != nil {
+		return err
+	}
+	defer src.Close() //nolint:errcheck // read only
+
+	dstPath := path + compressionExts[compression]
+	dst, err := os.OpenFile(dstPath+tmpExt, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, logFileMode)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			dst.Close()                 //nolint:errcheck,gosec // the file is removed
+			os.Remove(dstPath + tmpExt) //nolint:errcheck,gosec // best effort
+		}
+	}()
+
+	var w io.WriteCloser
+	switch compression {
+	case ZstdCompression:
+		if w, err = zstd.NewWriter(dst, zstd.WithEncoderConcurrency(1)); err != nil {
+			return err
+		}
+	default:
+		w = gzip.NewWriter(dst)
+	}
+	if _, err = io.Copy(w, src); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	if err = dst.Sync(); err != nil {
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(dstPath+tmpExt, dstPath); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// prune removes the oldest rotated files once there are more than the max number of files, or
+// once their total size is more than the max total size.
+func (f *rotatingFile) prune() {
+	if f.cfg.maxFiles == 0 && f.cfg.maxTotalSize == 0 {
+		return
+	}
+	files, err := f.rotatedFiles()
+	if err != nil {
+		report("Failed to prune rotated files", err)
+		return
+	}
+
+	var (
+		kept      int
+		totalSize int64
+	)
+	for i := len(files) - 1; i >= 0; i-- {
+		info, err := os.Stat(files[i].path)
+		if err != nil {
+			continue
+		}
+		kept++
+		totalSize += info.Size()
+		if (f.cfg.maxFiles > 0 && kept > f.cfg.maxFiles) ||
+			(f.cfg.maxTotalSize > 0 && totalSize > f.cfg.maxTotalSize) {
+			if err := os.Remove(files[i].path); err != nil {
+				report("Failed to remove rotated file "+files[i].path, err)
+			}
+		}
+	}
+}
+
+// report reports an error which doesn't prevent log lines from being written.
+func report(msg string, err error) {
+	debug.SendEvent(logger.DaemonName,
+		fmt.Sprintf("%s: %s", msg, err),
+		debug.ERROR,
+		debug.Driver(DriverName),
+		debug.Err(err))
+}
@@ -0,0 +1,245 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package localfile provides the local-file log driver, which writes container logs to a file on
+// the host with its own rotation, retention and compression, rather than moby's jsonfilelog.
+package localfile
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/containerd/containerd/runtime/v2/logging"
+	"github.com/docker/go-units"
+
+	"github.com/aws/shim-loggers-for-containerd/debug"
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+// local-file driver argument keys.
+const (
+	// DriverName is the name of the local-file log driver.
+	DriverName = "local-file"
+
+	// Required.
+
+	// PathKey is the path of the log file. Its parent directory is created if it doesn't exist.
+	PathKey = "local-file-path"
+
+	// Optional.
+
+	// FormatKey is either `text`, the default, for the log lines as they are, or `jsonl` for a
+	// JSON object per log line.
+	FormatKey = "local-file-format"
+	// MaxSizeKey is the size after which the log file is rotated, e.g. `10m`.
+	MaxSizeKey = "local-file-max-size"
+	// RotateKey rotates the log file every hour or day, either `hourly` or `daily`.
+	RotateKey = "local-file-rotate"
+	// MaxFilesKey is the max number of rotated files which are kept.
+	MaxFilesKey = "local-file-max-files"
+	// MaxTotalSizeKey is the max total size of the rotated files which are kept, e.g. `1g`.
+	MaxTotalSizeKey = "local-file-max-total-size"
+	// CompressionKey compresses the rotated files, either `none`, the default, `gzip` or `zstd`.
+	CompressionKey = "local-file-compression"
+	// FsyncKey is when the log file is synced to disk, either `never`, the default, `always`
+	// after every log line, or an interval, e.g. `1s`.
+	FsyncKey = "local-file-fsync"
+)
+
+// Supported values and default values of the arguments.
+const (
+	TextFormat      = "text"
+	JSONLinesFormat = "jsonl"
+
+	HourlyRotation = "hourly"
+	DailyRotation  = "daily"
+
+	NoCompression   = "none"
+	GzipCompression = "gzip"
+	ZstdCompression = "zstd"
+
+	NeverFsync  = "never"
+	AlwaysFsync = "always"
+)
+
+// Args represents local-file log driver arguments.
+type Args struct {
+	// Required.
+	Path string
+
+	// Optional.
+	Format       string
+	MaxSize      string
+	Rotate       string
+	MaxFiles     string
+	MaxTotalSize string
+	Compression  string
+	Fsync        string
+}
+
+// LoggerArgs stores global logger args and local-file specific args.
+type LoggerArgs struct {
+	globalArgs *logger.GlobalArgs
+	args       *Args
+}
+
+// InitLogger initializes the input arguments.
+func InitLogger(globalArgs *logger.GlobalArgs, localFileArgs *Args) *LoggerArgs {
+	return &LoggerArgs{
+		globalArgs: globalArgs,
+		args:       localFileArgs,
+	}
+}
+
+// RunLogDriver initiates the local-file driver and starts writing container logs to the log file.
+// Errors with the log driver are logged but not returned to prevent container termination.
+func (la *LoggerArgs) RunLogDriver(ctx context.Context, config *logging.Config, ready func() error) error {
+	defer debug.DeferFuncForRunLogDriver()
+
+	stream, err := la.newStream()
+	if err != nil {
+		debug.ErrLogger = err
+		return debug.ErrLogger
+	}
+	// Sync and close the log file before exiting.
+	defer stream.Close() //nolint:errcheck // errors are already logged
+
+	l, err := logger.NewPipelineLogger(la.globalArgs, config, logger.NewInfo(la.globalArgs.ContainerID, la.globalArgs.ContainerName), stream)
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("unable to create local-file driver: %w", err)
+		return debug.ErrLogger
+	}
+
+	// Start local-file driver.
+	debug.SendEventsToLog(logger.DaemonName, "Starting local-file driver", debug.INFO, 0)
+	err = l.Start(ctx, la.globalArgs.CleanupTime, ready)
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("failed to run local-file driver: %w", err)
+		// Do not return error if log driver has issue sending logs to destination, because if error
+		// returned here, containerd will identify this error and kill shim process, which will kill
+		// the container process accordingly.
+		// Note: the container will continue to run if shim logger exits after.
+		// Reference: https://github.com/containerd/containerd/blob/release/1.3/runtime/v2/logging/logging.go
+		return nil
+	}
+	debug.SendEventsToLog(logger.DaemonName, "Logging finished", debug.INFO, 1)
+
+	return nil
+}
+
+// NewStream creates the local-file stream, which is used when fanning out to multiple log drivers.
+func (la *LoggerArgs) NewStream() (logger.Client, error) {
+	stream, err := la.newStream()
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// newStream validates the log options and creates the local-file stream.
+func (la *LoggerArgs) newStream() (*client, error) {
+	cfg, err := getLocalFileConfig(la.args)
+	if err != nil {
+		return nil, fmt.Errorf("unable to validate log options: %w", err)
+	}
+	c, err := newClient(cfg, la.globalArgs)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create stream: %w", err)
+	}
+	return c, nil
+}
+
+// config is the validated local-file log driver arguments.
+type config struct {
+	path         string
+	format       string
+	maxSize      int64
+	rotate       string
+	maxFiles     int
+	maxTotalSize int64
+	compression  string
+	fsync        string
+	// fsyncInterval is only set if the log file is synced to disk at an interval.
+	fsyncInterval time.Duration
+}
+
+// getLocalFileConfig validates the local-file log driver arguments and sets the default values.
+func getLocalFileConfig(args *Args) (*config, error) {
+	path, err := filepath.Abs(args.Path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", PathKey, args.Path, err)
+	}
+	cfg := &config{
+		path:        path,
+		format:      args.Format,
+		rotate:      args.Rotate,
+		compression: args.Compression,
+		fsync:       args.Fsync,
+	}
+
+	switch cfg.format {
+	case "":
+		cfg.format = TextFormat
+	case TextFormat, JSONLinesFormat:
+	default:
+		return nil, fmt.Errorf("unknown %s: %s", FormatKey, args.Format)
+	}
+
+	if args.MaxSize != "" {
+		if cfg.maxSize, err = units.RAMInBytes(args.MaxSize); err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", MaxSizeKey, args.MaxSize, err)
+		}
+		if cfg.maxSize <= 0 {
+			return nil, fmt.Errorf("invalid %s %s: must be positive", MaxSizeKey, args.MaxSize)
+		}
+	}
+	switch cfg.rotate {
+	case "", HourlyRotation, DailyRotation:
+	default:
+		return nil, fmt.Errorf("unknown %s: %s", RotateKey, args.Rotate)
+	}
+
+	if args.MaxFiles != "" {
+		if cfg.maxFiles, err = strconv.Atoi(args.MaxFiles); err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", MaxFilesKey, args.MaxFiles, err)
+		}
+		if cfg.maxFiles <= 0 {
+			return nil, fmt.Errorf("invalid %s %s: must be positive", MaxFilesKey, args.MaxFiles)
+		}
+	}
+	if args.MaxTotalSize != "" {
+		if cfg.maxTotalSize, err = units.RAMInBytes(args.MaxTotalSize); err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", MaxTotalSizeKey, args.MaxTotalSize, err)
+		}
+		if cfg.maxTotalSize <= 0 {
+			return nil, fmt.Errorf("invalid %s %s: must be positive", MaxTotalSizeKey, args.MaxTotalSize)
+		}
+	}
+
+	switch cfg.compression {
+	case "":
+		cfg.compression = NoCompression
+	case NoCompression, GzipCompression, ZstdCompression:
+	default:
+		return nil, fmt.Errorf("unknown %s: %s", CompressionKey, args.Compression)
+	}
+
+	switch cfg.fsync {
+	case "":
+		cfg.fsync = NeverFsync
+	case NeverFsync, AlwaysFsync:
+	default:
+		if cfg.fsyncInterval, err = time.ParseDuration(args.Fsync); err != nil {
+			return nil, fmt.Errorf("invalid %s %s: must be %s, %s or an interval: %w",
+				FsyncKey, args.Fsync, NeverFsync, AlwaysFsync, err)
+		}
+		if cfg.fsyncInterval <= 0 {
+			return nil, fmt.Errorf("invalid %s %s: must be positive", FsyncKey, args.Fsync)
+		}
+	}
+
+	return cfg, nil
+}
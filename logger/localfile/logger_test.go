@@ -0,0 +1,312 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package localfile
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	types "github.com/docker/docker/api/types/backend"
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+const (
+	testContainerID   = "test-container-id"
+	testContainerName = "test-container-name"
+)
+
+// TestGetLocalFileConfig tests that the arguments are validated and the default values are set.
+func TestGetLocalFileConfig(t *testing.T) {
+	cfg, err := getLocalFileConfig(&Args{Path: "/var/log/containers/app.log"})
+	require.NoError(t, err)
+	require.Equal(t, "/var/log/containers/app.log", cfg.path)
+	require.Equal(t, TextFormat, cfg.format)
+	require.Zero(t, cfg.maxSize)
+	require.Empty(t, cfg.rotate)
+	require.Equal(t, NoCompression, cfg.compression)
+	require.Equal(t, NeverFsync, cfg.fsync)
+
+	cfg, err = getLocalFileConfig(&Args{
+		Path:         "/var/log/containers/app.log",
+		Format:       JSONLinesFormat,
+		MaxSize:      "10m",
+		Rotate:       DailyRotation,
+		MaxFiles:     "5",
+		MaxTotalSize: "1g",
+		Compression:  ZstdCompression,
+		Fsync:        "1s",
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(10*1024*1024), cfg.maxSize)
+	require.Equal(t, 5, cfg.maxFiles)
+	require.Equal(t, int64(1024*1024*1024), cfg.maxTotalSize)
+	require.Equal(t, time.Second, cfg.fsyncInterval)
+
+	for name, args := range map[string]*Args{
+		"format":         {Path: "app.log", Format: "csv"},
+		"max size":       {Path: "app.log", MaxSize: "0"},
+		"rotate":         {Path: "app.log", Rotate: "weekly"},
+		"max files":      {Path: "app.log", MaxFiles: "none"},
+		"max total size": {Path: "app.log", MaxTotalSize: "-1"},
+		"compression":    {Path: "app.log", Compression: "bzip2"},
+		"fsync":          {Path: "app.log", Fsync: "sometimes"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := getLocalFileConfig(args)
+			require.Error(t, err)
+		})
+	}
+}
+
+// TestClientWritesLogLines tests that log messages are written with the text and jsonl formats.
+func TestClientWritesLogLines(t *testing.T) {
+	timestamp := time.Date(2020, time.January, 14, 1, 59, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		format   string
+		expected string
+	}{
+		{
+			format:   TextFormat,
+			expected: "first\n<second>\npartial line\n",
+		},
+		{
+			format: JSONLinesFormat,
+			expected: `{"time":"2020-01-14T01:59:00Z","stream":"stdout","log":"first",` +
+				`"container_id":"test-container-id","container_name":"test-container-name"}` + "\n" +
+				`{"time":"2020-01-14T01:59:00Z","stream":"stderr","log":"<second>",` +
+				`"container_id":"test-container-id","container_name":"test-container-name"}` + "\n" +
+				`{"time":"2020-01-14T01:59:00Z","stream":"stdout","log":"partial ",` +
+				`"container_id":"test-container-id","container_name":"test-container-name"}` + "\n" +
+				`{"time":"2020-01-14T01:59:00Z","stream":"stdout","log":"line",` +
+				`"container_id":"test-container-id","container_name":"test-container-name"}` + "\n",
+		},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "containers", "app.log")
+			la := InitLogger(
+				&logger.GlobalArgs{ContainerID: testContainerID, ContainerName: testContainerName},
+				&Args{Path: path, Format: tc.format, Fsync: AlwaysFsync},
+			)
+			stream, err := la.newStream()
+			require.NoError(t, err)
+
+			for _, m := range []struct {
+				source, line string
+				partial      *types.PartialLogMetaData
+			}{
+				{source: "stdout", line: "first"},
+				{source: "stderr", line: "<second>"},
+				{source: "stdout", line: "partial ", partial: &types.PartialLogMetaData{ID: "id", Ordinal: 1}},
+				{source: "stdout", line: "line", partial: &types.PartialLogMetaData{ID: "id", Ordinal: 2, Last: true}},
+			} {
+				msg := dockerlogger.NewMessage()
+				msg.Line = append(msg.Line, m.line...)
+				msg.Source = m.source
+				msg.Timestamp = timestamp
+				msg.PLogMetaData = m.partial
+				require.NoError(t, stream.Log(msg))
+			}
+			require.NoError(t, stream.Close())
+			require.ErrorIs(t, stream.Log(dockerlogger.NewMessage()), errFileClosed)
+
+			b, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, string(b))
+		})
+	}
+}
+
+// fakeClock is a clock which only moves forward when it's told to.
+type fakeClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// write writes log lines to the file.
+func write(t *testing.T, f *rotatingFile, lines ...string) {
+	for _, line := range lines {
+		_, err := f.Write([]byte(line + "\n"))
+		require.NoError(t, err)
+	}
+}
+
+// readRotated returns the content of the rotated files, from the oldest to the newest.
+func readRotated(t *testing.T, f *rotatingFile) []string {
+	files, err := f.rotatedFiles()
+	require.NoError(t, err)
+	var contents []string
+	for _, file := range files {
+		r, err := os.Open(file.path)
+		require.NoError(t, err)
+		var content io.Reader = r
+		switch filepath.Ext(file.path) {
+		case ".gz":
+			zr, err := gzip.NewReader(r)
+			require.NoError(t, err)
+			content = zr
+		case ".zst":
+			zr, err := zstd.NewReader(r)
+			require.NoError(t, err)
+			defer zr.Close()
+			content = zr
+		}
+		b, err := io.ReadAll(content)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		contents = append(contents, string(b))
+	}
+	return contents
+}
+
+// TestRotatingFileRotatesBySize tests that the log file is rotated once writing a log line would
+// make it larger than the max size, and that rotated files are compressed.
+func TestRotatingFileRotatesBySize(t *testing.T) {
+	for _, compression := range []string{NoCompression, GzipCompression, ZstdCompression} {
+		t.Run(compression, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.log")
+			clock := &fakeClock{now: time.Now()}
+			f, err := newRotatingFile(&config{path: path, maxSize: 10, compression: compression}, clock.Now)
+			require.NoError(t, err)
+
+			write(t, f, "0123", "4567", "89", "abcdefghijklmnop", "q")
+			require.NoError(t, f.Close())
+
+			b, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.Equal(t, "q\n", string(b))
+			require.Equal(t, []string{"0123\n4567\n", "89\n", "abcdefghijklmnop\n"}, readRotated(t, f))
+			files, err := f.rotatedFiles()
+			require.NoError(t, err)
+			for _, file := range files {
+				require.Equal(t, compression != NoCompression, file.compressed)
+			}
+		})
+	}
+}
+
+// TestRotatingFileRotatesByTime tests that the log file is rotated with the first log line after
+// the end of the hour or day, and that it isn't rotated if it's empty.
+func TestRotatingFileRotatesByTime(t *testing.T) {
+	for _, tc := range []struct {
+		rotate string
+		period time.Duration
+	}{
+		{rotate: HourlyRotation, period: time.Hour},
+		{rotate: DailyRotation, period: 24 * time.Hour},
+	} {
+		t.Run(tc.rotate, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.log")
+			clock := &fakeClock{now: time.Date(2020, time.January, 14, 1, 59, 0, 0, time.Local)}
+			f, err := newRotatingFile(&config{path: path, rotate: tc.rotate, compression: NoCompression}, clock.Now)
+			require.NoError(t, err)
+
+			write(t, f, "first")
+			clock.Add(time.Minute)
+			if tc.rotate == DailyRotation {
+				write(t, f, "second")
+				clock.Add(tc.period)
+			}
+			write(t, f, "third")
+			// Nothing is written during the next period, so the log file isn't rotated until the one
+			// after it, and then only once.
+			clock.Add(2 * tc.period)
+			write(t, f, "fourth")
+			clock.Add(tc.period)
+			require.NoError(t, f.Close())
+
+			b, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.Equal(t, "fourth\n", string(b))
+			if tc.rotate == DailyRotation {
+				require.Equal(t, []string{"first\nsecond\n", "third\n"}, readRotated(t, f))
+			} else {
+				require.Equal(t, []string{"first\n", "third\n"}, readRotated(t, f))
+			}
+		})
+	}
+}
+
+// TestRotatingFilePrunesRotatedFiles tests that the oldest rotated files are removed once there
+// are more than the max number of files, or once they're larger than the max total size, including
+// the rotated files of previous runs.
+func TestRotatingFilePrunesRotatedFiles(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		cfg      config
+		expected []string
+	}{
+		{name: "max files", cfg: config{maxFiles: 2}, expected: []string{"ccc\n", "dddd\n"}},
+		{name: "max total size", cfg: config{maxTotalSize: 8}, expected: []string{"dddd\n"}},
+		{name: "both", cfg: config{maxFiles: 3, maxTotalSize: 9}, expected: []string{"ccc\n", "dddd\n"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "app.log")
+			clock := &fakeClock{now: time.Now()}
+			// A rotated file of a previous run, and files which aren't rotated files.
+			old := path + "." + clock.Now().Add(-time.Hour).UTC().Format(rotatedTimeLayout)
+			require.NoError(t, os.WriteFile(old, []byte("a\n"), 0o600))
+			require.NoError(t, os.WriteFile(path+".bak", []byte("backup\n"), 0o600))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "other.log"), []byte("other\n"), 0o600))
+
+			cfg := tc.cfg
+			cfg.path, cfg.maxSize, cfg.compression = path, 1, NoCompression
+			f, err := newRotatingFile(&cfg, clock.Now)
+			require.NoError(t, err)
+			write(t, f, "bb", "ccc", "dddd", "e")
+			require.NoError(t, f.Close())
+
+			require.Equal(t, tc.expected, readRotated(t, f))
+			require.FileExists(t, path+".bak")
+			require.FileExists(t, filepath.Join(dir, "other.log"))
+		})
+	}
+}
+
+// TestRotatingFileReopens tests that a new log file is created once the log file is moved and
+// reopened.
+func TestRotatingFileReopens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, err := newRotatingFile(&config{path: path, compression: NoCompression, fsyncInterval: time.Millisecond}, time.Now)
+	require.NoError(t, err)
+
+	write(t, f, "first")
+	require.NoError(t, os.Rename(path, path+".1"))
+	write(t, f, "second")
+	require.NoError(t, f.Reopen())
+	write(t, f, "third")
+	require.NoError(t, f.Close())
+	require.ErrorIs(t, f.Reopen(), errFileClosed)
+
+	b, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	require.Equal(t, "first\nsecond\n", string(b))
+	b, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "third\n", string(b))
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package localfile
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyReopen relays SIGHUP to c, which is what logrotate sends in its postrotate scripts.
+func notifyReopen(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGHUP)
+}
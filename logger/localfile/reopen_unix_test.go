@@ -0,0 +1,54 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit && !windows
+// +build unit,!windows
+
+package localfile
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+// TestClientReopensOnSIGHUP tests that the log file is reopened once the shim logger receives
+// SIGHUP, in the same way as after logrotate moves it.
+func TestClientReopensOnSIGHUP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	la := InitLogger(&logger.GlobalArgs{ContainerID: testContainerID}, &Args{Path: path})
+	stream, err := la.newStream()
+	require.NoError(t, err)
+	defer stream.Close() //nolint:errcheck // closed below
+
+	log := func(line string) {
+		msg := dockerlogger.NewMessage()
+		msg.Line = append(msg.Line, line...)
+		msg.Source = "stdout"
+		msg.Timestamp = time.Now()
+		require.NoError(t, stream.Log(msg))
+	}
+	log("first")
+	require.NoError(t, os.Rename(path, path+".1"))
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	log("second")
+	require.NoError(t, stream.Close())
+
+	b, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	require.Equal(t, "first\n", string(b))
+	b, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "second\n", string(b))
+}
@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package localfile
+
+import "os"
+
+// notifyReopen doesn't relay any signal on Windows, which has no SIGHUP.
+func notifyReopen(_ chan<- os.Signal) {}
@@ -0,0 +1,296 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package loki
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+const (
+	// queueSize is the max number of log lines queued until they're batched.
+	queueSize = 1024
+	// pushTimeout bounds how long a single push request takes.
+	pushTimeout = 10 * time.Second
+	// maxPushAttempts is the max number of attempts to push a batch of log lines if Loki is
+	// temporarily unavailable or rate limits the push requests.
+	maxPushAttempts = 5
+	// initialRetryBackoff is how long to wait before retrying to push a batch of log lines, which
+	// is doubled after every attempt.
+	initialRetryBackoff = 500 * time.Millisecond
+	// maxResponseBodySize bounds how much of the response body is read from Loki.
+	maxResponseBodySize = 64 * 1024
+
+	// Names of the labels of the streams.
+	containerNameLabel = "container_name"
+	containerIDLabel   = "container_id"
+	imageLabel         = "image"
+	sourceLabel        = "source"
+)
+
+// entry is a log line of a stream.
+type entry struct {
+	source    string
+	timestamp time.Time
+	line      string
+}
+
+// stream is the log lines of a batch which have the same labels.
+type stream struct {
+	labels  map[string]string
+	entries []entry
+}
+
+// client converts log messages to log lines, and pushes them in batches in the background. The
+// log lines of the container are grouped into one stream per source.
+type client struct {
+	cfg        *config
+	labels     map[string]string
+	httpClient *http.Client
+	batcher    *logger.Batcher[entry]
+}
+
+// newClient creates a client pushing the log lines of the container with the given labels.
+func newClient(cfg *config, labels map[string]string) *client {
+	c := &client{
+		cfg:        cfg,
+		labels:     labels,
+		httpClient: &http.Client{Timeout: pushTimeout},
+	}
+	c.batcher = logger.NewBatcher(&logger.BatcherConfig[entry]{
+		DriverName:     DriverName,
+		Items:          "log lines",
+		QueueSize:      queueSize,
+		FlushBytes:     cfg.batchSize,
+		Size:           func(e entry) int { return len(e.line) },
+		Wait:           cfg.batchWait,
+		Send:           c.push,
+		Timeout:        pushTimeout,
+		MaxAttempts:    maxPushAttempts,
+		InitialBackoff: initialRetryBackoff,
+	})
+
+	return c
+}
+
+// newLabels creates the labels of the container, with its name, ID and image, along with the
+// given container labels. The names of the container labels are sanitized to be valid label names.
+func newLabels(globalArgs *logger.GlobalArgs, dockerConfigs *logger.DockerConfigs, keys []string) map[string]string {
+	labels := map[string]string{
+		containerNameLabel: globalArgs.ContainerName,
+		containerIDLabel:   globalArgs.ContainerID,
+	}
+	if dockerConfigs == nil {
+		return labels
+	}
+	if dockerConfigs.ContainerImageName != "" {
+		labels[imageLabel] = dockerConfigs.ContainerImageName
+	}
+	for _, key := range keys {
+		if value, ok := dockerConfigs.ContainerLabels[key]; ok {
+			labels[sanitizeLabelName(key)] = value
+		}
+	}
+	return labels
+}
+
+// sanitizeLabelName replaces the characters which are not allowed in label names with
+// underscores, e.g. `com.example.team` is turned into `com_example_team`.
+func sanitizeLabelName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+		case r >= '0' && r <= '9' && i > 0:
+		case r >= '0' && r <= '9':
+			b.WriteRune('_')
+		default:
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Log converts a log message to a log line and queues it to be pushed. It blocks if the queue is
+// full.
+func (c *client) Log(msg *dockerlogger.Message) error {
+	e := entry{source: msg.Source, timestamp: msg.Timestamp, line: string(msg.Line)}
+	dockerlogger.PutMessage(msg)
+	return c.batcher.Add(e)
+}
+
+// Close pushes the log lines which are not pushed yet.
+func (c *client) Close() error {
+	c.batcher.Close()
+	c.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// push pushes a batch of log lines. Push requests which fail because Loki is temporarily
+// unavailable or rate limits them are sent again by the batcher.
+func (c *client) push(ctx context.Context, entries []entry) ([]entry, error) {
+	body, contentType, err := c.encode(groupStreams(c.labels, entries))
+	if err != nil {
+		return nil, err
+	}
+	return nil, c.send(ctx, body, contentType)
+}
+
+// groupStreams groups log lines into streams by source, in the order of their first log lines.
+func groupStreams(labels map[string]string, entries []entry) []*stream {
+	var (
+		streams  []*stream
+		bySource = make(map[string]*stream)
+	)
+	for _, e := range entries {
+		s, ok := bySource[e.source]
+		if !ok {
+			s = &stream{labels: make(map[string]string, len(labels)+1)}
+			for name, value := range labels {
+				s.labels[name] = value
+			}
+			s.labels[sourceLabel] = e.source
+			bySource[e.source] = s
+			streams = append(streams, s)
+		}
+		s.entries = append(s.entries, e)
+	}
+	return streams
+}
+
+// encode encodes the streams in the format of the push request, and returns its content type.
+func (c *client) encode(streams []*stream) ([]byte, string, error) {
+	if c.cfg.format == JSONFormat {
+		body, err := encodeJSON(streams)
+		return body, "application/json", err
+	}
+	return snappy.Encode(nil, encodeProtobuf(streams)), "application/x-protobuf", nil
+}
+
+// encodeProtobuf encodes the streams as a logproto.PushRequest.
+func encodeProtobuf(streams []*stream) []byte {
+	var req []byte
+	for _, s := range streams {
+		// logproto.StreamAdapter
+		var sb []byte
+		sb = protowire.AppendTag(sb, 1, protowire.BytesType)
+		sb = protowire.AppendString(sb, formatLabels(s.labels))
+		for _, e := range s.entries {
+			// google.protobuf.Timestamp
+			var tb []byte
+			tb = protowire.AppendTag(tb, 1, protowire.VarintType)
+			tb = protowire.AppendVarint(tb, uint64(e.timestamp.Unix())) //nolint:gosec // timestamps are after 1970
+			tb = protowire.AppendTag(tb, 2, protowire.VarintType)
+			tb = protowire.AppendVarint(tb, uint64(e.timestamp.Nanosecond()))
+			// logproto.EntryAdapter
+			var eb []byte
+			eb = protowire.AppendTag(eb, 1, protowire.BytesType)
+			eb = protowire.AppendBytes(eb, tb)
+			eb = protowire.AppendTag(eb, 2, protowire.BytesType)
+			eb = protowire.AppendString(eb, e.line)
+
+			sb = protowire.AppendTag(sb, 2, protowire.BytesType)
+			sb = protowire.AppendBytes(sb, eb)
+		}
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, sb)
+	}
+	return req
+}
+
+// formatLabels formats labels in the Prometheus text format, e.g. `{source="stdout"}`, sorted
+// by name.
+func formatLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[name]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// jsonStream is a stream of the JSON push request.
+type jsonStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// encodeJSON encodes the streams as a JSON push request, where the timestamps of the log lines
+// are strings of Unix epoch nanoseconds.
+func encodeJSON(streams []*stream) ([]byte, error) {
+	req := struct {
+		Streams []jsonStream `json:"streams"`
+	}{Streams: make([]jsonStream, 0, len(streams))}
+	for _, s := range streams {
+		js := jsonStream{Stream: s.labels, Values: make([][2]string, 0, len(s.entries))}
+		for _, e := range s.entries {
+			js.Values = append(js.Values, [2]string{strconv.FormatInt(e.timestamp.UnixNano(), 10), e.line})
+		}
+		req.Streams = append(req.Streams, js)
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode push request: %w", err)
+	}
+	return body, nil
+}
+
+// send sends a push request.
+func (c *client) send(ctx context.Context, body []byte, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to create push request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.cfg.tenantID != "" {
+		req.Header.Set("X-Scope-OrgID", c.cfg.tenantID)
+	}
+	if c.cfg.username != "" {
+		req.SetBasicAuth(c.cfg.username, c.cfg.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return &logger.RetryableError{Err: fmt.Errorf("unable to send push request: %w", err)}
+	}
+	defer resp.Body.Close() //nolint:errcheck // nothing to do
+	// Loki explains why push requests fail in the response body.
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBodySize))
+
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		return nil
+	}
+	err = fmt.Errorf("push request failed with status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		return &logger.RetryableError{Err: err}
+	}
+	return err
+}
@@ -0,0 +1,215 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package loki provides a log driver pushing container logs to Grafana Loki with its push API.
+package loki
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/runtime/v2/logging"
+	"github.com/docker/go-units"
+
+	"github.com/aws/shim-loggers-for-containerd/debug"
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+// loki driver argument keys.
+const (
+	// DriverName is the name of the loki log driver.
+	DriverName = "loki"
+
+	// Required.
+
+	// URLKey is the URL of Loki, e.g. `http://localhost:3100`. The push API path is used if the
+	// URL has no path. Credentials in the URL are sent with the basic authentication.
+	URLKey = "loki-url"
+
+	// Optional.
+
+	// TenantIDKey is the tenant sent in the X-Scope-OrgID header, for multi-tenant Loki.
+	TenantIDKey = "loki-tenant-id"
+	// FormatKey is either `protobuf`, the default, which is compressed with snappy, or `json`.
+	FormatKey = "loki-format"
+	// LabelsKey is a comma-separated list of keys of container labels added to the labels of the
+	// streams.
+	LabelsKey = "loki-labels"
+	// BatchSizeKey is the size of the log lines after which a batch is pushed, e.g. `1m`.
+	BatchSizeKey = "loki-batch-size"
+	// BatchWaitKey is how long the first log line of a batch waits before the batch is pushed.
+	BatchWaitKey = "loki-batch-wait"
+)
+
+// Supported values and default values of the arguments.
+const (
+	ProtobufFormat = "protobuf"
+	JSONFormat     = "json"
+
+	// pushPath is the default path of the push API.
+	pushPath         = "/loki/api/v1/push"
+	defaultBatchSize = "1m"
+	defaultBatchWait = 1 * time.Second
+)
+
+// Args represents loki log driver arguments.
+type Args struct {
+	// Required.
+	URL string
+
+	// Optional.
+	TenantID  string
+	Format    string
+	Labels    string
+	BatchSize string
+	BatchWait string
+}
+
+// LoggerArgs stores global logger args, docker configs and loki specific args.
+type LoggerArgs struct {
+	globalArgs    *logger.GlobalArgs
+	dockerConfigs *logger.DockerConfigs
+	args          *Args
+}
+
+// InitLogger initializes the input arguments.
+func InitLogger(globalArgs *logger.GlobalArgs, dockerConfigs *logger.DockerConfigs, lokiArgs *Args) *LoggerArgs {
+	return &LoggerArgs{
+		globalArgs:    globalArgs,
+		dockerConfigs: dockerConfigs,
+		args:          lokiArgs,
+	}
+}
+
+// RunLogDriver initiates the loki driver and starts pushing container logs to Loki. Errors with
+// the log driver are logged but not returned to prevent container termination.
+func (la *LoggerArgs) RunLogDriver(ctx context.Context, config *logging.Config, ready func() error) error {
+	defer debug.DeferFuncForRunLogDriver()
+
+	stream, err := la.newStream()
+	if err != nil {
+		debug.ErrLogger = err
+		return debug.ErrLogger
+	}
+	// Push the log lines which are not pushed yet before exiting.
+	defer stream.Close() //nolint:errcheck // errors are already logged
+
+	l, err := logger.NewPipelineLogger(la.globalArgs, config, logger.NewInfo(la.globalArgs.ContainerID, la.globalArgs.ContainerName), stream)
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("unable to create loki driver: %w", err)
+		return debug.ErrLogger
+	}
+
+	// Start loki driver.
+	debug.SendEventsToLog(logger.DaemonName, "Starting loki driver", debug.INFO, 0)
+	err = l.Start(ctx, la.globalArgs.CleanupTime, ready)
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("failed to run loki driver: %w", err)
+		// Do not return error if log driver has issue sending logs to destination, because if error
+		// returned here, containerd will identify this error and kill shim process, which will kill
+		// the container process accordingly.
+		// Note: the container will continue to run if shim logger exits after.
+		// Reference: https://github.com/containerd/containerd/blob/release/1.3/runtime/v2/logging/logging.go
+		return nil
+	}
+	debug.SendEventsToLog(logger.DaemonName, "Logging finished", debug.INFO, 1)
+
+	return nil
+}
+
+// NewStream creates the loki stream, which is used when fanning out to multiple log drivers.
+func (la *LoggerArgs) NewStream() (logger.Client, error) {
+	stream, err := la.newStream()
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// newStream validates the log options and creates the loki stream.
+func (la *LoggerArgs) newStream() (*client, error) {
+	cfg, err := getLokiConfig(la.args)
+	if err != nil {
+		return nil, fmt.Errorf("unable to validate log options: %w", err)
+	}
+	return newClient(cfg, newLabels(la.globalArgs, la.dockerConfigs, cfg.labels)), nil
+}
+
+// config is the validated loki log driver arguments.
+type config struct {
+	url       string
+	username  string
+	password  string
+	tenantID  string
+	format    string
+	labels    []string
+	batchSize int64
+	batchWait time.Duration
+}
+
+// getLokiConfig validates the loki log driver arguments and sets the default values.
+func getLokiConfig(args *Args) (*config, error) {
+	u, err := url.Parse(args.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", URLKey, args.URL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid %s %s: scheme must be http or https", URLKey, args.URL)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid %s %s: host is required", URLKey, args.URL)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = pushPath
+	}
+
+	cfg := &config{
+		tenantID:  args.TenantID,
+		format:    args.Format,
+		batchWait: defaultBatchWait,
+	}
+	if u.User != nil {
+		cfg.username = u.User.Username()
+		cfg.password, _ = u.User.Password()
+		u.User = nil
+	}
+	cfg.url = u.String()
+
+	switch cfg.format {
+	case "":
+		cfg.format = ProtobufFormat
+	case ProtobufFormat, JSONFormat:
+	default:
+		return nil, fmt.Errorf("unknown %s: %s", FormatKey, args.Format)
+	}
+
+	for _, key := range strings.Split(args.Labels, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			cfg.labels = append(cfg.labels, key)
+		}
+	}
+
+	batchSize := args.BatchSize
+	if batchSize == "" {
+		batchSize = defaultBatchSize
+	}
+	if cfg.batchSize, err = units.RAMInBytes(batchSize); err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", BatchSizeKey, batchSize, err)
+	}
+	if cfg.batchSize <= 0 {
+		return nil, fmt.Errorf("invalid %s %s: must be positive", BatchSizeKey, batchSize)
+	}
+	if args.BatchWait != "" {
+		if cfg.batchWait, err = time.ParseDuration(args.BatchWait); err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", BatchWaitKey, args.BatchWait, err)
+		}
+		if cfg.batchWait <= 0 {
+			return nil, fmt.Errorf("invalid %s %s: must be positive", BatchWaitKey, args.BatchWait)
+		}
+	}
+
+	return cfg, nil
+}
@@ -60,19 +60,33 @@ func (s *slowClient) Log(_ *dockerlogger.Message) error {
 // a threshold. Update maxBinarySize downward as optimizations land.
 func TestBinarySize(t *testing.T) {
 	const (
-		// Binary size varies by OS/arch (~26-27 MiB without ldflags).
+		// Binary size varies by OS/arch and Go version (~48 MiB on linux/amd64
+		// without ldflags). The Firehose and Kinesis (~3 MiB) and S3 (~7 MiB)
+		// AWS SDK clients, and the Kafka client (~5 MiB), take ~15 MiB of it,
+		// which the threshold is raised by.
 		// Threshold set with headroom to accommodate different targets.
-		// Ratchet down after applying -ldflags="-s -w" (expect ~18 MiB).
-		maxBinarySize int64 = 35 * 1024 * 1024 // 35 MiB
+		// Ratchet down after applying -ldflags="-s -w".
+		maxBinarySize int64 = 51 * 1024 * 1024 // 51 MiB
+		// slimBuildTags leave out the drivers with the largest dependencies,
+		// which must keep the binary below the threshold from before them.
+		slimBuildTags           = "no_firehose,no_s3,no_kafka"
+		maxSlimBinarySize int64 = 35 * 1024 * 1024 // 35 MiB
 	)
 
+	checkBinarySize(t, "", maxBinarySize)
+	checkBinarySize(t, slimBuildTags, maxSlimBinarySize)
+}
+
+// checkBinarySize builds the shim-logger binary with the given build tags and
+// asserts its size stays below maxBinarySize.
+func checkBinarySize(t *testing.T, tags string, maxBinarySize int64) {
 	tmpBinary, err := os.CreateTemp("", "shim-logger-size-test-*")
 	require.NoError(t, err)
 	tmpPath := tmpBinary.Name()
 	require.NoError(t, tmpBinary.Close())
 	defer func() { _ = os.Remove(tmpPath) }()
 
-	cmd := exec.Command("go", "build", "-o", tmpPath, ".") //nolint:gosec // build path is a temp file, not user input
+	cmd := exec.Command("go", "build", "-tags", tags, "-o", tmpPath, ".") //nolint:gosec // build path is a temp file, not user input
 	cmd.Dir = ".."
 	out, err := cmd.CombinedOutput()
 	require.NoError(t, err, "build failed: %s", string(out))
@@ -80,11 +94,11 @@ func TestBinarySize(t *testing.T) {
 	info, err := os.Stat(tmpPath)
 	require.NoError(t, err)
 
-	t.Logf("binary size = %d bytes (%.1f MiB)", info.Size(), float64(info.Size())/(1024*1024))
+	t.Logf("binary size with tags %q = %d bytes (%.1f MiB)", tags, info.Size(), float64(info.Size())/(1024*1024))
 
 	if info.Size() > maxBinarySize {
-		t.Errorf("binary size %d bytes (%.1f MiB) exceeds threshold %d bytes (%.1f MiB)",
-			info.Size(), float64(info.Size())/(1024*1024),
+		t.Errorf("binary size with tags %q %d bytes (%.1f MiB) exceeds threshold %d bytes (%.1f MiB)",
+			tags, info.Size(), float64(info.Size())/(1024*1024),
 			maxBinarySize, float64(maxBinarySize)/(1024*1024))
 	}
 }
@@ -0,0 +1,187 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/shim-loggers-for-containerd/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	metricsNamespace = "shim_logger"
+	// metricsPath is the path of the scrape endpoint.
+	metricsPath = "/metrics"
+	// unixSocketPrefix is the prefix of a metrics address which is a unix socket path.
+	unixSocketPrefix = "unix://"
+	// metricsReadHeaderTimeout bounds how long the metrics server waits for request headers.
+	metricsReadHeaderTimeout = 5 * time.Second
+	// metricsDialTimeout bounds how long checking whether a metrics socket is in use takes.
+	metricsDialTimeout = time.Second
+)
+
+// Metrics of the shim logger. Like the counters used by startTracingLogRouting, they are shared
+// by the whole process since a shim logger process only serves a single container. The container
+// ID and container name labels are added when they are registered. The metrics of the log driver
+// and of its ring buffer are labeled with the log driver, which is each one of them when container
+// logs are fanned out to multiple log drivers.
+var (
+	linesReadFromSrc = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "lines_read_total",
+		Help:      "Number of log lines read from the container pipe, including partial log lines.",
+	}, []string{"source"})
+	bytesReadFromSrcTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "bytes_read_total",
+		Help:      "Number of bytes read from the container pipe.",
+	}, []string{"source"})
+	partialLinesEmitted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "partial_lines_total",
+		Help:      "Number of partial log lines emitted for log lines longer than the buffer.",
+	}, []string{"source"})
+	linesFiltered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "filtered_lines_total",
+		Help:      "Number of log lines read from the container pipe and filtered out, including partial log lines.",
+	}, []string{"source"})
+	linesDelivered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "lines_delivered_total",
+		Help:      "Number of log lines accepted by the log driver.",
+	}, []string{"source", "driver"})
+	bytesDelivered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "bytes_delivered_total",
+		Help:      "Number of bytes of log lines accepted by the log driver.",
+	}, []string{"source", "driver"})
+	deliveryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "delivery_errors_total",
+		Help:      "Number of log lines the log driver failed to accept.",
+	}, []string{"source", "driver"})
+	deliveryLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "delivery_duration_seconds",
+		Help:      "Time spent by the log driver to accept a single log line.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+	}, []string{"driver"})
+	bufferSizeBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "buffer_size_bytes",
+		Help:      "Number of bytes of log lines held by the ring buffer in non-blocking mode.",
+	}, []string{"driver"})
+	bufferLines = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "buffer_lines",
+		Help:      "Number of log lines held by the ring buffer in non-blocking mode.",
+	}, []string{"driver"})
+	bufferDroppedLines = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "buffer_dropped_lines_total",
+		Help:      "Number of log lines dropped from the ring buffer in non-blocking mode.",
+	}, []string{"source", "driver"})
+	bufferDroppedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "buffer_dropped_bytes_total",
+		Help:      "Number of bytes of log lines dropped from the ring buffer in non-blocking mode.",
+	}, []string{"source", "driver"})
+)
+
+// StartMetricsServer starts serving the metrics of the shim logger at the metrics address, which is
+// either a TCP address like `localhost:9090` or a unix socket path like `unix:///run/shim.sock`.
+// All the metrics are labeled with the container ID and container name.
+func StartMetricsServer(globalArgs *GlobalArgs) (*http.Server, error) {
+	registry := prometheus.NewRegistry()
+	registerer := prometheus.WrapRegistererWith(prometheus.Labels{
+		"container_id":   globalArgs.ContainerID,
+		"container_name": globalArgs.ContainerName,
+	}, registry)
+	for _, c := range []prometheus.Collector{
+		linesReadFromSrc,
+		bytesReadFromSrcTotal,
+		partialLinesEmitted,
+		linesFiltered,
+		linesDelivered,
+		bytesDelivered,
+		deliveryErrors,
+		deliveryLatency,
+		bufferSizeBytes,
+		bufferLines,
+		bufferDroppedLines,
+		bufferDroppedBytes,
+	} {
+		if err := registerer.Register(c); err != nil {
+			return nil, fmt.Errorf("unable to register metrics: %w", err)
+		}
+	}
+
+	listener, err := listenMetrics(globalArgs.MetricsAddress)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: metricsReadHeaderTimeout,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			debug.SendEvent(DaemonName, fmt.Sprintf("Metrics server stopped: %s", err), debug.ERROR, debug.Err(err))
+		}
+	}()
+
+	return server, nil
+}
+
+// listenMetrics listens on the given metrics address.
+func listenMetrics(address string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(address, unixSocketPrefix); ok {
+		// Only remove the socket file left by a previous run, otherwise listening fails. A socket
+		// accepting connections belongs to another shim logger, e.g. of another container given
+		// the same metrics address.
+		if conn, err := net.DialTimeout("unix", path, metricsDialTimeout); err == nil {
+			conn.Close() //nolint:errcheck // nothing to do
+			return nil, fmt.Errorf("metrics socket %s is in use", path)
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("unable to remove stale metrics socket %s: %w", path, err)
+		}
+		listener, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to listen on metrics socket %s: %w", path, err)
+		}
+		return listener, nil
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on metrics address %s: %w", address, err)
+	}
+	return listener, nil
+}
+
+// observeDelivery records the outcome of sending a log message to the log driver.
+func observeDelivery(driverName, source string, sizeInBytes int, start time.Time, err error) {
+	deliveryLatency.WithLabelValues(driverName).Observe(time.Since(start).Seconds())
+	if err != nil {
+		deliveryErrors.WithLabelValues(source, driverName).Inc()
+		return
+	}
+	linesDelivered.WithLabelValues(source, driverName).Inc()
+	bytesDelivered.WithLabelValues(source, driverName).Add(float64(sizeInBytes))
+	atomic.AddUint64(&bytesSentToDst, uint64(sizeInBytes)) //nolint:gosec // sizes are not negative
+}
@@ -0,0 +1,82 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package logger
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// clientFunc adapts a function to the Client interface.
+type clientFunc func(*dockerlogger.Message) error
+
+func (f clientFunc) Log(msg *dockerlogger.Message) error {
+	return f(msg)
+}
+
+// TestObserveDelivery tests that the outcome of sending a log message to the log driver is
+// recorded by the metrics.
+func TestObserveDelivery(t *testing.T) {
+	delivered := testutil.ToFloat64(linesDelivered.WithLabelValues(sourceSTDERR, "json-file"))
+	deliveredBytes := testutil.ToFloat64(bytesDelivered.WithLabelValues(sourceSTDERR, "json-file"))
+	failed := testutil.ToFloat64(deliveryErrors.WithLabelValues(sourceSTDERR, "json-file"))
+
+	l := &Logger{driverName: "json-file", Stream: clientFunc(func(*dockerlogger.Message) error { return nil })}
+	require.NoError(t, l.Log(newMessage([]byte("0123456789"), sourceSTDERR, dummyTime)))
+	l.Stream = clientFunc(func(*dockerlogger.Message) error { return errors.New(testErrMsg) })
+	require.Error(t, l.Log(newMessage([]byte("0123456789"), sourceSTDERR, dummyTime)))
+
+	require.Equal(t, delivered+1, testutil.ToFloat64(linesDelivered.WithLabelValues(sourceSTDERR, "json-file")))
+	require.Equal(t, deliveredBytes+10, testutil.ToFloat64(bytesDelivered.WithLabelValues(sourceSTDERR, "json-file")))
+	require.Equal(t, failed+1, testutil.ToFloat64(deliveryErrors.WithLabelValues(sourceSTDERR, "json-file")))
+}
+
+// TestStartMetricsServer tests that the metrics are served at a unix socket, labeled with the
+// container, and that a socket in use isn't taken over.
+func TestStartMetricsServer(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "metrics.sock")
+	server, err := StartMetricsServer(&GlobalArgs{
+		ContainerID:    testContainerID,
+		ContainerName:  testContainerName,
+		LogDriver:      "json-file",
+		MetricsAddress: unixSocketPrefix + socketPath,
+	})
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck // testing only
+
+	linesReadFromSrc.WithLabelValues(sourceSTDOUT).Inc()
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+	resp, err := client.Get("http://localhost" + metricsPath)
+	require.NoError(t, err)
+	defer resp.Body.Close() //nolint:errcheck // testing only
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body),
+		`shim_logger_lines_read_total{container_id="test-container-id",container_name="test-container-name",source="stdout"}`)
+
+	_, err = StartMetricsServer(&GlobalArgs{
+		ContainerID:    testContainerID,
+		MetricsAddress: unixSocketPrefix + socketPath,
+	})
+	require.ErrorContains(t, err, "in use")
+}
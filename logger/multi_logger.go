@@ -0,0 +1,437 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/containerd/containerd/runtime/v2/logging"
+	dockerlogger "github.com/docker/docker/daemon/logger"
+
+	"github.com/aws/shim-loggers-for-containerd/debug"
+)
+
+// multiClientQueueSize is the number of log messages queued for a single log driver, after which
+// logging waits for the log driver to catch up.
+const multiClientQueueSize = 128
+
+// MultiStream is one of the log drivers container logs are fanned out to.
+type MultiStream struct {
+	// DriverName is the name of the log driver.
+	DriverName string
+	// Mode is either blocking or non-blocking mode of this log driver. In non-blocking mode, log
+	// messages are saved to a ring buffer of its own, so that a slow log driver doesn't stall the
+	// other ones.
+	Mode string
+	// New creates the stream of the log driver.
+	New func() (Client, error)
+	// MaxBytesPerEvent is the max size of a log message accepted by the destination, if it has
+	// one. Larger log messages reassembled from partial log messages are split for this log
+	// driver only.
+	MaxBytesPerEvent int
+}
+
+// MultiLoggerArgs stores global logger args and the log drivers to fan out to.
+type MultiLoggerArgs struct {
+	globalArgs *GlobalArgs
+	streams    []*MultiStream
+}
+
+// InitMultiLogger initializes the input arguments.
+func InitMultiLogger(globalArgs *GlobalArgs, streams []*MultiStream) *MultiLoggerArgs {
+	return &MultiLoggerArgs{
+		globalArgs: globalArgs,
+		streams:    streams,
+	}
+}
+
+// RunLogDriver initiates all the log drivers and starts sending every container log message to
+// each of them.
+func (la *MultiLoggerArgs) RunLogDriver(ctx context.Context, config *logging.Config, ready func() error) error {
+	defer debug.DeferFuncForRunLogDriver()
+
+	client, err := newMultiClient(la.globalArgs, la.streams)
+	if err != nil {
+		debug.ErrLogger = err
+		return debug.ErrLogger
+	}
+
+	// The log messages are queued for every log driver, which also saves them to a ring buffer of
+	// its own in non-blocking mode, so container pipes are always read in blocking mode.
+	info := NewInfo(la.globalArgs.ContainerID, la.globalArgs.ContainerName)
+	l, err := newLogger(append(pipelineOptions(la.globalArgs, config, info, client),
+		WithDiscardSource(la.discardSource()))...)
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("unable to create log drivers %s: %w", la.globalArgs.LogDriver, err)
+		return debug.ErrLogger
+	}
+
+	debug.SendEventsToLog(DaemonName, "Starting log drivers "+la.globalArgs.LogDriver, debug.INFO, 0)
+	client.start()
+	err = l.Start(ctx, la.globalArgs.CleanupTime, ready)
+	// Send the log messages left in the queues and ring buffers before exiting, whether or not it
+	// fails.
+	client.close()
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("failed to run log drivers %s: %w", la.globalArgs.LogDriver, err)
+		// Do not return error if log driver has issue sending logs to destination, because if error
+		// returned here, containerd will identify this error and kill shim process, which will kill
+		// the container process accordingly.
+		return nil
+	}
+	debug.SendEventsToLog(DaemonName, "Logging finished", debug.INFO, 1)
+
+	return nil
+}
+
+// discardSource returns the container pipe which log messages are filtered out before they are
+// fanned out, if all the log drivers discard it. Otherwise, each log driver discards its own.
+func (la *MultiLoggerArgs) discardSource() string {
+	if len(la.streams) == 0 {
+		return ""
+	}
+	source := la.globalArgs.DiscardStreams[la.streams[0].DriverName]
+	for _, s := range la.streams[1:] {
+		if la.globalArgs.DiscardStreams[s.DriverName] != source {
+			return ""
+		}
+	}
+	return source
+}
+
+// multiClient is a Client sending every log message to multiple log driver streams.
+type multiClient struct {
+	streams []*multiClientStream
+	// spillDir is the directory holding the spill directories of the log drivers in non-blocking
+	// mode, if the spill queue is enabled.
+	spillDir string
+}
+
+// multiClientStream is a single log driver stream of multiClient.
+type multiClientStream struct {
+	driverName string
+	stream     Client
+	// queue holds the log messages not handed over to the stream yet, so that a slow log driver
+	// only stalls the other ones once its queue is full.
+	queue chan *multiMessage
+	// queueDone is closed once all the log messages in the queue are handed over.
+	queueDone chan struct{}
+	// buffer saves the log messages not sent to the stream yet in non-blocking mode, it's nil
+	// in blocking mode.
+	buffer *ringBuffer
+	// done is closed once all the log messages in the buffer are sent.
+	done chan struct{}
+	// discardSource is the container pipe which log messages aren't sent to the stream, if it's
+	// set.
+	discardSource string
+	// maxBytesPerEvent is the max size of a log message sent to the stream, if it's set.
+	maxBytesPerEvent int
+	// The counters of the log messages dropped from the buffer, along with the ones reported in
+	// the routing trace already.
+	dropped  droppedCounters
+	reported droppedCounters
+}
+
+// multiMessage is the copy of a log message queued for a single log driver, split if it's larger
+// than the max size of a log message of the log driver.
+type multiMessage struct {
+	messages []*dockerlogger.Message
+	// delivery is shared by the copies of the log message queued for all the log drivers, it's
+	// nil if the delivery isn't tracked.
+	delivery *multiDelivery
+}
+
+// multiDelivery tracks the delivery of a log message to all the log drivers.
+type multiDelivery struct {
+	// pending is the number of log drivers the log message isn't delivered to yet.
+	pending int32
+	// delivered is called once the log message is delivered to all the log drivers.
+	delivered func()
+}
+
+// done records that the log message is delivered to a log driver.
+func (d *multiDelivery) done() {
+	if d != nil && atomic.AddInt32(&d.pending, -1) == 0 {
+		d.delivered()
+	}
+}
+
+// newMultiClient creates the streams of all the given log drivers. The streams created already
+// are closed if any of them can't be created.
+func newMultiClient(globalArgs *GlobalArgs, streams []*MultiStream) (*multiClient, error) {
+	m := &multiClient{}
+	if globalArgs.SpillDir != "" {
+		m.spillDir = filepath.Join(globalArgs.SpillDir, globalArgs.ContainerID)
+	}
+	for _, s := range streams {
+		stream, err := s.New()
+		if err != nil {
+			m.closeStreams()
+			return nil, fmt.Errorf("unable to create %s driver: %w", s.DriverName, err)
+		}
+		cs := &multiClientStream{
+			driverName:       s.DriverName,
+			stream:           stream,
+			queue:            make(chan *multiMessage, multiClientQueueSize),
+			queueDone:        make(chan struct{}),
+			discardSource:    globalArgs.DiscardStreams[s.DriverName],
+			maxBytesPerEvent: s.MaxBytesPerEvent,
+		}
+		m.streams = append(m.streams, cs)
+		if s.Mode != NonBlockingMode {
+			continue
+		}
+		cs.buffer = newLoggerBuffer(globalArgs.MaxBufferSize)
+		cs.buffer.driverName = s.DriverName
+		cs.buffer.overflowPolicy = globalArgs.BufferOverflowPolicy
+		cs.buffer.overflowTimeout = globalArgs.BufferOverflowTimeout
+		cs.buffer.dropMarkerEnabled = globalArgs.BufferDropMarker
+		cs.buffer.onDrop = cs.recordDroppedMessage
+		cs.done = make(chan struct{})
+		// Each log driver spills the log messages which don't fit into its own ring buffer.
+		if m.spillDir != "" {
+			cs.buffer.spill = newSpillQueue(filepath.Join(m.spillDir, s.DriverName),
+				globalArgs.SpillSegmentSize, globalArgs.SpillMaxSize)
+			if err := cs.buffer.spill.open(true); err != nil {
+				m.closeStreams()
+				return nil, fmt.Errorf("unable to create %s driver: %w", s.DriverName, err)
+			}
+		}
+	}
+	return m, nil
+}
+
+// start starts handing the queued log messages over to every log driver, and sending the log
+// messages saved in the ring buffers to the log drivers in non-blocking mode.
+func (m *multiClient) start() {
+	for _, cs := range m.streams {
+		go cs.run()
+		if cs.buffer == nil {
+			continue
+		}
+		go func(cs *multiClientStream) {
+			defer close(cs.done)
+			for {
+				msg, err := cs.buffer.Dequeue()
+				if err != nil || msg == nil {
+					return
+				}
+				cs.log(msg)
+			}
+		}(cs)
+	}
+}
+
+// close hands the log messages left in the queues over to every log driver, sends the log
+// messages left in the ring buffers and spill queues to the log drivers in non-blocking mode, and
+// then closes the streams.
+func (m *multiClient) close() {
+	for _, cs := range m.streams {
+		close(cs.queue)
+		<-cs.queueDone
+		if cs.buffer == nil {
+			continue
+		}
+		cs.buffer.lock.Lock()
+		cs.buffer.isClosed = true
+		cs.buffer.wait.Broadcast()
+		cs.buffer.lock.Unlock()
+		<-cs.done
+		for _, msg := range cs.buffer.Flush() {
+			cs.log(msg)
+		}
+		// The log messages spilled to disk are newer than the ones in memory, so send them after.
+		err := cs.buffer.FlushSpilled(func(msg *dockerlogger.Message) error {
+			cs.log(msg)
+			return nil
+		})
+		if err != nil {
+			debug.SendEvent(DaemonName,
+				fmt.Sprintf("Unable to flush the spilled messages to the log driver %s: %s", cs.driverName, err),
+				debug.ERROR,
+				debug.Driver(cs.driverName),
+				debug.Err(err))
+		}
+	}
+	m.closeStreams()
+}
+
+// closeStreams closes the streams which need to flush the log messages they hold, and removes the
+// spill directories.
+func (m *multiClient) closeStreams() {
+	for _, cs := range m.streams {
+		if closer, ok := cs.stream.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				debug.SendEvent(DaemonName,
+					fmt.Sprintf("Unable to close the log driver %s: %s", cs.driverName, err),
+					debug.ERROR,
+					debug.Driver(cs.driverName),
+					debug.Err(err))
+			}
+		}
+		if cs.buffer != nil && cs.buffer.spill != nil {
+			if err := cs.buffer.spill.close(); err != nil {
+				debug.SendEvent(DaemonName, fmt.Sprintf("Unable to clean up spill directory: %s", err), debug.ERROR, debug.Err(err))
+			}
+		}
+	}
+	if m.spillDir != "" {
+		os.Remove(m.spillDir) //nolint:errcheck,gosec // it's only removed once empty
+	}
+}
+
+// reportTrace reports the log messages dropped from the ring buffer of every log driver in
+// non-blocking mode since the last report, or in total once the routing trace is stopped.
+func (m *multiClient) reportTrace(containerID string, total bool) {
+	for _, cs := range m.streams {
+		if cs.buffer == nil {
+			continue
+		}
+		counters := droppedCounters{
+			messages: atomic.LoadUint64(&cs.dropped.messages),
+			bytes:    atomic.LoadUint64(&cs.dropped.bytes),
+		}
+		if total {
+			debug.SendEvent(containerID,
+				fmt.Sprintf("In total, %d messages (%d bytes) are dropped from the buffer of the log driver %s.",
+					counters.messages, counters.bytes, cs.driverName),
+				debug.INFO,
+				debug.Driver(cs.driverName),
+				debug.Lines(counters.messages),
+				debug.Bytes(counters.bytes))
+			continue
+		}
+		last := cs.reported
+		cs.reported = counters
+		if counters == last {
+			continue
+		}
+		debug.SendEvent(containerID,
+			fmt.Sprintf("Within last minute, %d messages (%d bytes) are dropped from the buffer of the log driver %s.",
+				counters.messages-last.messages, counters.bytes-last.bytes, cs.driverName),
+			debug.INFO,
+			debug.Driver(cs.driverName),
+			debug.Lines(counters.messages-last.messages),
+			debug.Bytes(counters.bytes-last.bytes))
+	}
+}
+
+// Log queues a copy of the log message for every log driver not discarding its source. The copy
+// is split if it's larger than the max size of a log message of the log driver. Errors of the log
+// drivers are reported by the log drivers on their own, since they are only sent later on.
+func (m *multiClient) Log(msg *dockerlogger.Message) error {
+	m.log(msg, nil)
+	return nil
+}
+
+// log queues a copy of the log message for every log driver not discarding its source, and calls
+// delivered once it's delivered to all of them, if it's set.
+func (m *multiClient) log(msg *dockerlogger.Message, delivered func()) {
+	var delivery *multiDelivery
+	if delivered != nil {
+		delivery = &multiDelivery{delivered: delivered}
+		for _, cs := range m.streams {
+			if msg.Source != cs.discardSource {
+				delivery.pending++
+			}
+		}
+		if delivery.pending == 0 {
+			delivered()
+			return
+		}
+	}
+	for _, cs := range m.streams {
+		if msg.Source == cs.discardSource {
+			continue
+		}
+		// Log drivers may modify or reuse the log message once it's logged, so each of them gets
+		// its own copy.
+		cs.queue <- &multiMessage{
+			messages: splitMessage(copyMessage(msg), cs.maxBytesPerEvent),
+			delivery: delivery,
+		}
+	}
+}
+
+// run hands the queued log messages over to the log driver, or saves them to its ring buffer in
+// non-blocking mode, until the queue is closed.
+func (cs *multiClientStream) run() {
+	defer close(cs.queueDone)
+	for m := range cs.queue {
+		for _, msg := range m.messages {
+			if cs.buffer == nil {
+				cs.send(msg)
+				continue
+			}
+			source := msg.Source
+			if err := cs.buffer.Enqueue(msg); err != nil {
+				debug.SendEvent(DaemonName,
+					fmt.Sprintf("[BUFFER] Failed to save msg to the buffer of the log driver %s: %s", cs.driverName, err),
+					debug.ERROR,
+					debug.Driver(cs.driverName),
+					debug.Source(source),
+					debug.Err(err))
+			}
+		}
+		m.delivery.done()
+	}
+}
+
+// logAndObserve sends a log message to the log driver, and records the outcome in the metrics of
+// the log driver.
+func (cs *multiClientStream) logAndObserve(msg *dockerlogger.Message) error {
+	// The log driver may reuse the message once it's logged, so save what's observed beforehand.
+	source, sizeInBytes := msg.Source, len(msg.Line)
+	start := time.Now()
+	err := cs.stream.Log(msg)
+	observeDelivery(cs.driverName, source, sizeInBytes, start, err)
+	return err
+}
+
+// recordDroppedMessage counts a log message dropped from the ring buffer.
+func (cs *multiClientStream) recordDroppedMessage(msg *dockerlogger.Message, _ uint64) {
+	atomic.AddUint64(&cs.dropped.messages, 1)
+	atomic.AddUint64(&cs.dropped.bytes, uint64(len(msg.Line)))
+	bufferDroppedLines.WithLabelValues(msg.Source, cs.driverName).Inc()
+	bufferDroppedBytes.WithLabelValues(msg.Source, cs.driverName).Add(float64(len(msg.Line)))
+}
+
+// log sends a log message saved in the ring buffer to the log driver.
+func (cs *multiClientStream) log(msg *dockerlogger.Message) {
+	// Log messages reporting dropped log messages only need to be told apart for the write-ahead
+	// log, which saves log messages before they are fanned out.
+	cs.buffer.dropMarkers.Delete(msg)
+	cs.send(msg)
+}
+
+// send sends a log message to the log driver, and reports the error if it fails.
+func (cs *multiClientStream) send(msg *dockerlogger.Message) {
+	source := msg.Source
+	if err := cs.logAndObserve(msg); err != nil {
+		debug.SendEvent(DaemonName,
+			fmt.Sprintf("Failed to proxy msg to the log driver %s: %s", cs.driverName, err),
+			debug.ERROR,
+			debug.Driver(cs.driverName),
+			debug.Source(source),
+			debug.Err(err))
+	}
+}
+
+// copyMessage creates a deep copy of a log message.
+func copyMessage(msg *dockerlogger.Message) *dockerlogger.Message {
+	c := newMessage(msg.Line, msg.Source, msg.Timestamp)
+	if msg.PLogMetaData != nil {
+		plogMetaData := *msg.PLogMetaData
+		c.PLogMetaData = &plogMetaData
+	}
+	c.Attrs = append(c.Attrs, msg.Attrs...)
+	c.Err = msg.Err
+	return c
+}
@@ -0,0 +1,193 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// fanOutRecorder saves every log message it's sent, after waiting for release to be closed if
+// it's set.
+type fanOutRecorder struct {
+	lock     sync.Mutex
+	messages []*dockerlogger.Message
+	release  chan struct{}
+}
+
+func (c *fanOutRecorder) Log(msg *dockerlogger.Message) error {
+	if c.release != nil {
+		<-c.release
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.messages = append(c.messages, msg)
+	return nil
+}
+
+func (c *fanOutRecorder) lines() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	lines := make([]string, 0, len(c.messages))
+	for _, msg := range c.messages {
+		lines = append(lines, string(msg.Line))
+	}
+	return lines
+}
+
+// TestMultiClient tests that every log message is sent to all the log drivers, that a stalled log
+// driver doesn't stall the other ones, and that the delivery to each of them is observed on its
+// own.
+func TestMultiClient(t *testing.T) {
+	deliveredFast := testutil.ToFloat64(linesDelivered.WithLabelValues(sourceSTDOUT, "fast"))
+	deliveredSlow := testutil.ToFloat64(linesDelivered.WithLabelValues(sourceSTDOUT, "slow"))
+	fast := &fanOutRecorder{}
+	slow := &fanOutRecorder{release: make(chan struct{})}
+	m, err := newMultiClient(&GlobalArgs{
+		MaxBufferSize:        testBufferSize,
+		BufferOverflowPolicy: DropNewestOverflowPolicy,
+	}, []*MultiStream{
+		{DriverName: "fast", New: func() (Client, error) { return fast, nil }},
+		{DriverName: "slow", Mode: NonBlockingMode, New: func() (Client, error) { return slow, nil }},
+	})
+	require.NoError(t, err)
+	m.start()
+
+	expected := []string{"line1", "line2", "line3"}
+	for _, line := range expected {
+		require.NoError(t, m.Log(newMessage([]byte(line), sourceSTDOUT, dummyTime)))
+	}
+	require.Eventually(t, func() bool { return len(fast.lines()) == len(expected) }, time.Second, time.Millisecond)
+	require.Equal(t, expected, fast.lines())
+
+	close(slow.release)
+	m.close()
+	require.Equal(t, expected, slow.lines())
+	// Every log driver gets its own copy of the log message.
+	require.NotSame(t, fast.messages[0], slow.messages[0])
+	require.Equal(t, deliveredFast+3, testutil.ToFloat64(linesDelivered.WithLabelValues(sourceSTDOUT, "fast")))
+	require.Equal(t, deliveredSlow+3, testutil.ToFloat64(linesDelivered.WithLabelValues(sourceSTDOUT, "slow")))
+	require.Zero(t, testutil.ToFloat64(bufferLines.WithLabelValues("slow")))
+}
+
+// TestMultiClientBlocking tests that a stalled log driver in blocking mode only stalls the other
+// ones once its queue is full, and that a log message is only delivered once it's delivered to all
+// the log drivers.
+func TestMultiClientBlocking(t *testing.T) {
+	fast := &fanOutRecorder{}
+	slow := &fanOutRecorder{release: make(chan struct{})}
+	m, err := newMultiClient(&GlobalArgs{}, []*MultiStream{
+		{DriverName: "fast", New: func() (Client, error) { return fast, nil }},
+		{DriverName: "slow", New: func() (Client, error) { return slow, nil }},
+	})
+	require.NoError(t, err)
+	m.start()
+
+	var delivered atomic.Int32
+	// The stalled log driver holds the first log message, and queues the other ones.
+	for i := 0; i <= multiClientQueueSize; i++ {
+		m.log(newMessage([]byte(fmt.Sprintf("line%d", i)), sourceSTDOUT, dummyTime), func() { delivered.Add(1) })
+	}
+	require.Eventually(t, func() bool { return len(fast.lines()) == multiClientQueueSize+1 }, time.Second, time.Millisecond)
+	require.Zero(t, delivered.Load())
+
+	// The queue of the stalled log driver is full, so the next log message waits for it.
+	logged := make(chan struct{})
+	go func() {
+		defer close(logged)
+		m.log(newMessage([]byte("last"), sourceSTDOUT, dummyTime), func() { delivered.Add(1) })
+	}()
+	require.Never(t, func() bool {
+		select {
+		case <-logged:
+			return true
+		default:
+			return false
+		}
+	}, 100*time.Millisecond, time.Millisecond)
+
+	close(slow.release)
+	<-logged
+	m.close()
+	require.Len(t, slow.lines(), multiClientQueueSize+2)
+	require.Equal(t, int32(multiClientQueueSize+2), delivered.Load())
+}
+
+// closingRecorder is a fanOutRecorder recording whether it's closed.
+type closingRecorder struct {
+	fanOutRecorder
+	closed bool
+}
+
+func (c *closingRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+// TestNewMultiClientWithError tests that the streams created already are closed if any of them
+// can't be created.
+func TestNewMultiClientWithError(t *testing.T) {
+	created := &closingRecorder{}
+	_, err := newMultiClient(&GlobalArgs{}, []*MultiStream{
+		{DriverName: "created", New: func() (Client, error) { return created, nil }},
+		{DriverName: "failed", New: func() (Client, error) { return nil, errors.New(testErrMsg) }},
+	})
+	require.Error(t, err)
+	require.True(t, created.closed)
+}
+
+// TestMultiClientSpill tests that a log driver in non-blocking mode spills the log messages which
+// don't fit into its ring buffer to a spill directory of its own, and that the log messages
+// dropped from its ring buffer are counted.
+func TestMultiClientSpill(t *testing.T) {
+	spillDir := t.TempDir()
+	spilled := &fanOutRecorder{release: make(chan struct{})}
+	dropped := &fanOutRecorder{release: make(chan struct{})}
+	m, err := newMultiClient(&GlobalArgs{
+		ContainerID:          testContainerID,
+		MaxBufferSize:        10,
+		BufferOverflowPolicy: DropNewestOverflowPolicy,
+		SpillDir:             spillDir,
+		SpillSegmentSize:     1024,
+		SpillMaxSize:         4096,
+	}, []*MultiStream{
+		{DriverName: "spilled", Mode: NonBlockingMode, New: func() (Client, error) { return spilled, nil }},
+		{DriverName: "dropped", Mode: NonBlockingMode, New: func() (Client, error) { return dropped, nil }},
+	})
+	require.NoError(t, err)
+	// Only the first log driver spills.
+	require.NoError(t, m.streams[1].buffer.spill.close())
+	m.streams[1].buffer.spill = nil
+	m.start()
+
+	var expected []string
+	for i := 0; i < 5; i++ {
+		line := fmt.Sprintf("line%d", i)
+		expected = append(expected, line)
+		require.NoError(t, m.Log(newMessage([]byte(line), sourceSTDOUT, dummyTime)))
+	}
+	require.DirExists(t, filepath.Join(spillDir, testContainerID, "spilled"))
+
+	close(spilled.release)
+	close(dropped.release)
+	m.close()
+	require.Equal(t, expected, spilled.lines())
+	require.Less(t, len(dropped.lines()), len(expected))
+	require.NotZero(t, atomic.LoadUint64(&m.streams[1].dropped.messages))
+	m.reportTrace(testContainerID, false)
+	m.reportTrace(testContainerID, true)
+	require.NoDirExists(t, filepath.Join(spillDir, testContainerID))
+}
@@ -0,0 +1,287 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/aws/shim-loggers-for-containerd/debug"
+)
+
+// Built-in multiline presets.
+const (
+	// JavaMultilinePreset groups Java stack traces, i.e. the exception, `at ...`, `... N more`,
+	// `Caused by:` and `Suppressed:` lines, with the log line before them.
+	JavaMultilinePreset = "java"
+	// PythonMultilinePreset groups Python tracebacks, from `Traceback (most recent call last):` to
+	// the exception line, including chained exceptions.
+	PythonMultilinePreset = "python"
+	// GoMultilinePreset groups Go panics and fatal errors with the goroutine stack traces after them.
+	GoMultilinePreset = "go"
+)
+
+// multilinePresets are the start and continuation patterns of the built-in multiline presets.
+var multilinePresets = map[string]struct {
+	start        string
+	continuation string
+}{
+	JavaMultilinePreset: {
+		continuation: `^(?:\s+at\s|\s+\.\.\. \d+ (?:more|common frames omitted)|\s*Caused by:|\s*Suppressed:|` +
+			`(?:[\w$]+\.)+[\w$]*(?:Exception|Error|Throwable)\b)`,
+	},
+	PythonMultilinePreset: {
+		start: `^Traceback \(most recent call last\):`,
+		continuation: `^(?:\s|$|Traceback \(most recent call last\):|During handling of the above exception|` +
+			`The above exception was the direct cause|[\w.]+(?:Error|Exception|Warning|Exit|Interrupt|Iteration)\b)`,
+	},
+	GoMultilinePreset: {
+		start: `^(?:panic: |fatal error: )`,
+		continuation: `^(?:\s|$|panic: |goroutine \d+ \[|created by |\[signal |runtime stack:|exit status \d+$|` +
+			`[\w./*()\[\]-]+\(.*\)$)`,
+	},
+}
+
+// MultilineArgs sets how consecutive log lines of a source pipe are grouped into a single log
+// message, joined by newlines, e.g. the lines of a stack trace.
+//
+// If only the start pattern is set, a log line matching it starts a group, and the log lines
+// after it are added to the group until the next one matching it. If only the continuation
+// pattern is set, every log line starts a group, and the log lines matching it are added to the
+// group. If both are set, a log line matching the start pattern starts a group, the log lines
+// matching the continuation pattern are added to it, and the other log lines are sent as they are.
+type MultilineArgs struct {
+	// Preset is one of the built-in presets, whose patterns are used unless they are set.
+	Preset string
+	// StartPattern matches the first log line of a group.
+	StartPattern string
+	// ContinuePattern matches the log lines added to a group.
+	ContinuePattern string
+	// FlushTimeout is how long a group waits for the next log line before it's sent. Zero means a
+	// group is only sent once it's complete.
+	FlushTimeout time.Duration
+	// MaxLines is the max number of log lines of a group, zero means no limit.
+	MaxLines int
+	// MaxBytes is the max size of a group, zero means no limit.
+	MaxBytes int
+}
+
+// multiline is the validated multiline arguments.
+type multiline struct {
+	start        *regexp.Regexp
+	continuation *regexp.Regexp
+	flushTimeout time.Duration
+	maxLines     int
+	maxBytes     int
+}
+
+// newMultiline validates the multiline arguments and compiles the patterns.
+func newMultiline(args *MultilineArgs) (*multiline, error) {
+	start, continuation := args.StartPattern, args.ContinuePattern
+	if args.Preset != "" {
+		preset, ok := multilinePresets[args.Preset]
+		if !ok {
+			return nil, fmt.Errorf("unknown multiline preset: %s", args.Preset)
+		}
+		if start == "" && continuation == "" {
+			start, continuation = preset.start, preset.continuation
+		}
+	}
+	if start == "" && continuation == "" {
+		return nil, errors.New("either a multiline preset, start pattern or continuation pattern is required")
+	}
+	if args.FlushTimeout < 0 || args.MaxLines < 0 || args.MaxBytes < 0 {
+		return nil, errors.New("multiline flush timeout, max lines and max bytes must not be negative")
+	}
+
+	m := &multiline{
+		flushTimeout: args.FlushTimeout,
+		maxLines:     args.MaxLines,
+		maxBytes:     args.MaxBytes,
+	}
+	var err error
+	if start != "" {
+		if m.start, err = regexp.Compile(start); err != nil {
+			return nil, fmt.Errorf("invalid multiline start pattern %s: %w", start, err)
+		}
+	}
+	if continuation != "" {
+		if m.continuation, err = regexp.Compile(continuation); err != nil {
+			return nil, fmt.Errorf("invalid multiline continuation pattern %s: %w", continuation, err)
+		}
+	}
+	return m, nil
+}
+
+// multilineAction is what is done with a log line read from a source pipe.
+type multilineAction int
+
+const (
+	// startGroup sends the current group and starts a new one with the log line.
+	startGroup multilineAction = iota
+	// addToGroup adds the log line to the current group.
+	addToGroup
+	// sendAlone sends the current group and then the log line on its own.
+	sendAlone
+)
+
+// action decides what is done with a log line, depending on whether there is a group it can be
+// added to.
+func (m *multiline) action(line []byte, grouping bool) multilineAction {
+	if grouping && m.continuation != nil && m.continuation.Match(line) {
+		return addToGroup
+	}
+	if m.start == nil {
+		return startGroup
+	}
+	if m.start.Match(line) {
+		return startGroup
+	}
+	if grouping && m.continuation == nil {
+		return addToGroup
+	}
+	return sendAlone
+}
+
+// multilineGroup groups the log lines read from a single source pipe before sending them to
+// destination, and sends a group once a log line doesn't belong to it, once it's full, or once
+// no log line is added to it within the flush timeout.
+type multilineGroup struct {
+	cfg              *multiline
+	sendLogMsgToDest sendLogToDestFunc
+	containerID      string
+	source           string
+
+	lock sync.Mutex
+	// grouping is whether the next log lines can still be added to the current group. It's kept
+	// after the group is sent because it's full or timed out, so that the rest of it is grouped.
+	grouping bool
+	// buf holds the log lines of the current group, joined by newlines.
+	buf       []byte
+	lines     int
+	timestamp time.Time
+	// lastLine is when the last log line was added to the current group.
+	lastLine time.Time
+	timer    *time.Timer
+}
+
+// newMultilineGroup creates the group of a source pipe sending log messages with sendLogMsgToDest.
+func newMultilineGroup(
+	cfg *multiline,
+	containerID, source string,
+	sendLogMsgToDest sendLogToDestFunc,
+) *multilineGroup {
+	return &multilineGroup{
+		cfg:              cfg,
+		sendLogMsgToDest: sendLogMsgToDest,
+		containerID:      containerID,
+		source:           source,
+	}
+}
+
+// add adds a log line to the current group, or sends it. Partial log messages aren't grouped: the
+// current group is sent before them, and they are sent as they are.
+func (g *multilineGroup) add(
+	line []byte,
+	source string,
+	isPartialMsg, isLastPartial bool,
+	partialID string,
+	partialOrdinal int,
+	msgTimestamp time.Time,
+) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	action := sendAlone
+	if !isPartialMsg {
+		action = g.cfg.action(line, g.grouping)
+	}
+	if action == addToGroup && g.lines > 0 && g.isFull(line) {
+		action = startGroup
+	}
+	if action != addToGroup {
+		if err := g.flush(); err != nil {
+			return err
+		}
+	}
+
+	switch action {
+	case sendAlone:
+		g.grouping = false
+		return g.sendLogMsgToDest(line, source, isPartialMsg, isLastPartial, partialID, partialOrdinal, msgTimestamp)
+	case startGroup:
+		g.grouping = true
+	}
+	if g.lines == 0 {
+		g.timestamp = msgTimestamp
+	} else {
+		g.buf = append(g.buf, newline)
+	}
+	g.buf = append(g.buf, line...)
+	g.lines++
+	g.lastLine = time.Now()
+	if g.cfg.flushTimeout > 0 {
+		if g.timer == nil {
+			g.timer = time.AfterFunc(g.cfg.flushTimeout, g.flushOnTimeout)
+		} else {
+			g.timer.Reset(g.cfg.flushTimeout)
+		}
+	}
+	return nil
+}
+
+// isFull returns whether the current group would be larger than the max lines or max bytes with
+// the log line.
+func (g *multilineGroup) isFull(line []byte) bool {
+	return (g.cfg.maxLines > 0 && g.lines+1 > g.cfg.maxLines) ||
+		(g.cfg.maxBytes > 0 && len(g.buf)+1+len(line) > g.cfg.maxBytes)
+}
+
+// flush sends the current group as a single log message, if there is one.
+func (g *multilineGroup) flush() error {
+	if g.lines == 0 {
+		return nil
+	}
+	err := g.sendLogMsgToDest(g.buf, g.source, false, false, "", 0, g.timestamp)
+	g.buf = g.buf[:0]
+	g.lines = 0
+	return err
+}
+
+// flushOnTimeout sends the current group once no log line has been added to it within the flush
+// timeout.
+func (g *multilineGroup) flushOnTimeout() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.lines == 0 {
+		return
+	}
+	// A log line may have been added after the timer fired.
+	if wait := g.cfg.flushTimeout - time.Since(g.lastLine); wait > 0 {
+		g.timer.Reset(wait)
+		return
+	}
+	if err := g.flush(); err != nil {
+		debug.SendEvent(g.containerID,
+			fmt.Sprintf("[Pipe %s] Failed to send multiline log message: %s", g.source, err),
+			debug.ERROR,
+			debug.Source(g.source),
+			debug.Err(err))
+	}
+}
+
+// close sends the current group, once no more log lines are read from the source pipe.
+func (g *multilineGroup) close() error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.timer != nil {
+		g.timer.Stop()
+	}
+	return g.flush()
+}
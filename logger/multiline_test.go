@@ -0,0 +1,214 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package logger
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// sentMessages records the log messages sent to destination.
+type sentMessages struct {
+	lock       sync.Mutex
+	lines      []string
+	timestamps []time.Time
+}
+
+func (s *sentMessages) send(line []byte, _ string, _, _ bool, _ string, _ int, msgTimestamp time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.lines = append(s.lines, string(line))
+	s.timestamps = append(s.timestamps, msgTimestamp)
+	return nil
+}
+
+func (s *sentMessages) get() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string{}, s.lines...)
+}
+
+// readMultiline reads the log lines with multiline enabled, and returns the log messages sent to
+// destination.
+func readMultiline(t *testing.T, args *MultilineArgs, lines ...string) []string {
+	l, err := NewLogger(WithInfo(NewInfo(testContainerID, testContainerName)), WithMultiline(args))
+	require.NoError(t, err)
+	sent := &sentMessages{}
+	pipe := strings.NewReader(strings.Join(lines, "\n") + "\n")
+	require.NoError(t, l.Read(context.Background(), pipe, sourceSTDOUT, DefaultBufSizeInBytes, sent.send))
+	return sent.get()
+}
+
+// TestMultilinePatterns tests that log lines are grouped with a start pattern, a continuation
+// pattern, or both.
+func TestMultilinePatterns(t *testing.T) {
+	lines := []string{"first", "  one", "START second", "  two", "  three", "third", "START fourth"}
+	for _, tc := range []struct {
+		name     string
+		args     *MultilineArgs
+		expected []string
+	}{
+		{
+			name:     "start",
+			args:     &MultilineArgs{StartPattern: "^START"},
+			expected: []string{"first", "  one", "START second\n  two\n  three\nthird", "START fourth"},
+		},
+		{
+			name:     "continuation",
+			args:     &MultilineArgs{ContinuePattern: `^\s`},
+			expected: []string{"first\n  one", "START second\n  two\n  three", "third", "START fourth"},
+		},
+		{
+			name:     "both",
+			args:     &MultilineArgs{StartPattern: "^START", ContinuePattern: `^\s`},
+			expected: []string{"first", "  one", "START second\n  two\n  three", "third", "START fourth"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, readMultiline(t, tc.args, lines...))
+		})
+	}
+}
+
+// TestMultilinePresets tests that the stack traces of the built-in presets are grouped.
+func TestMultilinePresets(t *testing.T) {
+	javaTrace := []string{
+		"2020-01-14 01:59:00 ERROR Request failed",
+		"java.lang.IllegalStateException: boom",
+		"\tat com.example.App.handle(App.java:42)",
+		"\tat com.example.App.main(App.java:7)",
+		"Caused by: java.lang.NullPointerException",
+		"\tat com.example.Dao.get(Dao.java:12)",
+		"\t... 2 more",
+	}
+	pythonTrace := []string{
+		"Traceback (most recent call last):",
+		`  File "app.py", line 3, in <module>`,
+		"    main()",
+		"KeyError: 'id'",
+		"",
+		"During handling of the above exception, another exception occurred:",
+		"",
+		"Traceback (most recent call last):",
+		`  File "app.py", line 5, in <module>`,
+		"ValueError: invalid id",
+	}
+	goPanic := []string{
+		"panic: runtime error: index out of range [5] with length 3",
+		"",
+		"goroutine 1 [running]:",
+		"main.(*server).handle(0xc000010000, {0x0, 0x0})",
+		"\t/app/main.go:12 +0x1d",
+		"main.main()",
+		"\t/app/main.go:7 +0x25",
+		"exit status 2",
+	}
+	for _, tc := range []struct {
+		preset string
+		lines  []string
+	}{
+		{preset: JavaMultilinePreset, lines: javaTrace},
+		{preset: PythonMultilinePreset, lines: pythonTrace},
+		{preset: GoMultilinePreset, lines: goPanic},
+	} {
+		t.Run(tc.preset, func(t *testing.T) {
+			lines := append([]string{"before"}, tc.lines...)
+			lines = append(lines, "after")
+			expected := []string{"before", strings.Join(tc.lines, "\n"), "after"}
+			require.Equal(t, expected, readMultiline(t, &MultilineArgs{Preset: tc.preset}, lines...))
+		})
+	}
+}
+
+// TestMultilineMaxLinesAndBytes tests that a group is sent once it's full, and that the log lines
+// after it are still grouped.
+func TestMultilineMaxLinesAndBytes(t *testing.T) {
+	lines := []string{"START", " 1", " 2", " 3", " 4", "next"}
+	require.Equal(t,
+		[]string{"START\n 1", " 2\n 3", " 4\nnext"},
+		readMultiline(t, &MultilineArgs{StartPattern: "^START", MaxLines: 2}, lines...))
+	require.Equal(t,
+		[]string{"START\n 1", " 2\n 3\n 4", "next"},
+		readMultiline(t, &MultilineArgs{StartPattern: "^START", ContinuePattern: `^\s`, MaxBytes: 8}, lines...))
+}
+
+// TestMultilineFlushTimeout tests that a group is sent once no log line is added to it within the
+// flush timeout, with the timestamp of its first log line.
+func TestMultilineFlushTimeout(t *testing.T) {
+	m, err := newMultiline(&MultilineArgs{ContinuePattern: `^\s`, FlushTimeout: 50 * time.Millisecond})
+	require.NoError(t, err)
+	sent := &sentMessages{}
+	g := newMultilineGroup(m, testContainerID, sourceSTDOUT, sent.send)
+	defer g.close() //nolint:errcheck // testing only
+
+	require.NoError(t, g.add([]byte("first"), sourceSTDOUT, false, false, "", 1, dummyTime))
+	require.NoError(t, g.add([]byte(" second"), sourceSTDOUT, false, false, "", 1, dummyTime.Add(time.Second)))
+	require.Empty(t, sent.get())
+	require.Eventually(t, func() bool {
+		return len(sent.get()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"first\n second"}, sent.get())
+	require.Equal(t, []time.Time{dummyTime}, sent.timestamps)
+}
+
+// TestMultilinePartialMessages tests that partial log messages are sent as they are.
+func TestMultilinePartialMessages(t *testing.T) {
+	l, err := NewLogger(
+		WithInfo(NewInfo(testContainerID, testContainerName)),
+		WithMultiline(&MultilineArgs{ContinuePattern: `^\s`}),
+		WithBufferSizeInBytes(8),
+		WithMaxReadBytes(4),
+	)
+	require.NoError(t, err)
+	sent := &sentMessages{}
+	pipe := strings.NewReader("first\n 1\nlong line\n 2\n")
+	require.NoError(t, l.Read(context.Background(), pipe, sourceSTDOUT, 8, sent.send))
+	require.Equal(t, []string{"first\n 1", "long lin", "e", " 2"}, sent.get())
+}
+
+// TestMultilineBufferedLogger tests that log lines are grouped before they are saved to the ring
+// buffer in non-blocking mode.
+func TestMultilineBufferedLogger(t *testing.T) {
+	l, err := NewLogger(
+		WithInfo(NewInfo(testContainerID, testContainerName)),
+		WithMultiline(&MultilineArgs{Preset: GoMultilinePreset}),
+	)
+	require.NoError(t, err)
+	bl, ok := NewBufferedLogger(l, DefaultBufSizeInBytes, 1024, testContainerID).(*bufferedLogger)
+	require.True(t, ok)
+
+	pipe := strings.NewReader("panic: boom\n\ngoroutine 1 [running]:\nmain.main()\n\t/app/main.go:7 +0x25\ndone\n")
+	require.NoError(t, bl.Read(context.Background(), pipe, sourceSTDERR, DefaultBufSizeInBytes, bl.saveSingleLogMessageToRingBuffer))
+	var lines []string
+	for _, msg := range bl.buffer.Flush() {
+		require.Equal(t, sourceSTDERR, msg.Source)
+		lines = append(lines, string(msg.Line))
+	}
+	require.Equal(t, []string{"panic: boom\n\ngoroutine 1 [running]:\nmain.main()\n\t/app/main.go:7 +0x25", "done"}, lines)
+}
+
+// TestNewMultilineWithError tests that invalid multiline arguments are rejected.
+func TestNewMultilineWithError(t *testing.T) {
+	for name, args := range map[string]*MultilineArgs{
+		"no pattern":             {},
+		"unknown preset":         {Preset: "ruby"},
+		"invalid start":          {StartPattern: "("},
+		"invalid continuation":   {ContinuePattern: "["},
+		"negative max lines":     {StartPattern: "^START", MaxLines: -1},
+		"negative flush timeout": {StartPattern: "^START", FlushTimeout: -time.Second},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewLogger(WithMultiline(args))
+			require.Error(t, err)
+		})
+	}
+}
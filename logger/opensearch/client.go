@@ -0,0 +1,339 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package opensearch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/endpointcreds"
+	dockerlogger "github.com/docker/docker/daemon/logger"
+
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+const (
+	// maxBatchSize is the max number of documents indexed in a single bulk request.
+	maxBatchSize = 500
+	// maxBatchBytes is the max size of the body of a bulk request before compression, which stays
+	// well below the default 100 MiB limit of http.max_content_length.
+	maxBatchBytes = 5 * 1024 * 1024
+	// flushInterval is how long the first document of a batch waits before the batch is indexed,
+	// if there are not enough documents to fill it.
+	flushInterval = 1 * time.Second
+	// bulkTimeout bounds how long a single bulk request takes.
+	bulkTimeout = 30 * time.Second
+	// maxBulkAttempts is the max number of attempts to index a document, if either the cluster
+	// is temporarily unavailable or the document is rejected because the cluster is overloaded.
+	maxBulkAttempts = 3
+	// initialRetryBackoff is how long to wait before retrying to index documents, which is
+	// doubled after every attempt.
+	initialRetryBackoff = 1 * time.Second
+	// maxResponseBodySize bounds how much of the response body is read from the cluster. The
+	// response of a bulk request holds an item for every document.
+	maxResponseBodySize = 16 * 1024 * 1024
+	// credentialsEndpointHost is the host of the credentials endpoint on the ECS agent, in the
+	// same way as the moby awslogs log driver.
+	credentialsEndpointHost = "http://169.254.170.2"
+)
+
+// documentMetadata is the metadata of the container added to every document.
+type documentMetadata struct {
+	containerID        string
+	containerName      string
+	containerImageName string
+	containerImageID   string
+	containerLabels    map[string]string
+}
+
+// newDocumentMetadata creates the metadata of the container from its arguments and docker configs.
+func newDocumentMetadata(globalArgs *logger.GlobalArgs, dockerConfigs *logger.DockerConfigs) *documentMetadata {
+	meta := &documentMetadata{
+		containerID:   globalArgs.ContainerID,
+		containerName: globalArgs.ContainerName,
+	}
+	if dockerConfigs != nil {
+		meta.containerImageName = dockerConfigs.ContainerImageName
+		meta.containerImageID = dockerConfigs.ContainerImageID
+		meta.containerLabels = dockerConfigs.ContainerLabels
+	}
+	return meta
+}
+
+// document is the JSON document of a log message.
+type document struct {
+	Timestamp          string            `json:"@timestamp"`
+	Message            string            `json:"message"`
+	Stream             string            `json:"stream"`
+	ContainerID        string            `json:"container_id"`
+	ContainerName      string            `json:"container_name"`
+	ContainerImageName string            `json:"container_image_name,omitempty"`
+	ContainerImageID   string            `json:"container_image_id,omitempty"`
+	ContainerLabels    map[string]string `json:"container_labels,omitempty"`
+}
+
+// bulkAction is the action line preceding every document in the body of a bulk request. Create
+// is used rather than index, so that documents can be sent to data streams too.
+type bulkAction struct {
+	Create struct {
+		Index string `json:"_index"`
+	} `json:"create"`
+}
+
+// bulkResponse is the response of a bulk request, with an item for every document in order.
+type bulkResponse struct {
+	Errors bool                  `json:"errors"`
+	Items  []map[string]bulkItem `json:"items"`
+}
+
+// bulkItem is the result of indexing a document.
+type bulkItem struct {
+	Status int `json:"status"`
+	Error  *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+// client converts log messages to documents, and indexes them in batches with the _bulk API in
+// the background.
+//
+// Log blocks while the queue is full, which happens when the cluster doesn't keep up, so that
+// the container is slowed down in the blocking mode, and the buffer of the non-blocking mode
+// applies its overflow policy.
+type client struct {
+	cfg        *config
+	meta       *documentMetadata
+	httpClient *http.Client
+	// credentials and signer are only set with SigV4.
+	credentials aws.CredentialsProvider
+	signer      *v4.Signer
+	batcher     *logger.Batcher[[]byte]
+}
+
+// newClient creates a client indexing the documents of the container in the cluster. With SigV4,
+// the AWS config is loaded in the same way as the moby awslogs log driver, i.e. with the
+// credentials served by the ECS agent if the credentials endpoint is set, or with the default
+// credentials chain otherwise.
+func newClient(ctx context.Context, cfg *config, meta *documentMetadata) (*client, error) {
+	c := &client{
+		cfg:        cfg,
+		meta:       meta,
+		httpClient: &http.Client{Timeout: bulkTimeout},
+	}
+	if cfg.sigV4 {
+		opts := []func(*awsconfig.LoadOptions) error{awsconfig.WithRegion(cfg.region)}
+		if cfg.credentialsEndpoint != "" {
+			provider := endpointcreds.New(credentialsEndpointHost + cfg.credentialsEndpoint)
+			opts = append(opts, awsconfig.WithCredentialsProvider(aws.NewCredentialsCache(provider)))
+		}
+		awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load AWS config: %w", err)
+		}
+		c.credentials = awsCfg.Credentials
+		c.signer = v4.NewSigner()
+	}
+	c.batcher = logger.NewBatcher(&logger.BatcherConfig[[]byte]{
+		DriverName:     DriverName,
+		Items:          "documents",
+		QueueSize:      maxBatchSize,
+		MaxItems:       maxBatchSize,
+		MaxBytes:       maxBatchBytes,
+		Size:           func(entry []byte) int { return len(entry) },
+		Wait:           flushInterval,
+		Send:           c.send,
+		Timeout:        bulkTimeout,
+		MaxAttempts:    maxBulkAttempts,
+		InitialBackoff: initialRetryBackoff,
+	})
+
+	return c, nil
+}
+
+// Log converts a log message to a bulk entry, i.e. an action line and a document line, and queues
+// it to be indexed. It blocks if the queue is full.
+func (c *client) Log(msg *dockerlogger.Message) error {
+	entry, err := c.newEntry(msg)
+	dockerlogger.PutMessage(msg)
+	if err != nil {
+		return err
+	}
+	return c.batcher.Add(entry)
+}
+
+// newEntry converts a log message to a bulk entry, in the index of the date of the log message.
+func (c *client) newEntry(msg *dockerlogger.Message) ([]byte, error) {
+	index, err := c.cfg.indexName(indexFields{
+		ContainerName: c.meta.containerName,
+		ContainerID:   c.meta.containerID,
+		Date:          c.cfg.indexDate(msg.Timestamp),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to render index name: %w", err)
+	}
+	var action bulkAction
+	action.Create.Index = index
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	// Keep the log lines as they are rather than escaping HTML characters.
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(action); err != nil {
+		return nil, fmt.Errorf("unable to encode bulk action: %w", err)
+	}
+	if err := enc.Encode(document{
+		Timestamp:          msg.Timestamp.UTC().Format(time.RFC3339Nano),
+		Message:            string(msg.Line),
+		Stream:             msg.Source,
+		ContainerID:        c.meta.containerID,
+		ContainerName:      c.meta.containerName,
+		ContainerImageName: c.meta.containerImageName,
+		ContainerImageID:   c.meta.containerImageID,
+		ContainerLabels:    c.meta.containerLabels,
+	}); err != nil {
+		return nil, fmt.Errorf("unable to encode document: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Close indexes the documents which are not indexed yet.
+func (c *client) Close() error {
+	c.batcher.Close()
+	c.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// send indexes a batch of entries. If the cluster is temporarily unavailable, the whole batch is
+// sent again by the batcher, and if only some of the documents are rejected because the cluster
+// is overloaded, only those are sent again.
+func (c *client) send(ctx context.Context, entries [][]byte) ([][]byte, error) {
+	retry, err := c.bulk(ctx, entries)
+	if err != nil || len(retry) == 0 {
+		return nil, err
+	}
+	retried := make([][]byte, 0, len(retry))
+	for _, i := range retry {
+		retried = append(retried, entries[i])
+	}
+	return retried, errors.New("documents are rejected by the cluster")
+}
+
+// bulk sends a bulk request, and returns the indexes of the entries which are rejected but can be
+// retried, i.e. with either the 429 status or a 5xx one. The entries which are rejected for other
+// reasons, such as mapping conflicts, are dropped.
+func (c *client) bulk(ctx context.Context, entries [][]byte) ([]int, error) {
+	body := bytes.Join(entries, nil)
+	if c.cfg.compression == GzipCompression {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return nil, fmt.Errorf("unable to compress bulk request: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("unable to compress bulk request: %w", err)
+		}
+		body = buf.Bytes()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.bulkURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create bulk request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if c.cfg.compression == GzipCompression {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if err := c.authenticate(ctx, req, body); err != nil {
+		return nil, &logger.RetryableError{Err: err}
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, &logger.RetryableError{Err: fmt.Errorf("unable to send bulk request: %w", err)}
+	}
+	defer resp.Body.Close() //nolint:errcheck // nothing to do
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		// Drain the response body so that the connection can be reused.
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBodySize))
+		err := fmt.Errorf("bulk request failed with status %s", resp.Status)
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return nil, &logger.RetryableError{Err: err}
+		}
+		return nil, err
+	}
+
+	var result bulkResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBodySize)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("unable to decode bulk response: %w", err)
+	}
+	if !result.Errors {
+		return nil, nil
+	}
+	if len(result.Items) != len(entries) {
+		return nil, fmt.Errorf("bulk response has %d items for %d documents", len(result.Items), len(entries))
+	}
+
+	var (
+		retry    []int
+		rejected int
+		reason   string
+	)
+	for i, item := range result.Items {
+		for _, res := range item {
+			switch {
+			case res.Status < http.StatusMultipleChoices:
+			case res.Status == http.StatusTooManyRequests || res.Status >= http.StatusInternalServerError:
+				retry = append(retry, i)
+			default:
+				rejected++
+				if reason == "" && res.Error != nil {
+					reason = res.Error.Type + ": " + res.Error.Reason
+				}
+			}
+		}
+	}
+	if rejected > 0 {
+		c.batcher.Drop(rejected, fmt.Errorf("documents are rejected by the cluster: %s", reason))
+	}
+	return retry, nil
+}
+
+// authenticate sets the authentication of a bulk request, by either signing it with SigV4 or
+// setting the basic authentication.
+func (c *client) authenticate(ctx context.Context, req *http.Request, body []byte) error {
+	if c.signer == nil {
+		if c.cfg.username != "" {
+			req.SetBasicAuth(c.cfg.username, c.cfg.password)
+		}
+		return nil
+	}
+
+	creds, err := c.credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve AWS credentials: %w", err)
+	}
+	hash := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(hash[:])
+	// OpenSearch Serverless requires the hash of the payload to be sent along with the signature.
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if err := c.signer.SignHTTP(ctx, creds, req, payloadHash, c.cfg.service, c.cfg.region, time.Now()); err != nil {
+		return fmt.Errorf("unable to sign bulk request: %w", err)
+	}
+	return nil
+}
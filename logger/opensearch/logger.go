@@ -0,0 +1,280 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package opensearch provides a log driver indexing container logs as documents in OpenSearch or
+// Elasticsearch with the _bulk API, without a fluentd hop.
+package opensearch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/containerd/containerd/runtime/v2/logging"
+
+	"github.com/aws/shim-loggers-for-containerd/debug"
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+// opensearch driver argument keys.
+const (
+	// DriverName is the name of the opensearch log driver.
+	DriverName = "opensearch"
+
+	// Required.
+
+	// EndpointKey is the URL of the cluster, e.g. `https://search-domain.us-west-2.es.amazonaws.com`.
+	// The _bulk API is called under its path.
+	EndpointKey = "opensearch-endpoint"
+
+	// Optional.
+
+	// IndexKey is the template of the index names, which is rendered for every document.
+	IndexKey = "opensearch-index"
+	// IndexDateFormatKey is the Go time layout of the date of the documents in the index names.
+	IndexDateFormatKey = "opensearch-index-date-format"
+	// UsernameKey is the username of the basic authentication.
+	UsernameKey = "opensearch-username"
+	// PasswordKey is the password of the basic authentication.
+	PasswordKey = "opensearch-password" //nolint:gosec // not credentials
+	// PasswordFileKey is the path of a file holding the password of the basic authentication,
+	// which overrides PasswordKey, so that it doesn't show up in the command line.
+	PasswordFileKey = "opensearch-password-file" //nolint:gosec // not credentials
+	// AWSSigV4Key signs the requests with AWS Signature Version 4 instead of using the basic
+	// authentication, for Amazon OpenSearch Service.
+	AWSSigV4Key = "opensearch-aws-sigv4"
+	// RegionKey is the AWS region of the domain or collection, which is required with SigV4.
+	RegionKey = "opensearch-region"
+	// AWSServiceKey is the signing name of the service, either `es` for domains, the default, or
+	// `aoss` for serverless collections.
+	AWSServiceKey = "opensearch-aws-service"
+	// CredentialsEndpointKey is the path of the credentials endpoint on the ECS agent, in the
+	// same way as awslogs-credentials-endpoint.
+	CredentialsEndpointKey = "opensearch-credentials-endpoint" //nolint:gosec // not credentials
+	// CompressionKey is either `gzip` or `none`, the default.
+	CompressionKey = "opensearch-compression"
+)
+
+// Supported values and default values of the arguments.
+const (
+	GzipCompression = "gzip"
+	NoCompression   = "none"
+
+	// DefaultIndex is the default template of the index names.
+	DefaultIndex = "logs-{{.Date}}"
+	// DefaultIndexDateFormat is the default layout of the dates in the index names.
+	DefaultIndexDateFormat = "2006.01.02"
+
+	serviceES   = "es"
+	serviceAOSS = "aoss"
+)
+
+// Args represents opensearch log driver arguments.
+type Args struct {
+	// Required.
+	Endpoint string
+
+	// Optional.
+	Index               string
+	IndexDateFormat     string
+	Username            string
+	Password            string
+	AWSSigV4            string
+	Region              string
+	AWSService          string
+	CredentialsEndpoint string
+	Compression         string
+}
+
+// LoggerArgs stores global logger args, docker configs and opensearch specific args.
+type LoggerArgs struct {
+	globalArgs    *logger.GlobalArgs
+	dockerConfigs *logger.DockerConfigs
+	args          *Args
+}
+
+// InitLogger initializes the input arguments.
+func InitLogger(globalArgs *logger.GlobalArgs, dockerConfigs *logger.DockerConfigs, opensearchArgs *Args) *LoggerArgs {
+	return &LoggerArgs{
+		globalArgs:    globalArgs,
+		dockerConfigs: dockerConfigs,
+		args:          opensearchArgs,
+	}
+}
+
+// RunLogDriver initiates the opensearch driver and starts indexing container logs. Errors with
+// the log driver are logged but not returned to prevent container termination.
+func (la *LoggerArgs) RunLogDriver(ctx context.Context, config *logging.Config, ready func() error) error {
+	defer debug.DeferFuncForRunLogDriver()
+
+	stream, err := la.newStream(ctx)
+	if err != nil {
+		debug.ErrLogger = err
+		return debug.ErrLogger
+	}
+	// Index the documents which are not indexed yet before exiting.
+	defer stream.Close() //nolint:errcheck // errors are already logged
+
+	l, err := logger.NewPipelineLogger(la.globalArgs, config, logger.NewInfo(la.globalArgs.ContainerID, la.globalArgs.ContainerName), stream)
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("unable to create opensearch driver: %w", err)
+		return debug.ErrLogger
+	}
+
+	// Start opensearch driver.
+	debug.SendEventsToLog(logger.DaemonName, "Starting opensearch driver", debug.INFO, 0)
+	err = l.Start(ctx, la.globalArgs.CleanupTime, ready)
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("failed to run opensearch driver: %w", err)
+		// Do not return error if log driver has issue sending logs to destination, because if error
+		// returned here, containerd will identify this error and kill shim process, which will kill
+		// the container process accordingly.
+		// Note: the container will continue to run if shim logger exits after.
+		// Reference: https://github.com/containerd/containerd/blob/release/1.3/runtime/v2/logging/logging.go
+		return nil
+	}
+	debug.SendEventsToLog(logger.DaemonName, "Logging finished", debug.INFO, 1)
+
+	return nil
+}
+
+// NewStream creates the opensearch stream, which is used when fanning out to multiple log
+// drivers.
+func (la *LoggerArgs) NewStream() (logger.Client, error) {
+	stream, err := la.newStream(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// newStream validates the log options and creates the opensearch stream.
+func (la *LoggerArgs) newStream(ctx context.Context) (*client, error) {
+	cfg, err := getOpenSearchConfig(la.args)
+	if err != nil {
+		return nil, fmt.Errorf("unable to validate log options: %w", err)
+	}
+	stream, err := newClient(ctx, cfg, newDocumentMetadata(la.globalArgs, la.dockerConfigs))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create stream: %w", err)
+	}
+
+	return stream, nil
+}
+
+// config is the validated opensearch log driver arguments.
+type config struct {
+	bulkURL         string
+	index           *template.Template
+	indexDateFormat string
+	username        string
+	password        string
+	sigV4           bool
+	region          string
+	service         string
+	// credentialsEndpoint is only used with SigV4.
+	credentialsEndpoint string
+	compression         string
+}
+
+// indexFields are the fields of the index template.
+type indexFields struct {
+	ContainerName string
+	ContainerID   string
+	Date          string
+}
+
+// getOpenSearchConfig validates the opensearch log driver arguments and sets the default values.
+func getOpenSearchConfig(args *Args) (*config, error) {
+	endpoint, err := url.Parse(args.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", EndpointKey, args.Endpoint, err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("invalid %s %s: scheme must be http or https", EndpointKey, args.Endpoint)
+	}
+	if endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid %s %s: host is required", EndpointKey, args.Endpoint)
+	}
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + "/_bulk"
+
+	cfg := &config{
+		bulkURL:             endpoint.String(),
+		indexDateFormat:     args.IndexDateFormat,
+		username:            args.Username,
+		password:            args.Password,
+		region:              args.Region,
+		service:             args.AWSService,
+		credentialsEndpoint: args.CredentialsEndpoint,
+		compression:         args.Compression,
+	}
+
+	index := args.Index
+	if index == "" {
+		index = DefaultIndex
+	}
+	if cfg.index, err = template.New("index").Option("missingkey=error").Parse(index); err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", IndexKey, index, err)
+	}
+	if cfg.indexDateFormat == "" {
+		cfg.indexDateFormat = DefaultIndexDateFormat
+	}
+	// Render the template once, so that templates referring to unknown fields are rejected.
+	if _, err := cfg.indexName(indexFields{Date: "date"}); err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", IndexKey, index, err)
+	}
+
+	if args.AWSSigV4 != "" {
+		if cfg.sigV4, err = strconv.ParseBool(args.AWSSigV4); err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", AWSSigV4Key, args.AWSSigV4, err)
+		}
+	}
+	if cfg.sigV4 {
+		if cfg.username != "" || cfg.password != "" {
+			return nil, fmt.Errorf("%s cannot be used along with %s and %s", AWSSigV4Key, UsernameKey, PasswordKey)
+		}
+		if cfg.region == "" {
+			return nil, fmt.Errorf("%s is required with %s", RegionKey, AWSSigV4Key)
+		}
+		switch cfg.service {
+		case "":
+			cfg.service = serviceES
+		case serviceES, serviceAOSS:
+		default:
+			return nil, fmt.Errorf("unknown %s: %s", AWSServiceKey, args.AWSService)
+		}
+	} else if cfg.password != "" && cfg.username == "" {
+		return nil, fmt.Errorf("%s is required with %s", UsernameKey, PasswordKey)
+	}
+
+	switch cfg.compression {
+	case "":
+		cfg.compression = NoCompression
+	case GzipCompression, NoCompression:
+	default:
+		return nil, fmt.Errorf("unknown %s: %s", CompressionKey, args.Compression)
+	}
+
+	return cfg, nil
+}
+
+// indexName renders the index template. Index names must be lowercase, so container names are
+// lowercased along with the rest of the name.
+func (cfg *config) indexName(fields indexFields) (string, error) {
+	var buf bytes.Buffer
+	if err := cfg.index.Execute(&buf, fields); err != nil {
+		return "", err
+	}
+	return strings.ToLower(buf.String()), nil
+}
+
+// indexDate formats the date of a document in its index name, in UTC so that the index of a
+// document doesn't depend on the time zone of the host.
+func (cfg *config) indexDate(t time.Time) string {
+	return t.UTC().Format(cfg.indexDateFormat)
+}
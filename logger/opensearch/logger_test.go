@@ -0,0 +1,220 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package opensearch
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+const (
+	testContainerID   = "test-container-id"
+	testContainerName = "Test-Container-Name"
+	testImageName     = "test-image-name"
+)
+
+// TestGetOpenSearchConfig tests that the arguments are validated and the default values are set.
+func TestGetOpenSearchConfig(t *testing.T) {
+	cfg, err := getOpenSearchConfig(&Args{Endpoint: "https://search:9200/"})
+	require.NoError(t, err)
+	require.Equal(t, "https://search:9200/_bulk", cfg.bulkURL)
+	require.Equal(t, NoCompression, cfg.compression)
+	require.False(t, cfg.sigV4)
+	index, err := cfg.indexName(indexFields{Date: cfg.indexDate(time.Date(2020, time.January, 14, 1, 59, 0, 0, time.UTC))})
+	require.NoError(t, err)
+	require.Equal(t, "logs-2020.01.14", index)
+
+	cfg, err = getOpenSearchConfig(&Args{
+		Endpoint:        "https://proxy/opensearch",
+		Index:           "{{.ContainerName}}-{{.Date}}",
+		IndexDateFormat: "2006.01",
+		AWSSigV4:        "true",
+		Region:          "us-west-2",
+		Compression:     GzipCompression,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "https://proxy/opensearch/_bulk", cfg.bulkURL)
+	require.True(t, cfg.sigV4)
+	require.Equal(t, serviceES, cfg.service)
+	index, err = cfg.indexName(indexFields{
+		ContainerName: testContainerName,
+		Date:          cfg.indexDate(time.Date(2020, time.January, 14, 1, 59, 0, 0, time.UTC)),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "test-container-name-2020.01", index)
+
+	for name, args := range map[string]*Args{
+		"endpoint":         {Endpoint: "search:9200"},
+		"host":             {Endpoint: "http://"},
+		"index":            {Endpoint: "http://search:9200", Index: "{{.Date"},
+		"index field":      {Endpoint: "http://search:9200", Index: "{{.Hostname}}"},
+		"sigv4":            {Endpoint: "http://search:9200", AWSSigV4: "yes"},
+		"sigv4 region":     {Endpoint: "http://search:9200", AWSSigV4: "true"},
+		"sigv4 basic auth": {Endpoint: "http://search:9200", AWSSigV4: "true", Region: "us-west-2", Username: "admin"},
+		"sigv4 service":    {Endpoint: "http://search:9200", AWSSigV4: "true", Region: "us-west-2", AWSService: "s3"},
+		"password":         {Endpoint: "http://search:9200", Password: "secret"},
+		"compression":      {Endpoint: "http://search:9200", Compression: "zstd"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := getOpenSearchConfig(args)
+			require.Error(t, err)
+		})
+	}
+}
+
+// fakeCluster is a _bulk endpoint which rejects the documents whose message is in reject with the
+// given status, the first time they're indexed.
+type fakeCluster struct {
+	lock     sync.Mutex
+	reject   map[string]int
+	requests []*http.Request
+	docs     []document
+	indexes  []string
+}
+
+func (s *fakeCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.requests = append(s.requests, r)
+
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+
+	var (
+		items  []string
+		errors bool
+	)
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		var action bulkAction
+		if err := json.Unmarshal(scanner.Bytes(), &action); err != nil || !scanner.Scan() {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var doc document
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if status, ok := s.reject[doc.Message]; ok {
+			delete(s.reject, doc.Message)
+			errors = true
+			items = append(items, fmt.Sprintf(`{"create":{"status":%d,"error":{"type":"rejected","reason":"test"}}}`, status))
+			continue
+		}
+		s.docs = append(s.docs, doc)
+		s.indexes = append(s.indexes, action.Create.Index)
+		items = append(items, `{"create":{"status":201}}`)
+	}
+	_, _ = fmt.Fprintf(w, `{"took":1,"errors":%t,"items":[%s]}`, errors, strings.Join(items, ","))
+}
+
+func newTestClient(t *testing.T, args *Args) *client {
+	cfg, err := getOpenSearchConfig(args)
+	require.NoError(t, err)
+	c, err := newClient(context.Background(), cfg, newDocumentMetadata(
+		&logger.GlobalArgs{ContainerID: testContainerID, ContainerName: testContainerName},
+		&logger.DockerConfigs{ContainerImageName: testImageName, ContainerLabels: map[string]string{"team": "a"}},
+	))
+	require.NoError(t, err)
+	return c
+}
+
+func logLine(t *testing.T, c *client, line string) {
+	msg := dockerlogger.NewMessage()
+	msg.Line = append(msg.Line, line...)
+	msg.Source = "stdout"
+	msg.Timestamp = time.Date(2020, time.January, 14, 1, 59, 0, 0, time.UTC)
+	require.NoError(t, c.Log(msg))
+}
+
+// TestClientRetriesRejectedDocuments tests that only the documents which are rejected because
+// the cluster is overloaded are indexed again, and that the ones which are rejected for other
+// reasons are dropped.
+func TestClientRetriesRejectedDocuments(t *testing.T) {
+	cluster := &fakeCluster{reject: map[string]int{"overloaded": http.StatusTooManyRequests, "invalid": http.StatusBadRequest}}
+	server := httptest.NewServer(cluster)
+	defer server.Close()
+
+	c := newTestClient(t, &Args{Endpoint: server.URL, Username: "admin", Password: "secret", Compression: GzipCompression})
+	logLine(t, c, "first")
+	logLine(t, c, "overloaded")
+	logLine(t, c, "invalid")
+	logLine(t, c, "<last>")
+	require.NoError(t, c.Close())
+	require.ErrorIs(t, c.Log(dockerlogger.NewMessage()), logger.ErrBatcherClosed)
+
+	require.Len(t, cluster.requests, 2)
+	for _, r := range cluster.requests {
+		require.Equal(t, "/_bulk", r.URL.Path)
+		username, password, ok := r.BasicAuth()
+		require.True(t, ok)
+		require.Equal(t, "admin", username)
+		require.Equal(t, "secret", password)
+	}
+	messages := make([]string, 0, len(cluster.docs))
+	for _, doc := range cluster.docs {
+		messages = append(messages, doc.Message)
+	}
+	require.Equal(t, []string{"first", "<last>", "overloaded"}, messages)
+	require.Equal(t, []string{"logs-2020.01.14", "logs-2020.01.14", "logs-2020.01.14"}, cluster.indexes)
+	require.Equal(t, document{
+		Timestamp:          "2020-01-14T01:59:00Z",
+		Message:            "first",
+		Stream:             "stdout",
+		ContainerID:        testContainerID,
+		ContainerName:      testContainerName,
+		ContainerImageName: testImageName,
+		ContainerLabels:    map[string]string{"team": "a"},
+	}, cluster.docs[0])
+}
+
+// TestClientSignsRequests tests that bulk requests are signed with SigV4.
+func TestClientSignsRequests(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_ACCESS_KEY_ID", "test-access-key-id")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test-secret-access-key")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	cluster := &fakeCluster{}
+	server := httptest.NewServer(cluster)
+	defer server.Close()
+
+	c := newTestClient(t, &Args{Endpoint: server.URL, AWSSigV4: "true", Region: "us-west-2", AWSService: serviceAOSS})
+	logLine(t, c, "first")
+	require.NoError(t, c.Close())
+
+	require.Len(t, cluster.requests, 1)
+	auth := cluster.requests[0].Header.Get("Authorization")
+	require.True(t, strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=test-access-key-id/"), auth)
+	require.Contains(t, auth, "/us-west-2/aoss/aws4_request")
+	require.NotEmpty(t, cluster.requests[0].Header.Get("X-Amz-Content-Sha256"))
+	require.Len(t, cluster.docs, 1)
+}
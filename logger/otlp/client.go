@@ -0,0 +1,337 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	grpcgzip "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+const (
+	// maxBatchSize is the max number of log records exported in a single request.
+	maxBatchSize = 512
+	// flushInterval is how long the first log record of a batch waits before the batch is
+	// exported, if there are not enough log records to fill it.
+	flushInterval = 1 * time.Second
+	// exportTimeout bounds how long a single export request takes.
+	exportTimeout = 10 * time.Second
+	// maxExportAttempts is the max number of attempts to export a batch of log records if the
+	// OTLP endpoint is temporarily unavailable.
+	maxExportAttempts = 3
+	// initialRetryBackoff is how long to wait before retrying to export a batch of log records,
+	// which is doubled after every attempt.
+	initialRetryBackoff = 1 * time.Second
+	// logsPath is the default path of the OTLP/HTTP logs endpoint.
+	logsPath = "/v1/logs"
+	// maxResponseBodySize bounds how much of the response body is read from the OTLP endpoint.
+	maxResponseBodySize = 64 * 1024
+
+	// Attribute names follow the OpenTelemetry semantic conventions.
+	containerIDAttribute        = "container.id"
+	containerNameAttribute      = "container.name"
+	containerImageNameAttribute = "container.image.name"
+	containerImageIDAttribute   = "container.image.id"
+	containerLabelAttribute     = "container.label."
+	logIOStreamAttribute        = "log.iostream"
+
+	sourceSTDERR = "stderr"
+)
+
+// exporter sends a request holding a batch of log records to the OTLP endpoint.
+type exporter interface {
+	export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) error
+	close() error
+}
+
+// client converts log messages to OpenTelemetry log records, and exports them in batches in the
+// background.
+type client struct {
+	resource  *resourcepb.Resource
+	exporter  exporter
+	batcher   *logger.Batcher[*logspb.LogRecord]
+	closeOnce sync.Once
+}
+
+// newClient creates a client exporting log records of the given resource to the OTLP endpoint.
+func newClient(cfg *config, resource *resourcepb.Resource) (*client, error) {
+	var (
+		exp exporter
+		err error
+	)
+	switch cfg.protocol {
+	case GRPCProtocol:
+		exp, err = newGRPCExporter(cfg)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		exp = newHTTPExporter(cfg)
+	}
+
+	c := &client{
+		resource: resource,
+		exporter: exp,
+	}
+	c.batcher = logger.NewBatcher(&logger.BatcherConfig[*logspb.LogRecord]{
+		DriverName:     DriverName,
+		Items:          "log records",
+		QueueSize:      maxBatchSize,
+		MaxItems:       maxBatchSize,
+		Wait:           flushInterval,
+		Send:           c.export,
+		Timeout:        exportTimeout,
+		MaxAttempts:    maxExportAttempts,
+		InitialBackoff: initialRetryBackoff,
+	})
+
+	return c, nil
+}
+
+// Log converts a log message to a log record and queues it to be exported. It blocks if the
+// queue is full.
+func (c *client) Log(msg *dockerlogger.Message) error {
+	record := newLogRecord(msg)
+	dockerlogger.PutMessage(msg)
+	return c.batcher.Add(record)
+}
+
+// Close exports the log records which are not exported yet and closes the connection to the
+// OTLP endpoint.
+func (c *client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.batcher.Close()
+		err = c.exporter.close()
+	})
+	return err
+}
+
+// export exports a batch of log records. Requests which fail because the OTLP endpoint is
+// temporarily unavailable are sent again by the batcher.
+func (c *client) export(ctx context.Context, records []*logspb.LogRecord) ([]*logspb.LogRecord, error) {
+	return nil, c.exporter.export(ctx, &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: c.resource,
+			ScopeLogs: []*logspb.ScopeLogs{{
+				Scope:      &commonpb.InstrumentationScope{Name: logger.DaemonName},
+				LogRecords: records,
+			}},
+		}},
+	})
+}
+
+// newLogRecord converts a log message to a log record. Log messages from stderr are recorded with
+// the error severity, and the ones from stdout with the info severity.
+func newLogRecord(msg *dockerlogger.Message) *logspb.LogRecord {
+	severityNumber, severityText := logspb.SeverityNumber_SEVERITY_NUMBER_INFO, "INFO"
+	if msg.Source == sourceSTDERR {
+		severityNumber, severityText = logspb.SeverityNumber_SEVERITY_NUMBER_ERROR, "ERROR"
+	}
+	return &logspb.LogRecord{
+		TimeUnixNano:         uint64(msg.Timestamp.UnixNano()), //nolint:gosec // timestamps are after 1970
+		ObservedTimeUnixNano: uint64(time.Now().UnixNano()),    //nolint:gosec // timestamps are after 1970
+		SeverityNumber:       severityNumber,
+		SeverityText:         severityText,
+		Body:                 stringValue(string(msg.Line)),
+		Attributes:           []*commonpb.KeyValue{keyValue(logIOStreamAttribute, msg.Source)},
+	}
+}
+
+// newResource creates the resource of the container, with the container ID, name, image and
+// labels as attributes, along with the given extra attributes which take precedence.
+func newResource(
+	globalArgs *logger.GlobalArgs,
+	dockerConfigs *logger.DockerConfigs,
+	extraAttributes map[string]string,
+) *resourcepb.Resource {
+	attributes := map[string]string{
+		containerIDAttribute:   globalArgs.ContainerID,
+		containerNameAttribute: globalArgs.ContainerName,
+	}
+	if dockerConfigs != nil {
+		if dockerConfigs.ContainerImageName != "" {
+			attributes[containerImageNameAttribute] = dockerConfigs.ContainerImageName
+		}
+		if dockerConfigs.ContainerImageID != "" {
+			attributes[containerImageIDAttribute] = dockerConfigs.ContainerImageID
+		}
+		for key, value := range dockerConfigs.ContainerLabels {
+			attributes[containerLabelAttribute+key] = value
+		}
+	}
+	for key, value := range extraAttributes {
+		attributes[key] = value
+	}
+
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	resource := &resourcepb.Resource{Attributes: make([]*commonpb.KeyValue, 0, len(keys))}
+	for _, key := range keys {
+		resource.Attributes = append(resource.Attributes, keyValue(key, attributes[key]))
+	}
+
+	return resource
+}
+
+func keyValue(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: stringValue(value)}
+}
+
+func stringValue(value string) *commonpb.AnyValue {
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}
+}
+
+// httpExporter exports log records over OTLP/HTTP with protobuf encoding.
+type httpExporter struct {
+	url         string
+	headers     map[string]string
+	compression string
+	client      *http.Client
+}
+
+// newHTTPExporter creates an exporter sending requests to the endpoint, or to its default logs
+// path if the endpoint has no path.
+func newHTTPExporter(cfg *config) *httpExporter {
+	endpoint := *cfg.endpoint
+	if endpoint.Path == "" || endpoint.Path == "/" {
+		endpoint.Path = logsPath
+	}
+	return &httpExporter{
+		url:         endpoint.String(),
+		headers:     cfg.headers,
+		compression: cfg.compression,
+		client:      &http.Client{Timeout: exportTimeout},
+	}
+}
+
+func (e *httpExporter) export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) error {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("unable to encode log records: %w", err)
+	}
+	if e.compression == GzipCompression {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return fmt.Errorf("unable to compress log records: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("unable to compress log records: %w", err)
+		}
+		body = buf.Bytes()
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to create export request: %w", err)
+	}
+	for key, value := range e.headers {
+		httpReq.Header.Set(key, value)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	if e.compression == GzipCompression {
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := e.client.Do(httpReq)
+	if err != nil {
+		return &logger.RetryableError{Err: fmt.Errorf("unable to send export request: %w", err)}
+	}
+	defer resp.Body.Close() //nolint:errcheck // nothing to do
+	// Drain the response body so that the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBodySize))
+
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		return nil
+	}
+	err = fmt.Errorf("export request failed with status %s", resp.Status)
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return &logger.RetryableError{Err: err}
+	}
+	return err
+}
+
+func (e *httpExporter) close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// grpcExporter exports log records over OTLP/gRPC.
+type grpcExporter struct {
+	conn     *grpc.ClientConn
+	client   collogspb.LogsServiceClient
+	headers  metadata.MD
+	callOpts []grpc.CallOption
+}
+
+// newGRPCExporter creates an exporter connecting to the host of the endpoint, with TLS if its
+// scheme is https.
+func newGRPCExporter(cfg *config) (*grpcExporter, error) {
+	creds := insecure.NewCredentials()
+	if cfg.endpoint.Scheme == "https" {
+		creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+	conn, err := grpc.NewClient(cfg.endpoint.Host, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to %s: %w", cfg.endpoint.Host, err)
+	}
+
+	e := &grpcExporter{
+		conn:    conn,
+		client:  collogspb.NewLogsServiceClient(conn),
+		headers: metadata.New(cfg.headers),
+	}
+	if cfg.compression == GzipCompression {
+		e.callOpts = append(e.callOpts, grpc.UseCompressor(grpcgzip.Name))
+	}
+	return e, nil
+}
+
+func (e *grpcExporter) export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) error {
+	ctx = metadata.NewOutgoingContext(ctx, e.headers)
+	resp, err := e.client.Export(ctx, req, e.callOpts...)
+	if err != nil {
+		switch status.Code(err) {
+		case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded, codes.Aborted:
+			return &logger.RetryableError{Err: err}
+		}
+		return err
+	}
+	if rejected := resp.GetPartialSuccess().GetRejectedLogRecords(); rejected > 0 {
+		return fmt.Errorf("%d log records are rejected: %s", rejected, resp.GetPartialSuccess().GetErrorMessage())
+	}
+	return nil
+}
+
+func (e *grpcExporter) close() error {
+	return e.conn.Close()
+}
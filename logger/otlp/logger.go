@@ -0,0 +1,213 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package otlp provides a log driver sending container logs as OpenTelemetry log records to an
+// OTLP endpoint, such as the OpenTelemetry Collector, over either HTTP or gRPC.
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/containerd/containerd/runtime/v2/logging"
+
+	"github.com/aws/shim-loggers-for-containerd/debug"
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+// otlp driver argument keys.
+const (
+	// DriverName is the name of the otlp log driver.
+	DriverName = "otlp"
+
+	// Required.
+
+	// EndpointKey is the URL of the OTLP endpoint, e.g. `http://localhost:4318` for HTTP or
+	// `http://localhost:4317` for gRPC. The scheme decides whether TLS is used.
+	EndpointKey = "otlp-endpoint"
+
+	// Optional.
+
+	// ProtocolKey is either `http/protobuf`, the default, or `grpc`.
+	ProtocolKey = "otlp-protocol"
+	// HeadersKey is a comma-separated list of `key=value` pairs sent as HTTP headers or gRPC
+	// metadata with every export request, e.g. for authentication.
+	HeadersKey = "otlp-headers"
+	// CompressionKey is either `gzip` or `none`, the default.
+	CompressionKey = "otlp-compression"
+	// ResourceAttributesKey is a comma-separated list of `key=value` pairs added to the resource
+	// attributes of every log record, along with the ones of the container.
+	ResourceAttributesKey = "otlp-resource-attributes"
+)
+
+// Supported values of the protocol and compression arguments.
+const (
+	HTTPProtocol = "http/protobuf"
+	GRPCProtocol = "grpc"
+
+	GzipCompression = "gzip"
+	NoCompression   = "none"
+)
+
+// Args represents otlp log driver arguments.
+type Args struct {
+	// Required.
+	Endpoint string
+
+	// Optional.
+	Protocol           string
+	Headers            string
+	Compression        string
+	ResourceAttributes string
+}
+
+// LoggerArgs stores global logger args, docker configs and otlp specific args.
+type LoggerArgs struct {
+	globalArgs    *logger.GlobalArgs
+	dockerConfigs *logger.DockerConfigs
+	args          *Args
+}
+
+// InitLogger initializes the input arguments.
+func InitLogger(globalArgs *logger.GlobalArgs, dockerConfigs *logger.DockerConfigs, otlpArgs *Args) *LoggerArgs {
+	return &LoggerArgs{
+		globalArgs:    globalArgs,
+		dockerConfigs: dockerConfigs,
+		args:          otlpArgs,
+	}
+}
+
+// RunLogDriver initiates the otlp driver and starts sending container logs to the OTLP endpoint.
+// Errors with the log driver are logged but not returned to prevent container termination.
+func (la *LoggerArgs) RunLogDriver(ctx context.Context, config *logging.Config, ready func() error) error {
+	defer debug.DeferFuncForRunLogDriver()
+
+	stream, err := la.newStream()
+	if err != nil {
+		debug.ErrLogger = err
+		return debug.ErrLogger
+	}
+	// Export the log records which are not exported yet before exiting.
+	defer stream.Close() //nolint:errcheck // errors are already logged
+
+	l, err := logger.NewPipelineLogger(la.globalArgs, config, logger.NewInfo(la.globalArgs.ContainerID, la.globalArgs.ContainerName), stream)
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("unable to create otlp driver: %w", err)
+		return debug.ErrLogger
+	}
+
+	// Start otlp driver.
+	debug.SendEventsToLog(logger.DaemonName, "Starting otlp driver", debug.INFO, 0)
+	err = l.Start(ctx, la.globalArgs.CleanupTime, ready)
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("failed to run otlp driver: %w", err)
+		// Do not return error if log driver has issue sending logs to destination, because if error
+		// returned here, containerd will identify this error and kill shim process, which will kill
+		// the container process accordingly.
+		// Note: the container will continue to run if shim logger exits after.
+		// Reference: https://github.com/containerd/containerd/blob/release/1.3/runtime/v2/logging/logging.go
+		return nil
+	}
+	debug.SendEventsToLog(logger.DaemonName, "Logging finished", debug.INFO, 1)
+
+	return nil
+}
+
+// NewStream creates the otlp stream, which is used when fanning out to multiple log drivers.
+func (la *LoggerArgs) NewStream() (logger.Client, error) {
+	stream, err := la.newStream()
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// newStream validates the log options and creates the otlp stream.
+func (la *LoggerArgs) newStream() (*client, error) {
+	cfg, err := getOTLPConfig(la.args)
+	if err != nil {
+		return nil, fmt.Errorf("unable to validate log options: %w", err)
+	}
+	resource := newResource(la.globalArgs, la.dockerConfigs, cfg.resourceAttributes)
+	stream, err := newClient(cfg, resource)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create stream: %w", err)
+	}
+
+	return stream, nil
+}
+
+// config is the validated otlp log driver arguments.
+type config struct {
+	endpoint           *url.URL
+	protocol           string
+	headers            map[string]string
+	compression        string
+	resourceAttributes map[string]string
+}
+
+// getOTLPConfig validates the otlp log driver arguments and sets the default values.
+func getOTLPConfig(args *Args) (*config, error) {
+	endpoint, err := url.Parse(args.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", EndpointKey, args.Endpoint, err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("invalid %s %s: scheme must be http or https", EndpointKey, args.Endpoint)
+	}
+	if endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid %s %s: host is required", EndpointKey, args.Endpoint)
+	}
+
+	cfg := &config{
+		endpoint:    endpoint,
+		protocol:    args.Protocol,
+		compression: args.Compression,
+	}
+	switch cfg.protocol {
+	case "":
+		cfg.protocol = HTTPProtocol
+	case HTTPProtocol, GRPCProtocol:
+	default:
+		return nil, fmt.Errorf("unknown %s: %s", ProtocolKey, args.Protocol)
+	}
+	switch cfg.compression {
+	case "":
+		cfg.compression = NoCompression
+	case GzipCompression, NoCompression:
+	default:
+		return nil, fmt.Errorf("unknown %s: %s", CompressionKey, args.Compression)
+	}
+	if cfg.headers, err = parseKeyValuePairs(args.Headers); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", HeadersKey, err)
+	}
+	if cfg.resourceAttributes, err = parseKeyValuePairs(args.ResourceAttributes); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ResourceAttributesKey, err)
+	}
+
+	return cfg, nil
+}
+
+// parseKeyValuePairs parses a comma-separated list of `key=value` pairs. Values may be URL
+// encoded, so that they can hold commas.
+func parseKeyValuePairs(s string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	if s == "" {
+		return pairs, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s is not in the format of key=value", pair)
+		}
+		decoded, err := url.PathUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode value of %s: %w", key, err)
+		}
+		pairs[key] = decoded
+	}
+	return pairs, nil
+}
@@ -0,0 +1,124 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package otlp
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/require"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+const (
+	testContainerID   = "test-container-id"
+	testContainerName = "test-container-name"
+	testImageName     = "test-image-name"
+)
+
+// TestGetOTLPConfig tests that the arguments are validated and the default values are set.
+func TestGetOTLPConfig(t *testing.T) {
+	cfg, err := getOTLPConfig(&Args{
+		Endpoint:           "https://collector:4318",
+		Headers:            "Authorization=Bearer%20token, x-tenant=a%2Cb",
+		ResourceAttributes: "service.name=web",
+	})
+	require.NoError(t, err)
+	require.Equal(t, HTTPProtocol, cfg.protocol)
+	require.Equal(t, NoCompression, cfg.compression)
+	require.Equal(t, map[string]string{"Authorization": "Bearer token", "x-tenant": "a,b"}, cfg.headers)
+	require.Equal(t, map[string]string{"service.name": "web"}, cfg.resourceAttributes)
+
+	for _, args := range []*Args{
+		{Endpoint: "collector:4318"},
+		{Endpoint: "http://"},
+		{Endpoint: "http://collector:4318", Protocol: "http/json"},
+		{Endpoint: "http://collector:4318", Compression: "zstd"},
+		{Endpoint: "http://collector:4318", Headers: "Authorization"},
+	} {
+		_, err := getOTLPConfig(args)
+		require.Error(t, err)
+	}
+}
+
+// TestNewResource tests that the container is described by the resource attributes.
+func TestNewResource(t *testing.T) {
+	resource := newResource(
+		&logger.GlobalArgs{ContainerID: testContainerID, ContainerName: testContainerName},
+		&logger.DockerConfigs{ContainerImageName: testImageName, ContainerLabels: map[string]string{"team": "a"}},
+		map[string]string{"service.name": "web", containerNameAttribute: "overridden"},
+	)
+
+	attributes := make(map[string]string)
+	for _, kv := range resource.Attributes {
+		attributes[kv.Key] = kv.Value.GetStringValue()
+	}
+	require.Equal(t, map[string]string{
+		containerIDAttribute:             testContainerID,
+		containerNameAttribute:           "overridden",
+		containerImageNameAttribute:      testImageName,
+		containerLabelAttribute + "team": "a",
+		"service.name":                   "web",
+	}, attributes)
+}
+
+// TestClientHTTPExport tests that log messages are exported over OTLP/HTTP once the client is
+// closed.
+func TestClientHTTPExport(t *testing.T) {
+	requests := make(chan *collogspb.ExportLogsServiceRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, logsPath, r.URL.Path)
+		require.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		require.Equal(t, "secret", r.Header.Get("x-token"))
+		require.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		zr, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		req := &collogspb.ExportLogsServiceRequest{}
+		require.NoError(t, proto.Unmarshal(body, req))
+		requests <- req
+	}))
+	defer server.Close()
+
+	cfg, err := getOTLPConfig(&Args{Endpoint: server.URL, Headers: "x-token=secret", Compression: GzipCompression})
+	require.NoError(t, err)
+	c, err := newClient(cfg, newResource(&logger.GlobalArgs{ContainerID: testContainerID}, nil, nil))
+	require.NoError(t, err)
+
+	timestamp := time.Date(2020, time.January, 14, 1, 59, 0, 0, time.UTC)
+	for _, source := range []string{"stdout", sourceSTDERR} {
+		msg := dockerlogger.NewMessage()
+		msg.Line = append(msg.Line, "line from "+source...)
+		msg.Source = source
+		msg.Timestamp = timestamp
+		require.NoError(t, c.Log(msg))
+	}
+	require.NoError(t, c.Close())
+	require.ErrorIs(t, c.Log(dockerlogger.NewMessage()), logger.ErrBatcherClosed)
+
+	req := <-requests
+	require.Len(t, req.ResourceLogs, 1)
+	require.Equal(t, containerIDAttribute, req.ResourceLogs[0].Resource.Attributes[0].Key)
+	records := req.ResourceLogs[0].ScopeLogs[0].LogRecords
+	require.Len(t, records, 2)
+	require.Equal(t, "line from stdout", records[0].Body.GetStringValue())
+	require.Equal(t, uint64(timestamp.UnixNano()), records[0].TimeUnixNano)
+	require.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_INFO, records[0].SeverityNumber)
+	require.Equal(t, "line from stderr", records[1].Body.GetStringValue())
+	require.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_ERROR, records[1].SeverityNumber)
+	require.Equal(t, sourceSTDERR, records[1].Attributes[0].Value.GetStringValue())
+}
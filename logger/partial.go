@@ -0,0 +1,181 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package logger
+
+import (
+	"time"
+	"unicode/utf8"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+)
+
+// PartialContinuationMarker is appended to every log message but the last one a reassembled log
+// message is split into when it's larger than the max bytes.
+const PartialContinuationMarker = " [shim-logger] continued"
+
+// partialReassembler joins the partial log messages read from a single source pipe back into a
+// single log message, up to the max bytes. A log message larger than the max bytes is split into
+// log messages of up to the max bytes, ending with PartialContinuationMarker except for the last
+// one, and each of them is sent as a complete log message.
+//
+// If log messages are redacted, a log message is redacted as a whole before it's split, so that
+// a secret isn't split before it's redacted. It's kept whole up to the largest of the max bytes
+// and DefaultPartialReassemblyMaxBytes, and what's reassembled so far is redacted and split once
+// it's larger.
+type partialReassembler struct {
+	maxBytes         int
+	redact           func(line []byte) []byte
+	sendLogMsgToDest sendLogToDestFunc
+
+	// buf holds the partial log messages with the partial ID which aren't sent yet.
+	buf       []byte
+	partialID string
+	source    string
+	timestamp time.Time
+}
+
+// newPartialReassembler creates the reassembler of a source pipe sending log messages with
+// sendLogMsgToDest, after redacting them with redact if it's set.
+func newPartialReassembler(
+	maxBytes int,
+	redact func(line []byte) []byte,
+	sendLogMsgToDest sendLogToDestFunc,
+) *partialReassembler {
+	return &partialReassembler{
+		maxBytes:         maxBytes,
+		redact:           redact,
+		sendLogMsgToDest: sendLogMsgToDest,
+	}
+}
+
+// add adds a partial log message to the log message being reassembled, and sends it once it's
+// complete. Complete log messages are sent as they are.
+func (r *partialReassembler) add(
+	line []byte,
+	source string,
+	isPartialMsg, isLastPartial bool,
+	partialID string,
+	partialOrdinal int,
+	msgTimestamp time.Time,
+) error {
+	// The partial log messages of a log message are always read one after the other, so any log
+	// message being reassembled is incomplete if another one is read, e.g. if the pipe was closed
+	// in the middle of it.
+	if !isPartialMsg || partialID != r.partialID {
+		if err := r.flush(); err != nil {
+			return err
+		}
+	}
+	if !isPartialMsg {
+		if r.redact != nil {
+			line = r.redact(line)
+		}
+		return r.sendLogMsgToDest(line, source, isPartialMsg, isLastPartial, partialID, partialOrdinal, msgTimestamp)
+	}
+
+	if len(r.buf) == 0 {
+		r.partialID, r.source, r.timestamp = partialID, source, msgTimestamp
+	}
+	r.buf = append(r.buf, line...)
+	if r.redact != nil {
+		if len(r.buf) > max(r.maxBytes, DefaultPartialReassemblyMaxBytes) {
+			return r.sendRedacted(false)
+		}
+	} else {
+		// Only send what doesn't fit, since the next partial log message may be the last one.
+		for len(r.buf) > r.maxBytes {
+			if err := r.split(); err != nil {
+				return err
+			}
+		}
+	}
+	if isLastPartial {
+		return r.flush()
+	}
+	return nil
+}
+
+// split sends the beginning of the log message being reassembled along with the continuation
+// marker.
+func (r *partialReassembler) split() error {
+	n := splitIndex(r.buf, r.maxBytes)
+	line := make([]byte, 0, n+len(PartialContinuationMarker))
+	line = append(line, r.buf[:n]...)
+	line = append(line, PartialContinuationMarker...)
+	r.buf = r.buf[:copy(r.buf, r.buf[n:])]
+	return r.sendLogMsgToDest(line, r.source, false, false, "", 1, r.timestamp)
+}
+
+// sendRedacted redacts the log message being reassembled, and sends it split into log messages of
+// up to the max bytes, ending with the continuation marker except for the last one if the log
+// message is complete.
+func (r *partialReassembler) sendRedacted(complete bool) error {
+	line := r.redact(r.buf)
+	r.buf = r.buf[:0]
+	for len(line) > 0 {
+		if complete && len(line) <= r.maxBytes {
+			return r.sendLogMsgToDest(line, r.source, false, false, "", 1, r.timestamp)
+		}
+		n := len(line)
+		if n > r.maxBytes-len(PartialContinuationMarker) {
+			n = splitIndex(line, r.maxBytes)
+		}
+		split := make([]byte, 0, n+len(PartialContinuationMarker))
+		split = append(split, line[:n]...)
+		split = append(split, PartialContinuationMarker...)
+		if err := r.sendLogMsgToDest(split, r.source, false, false, "", 1, r.timestamp); err != nil {
+			return err
+		}
+		line = line[n:]
+	}
+	return nil
+}
+
+// flush sends the log message being reassembled, if there is one.
+func (r *partialReassembler) flush() error {
+	r.partialID = ""
+	if len(r.buf) == 0 {
+		return nil
+	}
+	if r.redact != nil {
+		return r.sendRedacted(true)
+	}
+	err := r.sendLogMsgToDest(r.buf, r.source, false, false, "", 1, r.timestamp)
+	r.buf = r.buf[:0]
+	return err
+}
+
+// splitIndex returns the size of the beginning of a log line larger than the max bytes, which fits
+// into the max bytes along with the continuation marker without splitting a UTF-8 encoded
+// character.
+func splitIndex(line []byte, maxBytes int) int {
+	n := maxBytes - len(PartialContinuationMarker)
+	for i := n; i > n-utf8.UTFMax && i > 0; i-- {
+		if utf8.RuneStart(line[i]) {
+			return i
+		}
+	}
+	return n
+}
+
+// splitMessage splits a log message larger than the max bytes into log messages of up to the max
+// bytes, ending with PartialContinuationMarker except for the last one, in the same way as a
+// reassembled log message. Partial log messages are left as they are.
+func splitMessage(msg *dockerlogger.Message, maxBytes int) []*dockerlogger.Message {
+	if maxBytes <= 0 || len(msg.Line) <= maxBytes || msg.PLogMetaData != nil {
+		return []*dockerlogger.Message{msg}
+	}
+	var messages []*dockerlogger.Message
+	line := msg.Line
+	for len(line) > maxBytes {
+		n := splitIndex(line, maxBytes)
+		m := copyMessage(msg)
+		m.Line = append(append(m.Line[:0], line[:n]...), PartialContinuationMarker...)
+		messages = append(messages, m)
+		line = line[n:]
+	}
+	// The log message itself is the last one.
+	msg.Line = msg.Line[:copy(msg.Line, line)]
+	return append(messages, msg)
+}
@@ -0,0 +1,127 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package logger
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// sentMessage is a log message sent to destination.
+type sentMessage struct {
+	line      string
+	isPartial bool
+	timestamp time.Time
+}
+
+// TestPartialReassembly tests that the partial log messages of a log line longer than the buffer
+// are reassembled into a single complete log message.
+func TestPartialReassembly(t *testing.T) {
+	l, err := NewLogger(
+		WithInfo(NewInfo(testContainerID, testContainerName)),
+		WithPartialReassembly(1024),
+		WithMaxReadBytes(4),
+	)
+	require.NoError(t, err)
+	var sent []sentMessage
+	send := func(line []byte, _ string, isPartialMsg, _ bool, _ string, _ int, msgTimestamp time.Time) error {
+		sent = append(sent, sentMessage{line: string(line), isPartial: isPartialMsg, timestamp: msgTimestamp})
+		return nil
+	}
+
+	pipe := strings.NewReader("short\na longer line\nno newline at the end")
+	require.NoError(t, l.Read(context.Background(), pipe, sourceSTDOUT, 8, send))
+	require.Len(t, sent, 3)
+	for i, line := range []string{"short", "a longer line", "no newline at the end"} {
+		require.Equal(t, line, sent[i].line)
+		require.False(t, sent[i].isPartial)
+	}
+}
+
+// TestPartialReassemblySplit tests that a reassembled log message larger than the max bytes is
+// split with the continuation marker, without splitting UTF-8 encoded characters.
+func TestPartialReassemblySplit(t *testing.T) {
+	var sent []sentMessage
+	send := func(line []byte, _ string, isPartialMsg, _ bool, _ string, _ int, msgTimestamp time.Time) error {
+		sent = append(sent, sentMessage{line: string(line), isPartial: isPartialMsg, timestamp: msgTimestamp})
+		return nil
+	}
+	maxBytes := len(PartialContinuationMarker) + 6
+	r := newPartialReassembler(maxBytes, nil, send)
+
+	later := dummyTime.Add(time.Second)
+	require.NoError(t, r.add([]byte("abcde€fgh"), sourceSTDOUT, true, false, "id", 1, dummyTime))
+	require.NoError(t, r.add([]byte("ijklmnopqrstuvwxyz0123"), sourceSTDOUT, true, true, "id", 2, dummyTime))
+	// An incomplete log message is sent once another one is read.
+	require.NoError(t, r.add([]byte("incomplete"), sourceSTDOUT, true, false, "other-id", 1, later))
+	require.NoError(t, r.add([]byte("complete"), sourceSTDOUT, false, false, "", 1, later))
+	require.NoError(t, r.flush())
+
+	var lines []string
+	for _, msg := range sent {
+		require.False(t, msg.isPartial)
+		require.LessOrEqual(t, len(msg.line), maxBytes)
+		lines = append(lines, msg.line)
+	}
+	require.Equal(t, []string{
+		"abcde" + PartialContinuationMarker,
+		"€fghijklmnopqrstuvwxyz0123",
+		"incomplete",
+		"complete",
+	}, lines)
+	require.Equal(t, dummyTime, sent[1].timestamp)
+	require.Equal(t, later, sent[2].timestamp)
+}
+
+// TestPartialReassemblyMultiline tests that log lines are grouped after they are reassembled.
+func TestPartialReassemblyMultiline(t *testing.T) {
+	l, err := NewLogger(
+		WithInfo(NewInfo(testContainerID, testContainerName)),
+		WithMultiline(&MultilineArgs{ContinuePattern: `^\s`}),
+		WithPartialReassembly(1024),
+		WithMaxReadBytes(4),
+	)
+	require.NoError(t, err)
+	sent := &sentMessages{}
+	pipe := strings.NewReader("first\n long continuation\nsecond\n")
+	require.NoError(t, l.Read(context.Background(), pipe, sourceSTDOUT, 8, sent.send))
+	require.Equal(t, []string{"first\n long continuation", "second"}, sent.get())
+}
+
+// TestPartialReassemblyMaxBytesPerEvent tests that a log message reassembled from partial log
+// messages is only split for the log drivers which max size of a log message it exceeds.
+func TestPartialReassemblyMaxBytesPerEvent(t *testing.T) {
+	unlimited := &fanOutRecorder{}
+	limited := &fanOutRecorder{}
+	m, err := newMultiClient(&GlobalArgs{}, []*MultiStream{
+		{DriverName: "json-file", New: func() (Client, error) { return unlimited, nil }},
+		{DriverName: "awslogs", MaxBytesPerEvent: 32, New: func() (Client, error) { return limited, nil }},
+	})
+	require.NoError(t, err)
+	m.start()
+	// The character é takes up 2 bytes, and isn't split.
+	line := strings.Repeat("0123456789", 2) + "012é" + strings.Repeat("0123456789", 3)
+	require.NoError(t, m.Log(newMessage([]byte(line), sourceSTDOUT, dummyTime)))
+	require.NoError(t, m.Log(newMessage([]byte("short"), sourceSTDOUT, dummyTime)))
+	m.close()
+
+	require.Equal(t, []string{line, "short"}, unlimited.lines())
+	require.Equal(t, []string{
+		"01234567" + PartialContinuationMarker,
+		"89012345" + PartialContinuationMarker,
+		"6789012" + PartialContinuationMarker,
+		"é" + strings.Repeat("0123456789", 3),
+		"short",
+	}, limited.lines())
+
+	_, err = NewLogger(WithPartialReassembly(len(PartialContinuationMarker)))
+	require.Error(t, err)
+}
@@ -0,0 +1,324 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/shim-loggers-for-containerd/debug"
+)
+
+// Policies of the log messages over the rate limit.
+const (
+	// DropRateLimitPolicy drops the log messages over the rate limit. This is the default policy.
+	DropRateLimitPolicy = "drop"
+	// SampleRateLimitPolicy sends one in every sample rate log messages over the rate limit, and
+	// drops the other ones.
+	SampleRateLimitPolicy = "sample"
+	// DedupeRateLimitPolicy drops the log messages over the rate limit, and counts the ones
+	// identical to the previous log message, which are reported by a log message such as
+	// `last message repeated 42 times` once another log message is read.
+	DedupeRateLimitPolicy = "dedupe"
+)
+
+const (
+	// defaultRateLimitSampleRate is the default sample rate of the sample policy.
+	defaultRateLimitSampleRate = 10
+	// rateLimitRepeatedFormat is the format of the log message reporting how many times the
+	// previous log message was repeated over the rate limit with the dedupe policy.
+	rateLimitRepeatedFormat = "last message repeated %d times"
+)
+
+// RateLimitArgs sets how many log messages per second are sent, with a token bucket of log
+// messages, of bytes, or both.
+type RateLimitArgs struct {
+	// LinesPerSecond is the rate of log messages, which aren't limited if it's 0.
+	LinesPerSecond int
+	// LineBurst is the max number of log messages sent at once, LinesPerSecond by default.
+	LineBurst int
+	// BytesPerSecond is the rate of bytes, which aren't limited if it's 0.
+	BytesPerSecond int
+	// ByteBurst is the max number of bytes sent at once, BytesPerSecond by default.
+	ByteBurst int
+	// Policy is the policy of the log messages over the rate limit, drop by default.
+	Policy string
+	// SampleRate is N when one in N log messages over the rate limit are sent with the sample
+	// policy, 10 by default.
+	SampleRate int
+}
+
+// tokenBucket holds up to burst tokens, which are refilled at rate tokens per second.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full token bucket, or returns nil if the rate is 0.
+func newTokenBucket(rate, burst int) *tokenBucket {
+	if rate == 0 {
+		return nil
+	}
+	if burst == 0 {
+		burst = rate
+	}
+	return &tokenBucket{rate: float64(rate), burst: float64(burst), tokens: float64(burst)}
+}
+
+// refill adds the tokens refilled since the last time, and returns whether n tokens are left. A
+// log message larger than the burst only takes the whole bucket, so that it can still be sent.
+func (b *tokenBucket) refill(now time.Time, n float64) bool {
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	return b.tokens >= min(n, b.burst)
+}
+
+// take takes n tokens, which must be left.
+func (b *tokenBucket) take(n float64) {
+	b.tokens -= min(n, b.burst)
+}
+
+// charge takes n tokens whether they are left or not, so that the tokens taken beyond the bucket
+// are refilled before the next log message can be sent.
+func (b *tokenBucket) charge(now time.Time, n float64) {
+	b.refill(now, n)
+	b.tokens -= n
+}
+
+// rateLimiter limits the rate of the log messages of all the container pipes.
+type rateLimiter struct {
+	policy     string
+	sampleRate uint64
+	// now returns the current time, it's only replaced in tests.
+	now func() time.Time
+
+	lock  sync.Mutex
+	lines *tokenBucket
+	bytes *tokenBucket
+
+	// The counters of the log messages over the rate limit, along with the ones reported in the
+	// routing trace already.
+	counters rateLimitCounters
+	reported rateLimitCounters
+}
+
+// rateLimitCounters count the log messages over the rate limit.
+type rateLimitCounters struct {
+	// dropped and droppedBytes count the log messages dropped, including the deduplicated ones.
+	dropped      uint64
+	droppedBytes uint64
+	// sampled counts the log messages sent with the sample policy.
+	sampled uint64
+	// deduplicated counts the log messages identical to the previous one with the dedupe policy.
+	deduplicated uint64
+}
+
+// newRateLimiter validates the rate limit arguments and creates the rate limiter.
+func newRateLimiter(args *RateLimitArgs) (*rateLimiter, error) {
+	if args.LinesPerSecond < 0 || args.LineBurst < 0 || args.BytesPerSecond < 0 || args.ByteBurst < 0 || args.SampleRate < 0 {
+		return nil, errors.New("rate limits can't be negative")
+	}
+	if args.LinesPerSecond == 0 && args.BytesPerSecond == 0 {
+		return nil, errors.New("either a rate of log lines or of bytes is required")
+	}
+	r := &rateLimiter{
+		policy:     args.Policy,
+		sampleRate: uint64(args.SampleRate),
+		now:        time.Now,
+		lines:      newTokenBucket(args.LinesPerSecond, args.LineBurst),
+		bytes:      newTokenBucket(args.BytesPerSecond, args.ByteBurst),
+	}
+	switch r.policy {
+	case "":
+		r.policy = DropRateLimitPolicy
+	case DropRateLimitPolicy, SampleRateLimitPolicy, DedupeRateLimitPolicy:
+	default:
+		return nil, fmt.Errorf("unknown rate limit policy: %s", args.Policy)
+	}
+	if r.sampleRate == 0 {
+		r.sampleRate = defaultRateLimitSampleRate
+	}
+	return r, nil
+}
+
+// allow returns whether a log message of the given size is within the rate limit, and takes its
+// tokens if it is.
+func (r *rateLimiter) allow(size int) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	now := r.now()
+	n := float64(size)
+	if r.lines != nil && !r.lines.refill(now, 1) {
+		return false
+	}
+	if r.bytes != nil && !r.bytes.refill(now, n) {
+		return false
+	}
+	if r.lines != nil {
+		r.lines.take(1)
+	}
+	if r.bytes != nil {
+		r.bytes.take(n)
+	}
+	return true
+}
+
+// charge takes the byte tokens of a partial log message following the first one, which is sent
+// along with it even if it's over the rate limit.
+func (r *rateLimiter) charge(size int) {
+	if r.bytes == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.bytes.charge(r.now(), float64(size))
+}
+
+// rateLimitedSource applies the rate limit to the log messages read from a single container pipe.
+type rateLimitedSource struct {
+	limiter          *rateLimiter
+	sendLogMsgToDest sendLogToDestFunc
+
+	lock sync.Mutex
+	// allowed is whether the log message being read, which may have multiple partial log
+	// messages, is sent.
+	allowed bool
+	// overLimit counts the log messages over the rate limit, for the sample policy.
+	overLimit uint64
+	// last is the previous log message, and repeated is how many log messages identical to it
+	// were dropped, for the dedupe policy.
+	last      []byte
+	repeated  uint64
+	timestamp time.Time
+}
+
+// newSource creates the rate limiter of a container pipe sending log messages with
+// sendLogMsgToDest.
+func (r *rateLimiter) newSource(sendLogMsgToDest sendLogToDestFunc) *rateLimitedSource {
+	return &rateLimitedSource{
+		limiter:          r,
+		sendLogMsgToDest: sendLogMsgToDest,
+	}
+}
+
+// add sends a log message if it's within the rate limit, or applies the policy to it. All the
+// partial log messages of a log message are sent or dropped along with the first one, and the
+// ones sent take their byte tokens.
+func (s *rateLimitedSource) add(
+	line []byte,
+	source string,
+	isPartialMsg, isLastPartial bool,
+	partialID string,
+	partialOrdinal int,
+	msgTimestamp time.Time,
+) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r := s.limiter
+	isFirst := !isPartialMsg || partialOrdinal == 1
+	if isFirst {
+		s.allowed = r.allow(len(line))
+	}
+	if r.policy == DedupeRateLimitPolicy && isFirst {
+		repeated := !isPartialMsg && s.last != nil && bytes.Equal(line, s.last)
+		if repeated && !s.allowed {
+			s.repeated++
+			s.timestamp = msgTimestamp
+			atomic.AddUint64(&r.counters.deduplicated, 1)
+			atomic.AddUint64(&r.counters.dropped, 1)
+			atomic.AddUint64(&r.counters.droppedBytes, uint64(len(line)))
+			return nil
+		}
+		if err := s.flush(source); err != nil {
+			return err
+		}
+		// Only the log messages sent are reported as repeated, and partial log messages are never
+		// identical to a complete log message.
+		if s.allowed && !isPartialMsg {
+			s.last = append(s.last[:0], line...)
+		} else {
+			s.last = nil
+		}
+	}
+	if !s.allowed && isFirst && r.policy == SampleRateLimitPolicy {
+		s.overLimit++
+		if (s.overLimit-1)%r.sampleRate == 0 {
+			s.allowed = true
+			atomic.AddUint64(&r.counters.sampled, 1)
+		}
+	}
+	if !s.allowed {
+		if isFirst {
+			atomic.AddUint64(&r.counters.dropped, 1)
+		}
+		atomic.AddUint64(&r.counters.droppedBytes, uint64(len(line)))
+		return nil
+	}
+	if !isFirst {
+		r.charge(len(line))
+	}
+	return s.sendLogMsgToDest(line, source, isPartialMsg, isLastPartial, partialID, partialOrdinal, msgTimestamp)
+}
+
+// flush sends the log message reporting how many times the previous log message was repeated, if
+// it was. The caller must hold the lock.
+func (s *rateLimitedSource) flush(source string) error {
+	if s.repeated == 0 {
+		return nil
+	}
+	line := []byte(fmt.Sprintf(rateLimitRepeatedFormat, s.repeated))
+	s.repeated = 0
+	return s.sendLogMsgToDest(line, source, false, false, "", 1, s.timestamp)
+}
+
+// close sends the log message reporting how many times the last log message was repeated once
+// the container pipe is closed.
+func (s *rateLimitedSource) close(source string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.flush(source)
+}
+
+// reportTrace reports the log messages over the rate limit since the last report, or in total
+// once the routing trace is stopped.
+func (r *rateLimiter) reportTrace(containerID string, total bool) {
+	counters := rateLimitCounters{
+		dropped:      atomic.LoadUint64(&r.counters.dropped),
+		droppedBytes: atomic.LoadUint64(&r.counters.droppedBytes),
+		sampled:      atomic.LoadUint64(&r.counters.sampled),
+		deduplicated: atomic.LoadUint64(&r.counters.deduplicated),
+	}
+	if total {
+		debug.SendEvent(containerID,
+			fmt.Sprintf("In total, %d log lines (%d bytes) over the rate limit are dropped, "+
+				"of which %d are deduplicated, and %d are sampled.",
+				counters.dropped, counters.droppedBytes, counters.deduplicated, counters.sampled),
+			debug.INFO,
+			debug.Lines(counters.dropped),
+			debug.Bytes(counters.droppedBytes))
+		return
+	}
+	last := r.reported
+	r.reported = counters
+	if counters == last {
+		return
+	}
+	debug.SendEvent(containerID,
+		fmt.Sprintf("Within last minute, %d log lines (%d bytes) over the rate limit are dropped, "+
+			"of which %d are deduplicated, and %d are sampled.",
+			counters.dropped-last.dropped, counters.droppedBytes-last.droppedBytes,
+			counters.deduplicated-last.deduplicated, counters.sampled-last.sampled),
+		debug.INFO,
+		debug.Lines(counters.dropped-last.dropped),
+		debug.Bytes(counters.droppedBytes-last.droppedBytes))
+}
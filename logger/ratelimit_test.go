@@ -0,0 +1,163 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package logger
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRateLimiter creates a rate limiter which time only moves forward with the returned
+// function.
+func newTestRateLimiter(t *testing.T, args *RateLimitArgs) (*rateLimiter, func(time.Duration)) {
+	r, err := newRateLimiter(args)
+	require.NoError(t, err)
+	now := dummyTime
+	r.now = func() time.Time { return now }
+	return r, func(d time.Duration) { now = now.Add(d) }
+}
+
+// sendLines sends the log lines through the rate limiter of a source, and returns the log
+// messages sent to destination.
+func sendLines(t *testing.T, s *rateLimitedSource, sent *sentMessages, lines ...string) []string {
+	for _, line := range lines {
+		require.NoError(t, s.add([]byte(line), sourceSTDOUT, false, false, "", 1, dummyTime))
+	}
+	return sent.get()
+}
+
+// TestRateLimitTokenBuckets tests that log lines are sent within both the rate of log lines and
+// of bytes, along with their bursts, and that a log line larger than the byte burst is still sent
+// once the bucket is full.
+func TestRateLimitTokenBuckets(t *testing.T) {
+	r, sleep := newTestRateLimiter(t, &RateLimitArgs{LinesPerSecond: 2, LineBurst: 3, BytesPerSecond: 100})
+	sent := &sentMessages{}
+	s := r.newSource(sent.send)
+	require.Equal(t, []string{"1", "2", "3"}, sendLines(t, s, sent, "1", "2", "3", "4"))
+
+	sleep(time.Second)
+	require.Equal(t, []string{"1", "2", "3", "5", "6"}, sendLines(t, s, sent, "5", "6", "7"))
+
+	sleep(10 * time.Second)
+	long := strings.Repeat("x", 150)
+	require.Equal(t, []string{"1", "2", "3", "5", "6", long}, sendLines(t, s, sent, long, "8"))
+
+	require.Equal(t, uint64(3), atomic.LoadUint64(&r.counters.dropped))
+	require.Equal(t, uint64(3), atomic.LoadUint64(&r.counters.droppedBytes))
+	r.reportTrace(testContainerID, false)
+	r.reportTrace(testContainerID, true)
+}
+
+// TestRateLimitSample tests that one in every sample rate log lines over the rate limit is sent.
+func TestRateLimitSample(t *testing.T) {
+	r, _ := newTestRateLimiter(t, &RateLimitArgs{LinesPerSecond: 1, Policy: SampleRateLimitPolicy, SampleRate: 3})
+	sent := &sentMessages{}
+	s := r.newSource(sent.send)
+	require.Equal(t,
+		[]string{"1", "2", "5", "8"},
+		sendLines(t, s, sent, "1", "2", "3", "4", "5", "6", "7", "8"))
+	require.Equal(t, uint64(3), atomic.LoadUint64(&r.counters.sampled))
+	require.Equal(t, uint64(4), atomic.LoadUint64(&r.counters.dropped))
+}
+
+// TestRateLimitDedupe tests that identical consecutive log lines over the rate limit are reported
+// once another log line is read or the container pipe is closed, only if the first one was sent.
+func TestRateLimitDedupe(t *testing.T) {
+	r, sleep := newTestRateLimiter(t, &RateLimitArgs{LinesPerSecond: 1, Policy: DedupeRateLimitPolicy})
+	sent := &sentMessages{}
+	s := r.newSource(sent.send)
+	sendLines(t, s, sent, "error", "error", "error", "other", "other")
+	sleep(time.Second)
+	sendLines(t, s, sent, "next", "next")
+	require.NoError(t, s.close(sourceSTDOUT))
+	require.Equal(t, []string{
+		"error",
+		"last message repeated 2 times",
+		"next",
+		"last message repeated 1 times",
+	}, sent.get())
+	require.Equal(t, uint64(3), atomic.LoadUint64(&r.counters.deduplicated))
+	require.Equal(t, uint64(5), atomic.LoadUint64(&r.counters.dropped))
+}
+
+// TestRateLimitPartialMessages tests that all the partial log messages of a log line are sent or
+// dropped along with the first one.
+func TestRateLimitPartialMessages(t *testing.T) {
+	l, err := NewLogger(
+		WithInfo(NewInfo(testContainerID, testContainerName)),
+		WithRateLimit(&RateLimitArgs{LinesPerSecond: 1, BytesPerSecond: 1024}),
+		WithMaxReadBytes(4),
+	)
+	require.NoError(t, err)
+	sent := &sentMessages{}
+	pipe := strings.NewReader("a long line\nanother long line\n")
+	require.NoError(t, l.Read(context.Background(), pipe, sourceSTDOUT, 8, sent.send))
+	require.Equal(t, []string{"a long l", "ine"}, sent.get())
+
+	inner, ok := l.(*Logger)
+	require.True(t, ok)
+	require.Len(t, inner.traceReporters(), 1)
+}
+
+// TestRateLimitPartialBytes tests that the partial log messages sent along with the first one take
+// their byte tokens, so that the next log line is over the rate limit until they are refilled.
+func TestRateLimitPartialBytes(t *testing.T) {
+	r, sleep := newTestRateLimiter(t, &RateLimitArgs{BytesPerSecond: 12})
+	sent := &sentMessages{}
+	s := r.newSource(sent.send)
+	require.NoError(t, s.add([]byte("a long l"), sourceSTDOUT, true, false, "id", 1, dummyTime))
+	require.NoError(t, s.add([]byte("ine, which is over"), sourceSTDOUT, true, true, "id", 2, dummyTime))
+	require.Equal(t, []string{"a long l", "ine, which is over"}, sendLines(t, s, sent, "xy"))
+
+	sleep(time.Second)
+	require.Len(t, sendLines(t, s, sent, "xy"), 2)
+
+	sleep(time.Second)
+	require.Equal(t, []string{"a long l", "ine, which is over", "xy"}, sendLines(t, s, sent, "xy"))
+	require.Equal(t, uint64(2), atomic.LoadUint64(&r.counters.dropped))
+	require.Equal(t, uint64(4), atomic.LoadUint64(&r.counters.droppedBytes))
+}
+
+// TestRateLimitBytesSent tests that the log messages over the rate limit aren't counted as sent
+// to the destination.
+func TestRateLimitBytesSent(t *testing.T) {
+	stream := &fanOutRecorder{}
+	l, err := NewLogger(
+		WithInfo(NewInfo(testContainerID, testContainerName)),
+		WithStream(stream),
+		WithRateLimit(&RateLimitArgs{LinesPerSecond: 1}),
+	)
+	require.NoError(t, err)
+	inner, ok := l.(*Logger)
+	require.True(t, ok)
+	atomic.StoreUint64(&bytesSentToDst, 0)
+
+	pipe := strings.NewReader("first\nsecond\nthird\n")
+	require.NoError(t, l.Read(context.Background(), pipe, sourceSTDOUT, 64, inner.sendLogMsgToDest))
+	require.Equal(t, []string{"first"}, stream.lines())
+	require.Equal(t, uint64(len("first")), atomic.LoadUint64(&bytesSentToDst))
+}
+
+// TestNewRateLimiterWithError tests that invalid rate limit arguments are rejected.
+func TestNewRateLimiterWithError(t *testing.T) {
+	for name, args := range map[string]*RateLimitArgs{
+		"no rate":        {},
+		"negative rate":  {LinesPerSecond: -1},
+		"negative burst": {BytesPerSecond: 1024, ByteBurst: -1},
+		"unknown policy": {LinesPerSecond: 1, Policy: "block"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewLogger(WithRateLimit(args))
+			require.Error(t, err)
+		})
+	}
+}
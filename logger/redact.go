@@ -0,0 +1,260 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package logger
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/aws/shim-loggers-for-containerd/debug"
+)
+
+// Built-in redaction detectors.
+const (
+	// AWSAccessKeyDetector matches AWS access key IDs.
+	AWSAccessKeyDetector = "aws-access-key"
+	// JWTDetector matches JSON web tokens.
+	JWTDetector = "jwt"
+	// BearerTokenDetector matches the token of `Bearer <token>`, e.g. in an Authorization header.
+	BearerTokenDetector = "bearer-token"
+	// EmailDetector matches email addresses.
+	EmailDetector = "email"
+	// CreditCardDetector matches credit card numbers, which pass the Luhn check, with or without
+	// spaces or dashes between the digits.
+	CreditCardDetector = "credit-card"
+)
+
+// Redaction actions.
+const (
+	// MaskRedactAction replaces a match with the mask. This is the default action.
+	MaskRedactAction = "mask"
+	// HashRedactAction replaces a match with the hex encoded HMAC-SHA256 of the salt and the
+	// match, so that the same values can still be correlated without being revealed.
+	HashRedactAction = "hash"
+)
+
+const (
+	// defaultRedactMask is the default replacement of a match with the mask action.
+	defaultRedactMask = "[REDACTED]"
+	// redactHashPrefix is the prefix of the replacement of a match with the hash action.
+	redactHashPrefix = "sha256:"
+	// redactHashLength is how many hex characters of the hash a match is replaced with.
+	redactHashLength = 16
+)
+
+// redactDetectors are the patterns of the built-in detectors, along with a validation of the
+// matches if a pattern isn't enough.
+var redactDetectors = map[string]struct {
+	pattern string
+	valid   func([]byte) bool
+}{
+	AWSAccessKeyDetector: {pattern: `\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`},
+	JWTDetector:          {pattern: `\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`},
+	BearerTokenDetector:  {pattern: `(?i)\bbearer\s+([A-Za-z0-9._~+/-]+=*)`},
+	EmailDetector:        {pattern: `\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`},
+	CreditCardDetector:   {pattern: `\b\d(?:[ -]?\d){12,18}\b`, valid: luhnValid},
+}
+
+// RedactRules are the rules to redact secrets and PII from log lines before they are sent.
+type RedactRules struct {
+	// Rules are applied one after the other to every log line.
+	Rules []RedactRule `json:"rules"`
+	// Mask is the replacement of a match with the mask action, `[REDACTED]` by default.
+	Mask string `json:"mask,omitempty"`
+	// Salt is the key of the HMAC of a match with the hash action, which is required by it.
+	Salt string `json:"salt,omitempty"`
+}
+
+// RedactRule is either a built-in detector or a custom regular expression. If the regular
+// expression has capturing groups, only what they match is replaced, e.g. the value of
+// `password=(\S+)`.
+type RedactRule struct {
+	// Name identifies the rule in the routing trace, it's the detector by default.
+	Name string `json:"name,omitempty"`
+	// Detector is one of the built-in detectors.
+	Detector string `json:"detector,omitempty"`
+	// Pattern is a regular expression, if the detector isn't set.
+	Pattern string `json:"pattern,omitempty"`
+	// Action is either mask, the default, or hash.
+	Action string `json:"action,omitempty"`
+}
+
+// redactor redacts log lines with the compiled redaction rules.
+type redactor struct {
+	rules []*redactRule
+	mask  []byte
+	salt  []byte
+}
+
+// redactRule is a compiled redaction rule.
+type redactRule struct {
+	name    string
+	pattern *regexp.Regexp
+	valid   func([]byte) bool
+	hash    bool
+	// hits is the number of matches replaced by the rule, and reported is how many of them were
+	// reported in the routing trace already.
+	hits     uint64
+	reported uint64
+}
+
+// newRedactor validates the redaction rules and compiles them.
+func newRedactor(rules *RedactRules) (*redactor, error) {
+	if len(rules.Rules) == 0 {
+		return nil, errors.New("at least one redaction rule is required")
+	}
+	r := &redactor{
+		mask: []byte(rules.Mask),
+		salt: []byte(rules.Salt),
+	}
+	if rules.Mask == "" {
+		r.mask = []byte(defaultRedactMask)
+	}
+	for i, rule := range rules.Rules {
+		compiled := &redactRule{name: rule.Name}
+		switch {
+		case rule.Detector != "" && rule.Pattern != "":
+			return nil, fmt.Errorf("redaction rule %d has both a detector and a pattern", i)
+		case rule.Detector != "":
+			detector, ok := redactDetectors[rule.Detector]
+			if !ok {
+				return nil, fmt.Errorf("unknown redaction detector: %s", rule.Detector)
+			}
+			compiled.pattern = regexp.MustCompile(detector.pattern)
+			compiled.valid = detector.valid
+			if compiled.name == "" {
+				compiled.name = rule.Detector
+			}
+		case rule.Pattern != "":
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid redaction pattern %s: %w", rule.Pattern, err)
+			}
+			compiled.pattern = pattern
+			if compiled.name == "" {
+				compiled.name = rule.Pattern
+			}
+		default:
+			return nil, fmt.Errorf("redaction rule %d has neither a detector nor a pattern", i)
+		}
+
+		switch rule.Action {
+		case "", MaskRedactAction:
+		case HashRedactAction:
+			if rules.Salt == "" {
+				return nil, fmt.Errorf("redaction rule %s hashes matches but no salt is set", compiled.name)
+			}
+			compiled.hash = true
+		default:
+			return nil, fmt.Errorf("unknown redaction action: %s", rule.Action)
+		}
+		r.rules = append(r.rules, compiled)
+	}
+	return r, nil
+}
+
+// redact returns the log line with the matches of every rule replaced. The log line is only
+// copied if anything is replaced.
+func (r *redactor) redact(line []byte) []byte {
+	for _, rule := range r.rules {
+		matches := rule.pattern.FindAllSubmatchIndex(line, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		var (
+			redacted []byte
+			last     int
+			hits     uint64
+		)
+		for _, match := range matches {
+			// Only replace what the capturing groups match, if there are any.
+			spans := match[:2]
+			if len(match) > 2 {
+				spans = match[2:]
+			}
+			for i := 0; i+1 < len(spans); i += 2 {
+				start, end := spans[i], spans[i+1]
+				if start < last || start == end {
+					continue
+				}
+				if rule.valid != nil && !rule.valid(line[start:end]) {
+					continue
+				}
+				redacted = append(redacted, line[last:start]...)
+				redacted = append(redacted, r.replacement(rule, line[start:end])...)
+				last = end
+				hits++
+			}
+		}
+		if hits == 0 {
+			continue
+		}
+		line = append(redacted, line[last:]...)
+		atomic.AddUint64(&rule.hits, hits)
+	}
+	return line
+}
+
+// replacement returns what a match of the rule is replaced with.
+func (r *redactor) replacement(rule *redactRule, match []byte) []byte {
+	if !rule.hash {
+		return r.mask
+	}
+	mac := hmac.New(sha256.New, r.salt)
+	mac.Write(match) //nolint:errcheck // never returns an error
+	return []byte(redactHashPrefix + hex.EncodeToString(mac.Sum(nil))[:redactHashLength])
+}
+
+// reportTrace reports the number of matches replaced by every rule since the last report, or in
+// total once the routing trace is stopped.
+func (r *redactor) reportTrace(containerID string, total bool) {
+	for _, rule := range r.rules {
+		hits := atomic.LoadUint64(&rule.hits)
+		if total {
+			debug.SendEvent(containerID,
+				fmt.Sprintf("In total, %d matches of redaction rule %s are replaced.", hits, rule.name),
+				debug.INFO,
+				debug.Rule(rule.name),
+				debug.Lines(hits))
+			continue
+		}
+		last := rule.reported
+		rule.reported = hits
+		if hits == last {
+			continue
+		}
+		debug.SendEvent(containerID,
+			fmt.Sprintf("Within last minute, %d matches of redaction rule %s are replaced.", hits-last, rule.name),
+			debug.INFO,
+			debug.Rule(rule.name),
+			debug.Lines(hits-last))
+	}
+}
+
+// luhnValid returns whether the digits of a number, which may be separated by spaces or dashes,
+// pass the Luhn check.
+func luhnValid(number []byte) bool {
+	sum, digits := 0, 0
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits > 0 && sum%10 == 0
+}
@@ -0,0 +1,521 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/aws/shim-loggers-for-containerd/debug"
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+const (
+	// flushInterval is how often the log lines written to the object are committed to the
+	// staging directory, and the age of the object is checked.
+	flushInterval = 1 * time.Second
+	// uploadRetryInterval is how often the uploads which failed are retried.
+	uploadRetryInterval = 30 * time.Second
+
+	// Staging files are named after the sequence number of their object, which is zero padded
+	// so that they are sorted in the order they are written.
+	sequenceFormat = "%010d"
+	// partSuffix is the suffix of the object which is being written.
+	partSuffix = ".part"
+	// readySuffix is the suffix of the objects which are rotated and ready to be uploaded.
+	readySuffix = ".ready"
+	// metaSuffix is the suffix of the metadata of an object.
+	metaSuffix = ".meta"
+	// sequenceFile holds the sequence number of the next object, so that it keeps increasing
+	// across restarts.
+	sequenceFile = "sequence"
+
+	dateFormat = "2006-01-02"
+	timeFormat = "150405"
+)
+
+// errArchiverClosed is returned when sending a log message after the archiver is closed.
+var errArchiverClosed = errors.New("s3 archiver is closed")
+
+// uploader uploads a staged object to the bucket.
+type uploader interface {
+	upload(key string, f *os.File, size int64) error
+}
+
+// keyFields are the fields which can be used in the key template.
+type keyFields struct {
+	ContainerName string
+	ContainerID   string
+	// Date is the UTC date the object is started at, in the format of 2006-01-02.
+	Date string
+	// Time is the UTC time the object is started at, in the format of 150405.
+	Time string
+	// Sequence is the sequence number of the object, which increases across restarts as long
+	// as the staging directory is kept.
+	Sequence string
+	// Extension is the file extension matching the compression, such as .ndjson.gz.
+	Extension string
+}
+
+// objectKey renders the key template with the given fields.
+func (cfg *config) objectKey(fields keyFields) (string, error) {
+	var buf bytes.Buffer
+	if err := cfg.keyTemplate.Execute(&buf, fields); err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(buf.String(), "/"), nil
+}
+
+// extension returns the file extension of the objects.
+func (cfg *config) extension() string {
+	switch cfg.compression {
+	case GzipCompression:
+		return ".ndjson.gz"
+	case ZstdCompression:
+		return ".ndjson.zst"
+	}
+	return ".ndjson"
+}
+
+// record is a log message as it's written to an object, as a line of JSON.
+type record struct {
+	ContainerID   string    `json:"container_id"`
+	ContainerName string    `json:"container_name"`
+	Source        string    `json:"source"`
+	Log           string    `json:"log"`
+	Time          time.Time `json:"time"`
+}
+
+// objectMeta is the metadata of a staged object.
+type objectMeta struct {
+	Key string `json:"key"`
+	// Size is the size of the staged object which is committed. Anything written after it is
+	// discarded when recovering from a crash.
+	Size int64 `json:"size"`
+}
+
+// object is the object which is being written to the staging directory.
+type object struct {
+	seq      uint64
+	key      string
+	file     *os.File
+	openedAt time.Time
+	// written is the number of bytes of the log lines written to the object, before compression.
+	written int64
+	// size is the number of compressed bytes written to the file, and committed the number of
+	// them which are synced to disk along with the metadata.
+	size      int64
+	committed int64
+	// w compresses the log lines written since the last commit, as a gzip member or a zstd
+	// frame. It's nil if nothing is written since the last commit.
+	w io.WriteCloser
+}
+
+// Write counts the compressed bytes written to the file.
+func (o *object) Write(p []byte) (int, error) {
+	n, err := o.file.Write(p)
+	o.size += int64(n)
+	return n, err
+}
+
+// archiver writes log messages as newline-delimited JSON to compressed objects in the staging
+// directory, and uploads them in the background once they are rotated.
+//
+// Log lines are compressed as a sequence of gzip members or zstd frames, one for every flush
+// interval, which is the same as one single stream once decompressed. The size of the complete
+// ones is committed to the metadata of the object, so that the object can be truncated to it
+// and uploaded after a crash.
+type archiver struct {
+	cfg           *config
+	containerID   string
+	containerName string
+	uploader      uploader
+	now           func() time.Time
+
+	// lock protects the fields below, which are used by both Log and the flush goroutine.
+	lock    sync.Mutex
+	closed  bool
+	current *object
+	nextSeq uint64
+
+	// wake wakes the upload goroutine up once an object is ready.
+	wake      chan struct{}
+	stop      chan struct{}
+	flushDone chan struct{}
+	// uploadDone is closed once the upload goroutine uploads the objects which are ready, after
+	// the archiver is closed.
+	uploadDone chan struct{}
+}
+
+// newArchiver creates an archiver staging the objects of the container in the staging directory.
+// Objects left in the staging directory, e.g. by a crash, are uploaded first.
+func newArchiver(cfg *config, globalArgs *logger.GlobalArgs, u uploader) (*archiver, error) {
+	a := &archiver{
+		cfg:           cfg,
+		containerID:   globalArgs.ContainerID,
+		containerName: globalArgs.ContainerName,
+		uploader:      u,
+		now:           time.Now,
+		wake:          make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+		flushDone:     make(chan struct{}),
+		uploadDone:    make(chan struct{}),
+	}
+	if err := a.recover(); err != nil {
+		return nil, err
+	}
+	go a.flush()
+	go a.upload()
+
+	return a, nil
+}
+
+// recover creates the staging directory, and marks the objects which are left being written as
+// ready, after discarding what is not committed.
+func (a *archiver) recover() error {
+	if err := os.MkdirAll(a.cfg.stagingDir, 0o700); err != nil {
+		return fmt.Errorf("unable to create staging directory %s: %w", a.cfg.stagingDir, err)
+	}
+	content, err := os.ReadFile(filepath.Join(a.cfg.stagingDir, sequenceFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to read sequence number: %w", err)
+	}
+	if len(content) > 0 {
+		if a.nextSeq, err = strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64); err != nil {
+			return fmt.Errorf("unable to parse sequence number: %w", err)
+		}
+	}
+
+	parts, err := filepath.Glob(filepath.Join(a.cfg.stagingDir, "*"+partSuffix))
+	if err != nil {
+		return err
+	}
+	for _, part := range parts {
+		base := strings.TrimSuffix(part, partSuffix)
+		if seq, err := strconv.ParseUint(filepath.Base(base), 10, 64); err == nil && seq >= a.nextSeq {
+			a.nextSeq = seq + 1
+		}
+		meta, err := readMeta(base + metaSuffix)
+		if err != nil || meta.Size == 0 {
+			// Nothing is committed.
+			_ = os.Remove(part)
+			_ = os.Remove(base + metaSuffix)
+			continue
+		}
+		if err := os.Truncate(part, meta.Size); err != nil {
+			return fmt.Errorf("unable to recover staged object %s: %w", part, err)
+		}
+		if err := os.Rename(part, base+readySuffix); err != nil {
+			return fmt.Errorf("unable to recover staged object %s: %w", part, err)
+		}
+	}
+
+	return nil
+}
+
+// Log writes a log message to the current object, and rotates it once the log lines written to
+// it reach the max size.
+func (a *archiver) Log(msg *dockerlogger.Message) error {
+	data, err := json.Marshal(&record{
+		ContainerID:   a.containerID,
+		ContainerName: a.containerName,
+		Source:        msg.Source,
+		Log:           string(msg.Line),
+		Time:          msg.Timestamp,
+	})
+	dockerlogger.PutMessage(msg)
+	if err != nil {
+		return fmt.Errorf("unable to encode log message: %w", err)
+	}
+	data = append(data, '\n')
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.closed {
+		return errArchiverClosed
+	}
+	if a.current == nil {
+		if a.current, err = a.openObject(); err != nil {
+			return err
+		}
+	}
+	if a.current.w == nil {
+		if a.current.w, err = a.newCompressor(a.current); err != nil {
+			return err
+		}
+	}
+	if _, err := a.current.w.Write(data); err != nil {
+		return fmt.Errorf("unable to write to staged object: %w", err)
+	}
+	a.current.written += int64(len(data))
+	if a.current.written >= a.cfg.maxSize {
+		return a.rotate()
+	}
+	return nil
+}
+
+// Close rotates the current object, and uploads the objects which are ready. The ones which
+// can't be uploaded are kept in the staging directory, and uploaded once the log driver starts
+// again.
+func (a *archiver) Close() error {
+	a.lock.Lock()
+	if a.closed {
+		a.lock.Unlock()
+		return nil
+	}
+	a.closed = true
+	var err error
+	if a.current != nil {
+		err = a.rotate()
+	}
+	a.lock.Unlock()
+
+	close(a.stop)
+	<-a.flushDone
+	<-a.uploadDone
+	return err
+}
+
+// openObject starts a new object in the staging directory.
+func (a *archiver) openObject() (*object, error) {
+	seq := a.nextSeq
+	a.nextSeq++
+	if err := writeFileAtomic(filepath.Join(a.cfg.stagingDir, sequenceFile),
+		[]byte(strconv.FormatUint(a.nextSeq, 10))); err != nil {
+		return nil, fmt.Errorf("unable to save sequence number: %w", err)
+	}
+
+	now := a.now().UTC()
+	key, err := a.cfg.objectKey(keyFields{
+		ContainerName: a.containerName,
+		ContainerID:   a.containerID,
+		Date:          now.Format(dateFormat),
+		Time:          now.Format(timeFormat),
+		Sequence:      fmt.Sprintf(sequenceFormat, seq),
+		Extension:     a.cfg.extension(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to render object key: %w", err)
+	}
+
+	base := a.stagingPath(seq)
+	if err := writeMeta(base+metaSuffix, &objectMeta{Key: key}); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(base+partSuffix, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create staged object: %w", err)
+	}
+
+	return &object{seq: seq, key: key, file: f, openedAt: now}, nil
+}
+
+// newCompressor starts a gzip member or a zstd frame in the object.
+func (a *archiver) newCompressor(o *object) (io.WriteCloser, error) {
+	switch a.cfg.compression {
+	case GzipCompression:
+		return gzip.NewWriter(o), nil
+	case ZstdCompression:
+		w, err := zstd.NewWriter(o, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("unable to create zstd writer: %w", err)
+		}
+		return w, nil
+	}
+	return nopCloser{o}, nil
+}
+
+// commit completes the gzip member or zstd frame of the object, and saves its size along with
+// the metadata, so that it's not lost after a crash.
+func (a *archiver) commit(o *object) error {
+	if o.w == nil {
+		return nil
+	}
+	err := o.w.Close()
+	o.w = nil
+	if err != nil {
+		return fmt.Errorf("unable to write to staged object: %w", err)
+	}
+	if err := o.file.Sync(); err != nil {
+		return fmt.Errorf("unable to sync staged object: %w", err)
+	}
+	o.committed = o.size
+	return writeMeta(a.stagingPath(o.seq)+metaSuffix, &objectMeta{Key: o.key, Size: o.committed})
+}
+
+// rotate commits the current object and marks it as ready to be uploaded.
+func (a *archiver) rotate() error {
+	o := a.current
+	a.current = nil
+	err := a.commit(o)
+	if closeErr := o.file.Close(); err == nil {
+		err = closeErr
+	}
+	base := a.stagingPath(o.seq)
+	if o.committed == 0 {
+		_ = os.Remove(base + partSuffix)
+		_ = os.Remove(base + metaSuffix)
+		return err
+	}
+	if renameErr := os.Rename(base+partSuffix, base+readySuffix); renameErr != nil {
+		return fmt.Errorf("unable to rotate staged object: %w", renameErr)
+	}
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+	return err
+}
+
+// flush commits the current object every flush interval, and rotates it once it's old enough.
+func (a *archiver) flush() {
+	defer close(a.flushDone)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+		}
+		a.lock.Lock()
+		var err error
+		if a.current != nil {
+			if a.now().Sub(a.current.openedAt) >= a.cfg.maxAge {
+				err = a.rotate()
+			} else {
+				err = a.commit(a.current)
+			}
+		}
+		a.lock.Unlock()
+		if err != nil {
+			debug.SendEvent(logger.DaemonName,
+				fmt.Sprintf("Failed to stage log lines: %s", err),
+				debug.ERROR,
+				debug.Driver(DriverName),
+				debug.Err(err))
+		}
+	}
+}
+
+// upload uploads the objects which are ready once woken up, and retries the ones which failed
+// every retry interval.
+func (a *archiver) upload() {
+	defer close(a.uploadDone)
+	ticker := time.NewTicker(uploadRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		a.uploadReady()
+		select {
+		case <-a.stop:
+			// Close rotates the current object before stopping.
+			a.uploadReady()
+			return
+		case <-a.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// uploadReady uploads the objects which are ready in the order they are written, and removes them
+// from the staging directory once they are uploaded. It stops at the first failure.
+func (a *archiver) uploadReady() {
+	ready, err := filepath.Glob(filepath.Join(a.cfg.stagingDir, "*"+readySuffix))
+	if err != nil {
+		return
+	}
+	sort.Strings(ready)
+	for _, path := range ready {
+		if err := a.uploadObject(path); err != nil {
+			debug.SendEvent(logger.DaemonName,
+				fmt.Sprintf("Failed to upload staged object %s: %s", path, err),
+				debug.ERROR,
+				debug.Driver(DriverName),
+				debug.Err(err))
+			return
+		}
+	}
+}
+
+func (a *archiver) uploadObject(path string) error {
+	base := strings.TrimSuffix(path, readySuffix)
+	meta, err := readMeta(base + metaSuffix)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path) //nolint:gosec // staged by the archiver
+	if err != nil {
+		return fmt.Errorf("unable to open staged object: %w", err)
+	}
+	err = a.uploader.upload(meta.Key, f, meta.Size)
+	_ = f.Close()
+	if err != nil {
+		return err
+	}
+	_ = os.Remove(path)
+	_ = os.Remove(base + metaSuffix)
+	return nil
+}
+
+// stagingPath returns the path of the staging files of an object, without their suffix.
+func (a *archiver) stagingPath(seq uint64) string {
+	return filepath.Join(a.cfg.stagingDir, fmt.Sprintf(sequenceFormat, seq))
+}
+
+func readMeta(path string) (*objectMeta, error) {
+	content, err := os.ReadFile(path) //nolint:gosec // staged by the archiver
+	if err != nil {
+		return nil, fmt.Errorf("unable to read staged object metadata: %w", err)
+	}
+	var meta objectMeta
+	if err := json.Unmarshal(content, &meta); err != nil {
+		return nil, fmt.Errorf("unable to parse staged object metadata %s: %w", path, err)
+	}
+	return &meta, nil
+}
+
+func writeMeta(path string, meta *objectMeta) error {
+	content, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("unable to encode staged object metadata: %w", err)
+	}
+	if err := writeFileAtomic(path, content); err != nil {
+		return fmt.Errorf("unable to save staged object metadata: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes a file by renaming a temporary one, so that it's never half written.
+func writeFileAtomic(path string, content []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// nopCloser writes to the object without compressing.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,202 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+// fakeUploader records the objects it's given, or fails if err is set.
+type fakeUploader struct {
+	lock    sync.Mutex
+	keys    []string
+	objects [][]byte
+	err     error
+}
+
+func (u *fakeUploader) upload(key string, f *os.File, size int64) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if u.err != nil {
+		return u.err
+	}
+	content := make([]byte, size)
+	if _, err := f.ReadAt(content, 0); err != nil {
+		return err
+	}
+	u.keys = append(u.keys, key)
+	u.objects = append(u.objects, content)
+	return nil
+}
+
+func newTestArchiver(t *testing.T, cfg *config, u uploader) *archiver {
+	a, err := newArchiver(cfg, &logger.GlobalArgs{
+		ContainerID:   testContainerID,
+		ContainerName: testContainerName,
+	}, u)
+	require.NoError(t, err)
+	setNow(a, time.Date(2020, time.January, 14, 1, 59, 0, 0, time.UTC))
+	return a
+}
+
+// setNow sets the time of the archiver.
+func setNow(a *archiver, now time.Time) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.now = func() time.Time {
+		return now
+	}
+}
+
+func logLine(t *testing.T, a *archiver, line string) {
+	msg := dockerlogger.NewMessage()
+	msg.Line = append(msg.Line, line...)
+	msg.Source = "stdout"
+	msg.Timestamp = time.Date(2020, time.January, 14, 1, 59, 0, 0, time.UTC)
+	require.NoError(t, a.Log(msg))
+}
+
+// decodeObject decompresses an object and returns the log lines of its records.
+func decodeObject(t *testing.T, compression string, content []byte) []string {
+	var r io.Reader = bytes.NewReader(content)
+	switch compression {
+	case GzipCompression:
+		zr, err := gzip.NewReader(r)
+		require.NoError(t, err)
+		r = zr
+	case ZstdCompression:
+		zr, err := zstd.NewReader(r)
+		require.NoError(t, err)
+		defer zr.Close()
+		r = zr
+	}
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var rec record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+		require.Equal(t, testContainerID, rec.ContainerID)
+		require.Equal(t, testContainerName, rec.ContainerName)
+		lines = append(lines, rec.Log)
+	}
+	require.NoError(t, scanner.Err())
+	return lines
+}
+
+// TestArchiverRotatesBySize tests that objects are rotated once their log lines reach the max
+// size, and that every object is decompressed as a whole, although it's made of several gzip
+// members or zstd frames.
+func TestArchiverRotatesBySize(t *testing.T) {
+	for _, compression := range []string{GzipCompression, ZstdCompression, NoCompression} {
+		t.Run(compression, func(t *testing.T) {
+			cfg, err := getS3Config(&Args{
+				Compression: compression,
+				MaxSize:     "200",
+				StagingDir:  t.TempDir(),
+			}, testContainerID)
+			require.NoError(t, err)
+			u := &fakeUploader{}
+			a := newTestArchiver(t, cfg, u)
+
+			logLine(t, a, "first")
+			a.lock.Lock()
+			require.NoError(t, a.commit(a.current))
+			a.lock.Unlock()
+			// Both records are larger than the max size.
+			logLine(t, a, "second")
+			logLine(t, a, strings.Repeat("x", 1024))
+			logLine(t, a, "third")
+			require.NoError(t, a.Close())
+			require.ErrorIs(t, a.Log(dockerlogger.NewMessage()), errArchiverClosed)
+
+			require.Len(t, u.objects, 3)
+			ext := cfg.extension()
+			require.Equal(t, []string{
+				"test-container-name/test-container-id/2020-01-14/015900-0000000000" + ext,
+				"test-container-name/test-container-id/2020-01-14/015900-0000000001" + ext,
+				"test-container-name/test-container-id/2020-01-14/015900-0000000002" + ext,
+			}, u.keys)
+			require.Equal(t, []string{"first", "second"}, decodeObject(t, compression, u.objects[0]))
+			require.Equal(t, []string{strings.Repeat("x", 1024)}, decodeObject(t, compression, u.objects[1]))
+			require.Equal(t, []string{"third"}, decodeObject(t, compression, u.objects[2]))
+
+			staged, err := os.ReadDir(cfg.stagingDir)
+			require.NoError(t, err)
+			require.Len(t, staged, 1)
+			require.Equal(t, sequenceFile, staged[0].Name())
+		})
+	}
+}
+
+// TestArchiverRotatesByAge tests that objects are rotated and uploaded once they reach the max
+// age, without waiting for more log lines.
+func TestArchiverRotatesByAge(t *testing.T) {
+	cfg, err := getS3Config(&Args{MaxAge: "1m", StagingDir: t.TempDir()}, testContainerID)
+	require.NoError(t, err)
+	u := &fakeUploader{}
+	a := newTestArchiver(t, cfg, u)
+	defer a.Close() //nolint:errcheck // testing only
+
+	logLine(t, a, "first")
+	setNow(a, time.Date(2020, time.January, 14, 2, 0, 0, 0, time.UTC))
+	require.Eventually(t, func() bool {
+		u.lock.Lock()
+		defer u.lock.Unlock()
+		return len(u.objects) == 1
+	}, 5*time.Second, 100*time.Millisecond)
+	require.Equal(t, []string{"first"}, decodeObject(t, GzipCompression, u.objects[0]))
+}
+
+// TestArchiverRecoversStagedObjects tests that the committed log lines of an object which is
+// left in the staging directory by a crash are uploaded once the archiver starts again, and that
+// the sequence numbers keep increasing.
+func TestArchiverRecoversStagedObjects(t *testing.T) {
+	cfg, err := getS3Config(&Args{StagingDir: t.TempDir()}, testContainerID)
+	require.NoError(t, err)
+	a := newTestArchiver(t, cfg, &fakeUploader{err: errors.New("unavailable")})
+	// Stop the background goroutines, so that nothing is committed but explicitly.
+	close(a.stop)
+	<-a.flushDone
+	<-a.uploadDone
+
+	logLine(t, a, "committed")
+	a.lock.Lock()
+	require.NoError(t, a.commit(a.current))
+	a.lock.Unlock()
+	logLine(t, a, "lost")
+	// Crash without completing the gzip member of the last log line.
+	require.NoError(t, a.current.file.Close())
+
+	u := &fakeUploader{}
+	a = newTestArchiver(t, cfg, u)
+	logLine(t, a, "restarted")
+	require.NoError(t, a.Close())
+
+	require.Len(t, u.objects, 2)
+	require.Equal(t, []string{
+		"test-container-name/test-container-id/2020-01-14/015900-0000000000.ndjson.gz",
+		"test-container-name/test-container-id/2020-01-14/015900-0000000001.ndjson.gz",
+	}, u.keys)
+	require.Equal(t, []string{"committed"}, decodeObject(t, GzipCompression, u.objects[0]))
+	require.Equal(t, []string{"restarted"}, decodeObject(t, GzipCompression, u.objects[1]))
+}
@@ -0,0 +1,240 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package s3 provides a log driver archiving container logs to Amazon S3, as compressed
+// newline-delimited JSON objects which are rotated by size and age. Log lines are staged in a
+// local directory until their object is uploaded, so that they survive a restart.
+package s3
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/containerd/containerd/runtime/v2/logging"
+	"github.com/docker/go-units"
+
+	"github.com/aws/shim-loggers-for-containerd/debug"
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+// s3 driver argument keys.
+const (
+	// DriverName is the name of the s3 log driver.
+	DriverName = "s3"
+
+	// BucketKey is the name of the bucket to upload the objects to.
+	BucketKey = "s3-bucket"
+	// RegionKey is the AWS region of the bucket.
+	RegionKey = "s3-region"
+	// EndpointKey overrides the S3 endpoint, e.g. for a local stand-in.
+	EndpointKey = "s3-endpoint"
+	// CredentialsEndpointKey is the path of the credentials endpoint on the ECS agent, in the
+	// same way as awslogs-credentials-endpoint.
+	CredentialsEndpointKey = "s3-credentials-endpoint" //nolint:gosec // not credentials
+	// ForcePathStyleKey addresses the bucket in the path of the URLs instead of the host name.
+	ForcePathStyleKey = "s3-force-path-style"
+	// KeyTemplateKey is the template of the object keys.
+	KeyTemplateKey = "s3-key-template"
+	// CompressionKey is the compression of the objects.
+	CompressionKey = "s3-compression"
+	// MaxSizeKey is the size after which an object is rotated.
+	MaxSizeKey = "s3-max-size"
+	// MaxAgeKey is the age after which an object is rotated.
+	MaxAgeKey = "s3-max-age"
+	// StagingDirKey is the directory to stage the objects in until they are uploaded.
+	StagingDirKey = "s3-staging-dir"
+
+	// GzipCompression compresses the objects with gzip.
+	GzipCompression = "gzip"
+	// ZstdCompression compresses the objects with zstd.
+	ZstdCompression = "zstd"
+	// NoCompression doesn't compress the objects.
+	NoCompression = "none"
+
+	// DefaultKeyTemplate is the default template of the object keys.
+	DefaultKeyTemplate = "{{.ContainerName}}/{{.ContainerID}}/{{.Date}}/{{.Time}}-{{.Sequence}}{{.Extension}}"
+	defaultMaxSize     = "64m"
+	defaultMaxAge      = 5 * time.Minute
+)
+
+// Args represents s3 log driver arguments.
+type Args struct {
+	// Required arguments.
+	Bucket string
+	Region string
+
+	// Optional arguments.
+	Endpoint            string
+	CredentialsEndpoint string
+	ForcePathStyle      string
+	KeyTemplate         string
+	Compression         string
+	MaxSize             string
+	MaxAge              string
+	StagingDir          string
+}
+
+// LoggerArgs stores global logger args and s3 specific args.
+type LoggerArgs struct {
+	globalArgs *logger.GlobalArgs
+	args       *Args
+}
+
+// InitLogger initializes the input arguments.
+func InitLogger(globalArgs *logger.GlobalArgs, s3Args *Args) *LoggerArgs {
+	return &LoggerArgs{
+		globalArgs: globalArgs,
+		args:       s3Args,
+	}
+}
+
+// RunLogDriver initiates the s3 driver and starts archiving container logs to the bucket.
+// Errors with the log driver are logged but not returned to prevent container termination.
+func (la *LoggerArgs) RunLogDriver(ctx context.Context, config *logging.Config, ready func() error) error {
+	defer debug.DeferFuncForRunLogDriver()
+
+	stream, err := la.newStream(ctx)
+	if err != nil {
+		debug.ErrLogger = err
+		return debug.ErrLogger
+	}
+	// Upload the object which is being written before exiting.
+	defer stream.Close() //nolint:errcheck // errors are already logged
+
+	l, err := logger.NewPipelineLogger(la.globalArgs, config, logger.NewInfo(la.globalArgs.ContainerID, la.globalArgs.ContainerName), stream)
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("unable to create s3 driver: %w", err)
+		return debug.ErrLogger
+	}
+
+	// Start s3 driver
+	debug.SendEventsToLog(logger.DaemonName, "Starting s3 driver", debug.INFO, 0)
+	err = l.Start(ctx, la.globalArgs.CleanupTime, ready)
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("failed to run s3 driver: %w", err)
+		// Do not return error if log driver has issue sending logs to destination, because if error
+		// returned here, containerd will identify this error and kill shim process, which will kill
+		// the container process accordingly.
+		// Note: the container will continue to run if shim logger exits after.
+		// Reference: https://github.com/containerd/containerd/blob/release/1.3/runtime/v2/logging/logging.go
+		return nil
+	}
+	debug.SendEventsToLog(logger.DaemonName, "Logging finished", debug.INFO, 1)
+
+	return nil
+}
+
+// NewStream creates the s3 stream, which is used when fanning out to multiple log drivers.
+func (la *LoggerArgs) NewStream() (logger.Client, error) {
+	stream, err := la.newStream(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// newStream validates the log options and creates the s3 stream.
+func (la *LoggerArgs) newStream(ctx context.Context) (*archiver, error) {
+	cfg, err := getS3Config(la.args, la.globalArgs.ContainerID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to validate log options: %w", err)
+	}
+	u, err := newS3Uploader(ctx, la.args, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create stream: %w", err)
+	}
+	stream, err := newArchiver(cfg, la.globalArgs, u)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create stream: %w", err)
+	}
+
+	return stream, nil
+}
+
+// config is the validated s3 log driver arguments.
+type config struct {
+	bucket         string
+	forcePathStyle bool
+	keyTemplate    *template.Template
+	compression    string
+	maxSize        int64
+	maxAge         time.Duration
+	// stagingDir is the staging directory of the container.
+	stagingDir string
+}
+
+// getS3Config validates the s3 log driver arguments and sets the default values. The objects of
+// every container are staged in their own directory, under the staging directory.
+func getS3Config(args *Args, containerID string) (*config, error) {
+	cfg := &config{
+		bucket:      args.Bucket,
+		compression: args.Compression,
+		maxAge:      defaultMaxAge,
+	}
+
+	if args.ForcePathStyle != "" {
+		forcePathStyle, err := strconv.ParseBool(args.ForcePathStyle)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", ForcePathStyleKey, args.ForcePathStyle, err)
+		}
+		cfg.forcePathStyle = forcePathStyle
+	}
+
+	keyTemplate := args.KeyTemplate
+	if keyTemplate == "" {
+		keyTemplate = DefaultKeyTemplate
+	}
+	tmpl, err := template.New("key").Option("missingkey=error").Parse(keyTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", KeyTemplateKey, keyTemplate, err)
+	}
+	cfg.keyTemplate = tmpl
+
+	switch cfg.compression {
+	case "":
+		cfg.compression = GzipCompression
+	case GzipCompression, ZstdCompression, NoCompression:
+	default:
+		return nil, fmt.Errorf("unknown %s: %s", CompressionKey, args.Compression)
+	}
+
+	maxSize := args.MaxSize
+	if maxSize == "" {
+		maxSize = defaultMaxSize
+	}
+	cfg.maxSize, err = units.RAMInBytes(maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", MaxSizeKey, maxSize, err)
+	}
+	if cfg.maxSize <= 0 {
+		return nil, fmt.Errorf("invalid %s %s: must be positive", MaxSizeKey, maxSize)
+	}
+
+	if args.MaxAge != "" {
+		cfg.maxAge, err = time.ParseDuration(args.MaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", MaxAgeKey, args.MaxAge, err)
+		}
+		if cfg.maxAge <= 0 {
+			return nil, fmt.Errorf("invalid %s %s: must be positive", MaxAgeKey, args.MaxAge)
+		}
+	}
+
+	stagingDir := args.StagingDir
+	if stagingDir == "" {
+		stagingDir = filepath.Join(os.TempDir(), logger.DaemonName, DriverName)
+	}
+	cfg.stagingDir = filepath.Join(stagingDir, containerID)
+
+	// Render the key template once, so that errors are reported before any log line is written.
+	if _, err := cfg.objectKey(keyFields{}); err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", KeyTemplateKey, keyTemplate, err)
+	}
+
+	return cfg, nil
+}
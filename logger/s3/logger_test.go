@@ -0,0 +1,88 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package s3
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testContainerID   = "test-container-id"
+	testContainerName = "test-container-name"
+	testBucket        = "test-bucket"
+	testRegion        = "us-west-2"
+)
+
+// TestGetS3Config tests that the s3 log driver arguments are validated, and that the default
+// values are set.
+func TestGetS3Config(t *testing.T) {
+	cfg, err := getS3Config(&Args{Bucket: testBucket, Region: testRegion}, testContainerID)
+	require.NoError(t, err)
+	require.Equal(t, testBucket, cfg.bucket)
+	require.False(t, cfg.forcePathStyle)
+	require.Equal(t, GzipCompression, cfg.compression)
+	require.Equal(t, int64(64*1024*1024), cfg.maxSize)
+	require.Equal(t, defaultMaxAge, cfg.maxAge)
+	require.Equal(t, testContainerID, filepath.Base(cfg.stagingDir))
+
+	key, err := cfg.objectKey(keyFields{
+		ContainerName: testContainerName,
+		ContainerID:   testContainerID,
+		Date:          "2020-01-14",
+		Time:          "015900",
+		Sequence:      "0000000001",
+		Extension:     cfg.extension(),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "test-container-name/test-container-id/2020-01-14/015900-0000000001.ndjson.gz", key)
+
+	stagingDir := t.TempDir()
+	cfg, err = getS3Config(&Args{
+		Bucket:         testBucket,
+		Region:         testRegion,
+		ForcePathStyle: "true",
+		KeyTemplate:    "/logs/{{.Date}}/{{.ContainerID}}-{{.Sequence}}{{.Extension}}",
+		Compression:    ZstdCompression,
+		MaxSize:        "1m",
+		MaxAge:         "1h",
+		StagingDir:     stagingDir,
+	}, testContainerID)
+	require.NoError(t, err)
+	require.True(t, cfg.forcePathStyle)
+	require.Equal(t, int64(1024*1024), cfg.maxSize)
+	require.Equal(t, time.Hour, cfg.maxAge)
+	require.Equal(t, filepath.Join(stagingDir, testContainerID), cfg.stagingDir)
+	key, err = cfg.objectKey(keyFields{ContainerID: testContainerID, Date: "2020-01-14", Sequence: "0000000002",
+		Extension: cfg.extension()})
+	require.NoError(t, err)
+	require.Equal(t, "logs/2020-01-14/test-container-id-0000000002.ndjson.zst", key)
+}
+
+// TestGetS3ConfigValidationError tests that invalid s3 log driver arguments are rejected.
+func TestGetS3ConfigValidationError(t *testing.T) {
+	for name, args := range map[string]*Args{
+		"force path style": {ForcePathStyle: "yes"},
+		"key template":     {KeyTemplate: "{{.Date"},
+		"key field":        {KeyTemplate: "{{.Hostname}}"},
+		"compression":      {Compression: "lz4"},
+		"max size":         {MaxSize: "big"},
+		"zero max size":    {MaxSize: "0"},
+		"max age":          {MaxAge: "1"},
+		"negative max age": {MaxAge: "-1m"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			args.Bucket = testBucket
+			args.Region = testRegion
+			_, err := getS3Config(args, testContainerID)
+			require.Error(t, err)
+		})
+	}
+}
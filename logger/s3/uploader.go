@@ -0,0 +1,151 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !no_s3
+
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/endpointcreds"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// partSize is the size of the parts of a multipart upload. Objects which are not larger are
+	// uploaded with a single PutObject request.
+	partSize = 8 * 1024 * 1024
+	// uploadTimeout bounds how long uploading an object takes, including the retries of the SDK.
+	uploadTimeout = 5 * time.Minute
+	// credentialsEndpointHost is the host of the credentials endpoint on the ECS agent, in the
+	// same way as the moby awslogs log driver.
+	credentialsEndpointHost = "http://169.254.170.2"
+	contentType             = "application/x-ndjson"
+)
+
+// s3Uploader uploads staged objects to the bucket.
+type s3Uploader struct {
+	client          *awss3.Client
+	bucket          string
+	contentEncoding *string
+	partSize        int64
+}
+
+// newS3Uploader creates an uploader with the AWS config loaded in the same way as the moby
+// awslogs log driver, i.e. with the credentials served by the ECS agent if the credentials
+// endpoint is set, or with the default credentials chain otherwise.
+func newS3Uploader(ctx context.Context, args *Args, cfg *config) (*s3Uploader, error) {
+	opts := []func(*awsconfig.LoadOptions) error{awsconfig.WithRegion(args.Region)}
+	if args.CredentialsEndpoint != "" {
+		provider := endpointcreds.New(credentialsEndpointHost + args.CredentialsEndpoint)
+		opts = append(opts, awsconfig.WithCredentialsProvider(aws.NewCredentialsCache(provider)))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load AWS config: %w", err)
+	}
+
+	u := &s3Uploader{
+		client: awss3.NewFromConfig(awsCfg, func(o *awss3.Options) {
+			if args.Endpoint != "" {
+				o.BaseEndpoint = aws.String(args.Endpoint)
+			}
+			o.UsePathStyle = cfg.forcePathStyle
+		}),
+		bucket:   cfg.bucket,
+		partSize: partSize,
+	}
+	if cfg.compression != NoCompression {
+		u.contentEncoding = aws.String(cfg.compression)
+	}
+	return u, nil
+}
+
+// upload uploads the first size bytes of the file, with a multipart upload if they don't fit in
+// a single part.
+func (u *s3Uploader) upload(key string, f *os.File, size int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+	defer cancel()
+
+	if size <= u.partSize {
+		_, err := u.client.PutObject(ctx, &awss3.PutObjectInput{
+			Bucket:          aws.String(u.bucket),
+			Key:             aws.String(key),
+			Body:            io.NewSectionReader(f, 0, size),
+			ContentLength:   aws.Int64(size),
+			ContentType:     aws.String(contentType),
+			ContentEncoding: u.contentEncoding,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to upload object %s: %w", key, err)
+		}
+		return nil
+	}
+
+	created, err := u.client.CreateMultipartUpload(ctx, &awss3.CreateMultipartUploadInput{
+		Bucket:            aws.String(u.bucket),
+		Key:               aws.String(key),
+		ContentType:       aws.String(contentType),
+		ContentEncoding:   u.contentEncoding,
+		ChecksumAlgorithm: types.ChecksumAlgorithmCrc32,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create multipart upload of object %s: %w", key, err)
+	}
+	if err := u.uploadParts(ctx, key, created.UploadId, f, size); err != nil {
+		// Abort the multipart upload, so that the parts which are uploaded are not billed.
+		abortCtx, abortCancel := context.WithTimeout(context.Background(), time.Minute)
+		defer abortCancel()
+		_, _ = u.client.AbortMultipartUpload(abortCtx, &awss3.AbortMultipartUploadInput{
+			Bucket:   aws.String(u.bucket),
+			Key:      aws.String(key),
+			UploadId: created.UploadId,
+		})
+		return fmt.Errorf("unable to upload object %s: %w", key, err)
+	}
+	return nil
+}
+
+// uploadParts uploads the parts of a multipart upload, and completes it.
+func (u *s3Uploader) uploadParts(ctx context.Context, key string, uploadID *string, f *os.File, size int64) error {
+	var parts []types.CompletedPart
+	for offset, partNumber := int64(0), int32(1); offset < size; offset, partNumber = offset+u.partSize, partNumber+1 {
+		length := min(u.partSize, size-offset)
+		uploaded, err := u.client.UploadPart(ctx, &awss3.UploadPartInput{
+			Bucket:            aws.String(u.bucket),
+			Key:               aws.String(key),
+			UploadId:          uploadID,
+			PartNumber:        aws.Int32(partNumber),
+			Body:              io.NewSectionReader(f, offset, length),
+			ContentLength:     aws.Int64(length),
+			ChecksumAlgorithm: types.ChecksumAlgorithmCrc32,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to upload part %d: %w", partNumber, err)
+		}
+		parts = append(parts, types.CompletedPart{
+			ETag:          uploaded.ETag,
+			PartNumber:    aws.Int32(partNumber),
+			ChecksumCRC32: uploaded.ChecksumCRC32,
+		})
+	}
+
+	_, err := u.client.CompleteMultipartUpload(ctx, &awss3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(u.bucket),
+		Key:             aws.String(key),
+		UploadId:        uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to complete multipart upload: %w", err)
+	}
+	return nil
+}
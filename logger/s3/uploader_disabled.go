@@ -0,0 +1,16 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build no_s3
+
+package s3
+
+import (
+	"context"
+	"errors"
+)
+
+// newS3Uploader fails, since the shim logger is built with the no_s3 build tag.
+func newS3Uploader(_ context.Context, _ *Args, _ *config) (uploader, error) {
+	return nil, errors.New("the s3 driver is not built in this shim logger")
+}
@@ -0,0 +1,106 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit && !no_s3
+// +build unit,!no_s3
+
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 is a bucket supporting PutObject and multipart uploads, addressed in the path style.
+type fakeS3 struct {
+	lock    sync.Mutex
+	objects map[string][]byte
+	parts   map[string][][]byte
+	puts    int
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/"+testBucket+"/")
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.parts[key] = nil
+		_, _ = w.Write([]byte("<InitiateMultipartUploadResult><Bucket>" + testBucket + "</Bucket><Key>" + key +
+			"</Key><UploadId>test-upload-id</UploadId></InitiateMultipartUploadResult>"))
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		s.parts[key] = append(s.parts[key], body)
+		w.Header().Set("ETag", "\"etag-"+query.Get("partNumber")+"\"")
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &complete); err != nil || len(complete.Parts) != len(s.parts[key]) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.objects[key] = bytes.Join(s.parts[key], nil)
+		_, _ = w.Write([]byte("<CompleteMultipartUploadResult><Bucket>" + testBucket + "</Bucket><Key>" + key +
+			"</Key><ETag>\"etag\"</ETag></CompleteMultipartUploadResult>"))
+	case r.Method == http.MethodPut:
+		s.puts++
+		s.objects[key] = body
+		w.Header().Set("ETag", "\"etag\"")
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// TestS3Uploader tests that small objects are uploaded with PutObject, and large ones with a
+// multipart upload.
+func TestS3Uploader(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_ACCESS_KEY_ID", "test-access-key-id")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test-secret-access-key")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	s := &fakeS3{objects: make(map[string][]byte), parts: make(map[string][][]byte)}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	args := &Args{Bucket: testBucket, Region: testRegion, Endpoint: server.URL, ForcePathStyle: "true"}
+	cfg, err := getS3Config(args, testContainerID)
+	require.NoError(t, err)
+	u, err := newS3Uploader(context.Background(), args, cfg)
+	require.NoError(t, err)
+	u.partSize = 10
+
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	path := filepath.Join(dir, "object")
+	require.NoError(t, os.WriteFile(path, append(content, "not committed"...), 0o600))
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	require.NoError(t, u.upload("small", f, 10))
+	require.NoError(t, u.upload("large", f, int64(len(content))))
+	require.Equal(t, 1, s.puts)
+	require.Equal(t, content[:10], s.objects["small"])
+	require.Len(t, s.parts["large"], 4)
+	require.Equal(t, content, s.objects["large"])
+}
@@ -0,0 +1,309 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+)
+
+const (
+	// spillDirMode is the permission mode of the directory holding the spill segments.
+	// Owner=rwx, group=none, other=none, since the segments hold container logs.
+	spillDirMode = os.FileMode(0o700)
+	// spillSegmentNameFormat is the name format of a spill segment. Segments are named by an
+	// increasing sequence number so that they can be replayed in order.
+	spillSegmentNameFormat = "segment-%020d.log"
+)
+
+// errSpillQueueFull is returned when saving a log message to the spill queue would exceed its max size.
+var errSpillQueueFull = errors.New("spill queue is full")
+
+// spillQueue is an on-disk queue of log messages, used to hold the log messages that don't fit
+// into the ring buffer. Log messages are appended to size-capped segment files, and are read back
+// in order. A segment file is deleted after all of its log messages are sent to the destination.
+//
+// spillQueue is not safe for concurrent use, it's protected by the lock of the ring buffer.
+type spillQueue struct {
+	// dir is the directory holding the segment files of a single container.
+	dir string
+	// maxSegmentSizeInBytes is the size of a segment file after which a new one is started.
+	maxSegmentSizeInBytes int64
+	// maxSizeInBytes is the maximum total size of all segment files.
+	maxSizeInBytes int64
+	// curSizeInBytes is the current total size of all segment files.
+	curSizeInBytes int64
+	// len is the number of log messages which are saved but not read yet.
+	len int
+
+	// segments saves the sequence numbers of all segment files, the oldest one first.
+	segments []uint64
+	// nextSegment is the sequence number of the next segment file to create.
+	nextSegment uint64
+
+	// writer is the segment file log messages are appended to. It's always the newest segment.
+	writer            *os.File
+	writerSizeInBytes int64
+
+	// reader is the segment file log messages are read from. It's always the oldest segment.
+	reader        *os.File
+	readerDecoder *json.Decoder
+	// readerDone indicates that all log messages of the reader segment are read, so that it
+	// can be deleted once the last of them is sent to the destination.
+	readerDone bool
+}
+
+// newSpillQueue creates a spill queue saving segment files under the given directory.
+func newSpillQueue(dir string, maxSegmentSize, maxSize int) *spillQueue {
+	return &spillQueue{
+		dir:                   dir,
+		maxSegmentSizeInBytes: int64(maxSegmentSize),
+		maxSizeInBytes:        int64(maxSize),
+	}
+}
+
+// open prepares the directory for the segment files. Segment files left by a previous run, e.g.
+// because the destination was unavailable when it exited, are recovered so that their log
+// messages are read before the new ones, or removed if they are replayed by other means.
+func (q *spillQueue) open(replay bool) error {
+	if !replay {
+		if err := os.RemoveAll(q.dir); err != nil {
+			return fmt.Errorf("unable to remove stale spill directory %s: %w", q.dir, err)
+		}
+	}
+	if err := os.MkdirAll(q.dir, spillDirMode); err != nil {
+		return fmt.Errorf("unable to create spill directory %s: %w", q.dir, err)
+	}
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return fmt.Errorf("unable to read spill directory %s: %w", q.dir, err)
+	}
+	// Segment files are named by a zero-padded sequence number, so they are sorted by it.
+	for _, entry := range entries {
+		var seq uint64
+		if _, err := fmt.Sscanf(entry.Name(), spillSegmentNameFormat, &seq); err != nil ||
+			entry.Name() != fmt.Sprintf(spillSegmentNameFormat, seq) {
+			continue
+		}
+		if err := q.recoverSegment(seq); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recoverSegment adds a segment file left by a previous run to the queue. A log message cut short when
+// the previous run exited is truncated, and a segment file without log messages is deleted.
+func (q *spillQueue) recoverSegment(seq uint64) error {
+	path := q.segmentPath(seq)
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("unable to open spill segment %s: %w", path, err)
+	}
+	defer f.Close() //nolint:errcheck // nothing is buffered to be written on close
+
+	decoder := json.NewDecoder(bufio.NewReader(f))
+	var count int
+	var size int64
+	for {
+		msg := dockerlogger.NewMessage()
+		if err := decoder.Decode(msg); err != nil {
+			break
+		}
+		count++
+		size = decoder.InputOffset()
+	}
+	if count == 0 {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("unable to delete spill segment %s: %w", path, err)
+		}
+		return nil
+	}
+	if err := f.Truncate(size); err != nil {
+		return fmt.Errorf("unable to truncate spill segment %s: %w", path, err)
+	}
+
+	q.segments = append(q.segments, seq)
+	q.nextSegment = seq + 1
+	q.len += count
+	q.curSizeInBytes += size
+	return nil
+}
+
+// close closes all the open segment files. The directory holding them is removed if all the log
+// messages are read, otherwise the log messages left are kept for the next run.
+func (q *spillQueue) close() error {
+	var err error
+	if q.reader != nil && !q.isEmpty() {
+		err = q.trimReader()
+	}
+	if q.writer != nil {
+		q.writer.Close() //nolint:errcheck,gosec // nothing is written after this
+		q.writer = nil
+	}
+	if q.reader != nil {
+		q.reader.Close() //nolint:errcheck,gosec // nothing is read after this
+		q.reader = nil
+	}
+	empty := q.isEmpty()
+	q.segments = nil
+	q.curSizeInBytes = 0
+	q.len = 0
+	if !empty {
+		return err
+	}
+	return os.RemoveAll(q.dir)
+}
+
+// trimReader removes the log messages read already from the segment file being read, so that
+// they aren't read again by the next run.
+func (q *spillQueue) trimReader() error {
+	name := q.reader.Name()
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("unable to read spill segment %s: %w", name, err)
+	}
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, b[q.readerDecoder.InputOffset():], 0o600); err != nil {
+		return fmt.Errorf("unable to write spill segment %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("unable to replace spill segment %s: %w", name, err)
+	}
+	return nil
+}
+
+// isEmpty indicates if there are log messages saved in the spill queue which are not read yet.
+func (q *spillQueue) isEmpty() bool {
+	return q.len == 0
+}
+
+// push appends a log message to the newest segment file, and starts a new segment file if the
+// current one reaches its max size.
+func (q *spillQueue) push(msg *dockerlogger.Message) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("unable to encode log message: %w", err)
+	}
+	b = append(b, newline)
+	if q.curSizeInBytes+int64(len(b)) > q.maxSizeInBytes {
+		return errSpillQueueFull
+	}
+
+	if q.writer == nil || q.writerSizeInBytes >= q.maxSegmentSizeInBytes {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := q.writer.Write(b)
+	q.writerSizeInBytes += int64(n)
+	q.curSizeInBytes += int64(n)
+	if err != nil {
+		return fmt.Errorf("unable to write log message to spill segment %s: %w", q.writer.Name(), err)
+	}
+	q.len++
+
+	return nil
+}
+
+// rotate closes the current segment file being written and starts a new one.
+func (q *spillQueue) rotate() error {
+	if q.writer != nil {
+		if err := q.writer.Close(); err != nil {
+			return fmt.Errorf("unable to close spill segment %s: %w", q.writer.Name(), err)
+		}
+		q.writer = nil
+	}
+
+	seq := q.nextSegment
+	f, err := os.OpenFile(q.segmentPath(seq), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("unable to create spill segment: %w", err)
+	}
+	q.nextSegment++
+	q.segments = append(q.segments, seq)
+	q.writer = f
+	q.writerSizeInBytes = 0
+
+	return nil
+}
+
+// pop reads the oldest log message from the spill queue. The segment file holding the log
+// message returned by the previous call is deleted if all of its log messages are read, as the
+// caller is expected to have sent it to the destination by then.
+func (q *spillQueue) pop() (*dockerlogger.Message, error) {
+	if err := q.release(); err != nil {
+		return nil, err
+	}
+	if q.isEmpty() {
+		return nil, nil //nolint: nilnil // nothing left in the queue
+	}
+
+	if q.reader == nil {
+		// Never read from the segment file which is still being written, start a new segment
+		// file for the following log messages instead.
+		if len(q.segments) == 1 && q.writer != nil {
+			if err := q.rotate(); err != nil {
+				return nil, err
+			}
+		}
+		f, err := os.Open(q.segmentPath(q.segments[0]))
+		if err != nil {
+			return nil, fmt.Errorf("unable to open spill segment: %w", err)
+		}
+		q.reader = f
+		q.readerDecoder = json.NewDecoder(bufio.NewReader(f))
+	}
+
+	msg := dockerlogger.NewMessage()
+	if err := q.readerDecoder.Decode(msg); err != nil {
+		return nil, fmt.Errorf("unable to read log message from spill segment %s: %w", q.reader.Name(), err)
+	}
+	q.len--
+	// Peek if there are more log messages left in the segment file, so that it can be deleted
+	// right after the last one is sent.
+	if !q.readerDecoder.More() {
+		q.readerDone = true
+	}
+
+	return msg, nil
+}
+
+// release deletes the segment file being read if all of its log messages are read.
+func (q *spillQueue) release() error {
+	if !q.readerDone {
+		return nil
+	}
+
+	name := q.reader.Name()
+	info, err := q.reader.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to stat spill segment %s: %w", name, err)
+	}
+	if err := q.reader.Close(); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("unable to close spill segment %s: %w", name, err)
+	}
+	if err := os.Remove(name); err != nil {
+		return fmt.Errorf("unable to delete spill segment %s: %w", name, err)
+	}
+	q.curSizeInBytes -= info.Size()
+	q.segments = q.segments[1:]
+	q.reader = nil
+	q.readerDecoder = nil
+	q.readerDone = false
+
+	return nil
+}
+
+// segmentPath returns the path of the segment file with the given sequence number.
+func (q *spillQueue) segmentPath(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf(spillSegmentNameFormat, seq))
+}
@@ -0,0 +1,156 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSpillQueuePushPop tests that spilled messages are read back in order and that segment
+// files are deleted once all of their messages are read.
+func TestSpillQueuePushPop(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), testContainerID)
+	q := newSpillQueue(dir, 100, 10000)
+	require.NoError(t, q.open(true))
+	defer q.close() //nolint:errcheck // testing only
+
+	var expected []*dockerlogger.Message
+	for i := 0; i < 10; i++ {
+		msg := newMessage([]byte(fmt.Sprintf("line%d", i)), sourceSTDOUT, dummyTime)
+		expected = append(expected, msg)
+		require.NoError(t, q.push(msg))
+	}
+	require.False(t, q.isEmpty())
+	// Each segment only holds one message since a message is larger than half of segment size.
+	segments, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, segments, 10)
+
+	for _, msg := range expected {
+		spilled, err := q.pop()
+		require.NoError(t, err)
+		require.Equal(t, string(msg.Line), string(spilled.Line))
+		require.Equal(t, msg.Source, spilled.Source)
+		require.True(t, msg.Timestamp.Equal(spilled.Timestamp))
+	}
+	require.True(t, q.isEmpty())
+
+	// The last segment is deleted on the next read.
+	msg, err := q.pop()
+	require.NoError(t, err)
+	require.Nil(t, msg)
+	segments, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	// Only the segment started for new messages is left.
+	require.Len(t, segments, 1)
+	require.Zero(t, q.curSizeInBytes)
+
+	require.NoError(t, q.close())
+	require.NoDirExists(t, dir)
+}
+
+// TestSpillQueueReplay tests that the messages left in the spill queue when it's closed are read
+// first by the next run, without the ones read already and the one cut short, unless they are
+// replayed by other means.
+func TestSpillQueueReplay(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), testContainerID)
+	q := newSpillQueue(dir, 1024, 10000)
+	require.NoError(t, q.open(true))
+	for i := 0; i < 4; i++ {
+		require.NoError(t, q.push(newMessage([]byte(fmt.Sprintf("line%d", i)), sourceSTDOUT, dummyTime)))
+	}
+	msg, err := q.pop()
+	require.NoError(t, err)
+	require.Equal(t, "line0", string(msg.Line))
+	// The segment read from keeps the messages not read yet.
+	require.NoError(t, q.close())
+	require.DirExists(t, dir)
+
+	// Simulate a log message cut short while it was written.
+	f, err := os.OpenFile(q.segmentPath(q.nextSegment), os.O_CREATE|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"Line":"bGlu`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	q = newSpillQueue(dir, 1024, 10000)
+	require.NoError(t, q.open(true))
+	require.Equal(t, 3, q.len)
+	require.NoError(t, q.push(newMessage([]byte("line4"), sourceSTDOUT, dummyTime)))
+
+	var replayed []string
+	for !q.isEmpty() {
+		msg, err := q.pop()
+		require.NoError(t, err)
+		replayed = append(replayed, string(msg.Line))
+	}
+	require.Equal(t, []string{"line1", "line2", "line3", "line4"}, replayed)
+	require.NoError(t, q.close())
+	require.NoDirExists(t, dir)
+
+	// The messages left aren't recovered if they are replayed by other means.
+	require.NoError(t, q.open(true))
+	require.NoError(t, q.push(newMessage([]byte("line5"), sourceSTDOUT, dummyTime)))
+	require.NoError(t, q.close())
+	q = newSpillQueue(dir, 1024, 10000)
+	require.NoError(t, q.open(false))
+	require.True(t, q.isEmpty())
+	require.NoError(t, q.close())
+}
+
+// TestSpillQueueFull tests that a message is not spilled if the spill queue reaches its max size.
+func TestSpillQueueFull(t *testing.T) {
+	q := newSpillQueue(filepath.Join(t.TempDir(), testContainerID), 100, 200)
+	require.NoError(t, q.open(true))
+	defer q.close() //nolint:errcheck // testing only
+
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		err = q.push(newMessage([]byte(fmt.Sprintf("line%d", i)), sourceSTDOUT, dummyTime))
+	}
+	require.ErrorIs(t, err, errSpillQueueFull)
+	require.LessOrEqual(t, q.curSizeInBytes, int64(200))
+}
+
+// TestLogBufferSpill tests that messages which don't fit into the buffer are spilled to disk and
+// dequeued in order after the ones in memory.
+func TestLogBufferSpill(t *testing.T) {
+	lb := newLoggerBuffer(10)
+	lb.spill = newSpillQueue(filepath.Join(t.TempDir(), testContainerID), 1024, 4096)
+	require.NoError(t, lb.spill.open(true))
+	defer lb.spill.close() //nolint:errcheck // testing only
+
+	lines := []string{"line1", "line2", "line3", "line4", "line5"}
+	for _, line := range lines {
+		require.NoError(t, lb.Enqueue(newMessage([]byte(line), sourceSTDOUT, dummyTime)))
+	}
+	// Only the first two messages fit into memory.
+	require.Len(t, lb.queue, 2)
+	require.Equal(t, 3, lb.spill.len)
+
+	for _, line := range lines[:4] {
+		msg, err := lb.Dequeue()
+		require.NoError(t, err)
+		require.Equal(t, line, string(msg.Line))
+	}
+	// New messages keep being spilled until the spill queue is drained.
+	require.NoError(t, lb.Enqueue(newMessage([]byte("line6"), sourceSTDOUT, dummyTime)))
+	require.Empty(t, lb.queue)
+
+	var flushed []string
+	require.NoError(t, lb.FlushSpilled(func(msg *dockerlogger.Message) error {
+		flushed = append(flushed, string(msg.Line))
+		return nil
+	}))
+	require.Equal(t, []string{"line5", "line6"}, flushed)
+}
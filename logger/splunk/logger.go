@@ -96,40 +96,18 @@ func InitLogger(globalArgs *logger.GlobalArgs, dockerConfigs *logger.DockerConfi
 func (la *LoggerArgs) RunLogDriver(ctx context.Context, config *logging.Config, ready func() error) error {
 	defer debug.DeferFuncForRunLogDriver()
 
-	loggerConfig, err := getSplunkConfig(la.args)
-	if err != nil {
-		debug.ErrLogger = fmt.Errorf("unable to validate log options: %w", err)
-		return debug.ErrLogger
-	}
-	info := logger.NewInfo(
-		la.globalArgs.ContainerID,
-		la.globalArgs.ContainerName,
-		logger.WithConfig(loggerConfig),
-	)
-	info = logger.UpdateDockerConfigs(info, la.dockerConfigs)
-
-	stream, err := dockersplunk.New(*info)
+	info, stream, err := la.newStream()
 	if err != nil {
-		debug.ErrLogger = fmt.Errorf("unable to create stream: %w", err)
+		debug.ErrLogger = err
 		return debug.ErrLogger
 	}
 
-	l, err := logger.NewLogger(
-		logger.WithStdout(config.Stdout),
-		logger.WithStderr(config.Stderr),
-		logger.WithInfo(info),
-		logger.WithStream(stream),
-	)
+	l, err := logger.NewPipelineLogger(la.globalArgs, config, info, stream)
 	if err != nil {
 		debug.ErrLogger = fmt.Errorf("unable to create splunk log driver: %w", err)
 		return debug.ErrLogger
 	}
 
-	if la.globalArgs.Mode == logger.NonBlockingMode {
-		debug.SendEventsToLog(logger.DaemonName, "Starting non-blocking mode driver", debug.INFO, 0)
-		l = logger.NewBufferedLogger(l, logger.DefaultBufSizeInBytes, la.globalArgs.MaxBufferSize, la.globalArgs.ContainerID)
-	}
-
 	// Start splunk log driver.
 	debug.SendEventsToLog(logger.DaemonName, "Starting splunk driver", debug.INFO, 0)
 	err = l.Start(ctx, la.globalArgs.CleanupTime, ready)
@@ -147,6 +125,32 @@ func (la *LoggerArgs) RunLogDriver(ctx context.Context, config *logging.Config,
 	return nil
 }
 
+// NewStream creates the splunk stream, which is used when fanning out to multiple log drivers.
+func (la *LoggerArgs) NewStream() (logger.Client, error) {
+	_, stream, err := la.newStream()
+	return stream, err
+}
+
+// newStream validates the log options and creates the splunk stream along with its info.
+func (la *LoggerArgs) newStream() (*dockerlogger.Info, dockerlogger.Logger, error) {
+	loggerConfig, err := getSplunkConfig(la.args)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to validate log options: %w", err)
+	}
+	info := logger.NewInfo(
+		la.globalArgs.ContainerID,
+		la.globalArgs.ContainerName,
+		logger.WithConfig(loggerConfig),
+	)
+	info = logger.UpdateDockerConfigs(info, la.dockerConfigs)
+	stream, err := dockersplunk.New(*info)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create stream: %w", err)
+	}
+
+	return info, stream, nil
+}
+
 // getSplunkConfig sets values for splunk config.
 func getSplunkConfig(arg *Args) (map[string]string, error) {
 	config := make(map[string]string)
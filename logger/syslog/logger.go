@@ -0,0 +1,216 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package syslog provides a log driver sending container logs to a syslog server, either the
+// local one or a remote one over UDP, TCP or TCP with TLS.
+//
+// The log options are the ones of the moby syslog log driver, along with the framing of the log
+// messages. The moby syslog log driver only uses octet-counted framing for RFC 5424 log messages
+// over TCP with TLS, so the stream is built here rather than by moby.
+package syslog
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/containerd/containerd/runtime/v2/logging"
+	dockerlogger "github.com/docker/docker/daemon/logger"
+
+	"github.com/aws/shim-loggers-for-containerd/debug"
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+const (
+	// DriverName is the name of the syslog log driver.
+	DriverName = "syslog"
+
+	// AddressKey is the address of the syslog server, in the format of
+	// `[udp|tcp|tcp+tls]://host[:port]` or `[unix|unixgram]://path`. Logs are sent to the local
+	// syslog server when it's not set.
+	AddressKey = "syslog-address"
+	// FacilityKey is the syslog facility, either a name such as `daemon` or a number between 0
+	// and 23.
+	FacilityKey = "syslog-facility"
+	// FormatKey is the format of the log messages, either `rfc3164`, `rfc5424` or `rfc5424micro`.
+	FormatKey = "syslog-format"
+	// FramingKey is how log messages are separated in the stream, either `non-transparent` or
+	// `octet-counted`, as described in RFC 6587.
+	FramingKey = "syslog-framing"
+	// TLSCACertKey is the path of the CA certificate to verify the syslog server with.
+	TLSCACertKey = "syslog-tls-ca-cert"
+	// TLSCertKey is the path of the client certificate.
+	TLSCertKey = "syslog-tls-cert"
+	// TLSKeyKey is the path of the client key.
+	TLSKeyKey = "syslog-tls-key"
+	// TLSSkipVerifyKey skips verifying the certificate of the syslog server when it's set.
+	TLSSkipVerifyKey = "syslog-tls-skip-verify"
+	// SyslogTagKey specifies the tag template of the log messages.
+	SyslogTagKey = "syslog-tag"
+
+	// Convert input parameter "syslog-tag" to the syslog parameter "tag".
+	// This is to distinguish between the "tag" parameter from the other log drivers.
+	tagKey = "tag"
+)
+
+// Supported values of the format and framing arguments.
+const (
+	RFC3164Format      = "rfc3164"
+	RFC5424Format      = "rfc5424"
+	RFC5424MicroFormat = "rfc5424micro"
+
+	NonTransparentFraming = "non-transparent"
+	OctetCountedFraming   = "octet-counted"
+)
+
+const (
+	// maxUDPPayloadBytes is the max size of the payload of a UDP datagram over IPv4.
+	maxUDPPayloadBytes = 65507
+	// udpOverheadBytes leaves room in a datagram for the header of a log message.
+	udpOverheadBytes = 1024
+	// MaximumUDPBytesPerEvent is the max size of a log line sent over UDP.
+	MaximumUDPBytesPerEvent = maxUDPPayloadBytes - udpOverheadBytes
+)
+
+// Args represents syslog log driver arguments.
+type Args struct {
+	// Optional arguments
+	Address       string
+	Facility      string
+	Format        string
+	Framing       string
+	TLSCACert     string
+	TLSCert       string
+	TLSKey        string
+	TLSSkipVerify string
+	Tag           string
+	// TagSpecified represents whether a syslog tag was specified. Used to differentiate
+	// between the default empty string and an explicitly-set empty tag, mirroring the splunk
+	// driver's pattern.
+	TagSpecified bool
+}
+
+// LoggerArgs stores global logger args, docker configs and syslog specific args.
+type LoggerArgs struct {
+	globalArgs    *logger.GlobalArgs
+	dockerConfigs *logger.DockerConfigs
+	args          *Args
+}
+
+// InitLogger initializes the input arguments.
+func InitLogger(globalArgs *logger.GlobalArgs, dockerConfigs *logger.DockerConfigs, syslogArgs *Args) *LoggerArgs {
+	return &LoggerArgs{
+		globalArgs:    globalArgs,
+		dockerConfigs: dockerConfigs,
+		args:          syslogArgs,
+	}
+}
+
+// RunLogDriver initializes and starts the syslog logger.
+// Errors with the log driver are logged but not returned to prevent container termination.
+func (la *LoggerArgs) RunLogDriver(ctx context.Context, config *logging.Config, ready func() error) error {
+	defer debug.DeferFuncForRunLogDriver()
+
+	info, stream, err := la.newStream()
+	if err != nil {
+		debug.ErrLogger = err
+		return debug.ErrLogger
+	}
+	defer stream.Close() //nolint:errcheck // nothing is left to send once logging finished
+
+	l, err := logger.NewPipelineLogger(la.globalArgs, config, info, stream,
+		logger.WithMaxBytesPerEvent(la.MaxBytesPerEvent()))
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("unable to create syslog driver: %w", err)
+		return debug.ErrLogger
+	}
+
+	// Start syslog driver
+	debug.SendEventsToLog(logger.DaemonName, "Starting syslog driver", debug.INFO, 0)
+	err = l.Start(ctx, la.globalArgs.CleanupTime, ready)
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("failed to run syslog driver: %w", err)
+		// Do not return error if log driver has issue sending logs to destination, because if error
+		// returned here, containerd will identify this error and kill shim process, which will kill
+		// the container process accordingly.
+		// Note: the container will continue to run if shim logger exits after.
+		// Reference: https://github.com/containerd/containerd/blob/release/1.3/runtime/v2/logging/logging.go
+		return nil
+	}
+	debug.SendEventsToLog(logger.DaemonName, "Logging finished", debug.INFO, 1)
+
+	return nil
+}
+
+// MaxBytesPerEvent returns the max size of a log line sent to the syslog server, which is only
+// limited over UDP.
+func (la *LoggerArgs) MaxBytesPerEvent() int {
+	if strings.HasPrefix(la.args.Address, udpProto+"://") {
+		return MaximumUDPBytesPerEvent
+	}
+	return 0
+}
+
+// NewStream creates the syslog stream, which is used when fanning out to multiple log drivers.
+func (la *LoggerArgs) NewStream() (logger.Client, error) {
+	_, stream, err := la.newStream()
+	return stream, err
+}
+
+// newStream validates the log options and creates the syslog stream along with its info.
+func (la *LoggerArgs) newStream() (*dockerlogger.Info, dockerlogger.Logger, error) {
+	loggerConfig, err := getSyslogConfig(la.args)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to validate log options: %w", err)
+	}
+	info := logger.NewInfo(
+		la.globalArgs.ContainerID,
+		la.globalArgs.ContainerName,
+		logger.WithConfig(loggerConfig),
+	)
+	info = logger.UpdateDockerConfigs(info, la.dockerConfigs)
+	stream, err := newSyslogger(*info)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create stream: %w", err)
+	}
+
+	return info, stream, nil
+}
+
+// getSyslogConfig sets values for syslog config and validates them. Optional fields are only
+// set when non-empty, in the same way as the moby syslog log driver expects them.
+func getSyslogConfig(arg *Args) (map[string]string, error) {
+	config := make(map[string]string)
+	if arg.Address != "" {
+		config[AddressKey] = arg.Address
+	}
+	if arg.Facility != "" {
+		config[FacilityKey] = arg.Facility
+	}
+	if arg.Format != "" {
+		config[FormatKey] = arg.Format
+	}
+	if arg.Framing != "" {
+		config[FramingKey] = arg.Framing
+	}
+	if arg.TLSCACert != "" {
+		config[TLSCACertKey] = arg.TLSCACert
+	}
+	if arg.TLSCert != "" {
+		config[TLSCertKey] = arg.TLSCert
+	}
+	if arg.TLSKey != "" {
+		config[TLSKeyKey] = arg.TLSKey
+	}
+	if arg.TLSSkipVerify != "" {
+		config[TLSSkipVerifyKey] = arg.TLSSkipVerify
+	}
+	if arg.TagSpecified {
+		config[tagKey] = arg.Tag
+	}
+
+	if err := validateLogOpt(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
@@ -0,0 +1,147 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package syslog
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+const (
+	testContainerID   = "test-container-id"
+	testContainerName = "test-container-name"
+	testImageName     = "test-image-name"
+)
+
+func TestGetSyslogConfig(t *testing.T) {
+	config, err := getSyslogConfig(&Args{
+		Address:       "tcp://localhost",
+		Facility:      "local0",
+		Format:        RFC5424Format,
+		Framing:       OctetCountedFraming,
+		TLSSkipVerify: "false",
+		Tag:           "{{.ImageName}}",
+		TagSpecified:  true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		AddressKey:       "tcp://localhost",
+		FacilityKey:      "local0",
+		FormatKey:        RFC5424Format,
+		FramingKey:       OctetCountedFraming,
+		TLSSkipVerifyKey: "false",
+		tagKey:           "{{.ImageName}}",
+	}, config)
+
+	config, err = getSyslogConfig(&Args{})
+	require.NoError(t, err)
+	require.Empty(t, config)
+}
+
+// TestGetSyslogConfigValidationError tests that getSyslogConfig returns an error for invalid
+// log options.
+func TestGetSyslogConfigValidationError(t *testing.T) {
+	for _, args := range []*Args{
+		{Address: "http://localhost"},
+		{Address: "tcp://"},
+		{Address: "unix:///does/not/exist"},
+		{Facility: "local8"},
+		{Format: "rfc9999"},
+		{Framing: "length-prefixed"},
+		{Address: "udp://localhost", Framing: OctetCountedFraming},
+		{Framing: OctetCountedFraming},
+		{TLSSkipVerify: "yes please"},
+	} {
+		config, err := getSyslogConfig(args)
+		require.Error(t, err, "%+v", args)
+		require.Nil(t, config)
+	}
+}
+
+// TestSysloggerOctetCounted tests that log messages are sent with the tag, severity and framing
+// given in the log options, and with their own timestamps.
+func TestSysloggerOctetCounted(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		var messages []string
+		for len(messages) < 2 {
+			length, err := reader.ReadString(' ')
+			if err != nil {
+				break
+			}
+			n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+			if err != nil {
+				break
+			}
+			message := make([]byte, n)
+			if _, err := io.ReadFull(reader, message); err != nil {
+				break
+			}
+			messages = append(messages, string(message))
+		}
+		received <- messages
+	}()
+
+	la := InitLogger(
+		&logger.GlobalArgs{ContainerID: testContainerID, ContainerName: testContainerName},
+		&logger.DockerConfigs{ContainerImageName: testImageName},
+		&Args{
+			Address:      "tcp://" + listener.Addr().String(),
+			Facility:     "local0",
+			Format:       RFC5424Format,
+			Framing:      OctetCountedFraming,
+			Tag:          "{{.ImageName}}/{{.Name}}",
+			TagSpecified: true,
+		},
+	)
+	stream, err := la.NewStream()
+	require.NoError(t, err)
+	for _, source := range []string{"stdout", sourceSTDERR} {
+		msg := dockerlogger.NewMessage()
+		msg.Line = append(msg.Line, "line from "+source...)
+		msg.Source = source
+		msg.Timestamp = time.Date(2020, time.January, 14, 1, 59, 0, 0, time.UTC)
+		require.NoError(t, stream.Log(msg))
+	}
+	require.NoError(t, stream.(dockerlogger.Logger).Close())
+
+	messages := <-received
+	require.Len(t, messages, 2)
+	tag := testImageName + "/" + testContainerName
+	// local0 is facility 16, info is severity 6 and err is severity 3.
+	require.True(t, strings.HasPrefix(messages[0], "<134>1 2020-01-14T01:59:00Z "), messages[0])
+	require.True(t, strings.HasSuffix(messages[0], " "+tag+" - line from stdout\n"), messages[0])
+	require.True(t, strings.HasPrefix(messages[1], "<131>1 2020-01-14T01:59:00Z "), messages[1])
+	require.True(t, strings.HasSuffix(messages[1], " "+tag+" - line from stderr\n"), messages[1])
+}
+
+// TestMaxBytesPerEvent tests that the size of log lines is only limited over UDP.
+func TestMaxBytesPerEvent(t *testing.T) {
+	la := InitLogger(&logger.GlobalArgs{}, &logger.DockerConfigs{}, &Args{Address: "udp://127.0.0.1:514"})
+	require.Equal(t, MaximumUDPBytesPerEvent, la.MaxBytesPerEvent())
+	la = InitLogger(&logger.GlobalArgs{}, &logger.DockerConfigs{}, &Args{Address: "tcp://127.0.0.1:514"})
+	require.Zero(t, la.MaxBytesPerEvent())
+}
@@ -0,0 +1,283 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package syslog
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	srslog "github.com/RackSec/srslog"
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/docker/docker/daemon/logger/loggerutils"
+	"github.com/docker/go-connections/tlsconfig"
+)
+
+const (
+	udpProto       = "udp"
+	tcpProto       = "tcp"
+	secureProto    = "tcp+tls"
+	unixProto      = "unix"
+	unixgramProto  = "unixgram"
+	defaultPort    = "514"
+	sourceSTDERR   = "stderr"
+	rfc5424Version = 1
+)
+
+var facilities = map[string]srslog.Priority{
+	"kern":     srslog.LOG_KERN,
+	"user":     srslog.LOG_USER,
+	"mail":     srslog.LOG_MAIL,
+	"daemon":   srslog.LOG_DAEMON,
+	"auth":     srslog.LOG_AUTH,
+	"syslog":   srslog.LOG_SYSLOG,
+	"lpr":      srslog.LOG_LPR,
+	"news":     srslog.LOG_NEWS,
+	"uucp":     srslog.LOG_UUCP,
+	"cron":     srslog.LOG_CRON,
+	"authpriv": srslog.LOG_AUTHPRIV,
+	"ftp":      srslog.LOG_FTP,
+	"local0":   srslog.LOG_LOCAL0,
+	"local1":   srslog.LOG_LOCAL1,
+	"local2":   srslog.LOG_LOCAL2,
+	"local3":   srslog.LOG_LOCAL3,
+	"local4":   srslog.LOG_LOCAL4,
+	"local5":   srslog.LOG_LOCAL5,
+	"local6":   srslog.LOG_LOCAL6,
+	"local7":   srslog.LOG_LOCAL7,
+}
+
+// syslogger is a dockerlogger.Logger sending log messages to a syslog server. Log messages from
+// stderr are sent with the error severity, and the other ones with the info severity.
+type syslogger struct {
+	writer *srslog.Writer
+	// timestampLayout is the layout of the timestamps of RFC 5424 log messages, which are set by
+	// the syslogger rather than the formatter. It's empty for the other formats.
+	timestampLayout string
+}
+
+// newSyslogger connects to the syslog server set in the config of the info.
+func newSyslogger(info dockerlogger.Info) (*syslogger, error) {
+	tag, err := loggerutils.ParseLogTag(info, loggerutils.DefaultTemplate)
+	if err != nil {
+		return nil, err
+	}
+	proto, address, err := parseAddress(info.Config[AddressKey])
+	if err != nil {
+		return nil, err
+	}
+	facility, err := parseFacility(info.Config[FacilityKey])
+	if err != nil {
+		return nil, err
+	}
+	formatter, timestampLayout, err := parseFormat(info.Config[FormatKey])
+	if err != nil {
+		return nil, err
+	}
+	framer, err := parseFraming(info.Config[FramingKey], info.Config[FormatKey], proto)
+	if err != nil {
+		return nil, err
+	}
+
+	var writer *srslog.Writer
+	if proto == secureProto {
+		tlsConfig, tlsErr := parseTLSConfig(info.Config)
+		if tlsErr != nil {
+			return nil, tlsErr
+		}
+		writer, err = srslog.DialWithTLSConfig(proto, address, facility, tag, tlsConfig)
+	} else {
+		writer, err = srslog.Dial(proto, address, facility, tag)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to syslog server: %w", err)
+	}
+	writer.SetFormatter(formatter)
+	writer.SetFramer(framer)
+
+	return &syslogger{writer: writer, timestampLayout: timestampLayout}, nil
+}
+
+// Log sends the log message to the syslog server.
+func (s *syslogger) Log(msg *dockerlogger.Message) error {
+	if len(msg.Line) == 0 {
+		return nil
+	}
+
+	line := string(msg.Line)
+	if s.timestampLayout != "" {
+		line = msg.Timestamp.Format(s.timestampLayout) + " " + line
+	}
+	source := msg.Source
+	dockerlogger.PutMessage(msg)
+	if source == sourceSTDERR {
+		return s.writer.Err(line)
+	}
+	return s.writer.Info(line)
+}
+
+// Close closes the connection to the syslog server.
+func (s *syslogger) Close() error {
+	return s.writer.Close()
+}
+
+// Name returns the name of the log driver.
+func (s *syslogger) Name() string {
+	return DriverName
+}
+
+// validateLogOpt validates the syslog config, which holds the same log options as the moby
+// syslog log driver along with the framing.
+func validateLogOpt(cfg map[string]string) error {
+	for key := range cfg {
+		switch key {
+		case AddressKey, FacilityKey, FormatKey, FramingKey, TLSCACertKey, TLSCertKey, TLSKeyKey, TLSSkipVerifyKey, tagKey:
+		default:
+			return fmt.Errorf("unknown log opt '%s' for syslog log driver", key)
+		}
+	}
+	proto, _, err := parseAddress(cfg[AddressKey])
+	if err != nil {
+		return err
+	}
+	if _, err := parseFacility(cfg[FacilityKey]); err != nil {
+		return err
+	}
+	if _, _, err := parseFormat(cfg[FormatKey]); err != nil {
+		return err
+	}
+	if _, err := parseFraming(cfg[FramingKey], cfg[FormatKey], proto); err != nil {
+		return err
+	}
+	if v, ok := cfg[TLSSkipVerifyKey]; ok {
+		if _, err := strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("invalid %s %s: %w", TLSSkipVerifyKey, v, err)
+		}
+	}
+	return nil
+}
+
+// parseAddress returns the network and the address of the syslog server. Both are empty for the
+// local syslog server.
+func parseAddress(address string) (string, string, error) {
+	if address == "" {
+		return "", "", nil
+	}
+	addr, err := url.Parse(address)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch addr.Scheme {
+	case unixProto, unixgramProto:
+		if _, err := os.Stat(addr.Path); err != nil {
+			return "", "", err
+		}
+		return addr.Scheme, addr.Path, nil
+	case udpProto, tcpProto, secureProto:
+	default:
+		return "", "", fmt.Errorf("unsupported scheme: '%s'", addr.Scheme)
+	}
+
+	host := addr.Host
+	if host == "" {
+		return "", "", fmt.Errorf("invalid %s %s: host is required", AddressKey, address)
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		var addrErr *net.AddrError
+		if !errors.As(err, &addrErr) || addrErr.Err != "missing port in address" {
+			return "", "", err
+		}
+		host = net.JoinHostPort(host, defaultPort)
+	}
+	return addr.Scheme, host, nil
+}
+
+// parseFacility returns the syslog facility, which defaults to daemon.
+func parseFacility(facility string) (srslog.Priority, error) {
+	if facility == "" {
+		return srslog.LOG_DAEMON, nil
+	}
+	if syslogFacility, valid := facilities[facility]; valid {
+		return syslogFacility, nil
+	}
+	fInt, err := strconv.Atoi(facility)
+	if err == nil && 0 <= fInt && fInt <= 23 {
+		return srslog.Priority(fInt << 3), nil
+	}
+	return srslog.Priority(0), fmt.Errorf("invalid %s: %s", FacilityKey, facility)
+}
+
+// parseFormat returns the formatter of the log messages, along with the timestamp layout of the
+// RFC 5424 formats. The default one is the format of the local syslog server.
+func parseFormat(format string) (srslog.Formatter, string, error) {
+	switch format {
+	case "":
+		return srslog.UnixFormatter, "", nil
+	case RFC3164Format:
+		return srslog.RFC3164Formatter, "", nil
+	case RFC5424Format:
+		return rfc5424Formatter, time.RFC3339, nil
+	case RFC5424MicroFormat:
+		// RFC 5424 limits the precision of the timestamp to microseconds.
+		return rfc5424Formatter, "2006-01-02T15:04:05.000000Z07:00", nil
+	default:
+		return nil, "", fmt.Errorf("invalid %s: %s", FormatKey, format)
+	}
+}
+
+// parseFraming returns the framer of the log messages. Octet-counted framing is only supported
+// over TCP, and is the default one for RFC 5424 log messages over TCP with TLS as described in
+// RFC 5425.
+func parseFraming(framing, format, proto string) (srslog.Framer, error) {
+	switch framing {
+	case "":
+		if proto == secureProto && (format == RFC5424Format || format == RFC5424MicroFormat) {
+			return srslog.RFC5425MessageLengthFramer, nil
+		}
+		return srslog.DefaultFramer, nil
+	case NonTransparentFraming:
+		return srslog.DefaultFramer, nil
+	case OctetCountedFraming:
+		if proto != tcpProto && proto != secureProto {
+			return nil, fmt.Errorf("%s %s is only supported over tcp or tcp+tls", FramingKey, framing)
+		}
+		return srslog.RFC5425MessageLengthFramer, nil
+	default:
+		return nil, fmt.Errorf("invalid %s: %s", FramingKey, framing)
+	}
+}
+
+// parseTLSConfig returns the TLS config to connect to the syslog server with.
+func parseTLSConfig(cfg map[string]string) (*tls.Config, error) {
+	skipVerify := false
+	if v, ok := cfg[TLSSkipVerifyKey]; ok {
+		var err error
+		if skipVerify, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", TLSSkipVerifyKey, v, err)
+		}
+	}
+
+	return tlsconfig.Client(tlsconfig.Options{
+		CAFile:             cfg[TLSCACertKey],
+		CertFile:           cfg[TLSCertKey],
+		KeyFile:            cfg[TLSKeyKey],
+		InsecureSkipVerify: skipVerify,
+	})
+}
+
+// rfc5424Formatter is an RFC 5424 formatter. The content starts with the timestamp of the log
+// message followed by a space, since the formatters of srslog aren't given the log message. The tag
+// is used as the app name too, since rsyslog fills in its %syslogtag% template attribute with it.
+func rfc5424Formatter(p srslog.Priority, hostname, tag, content string) string {
+	timestamp, content, _ := strings.Cut(content, " ")
+	return fmt.Sprintf("<%d>%d %s %s %s %d %s - %s",
+		p, rfc5424Version, timestamp, hostname, tag, os.Getpid(), tag, content)
+}
@@ -0,0 +1,306 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package logger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/shim-loggers-for-containerd/debug"
+)
+
+// Sources of the timestamps of log messages.
+const (
+	// ReadTimeTimestampSource stamps log messages with the time they are read from the container
+	// pipe. This is the default source.
+	ReadTimeTimestampSource = "read-time"
+	// RegexTimestampSource extracts the timestamp from the prefix of log messages with a regular
+	// expression, and parses it with a Go time layout.
+	RegexTimestampSource = "regex"
+	// StrftimeTimestampSource extracts the timestamp from the prefix of log messages with a
+	// strftime format.
+	StrftimeTimestampSource = "strftime"
+	// JSONTimestampSource extracts the timestamp from a field of log messages which are JSON
+	// objects.
+	JSONTimestampSource = "json"
+)
+
+const (
+	// DefaultTimestampMaxSkew is the default max difference between the timestamp extracted from
+	// a log message and the time it's read. It's within the window of CloudWatch Logs, which
+	// rejects log events more than 2 hours in the future.
+	DefaultTimestampMaxSkew = 2 * time.Hour
+	// defaultTimestampJSONField is the default field of the timestamp of JSON log messages.
+	defaultTimestampJSONField = "timestamp"
+	// timestampRegexGroup is the name of the capturing group of the timestamp in a regular
+	// expression, which may be left out if there's a single capturing group.
+	timestampRegexGroup = "timestamp"
+	// minEpochMilliseconds is the min number of a JSON timestamp field taken as milliseconds
+	// rather than seconds since the Unix epoch, which would be year 33658 in seconds.
+	minEpochMilliseconds = 1e12
+)
+
+// strftimeDirectives maps the supported strftime directives to the Go time layout and regular
+// expression of their values.
+var strftimeDirectives = map[byte]struct {
+	layout string
+	regex  string
+}{
+	'Y': {"2006", `\d{4}`},
+	'y': {"06", `\d{2}`},
+	'm': {"01", `\d{2}`},
+	'd': {"02", `\d{2}`},
+	'e': {"_2", `[ \d]\d`},
+	'j': {"002", `\d{3}`},
+	'H': {"15", `\d{2}`},
+	'I': {"03", `\d{2}`},
+	'M': {"04", `\d{2}`},
+	'S': {"05", `\d{2}`},
+	'f': {"000000", `\d{6}`},
+	'L': {"000", `\d{3}`},
+	'p': {"PM", `[AP]M`},
+	'b': {"Jan", `[A-Z][a-z]{2}`},
+	'B': {"January", `[A-Z][a-z]+`},
+	'a': {"Mon", `[A-Z][a-z]{2}`},
+	'A': {"Monday", `[A-Z][a-z]+`},
+	'z': {"Z0700", `(?:Z|[+-]\d{4})`},
+	'F': {"2006-01-02", `\d{4}-\d{2}-\d{2}`},
+	'T': {"15:04:05", `\d{2}:\d{2}:\d{2}`},
+	'%': {"%", `%`},
+}
+
+// TimestampArgs sets where the timestamps of log messages come from.
+type TimestampArgs struct {
+	// Source is the source of the timestamps, ReadTimeTimestampSource by default.
+	Source string
+	// Regex is the regular expression matching the prefix of log messages with the regex source.
+	// The timestamp is its capturing group named timestamp, its only capturing group, or the
+	// whole match.
+	Regex string
+	// Layout is the Go time layout of the timestamps with the regex and json sources,
+	// time.RFC3339Nano by default. Timestamps without a time zone are in UTC.
+	Layout string
+	// Strftime is the strftime format of the prefix of log messages with the strftime source.
+	Strftime string
+	// JSONField is the field of the timestamp with the json source, timestamp by default. Numbers
+	// are taken as seconds since the Unix epoch, or as milliseconds if they are too large.
+	JSONField string
+	// MaxSkew is the max difference between a timestamp and the time it's read, beyond which the
+	// read time is used instead. DefaultTimestampMaxSkew if it's 0.
+	MaxSkew time.Duration
+}
+
+// timestamper extracts the timestamps of log messages, which falls back to the time they are read
+// if the timestamp can't be parsed or is skewed.
+type timestamper struct {
+	regex     *regexp.Regexp
+	group     int
+	layout    string
+	jsonField string
+	maxSkew   time.Duration
+
+	// The counters of the log messages falling back to the read time, along with the ones
+	// reported in the routing trace already.
+	counters timestampCounters
+	reported timestampCounters
+}
+
+// timestampCounters count the log messages falling back to the read time.
+type timestampCounters struct {
+	// unparsed counts the log messages which timestamp can't be found or parsed.
+	unparsed uint64
+	// skewed counts the log messages which timestamp is too far from the read time.
+	skewed uint64
+}
+
+// newTimestamper validates the timestamp arguments of a source other than the read time, and
+// creates the timestamper.
+func newTimestamper(args *TimestampArgs) (*timestamper, error) {
+	t := &timestamper{
+		layout:  args.Layout,
+		maxSkew: args.MaxSkew,
+	}
+	if t.layout == "" {
+		t.layout = time.RFC3339Nano
+	}
+	if t.maxSkew < 0 {
+		return nil, errors.New("timestamp max skew can't be negative")
+	}
+	if t.maxSkew == 0 {
+		t.maxSkew = DefaultTimestampMaxSkew
+	}
+
+	switch args.Source {
+	case RegexTimestampSource:
+		if args.Regex == "" {
+			return nil, errors.New("regular expression of timestamps is required")
+		}
+		if err := t.compile(args.Regex); err != nil {
+			return nil, err
+		}
+	case StrftimeTimestampSource:
+		regex, layout, err := convertStrftime(args.Strftime)
+		if err != nil {
+			return nil, err
+		}
+		t.layout = layout
+		if err := t.compile(regex); err != nil {
+			return nil, err
+		}
+	case JSONTimestampSource:
+		t.jsonField = args.JSONField
+		if t.jsonField == "" {
+			t.jsonField = defaultTimestampJSONField
+		}
+	default:
+		return nil, fmt.Errorf("unknown timestamp source: %s", args.Source)
+	}
+	return t, nil
+}
+
+// compile compiles the regular expression matching the prefix of log messages, and finds the
+// capturing group of the timestamp.
+func (t *timestamper) compile(regex string) error {
+	re, err := regexp.Compile(`^(?:` + regex + `)`)
+	if err != nil {
+		return fmt.Errorf("unable to compile regular expression of timestamps %s: %w", regex, err)
+	}
+	t.regex = re
+	t.group = re.SubexpIndex(timestampRegexGroup)
+	if t.group < 0 && re.NumSubexp() <= 1 {
+		t.group = re.NumSubexp()
+	}
+	if t.group < 0 {
+		return fmt.Errorf("regular expression of timestamps %s has multiple capturing groups, "+
+			"but none is named %s", regex, timestampRegexGroup)
+	}
+	return nil
+}
+
+// convertStrftime converts a strftime format to the regular expression matching it, and to the Go
+// time layout parsing it.
+func convertStrftime(format string) (string, string, error) {
+	if format == "" {
+		return "", "", errors.New("strftime format of timestamps is required")
+	}
+	var regex, layout strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			regex.WriteString(regexp.QuoteMeta(format[i : i+1]))
+			layout.WriteByte(format[i])
+			continue
+		}
+		i++
+		if i == len(format) {
+			return "", "", fmt.Errorf("strftime format %s ends with %%", format)
+		}
+		directive, ok := strftimeDirectives[format[i]]
+		if !ok {
+			return "", "", fmt.Errorf("unsupported strftime directive %%%c in %s", format[i], format)
+		}
+		regex.WriteString(directive.regex)
+		layout.WriteString(directive.layout)
+	}
+	return regex.String(), layout.String(), nil
+}
+
+// extract returns the timestamp of a log message read at the given time, which is the read time
+// if the timestamp can't be parsed or is more than the max skew away from it.
+func (t *timestamper) extract(line []byte, readTime time.Time) time.Time {
+	ts, ok := t.parse(line)
+	if !ok {
+		atomic.AddUint64(&t.counters.unparsed, 1)
+		return readTime
+	}
+	// Timestamps without a year, such as the ones of syslog, are in the year they are read, or in
+	// the previous year if they would be months ahead, i.e. read just after New Year.
+	if ts.Year() == 0 {
+		ts = ts.AddDate(readTime.Year(), 0, 0)
+		if ts.After(readTime.AddDate(0, 6, 0)) {
+			ts = ts.AddDate(-1, 0, 0)
+		}
+	}
+	if ts.Before(readTime.Add(-t.maxSkew)) || ts.After(readTime.Add(t.maxSkew)) {
+		atomic.AddUint64(&t.counters.skewed, 1)
+		return readTime
+	}
+	return ts.UTC()
+}
+
+// parse parses the timestamp of a log message.
+func (t *timestamper) parse(line []byte) (time.Time, bool) {
+	if t.regex != nil {
+		match := t.regex.FindSubmatch(line)
+		if match == nil || match[t.group] == nil {
+			return time.Time{}, false
+		}
+		ts, err := time.Parse(t.layout, string(match[t.group]))
+		return ts, err == nil
+	}
+
+	object, ok := ParseJSONObject(line)
+	if !ok {
+		return time.Time{}, false
+	}
+	value, ok := object[t.jsonField]
+	if !ok {
+		return time.Time{}, false
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		ts, err := time.Parse(t.layout, s)
+		return ts, err == nil
+	}
+	var epoch float64
+	if err := json.Unmarshal(value, &epoch); err != nil || epoch <= 0 {
+		return time.Time{}, false
+	}
+	if epoch >= minEpochMilliseconds {
+		epoch /= 1e3
+	}
+	sec, frac := math.Modf(epoch)
+	return time.Unix(int64(sec), int64(frac*1e9)), true
+}
+
+// timestamp returns the timestamp of a log message which is just read.
+func (l *Logger) timestamp(line []byte) time.Time {
+	readTime := time.Now().UTC()
+	if l.timestamper == nil {
+		return readTime
+	}
+	return l.timestamper.extract(line, readTime)
+}
+
+// reportTrace reports the log messages falling back to the read time since the last report, or in
+// total once the routing trace is stopped.
+func (t *timestamper) reportTrace(containerID string, total bool) {
+	counters := timestampCounters{
+		unparsed: atomic.LoadUint64(&t.counters.unparsed),
+		skewed:   atomic.LoadUint64(&t.counters.skewed),
+	}
+	if total {
+		debug.SendEvent(containerID,
+			fmt.Sprintf("In total, %d log lines without a valid timestamp and %d log lines with a skewed "+
+				"timestamp are stamped with the read time.", counters.unparsed, counters.skewed),
+			debug.INFO,
+			debug.Lines(counters.unparsed+counters.skewed))
+		return
+	}
+	last := t.reported
+	t.reported = counters
+	if counters == last {
+		return
+	}
+	debug.SendEvent(containerID,
+		fmt.Sprintf("Within last minute, %d log lines without a valid timestamp and %d log lines with a "+
+			"skewed timestamp are stamped with the read time.", counters.unparsed-last.unparsed, counters.skewed-last.skewed),
+		debug.INFO,
+		debug.Lines(counters.unparsed-last.unparsed+counters.skewed-last.skewed))
+}
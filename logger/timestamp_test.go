@@ -0,0 +1,179 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package logger
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestTimestampSources tests that timestamps are extracted from log lines with every source, and
+// that the read time is used if they can't be parsed or are skewed.
+func TestTimestampSources(t *testing.T) {
+	readTime := dummyTime.Add(time.Minute)
+	testCases := []struct {
+		name     string
+		args     *TimestampArgs
+		line     string
+		expected time.Time
+	}{
+		{
+			name:     "regex whole match",
+			args:     &TimestampArgs{Source: RegexTimestampSource, Regex: `\S+`},
+			line:     "2020-01-14T01:59:00.5Z INFO started",
+			expected: dummyTime.Add(500 * time.Millisecond),
+		},
+		{
+			name: "regex named group",
+			args: &TimestampArgs{
+				Source: RegexTimestampSource,
+				Regex:  `\[(\w+)\] (?P<timestamp>[^ ]+ [^ ]+)`,
+				Layout: "2006/01/02 15:04:05",
+			},
+			line:     "[main] 2020/01/14 01:59:00 started",
+			expected: dummyTime,
+		},
+		{
+			name:     "regex not at the start",
+			args:     &TimestampArgs{Source: RegexTimestampSource, Regex: `(\d{4}-\S+)`},
+			line:     "INFO 2020-01-14T01:59:00Z started",
+			expected: readTime,
+		},
+		{
+			name:     "strftime",
+			args:     &TimestampArgs{Source: StrftimeTimestampSource, Strftime: "%Y-%m-%d %H:%M:%S,%L %z"},
+			line:     "2020-01-14 03:59:00,250 +0200 INFO started",
+			expected: dummyTime.Add(250 * time.Millisecond),
+		},
+		{
+			name:     "strftime names",
+			args:     &TimestampArgs{Source: StrftimeTimestampSource, Strftime: "%b %e %T"},
+			line:     "Jan 14 01:59:00 host app: started",
+			expected: dummyTime,
+		},
+		{
+			name:     "strftime names before New Year",
+			args:     &TimestampArgs{Source: StrftimeTimestampSource, Strftime: "%b %e %T", MaxSkew: 14 * 24 * time.Hour},
+			line:     "Dec 31 23:59:00 host app: started",
+			expected: time.Date(2019, time.December, 31, 23, 59, 0, 0, time.UTC),
+		},
+		{
+			name:     "json string",
+			args:     &TimestampArgs{Source: JSONTimestampSource},
+			line:     `{"timestamp":"2020-01-14T01:59:00Z","msg":"started"}`,
+			expected: dummyTime,
+		},
+		{
+			name:     "json seconds",
+			args:     &TimestampArgs{Source: JSONTimestampSource, JSONField: "ts"},
+			line:     fmt.Sprintf(`{"ts":%d.25}`, dummyTime.Unix()),
+			expected: dummyTime.Add(250 * time.Millisecond),
+		},
+		{
+			name:     "json milliseconds",
+			args:     &TimestampArgs{Source: JSONTimestampSource, JSONField: "time"},
+			line:     fmt.Sprintf(`{"time":%d}`, dummyTime.UnixMilli()+750),
+			expected: dummyTime.Add(750 * time.Millisecond),
+		},
+		{
+			name:     "json missing field",
+			args:     &TimestampArgs{Source: JSONTimestampSource},
+			line:     `{"msg":"started"}`,
+			expected: readTime,
+		},
+		{
+			name:     "unparsable",
+			args:     &TimestampArgs{Source: StrftimeTimestampSource, Strftime: "%F %T"},
+			line:     "2020-13-14 01:59:00 started",
+			expected: readTime,
+		},
+		{
+			name:     "backdated",
+			args:     &TimestampArgs{Source: JSONTimestampSource, MaxSkew: time.Second},
+			line:     `{"timestamp":"2020-01-14T01:59:00Z"}`,
+			expected: readTime,
+		},
+		{
+			name:     "future",
+			args:     &TimestampArgs{Source: JSONTimestampSource},
+			line:     `{"timestamp":"2020-01-14T04:00:01Z"}`,
+			expected: readTime,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts, err := newTimestamper(tc.args)
+			require.NoError(t, err)
+			actual := ts.extract([]byte(tc.line), readTime)
+			require.True(t, tc.expected.Equal(actual), "expected %s, got %s", tc.expected, actual)
+			require.Equal(t, time.UTC, actual.Location())
+		})
+	}
+}
+
+// TestTimestampRead tests that all the partial log messages of a log line have the timestamp of
+// the first one, and that the log lines falling back to the read time are reported.
+func TestTimestampRead(t *testing.T) {
+	l, err := NewLogger(
+		WithInfo(NewInfo(testContainerID, testContainerName)),
+		WithTimestamp(&TimestampArgs{
+			Source:   StrftimeTimestampSource,
+			Strftime: "%Y-%m-%dT%H:%M:%S",
+			MaxSkew:  time.Since(dummyTime) + time.Hour,
+		}),
+		WithMaxReadBytes(8),
+	)
+	require.NoError(t, err)
+	sent := &sentMessages{}
+	start := time.Now()
+	pipe := strings.NewReader("2020-01-14T01:59:00 a long line\nno timestamp\n")
+	require.NoError(t, l.Read(context.Background(), pipe, sourceSTDOUT, 24, sent.send))
+
+	require.Equal(t, []string{"2020-01-14T01:59:00 a lo", "ng line", "no timestamp"}, sent.get())
+	require.Equal(t, dummyTime, sent.timestamps[0])
+	require.Equal(t, dummyTime, sent.timestamps[1])
+	require.False(t, sent.timestamps[2].Before(start))
+
+	inner, ok := l.(*Logger)
+	require.True(t, ok)
+	require.Len(t, inner.traceReporters(), 1)
+	require.Equal(t, uint64(1), atomic.LoadUint64(&inner.timestamper.counters.unparsed))
+	inner.timestamper.reportTrace(testContainerID, false)
+	inner.timestamper.reportTrace(testContainerID, true)
+}
+
+// TestNewTimestamperWithError tests that invalid timestamp arguments are rejected, and that the
+// read-time source doesn't need a timestamper.
+func TestNewTimestamperWithError(t *testing.T) {
+	for name, args := range map[string]*TimestampArgs{
+		"unknown source":        {Source: "syslog"},
+		"no regex":              {Source: RegexTimestampSource},
+		"invalid regex":         {Source: RegexTimestampSource, Regex: `(\d+`},
+		"ambiguous groups":      {Source: RegexTimestampSource, Regex: `(\S+) (\S+)`},
+		"no strftime":           {Source: StrftimeTimestampSource},
+		"unsupported directive": {Source: StrftimeTimestampSource, Strftime: "%Y %Q"},
+		"trailing percent":      {Source: StrftimeTimestampSource, Strftime: "%Y %"},
+		"negative max skew":     {Source: JSONTimestampSource, MaxSkew: -time.Second},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewLogger(WithTimestamp(args))
+			require.Error(t, err)
+		})
+	}
+
+	l, err := NewLogger(WithTimestamp(&TimestampArgs{Source: ReadTimeTimestampSource}))
+	require.NoError(t, err)
+	inner, ok := l.(*Logger)
+	require.True(t, ok)
+	require.Nil(t, inner.timestamper)
+}
@@ -0,0 +1,323 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package logger
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	types "github.com/docker/docker/api/types/backend"
+	dockerlogger "github.com/docker/docker/daemon/logger"
+)
+
+const (
+	// noWALSeq is the sequence number of the log messages which aren't saved in the write-ahead
+	// log, such as the ones reporting dropped log messages.
+	noWALSeq = math.MaxUint64
+	// walDirMode is the permission mode of the directory holding the write-ahead log files.
+	// Owner=rwx, group=none, other=none, since the files hold container logs.
+	walDirMode = os.FileMode(0o700)
+	// walEntriesFileSuffix is the suffix of the file holding the entries of a single source pipe.
+	walEntriesFileSuffix = ".wal"
+	// walCheckpointFileSuffix is the suffix of the file holding the delivery checkpoint of a
+	// single source pipe.
+	walCheckpointFileSuffix = ".checkpoint"
+	// walCompactionSizeInBytes is the size of the entries file after which it's truncated once
+	// all of its entries are delivered.
+	walCompactionSizeInBytes = 1024 * 1024
+)
+
+// writeAheadLog saves every log message read from the container pipes to disk before it's sent,
+// along with a checkpoint of how many of them are delivered, so that the log messages which are
+// not delivered yet can be replayed if the shim logger is restarted after a crash.
+//
+// Each source pipe has its own entries and checkpoint files, since log messages of a single source
+// pipe are always delivered in the order they are read, whether in blocking or non-blocking mode.
+// Every log message has a sequence number, and the checkpoint is the number of log messages at the
+// head of the entries file that are either sent to the destination or dropped from the ring
+// buffer. A log message dropped from the ring buffer while older ones are still queued is recorded
+// as a tombstone in memory, so that the checkpoint never moves past a log message which is not
+// delivered yet, at the cost of replaying the dropped log message after a crash. Files are not
+// synced to disk after every write, so the write-ahead log survives a crash of the shim logger but
+// not of the host.
+type writeAheadLog struct {
+	// dir is the directory holding the write-ahead log files of a single container.
+	dir     string
+	sources map[string]*walSource
+}
+
+// walSource is the write-ahead log of a single source pipe.
+type walSource struct {
+	lock sync.Mutex
+	// entries is the append-only file of log messages read from the source pipe.
+	entries            *os.File
+	entriesSizeInBytes int64
+	// checkpoint is the file holding the number of delivered log messages.
+	checkpoint *os.File
+	// base is the sequence number of the first log message in the entries file.
+	base uint64
+	// appended is the number of log messages saved in the entries file.
+	appended uint64
+	// delivered is the number of log messages at the head of the entries file which are delivered.
+	delivered uint64
+	// dropped holds the sequence numbers of the log messages after the delivered ones which are
+	// dropped from the ring buffer.
+	dropped map[uint64]struct{}
+}
+
+// newWriteAheadLog creates a write-ahead log saving files under the given directory.
+func newWriteAheadLog(dir string) *writeAheadLog {
+	return &writeAheadLog{
+		dir: dir,
+		sources: map[string]*walSource{
+			sourceSTDOUT: {dropped: make(map[uint64]struct{})},
+			sourceSTDERR: {dropped: make(map[uint64]struct{})},
+		},
+	}
+}
+
+// open opens the write-ahead log files of all source pipes, creating them if they don't exist.
+func (w *writeAheadLog) open() error {
+	if err := os.MkdirAll(w.dir, walDirMode); err != nil {
+		return fmt.Errorf("unable to create write-ahead log directory %s: %w", w.dir, err)
+	}
+	for source, s := range w.sources {
+		var err error
+		s.entries, err = os.OpenFile(w.path(source, walEntriesFileSuffix), os.O_CREATE|os.O_RDWR, 0o600)
+		if err != nil {
+			return fmt.Errorf("unable to open write-ahead log of pipe %s: %w", source, err)
+		}
+		s.checkpoint, err = os.OpenFile(w.path(source, walCheckpointFileSuffix), os.O_CREATE|os.O_RDWR, 0o600)
+		if err != nil {
+			return fmt.Errorf("unable to open write-ahead log checkpoint of pipe %s: %w", source, err)
+		}
+	}
+	return nil
+}
+
+// close closes the write-ahead log files of all source pipes. The files are kept so that the log
+// messages which are not delivered yet can be replayed on the next start.
+func (w *writeAheadLog) close() {
+	for _, s := range w.sources {
+		s.lock.Lock()
+		if s.entries != nil {
+			s.entries.Close() //nolint:errcheck,gosec // nothing to do
+		}
+		if s.checkpoint != nil {
+			s.checkpoint.Close() //nolint:errcheck,gosec // nothing to do
+		}
+		s.lock.Unlock()
+	}
+}
+
+// replay sends the log messages left undelivered by a previous run to the given function, pipe by
+// pipe, and then truncates the write-ahead log files.
+func (w *writeAheadLog) replay(send func(*dockerlogger.Message) error) error {
+	for _, source := range []string{sourceSTDOUT, sourceSTDERR} {
+		s := w.sources[source]
+		s.lock.Lock()
+		err := s.replay(send)
+		s.lock.Unlock()
+		if err != nil {
+			return fmt.Errorf("unable to replay write-ahead log of pipe %s: %w", source, err)
+		}
+	}
+	return nil
+}
+
+// wrap returns a sendLogToDestFunc which saves every log message to the write-ahead log of its
+// source pipe before calling the given one.
+func (w *writeAheadLog) wrap(sendLogMsgToDest sendLogToDestFunc) sendLogToDestFunc {
+	return func(
+		line []byte,
+		source string,
+		isPartialMsg, isLastPartial bool,
+		partialID string,
+		partialOrdinal int,
+		msgTimestamp time.Time,
+	) error {
+		message := newMessage(line, source, msgTimestamp)
+		if isPartialMsg {
+			message.PLogMetaData = &types.PartialLogMetaData{ID: partialID, Ordinal: partialOrdinal, Last: isLastPartial}
+		}
+		if err := w.append(message); err != nil {
+			return err
+		}
+		return sendLogMsgToDest(line, source, isPartialMsg, isLastPartial, partialID, partialOrdinal, msgTimestamp)
+	}
+}
+
+// append saves a log message to the write-ahead log of its source pipe.
+func (w *writeAheadLog) append(msg *dockerlogger.Message) error {
+	s, ok := w.sources[msg.Source]
+	if !ok {
+		return fmt.Errorf("unknown source pipe %s", msg.Source)
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("unable to encode log message: %w", err)
+	}
+	b = append(b, newline)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	n, err := s.entries.WriteAt(b, s.entriesSizeInBytes)
+	s.entriesSizeInBytes += int64(n)
+	if err != nil {
+		return fmt.Errorf("unable to write log message to write-ahead log: %w", err)
+	}
+	s.appended++
+
+	return nil
+}
+
+// appendedSeq returns the sequence number of the last log message saved for the given source pipe.
+// Called from the sendLogToDestFunc wrapped by wrap, it's the sequence number of the log message
+// being sent, since the log messages of a source pipe are sent one at a time.
+func (w *writeAheadLog) appendedSeq(source string) uint64 {
+	s, ok := w.sources[source]
+	if !ok {
+		return noWALSeq
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.base + s.appended - 1
+}
+
+// ack records that the oldest undelivered log message of the given source pipe, which isn't
+// dropped, is delivered.
+func (w *writeAheadLog) ack(source string) {
+	s, ok := w.sources[source]
+	if !ok {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	moved := s.skipDropped()
+	if s.delivered < s.appended {
+		s.delivered++
+		s.skipDropped()
+		moved = true
+	}
+	if moved {
+		s.advance()
+	}
+}
+
+// drop records that the log message of the given source pipe and sequence number is dropped, so
+// that it doesn't need to be replayed. Sequence numbers of log messages which aren't saved, such
+// as noWALSeq, are ignored.
+func (w *writeAheadLog) drop(source string, seq uint64) {
+	s, ok := w.sources[source]
+	if !ok {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if seq < s.base+s.delivered || seq >= s.base+s.appended {
+		return
+	}
+	s.dropped[seq] = struct{}{}
+	if s.skipDropped() {
+		s.advance()
+	}
+}
+
+// skipDropped moves the checkpoint past the dropped log messages right after it, and returns
+// whether it's moved. The caller must hold the lock.
+func (s *walSource) skipDropped() bool {
+	skipped := false
+	for {
+		seq := s.base + s.delivered
+		if _, ok := s.dropped[seq]; !ok {
+			return skipped
+		}
+		delete(s.dropped, seq)
+		s.delivered++
+		skipped = true
+	}
+}
+
+// advance saves the checkpoint after it's moved. The caller must hold the lock.
+func (s *walSource) advance() {
+	// Start over once everything is delivered, so that the entries file doesn't grow forever.
+	if s.delivered == s.appended && s.entriesSizeInBytes >= walCompactionSizeInBytes {
+		if err := s.reset(); err == nil {
+			return
+		}
+	}
+	s.saveCheckpoint() //nolint:errcheck,gosec // the log message is replayed again at worst
+}
+
+// replay sends the log messages after the checkpoint to the given function and then truncates
+// the write-ahead log files. The caller must hold the lock.
+func (s *walSource) replay(send func(*dockerlogger.Message) error) error {
+	var b [8]byte
+	n, err := s.checkpoint.ReadAt(b[:], 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	var delivered uint64
+	if n == len(b) {
+		delivered = binary.BigEndian.Uint64(b[:])
+	}
+
+	decoder := json.NewDecoder(bufio.NewReader(io.NewSectionReader(s.entries, 0, 1<<62)))
+	for i := uint64(0); ; i++ {
+		msg := dockerlogger.NewMessage()
+		if err := decoder.Decode(msg); err != nil {
+			// The last entry may be partially written if the shim logger crashed while writing it.
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return err
+		}
+		if i < delivered {
+			continue
+		}
+		if err := send(msg); err != nil {
+			return err
+		}
+	}
+
+	return s.reset()
+}
+
+// reset truncates the write-ahead log files. The caller must hold the lock.
+func (s *walSource) reset() error {
+	if err := s.entries.Truncate(0); err != nil {
+		return err
+	}
+	s.entriesSizeInBytes = 0
+	s.base += s.appended
+	s.appended = 0
+	s.delivered = 0
+	clear(s.dropped)
+	return s.saveCheckpoint()
+}
+
+// saveCheckpoint saves the number of delivered log messages. The caller must hold the lock.
+func (s *walSource) saveCheckpoint() error {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], s.delivered)
+	_, err := s.checkpoint.WriteAt(b[:], 0)
+	return err
+}
+
+// path returns the path of the write-ahead log file of the given source pipe.
+func (w *writeAheadLog) path(source, suffix string) string {
+	return filepath.Join(w.dir, source+suffix)
+}
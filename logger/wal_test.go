@@ -0,0 +1,154 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package logger
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWriteAheadLogReplay tests that only the log messages after the delivery checkpoint are
+// replayed after a restart.
+func TestWriteAheadLogReplay(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), testContainerID)
+	w := newWriteAheadLog(dir)
+	require.NoError(t, w.open())
+
+	var sent []string
+	send := w.wrap(func(line []byte, _ string, _, _ bool, _ string, _ int, _ time.Time) error {
+		sent = append(sent, string(line))
+		return nil
+	})
+	require.NoError(t, send([]byte("out1"), sourceSTDOUT, false, false, "", 1, dummyTime))
+	require.NoError(t, send([]byte("err1"), sourceSTDERR, false, false, "", 1, dummyTime))
+	require.NoError(t, send([]byte("out2"), sourceSTDOUT, true, false, "partial-id", 1, dummyTime))
+	require.NoError(t, send([]byte("out3"), sourceSTDOUT, true, true, "partial-id", 2, dummyTime))
+	require.Equal(t, []string{"out1", "err1", "out2", "out3"}, sent)
+	// Only the first log message of stdout is delivered before the crash.
+	w.ack(sourceSTDOUT)
+	w.close()
+
+	// Simulate a partially written entry at the time of crash.
+	f, err := os.OpenFile(filepath.Join(dir, sourceSTDERR+walEntriesFileSuffix), os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"Line":"ZXJy`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	restarted := newWriteAheadLog(dir)
+	require.NoError(t, restarted.open())
+	defer restarted.close()
+	var replayed []*dockerlogger.Message
+	require.NoError(t, restarted.replay(func(msg *dockerlogger.Message) error {
+		replayed = append(replayed, msg)
+		return nil
+	}))
+	require.Len(t, replayed, 3)
+	require.Equal(t, "out2", string(replayed[0].Line))
+	require.Equal(t, sourceSTDOUT, replayed[0].Source)
+	require.Equal(t, "partial-id", replayed[0].PLogMetaData.ID)
+	require.Equal(t, "out3", string(replayed[1].Line))
+	require.True(t, replayed[1].PLogMetaData.Last)
+	require.Equal(t, "err1", string(replayed[2].Line))
+	require.Equal(t, sourceSTDERR, replayed[2].Source)
+	require.True(t, dummyTime.Equal(replayed[2].Timestamp))
+
+	// Nothing is replayed twice.
+	replayed = nil
+	require.NoError(t, restarted.replay(func(msg *dockerlogger.Message) error {
+		replayed = append(replayed, msg)
+		return nil
+	}))
+	require.Empty(t, replayed)
+}
+
+// TestWriteAheadLogCompaction tests that the write-ahead log is truncated once everything in it
+// is delivered.
+func TestWriteAheadLogCompaction(t *testing.T) {
+	w := newWriteAheadLog(filepath.Join(t.TempDir(), testContainerID))
+	require.NoError(t, w.open())
+	defer w.close()
+
+	line := make([]byte, walCompactionSizeInBytes)
+	require.NoError(t, w.append(newMessage(line, sourceSTDOUT, dummyTime)))
+	require.NoError(t, w.append(newMessage([]byte("small"), sourceSTDOUT, dummyTime)))
+	w.ack(sourceSTDOUT)
+	require.NotZero(t, w.sources[sourceSTDOUT].entriesSizeInBytes)
+
+	w.ack(sourceSTDOUT)
+	require.Zero(t, w.sources[sourceSTDOUT].entriesSizeInBytes)
+	require.Zero(t, w.sources[sourceSTDOUT].appended)
+	info, err := w.sources[sourceSTDOUT].entries.Stat()
+	require.NoError(t, err)
+	require.Zero(t, info.Size())
+}
+
+// pooledClient puts every log message back to the pool once it's sent, like most log drivers.
+type pooledClient struct {
+	sent []string
+}
+
+func (c *pooledClient) Log(msg *dockerlogger.Message) error {
+	c.sent = append(c.sent, string(msg.Line))
+	dockerlogger.PutMessage(msg)
+	return nil
+}
+
+// TestWriteAheadLogDrop tests that a log message dropped from the ring buffer while older ones are
+// still queued doesn't move the checkpoint past them, and that log messages put back to the pool
+// once sent are acked against their source pipe.
+func TestWriteAheadLogDrop(t *testing.T) {
+	dir := t.TempDir()
+	client := &pooledClient{}
+	l, err := NewLogger(
+		WithInfo(NewInfo(testContainerID, testContainerName)),
+		WithStream(client),
+		WithWriteAheadLog(dir),
+	)
+	require.NoError(t, err)
+	bl, ok := NewBufferedLogger(l, DefaultBufSizeInBytes, 10, testContainerID).(*bufferedLogger)
+	require.True(t, ok)
+	require.NoError(t, bl.wal.open())
+	defer bl.wal.close()
+
+	// The last log message doesn't fit, so it's dropped while the other ones are still queued.
+	pipe := strings.NewReader("aaaa\nbbbb\ncccccccc\n")
+	require.NoError(t, bl.Read(context.Background(), pipe, sourceSTDOUT, 64, bl.saveSingleLogMessageToRingBuffer))
+	s := bl.wal.sources[sourceSTDOUT]
+	require.Equal(t, uint64(3), s.appended)
+	require.Zero(t, s.delivered)
+
+	require.NoError(t, bl.sendLogMessageToDestination())
+	require.Equal(t, uint64(1), s.delivered)
+
+	// Only the log messages after the first one are replayed after a crash, which is simulated
+	// with a copy of the write-ahead log files.
+	crashed := filepath.Join(t.TempDir(), testContainerID)
+	require.NoError(t, os.CopyFS(crashed, os.DirFS(filepath.Join(dir, testContainerID))))
+	restarted := newWriteAheadLog(crashed)
+	require.NoError(t, restarted.open())
+	defer restarted.close()
+	var replayed []string
+	require.NoError(t, restarted.sources[sourceSTDOUT].replay(func(msg *dockerlogger.Message) error {
+		replayed = append(replayed, string(msg.Line))
+		return nil
+	}))
+	require.Equal(t, []string{"bbbb", "cccccccc"}, replayed)
+
+	// The dropped log message is skipped once the one before it is delivered.
+	require.NoError(t, bl.sendLogMessageToDestination())
+	require.Equal(t, uint64(3), s.delivered)
+	require.Empty(t, s.dropped)
+	require.Equal(t, []string{"aaaa", "bbbb"}, client.sent)
+}
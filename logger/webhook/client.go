@@ -0,0 +1,228 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package webhook
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+const (
+	// queueSize is the max number of log messages queued until they're batched.
+	queueSize = 1024
+	// requestTimeout bounds how long a single request takes.
+	requestTimeout = 30 * time.Second
+	// maxRetryBackoff bounds how long to wait before sending a batch again.
+	maxRetryBackoff = 30 * time.Second
+	// maxResponseBodySize bounds how much of the response body is read.
+	maxResponseBodySize = 64 * 1024
+	// maxErrBodySize bounds how much of the response body is included in errors.
+	maxErrBodySize = 512
+)
+
+// recordMetadata is the metadata of the container added to every record.
+type recordMetadata struct {
+	containerID   string
+	containerName string
+	imageName     string
+	imageID       string
+	labels        map[string]string
+}
+
+// newRecordMetadata creates the metadata of the container from its arguments and docker configs.
+func newRecordMetadata(globalArgs *logger.GlobalArgs, dockerConfigs *logger.DockerConfigs) *recordMetadata {
+	meta := &recordMetadata{
+		containerID:   globalArgs.ContainerID,
+		containerName: globalArgs.ContainerName,
+	}
+	if dockerConfigs != nil {
+		meta.imageName = dockerConfigs.ContainerImageName
+		meta.imageID = dockerConfigs.ContainerImageID
+		meta.labels = dockerConfigs.ContainerLabels
+	}
+	return meta
+}
+
+// record is a log message along with the metadata of the container. It's encoded as a JSON object
+// with the ndjson and json formats, and its fields are the ones of the records of the template.
+type record struct {
+	Timestamp     time.Time         `json:"timestamp"`
+	Line          string            `json:"line"`
+	Source        string            `json:"source"`
+	ContainerID   string            `json:"container_id"`
+	ContainerName string            `json:"container_name"`
+	ImageName     string            `json:"image_name,omitempty"`
+	ImageID       string            `json:"image_id,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+}
+
+// client converts log messages to records, and POSTs them in batches in the background.
+//
+// Log blocks while the queue is full, which happens when the URL doesn't keep up, so that the
+// container is slowed down in the blocking mode, and the buffer of the non-blocking mode applies
+// its overflow policy.
+type client struct {
+	cfg        *config
+	meta       *recordMetadata
+	httpClient *http.Client
+	batcher    *logger.Batcher[record]
+}
+
+// newClient creates a client sending the records of the container to the URL.
+func newClient(cfg *config, meta *recordMetadata) *client {
+	c := &client{
+		cfg:        cfg,
+		meta:       meta,
+		httpClient: &http.Client{Timeout: requestTimeout},
+	}
+	c.batcher = logger.NewBatcher(&logger.BatcherConfig[record]{
+		DriverName:     DriverName,
+		Items:          "log messages",
+		QueueSize:      queueSize,
+		MaxItems:       cfg.batchSize,
+		FlushBytes:     cfg.batchBytes,
+		Size:           func(r record) int { return len(r.Line) },
+		Wait:           cfg.batchWait,
+		Send:           c.send,
+		Timeout:        requestTimeout,
+		MaxAttempts:    cfg.maxRetries + 1,
+		InitialBackoff: cfg.retryBackoff,
+		MaxBackoff:     maxRetryBackoff,
+	})
+
+	return c
+}
+
+// Log converts a log message to a record and queues it to be sent. It blocks if the queue is full.
+func (c *client) Log(msg *dockerlogger.Message) error {
+	r := record{
+		Timestamp:     msg.Timestamp.UTC(),
+		Line:          string(msg.Line),
+		Source:        msg.Source,
+		ContainerID:   c.meta.containerID,
+		ContainerName: c.meta.containerName,
+		ImageName:     c.meta.imageName,
+		ImageID:       c.meta.imageID,
+		Labels:        c.meta.labels,
+	}
+	dockerlogger.PutMessage(msg)
+	return c.batcher.Add(r)
+}
+
+// Close sends the records which are not sent yet.
+func (c *client) Close() error {
+	c.batcher.Close()
+	c.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// send sends a batch of records. Requests which fail with a network error, the 408 or 429
+// status, or a 5xx one are sent again by the batcher.
+func (c *client) send(ctx context.Context, records []record) ([]record, error) {
+	body, err := c.encode(records)
+	if err != nil {
+		return nil, err
+	}
+	return nil, c.post(ctx, body)
+}
+
+// encode encodes a batch of records in the format of the body, and compresses it if needed.
+func (c *client) encode(records []record) ([]byte, error) {
+	var buf bytes.Buffer
+	switch c.cfg.format {
+	case TemplateFormat:
+		if err := c.cfg.template.Execute(&buf, templateFields{Records: records}); err != nil {
+			return nil, fmt.Errorf("unable to render body: %w", err)
+		}
+	case JSONFormat:
+		enc := json.NewEncoder(&buf)
+		// Keep the log lines as they are rather than escaping HTML characters.
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(records); err != nil {
+			return nil, fmt.Errorf("unable to encode records: %w", err)
+		}
+	default:
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				return nil, fmt.Errorf("unable to encode record: %w", err)
+			}
+		}
+	}
+	if !c.cfg.gzip {
+		return buf.Bytes(), nil
+	}
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write(buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("unable to compress body: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("unable to compress body: %w", err)
+	}
+	return compressed.Bytes(), nil
+}
+
+// contentType returns the default content type of the body, which can be overridden with the
+// headers.
+func (c *client) contentType() string {
+	switch c.cfg.format {
+	case TemplateFormat:
+		return "text/plain; charset=utf-8"
+	case JSONFormat:
+		return "application/json"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+// post POSTs the body of a batch to the URL.
+func (c *client) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", c.contentType())
+	if c.cfg.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for name, value := range c.cfg.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return &logger.RetryableError{Err: fmt.Errorf("unable to send request: %w", err)}
+	}
+	defer resp.Body.Close() //nolint:errcheck // nothing to do
+	// Drain the response body so that the connection can be reused.
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBodySize))
+
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		return nil
+	}
+	if len(msg) > maxErrBodySize {
+		msg = msg[:maxErrBodySize]
+	}
+	err = fmt.Errorf("request failed with status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	switch {
+	case resp.StatusCode == http.StatusRequestTimeout,
+		resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode >= http.StatusInternalServerError:
+		return &logger.RetryableError{Err: err}
+	}
+	return err
+}
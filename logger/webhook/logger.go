@@ -0,0 +1,303 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package webhook provides the http log driver, which POSTs batches of container logs to any
+// URL, such as internal ingestion services and SaaS collectors.
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/containerd/containerd/runtime/v2/logging"
+	"github.com/docker/go-units"
+
+	"github.com/aws/shim-loggers-for-containerd/debug"
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+// http driver argument keys.
+const (
+	// DriverName is the name of the http log driver.
+	DriverName = "http"
+
+	// Required.
+
+	// URLKey is the URL the batches of log messages are POSTed to.
+	URLKey = "http-url"
+
+	// Optional.
+
+	// FormatKey is the encoding of the body of the requests, either `ndjson`, the default,
+	// `json` or `template`.
+	FormatKey = "http-format"
+	// TemplateKey is the Go template of the body of the requests, which is rendered for every
+	// batch. It implies the `template` format.
+	TemplateKey = "http-template"
+	// HeadersKey is a JSON object of the headers of the requests.
+	HeadersKey = "http-headers"
+	// HeadersFileKey is the path of a file holding a JSON object of headers, which are added to
+	// the ones of HeadersKey, e.g. for secrets mounted in the task.
+	HeadersFileKey = "http-headers-file"
+	// HeadersEndpointKey is an endpoint returning a JSON object of headers in its `headers` field,
+	// which are added to the ones of HeadersKey and HeadersFileKey.
+	HeadersEndpointKey = "http-headers-endpoint"
+	// GzipKey compresses the body of the requests with gzip.
+	GzipKey = "http-gzip"
+	// BatchSizeKey is the max number of log messages in a batch.
+	BatchSizeKey = "http-batch-size"
+	// BatchBytesKey is the size of the log lines after which a batch is sent, e.g. `1m`.
+	BatchBytesKey = "http-batch-bytes"
+	// BatchWaitKey is how long the first log message of a batch waits before the batch is sent.
+	BatchWaitKey = "http-batch-wait"
+	// MaxRetriesKey is the max number of times a batch is sent again if it fails with a network
+	// error, the 408 or 429 status, or a 5xx one.
+	MaxRetriesKey = "http-max-retries"
+	// RetryBackoffKey is how long to wait before sending a batch again the first time, which is
+	// doubled after every retry.
+	RetryBackoffKey = "http-retry-backoff"
+)
+
+// Supported values and default values of the arguments.
+const (
+	NDJSONFormat   = "ndjson"
+	JSONFormat     = "json"
+	TemplateFormat = "template"
+
+	defaultBatchSize    = 500
+	defaultBatchBytes   = "1m"
+	defaultBatchWait    = 1 * time.Second
+	defaultMaxRetries   = 5
+	defaultRetryBackoff = 1 * time.Second
+)
+
+// Args represents http log driver arguments.
+type Args struct {
+	// Required.
+	URL string
+
+	// Optional.
+	Format       string
+	Template     string
+	Headers      map[string]string
+	Gzip         string
+	BatchSize    string
+	BatchBytes   string
+	BatchWait    string
+	MaxRetries   string
+	RetryBackoff string
+}
+
+// LoggerArgs stores global logger args, docker configs and http specific args.
+type LoggerArgs struct {
+	globalArgs    *logger.GlobalArgs
+	dockerConfigs *logger.DockerConfigs
+	args          *Args
+}
+
+// InitLogger initializes the input arguments.
+func InitLogger(globalArgs *logger.GlobalArgs, dockerConfigs *logger.DockerConfigs, httpArgs *Args) *LoggerArgs {
+	return &LoggerArgs{
+		globalArgs:    globalArgs,
+		dockerConfigs: dockerConfigs,
+		args:          httpArgs,
+	}
+}
+
+// RunLogDriver initiates the http driver and starts sending container logs to the URL. Errors
+// with the log driver are logged but not returned to prevent container termination.
+func (la *LoggerArgs) RunLogDriver(ctx context.Context, config *logging.Config, ready func() error) error {
+	defer debug.DeferFuncForRunLogDriver()
+
+	stream, err := la.newStream()
+	if err != nil {
+		debug.ErrLogger = err
+		return debug.ErrLogger
+	}
+	// Send the log messages which are not sent yet before exiting.
+	defer stream.Close() //nolint:errcheck // errors are already logged
+
+	l, err := logger.NewPipelineLogger(la.globalArgs, config, logger.NewInfo(la.globalArgs.ContainerID, la.globalArgs.ContainerName), stream)
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("unable to create http driver: %w", err)
+		return debug.ErrLogger
+	}
+
+	// Start http driver.
+	debug.SendEventsToLog(logger.DaemonName, "Starting http driver", debug.INFO, 0)
+	err = l.Start(ctx, la.globalArgs.CleanupTime, ready)
+	if err != nil {
+		debug.ErrLogger = fmt.Errorf("failed to run http driver: %w", err)
+		// Do not return error if log driver has issue sending logs to destination, because if error
+		// returned here, containerd will identify this error and kill shim process, which will kill
+		// the container process accordingly.
+		// Note: the container will continue to run if shim logger exits after.
+		// Reference: https://github.com/containerd/containerd/blob/release/1.3/runtime/v2/logging/logging.go
+		return nil
+	}
+	debug.SendEventsToLog(logger.DaemonName, "Logging finished", debug.INFO, 1)
+
+	return nil
+}
+
+// NewStream creates the http stream, which is used when fanning out to multiple log drivers.
+func (la *LoggerArgs) NewStream() (logger.Client, error) {
+	stream, err := la.newStream()
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// newStream validates the log options and creates the http stream.
+func (la *LoggerArgs) newStream() (*client, error) {
+	cfg, err := getHTTPConfig(la.args)
+	if err != nil {
+		return nil, fmt.Errorf("unable to validate log options: %w", err)
+	}
+	return newClient(cfg, newRecordMetadata(la.globalArgs, la.dockerConfigs)), nil
+}
+
+// config is the validated http log driver arguments.
+type config struct {
+	url          string
+	format       string
+	template     *template.Template
+	headers      map[string]string
+	gzip         bool
+	batchSize    int
+	batchBytes   int64
+	batchWait    time.Duration
+	maxRetries   int
+	retryBackoff time.Duration
+}
+
+// templateFields are the fields of the body template.
+type templateFields struct {
+	Records []record
+}
+
+// templateFuncs are the functions of the body template, in addition to the builtin ones.
+var templateFuncs = template.FuncMap{
+	// json encodes a value as JSON, e.g. to quote log lines.
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// getHTTPConfig validates the http log driver arguments and sets the default values.
+func getHTTPConfig(args *Args) (*config, error) {
+	u, err := url.Parse(args.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", URLKey, args.URL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid %s %s: scheme must be http or https", URLKey, args.URL)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid %s %s: host is required", URLKey, args.URL)
+	}
+
+	cfg := &config{
+		url:          u.String(),
+		format:       args.Format,
+		headers:      args.Headers,
+		batchSize:    defaultBatchSize,
+		batchWait:    defaultBatchWait,
+		maxRetries:   defaultMaxRetries,
+		retryBackoff: defaultRetryBackoff,
+	}
+
+	if cfg.format == "" && args.Template != "" {
+		cfg.format = TemplateFormat
+	}
+	switch cfg.format {
+	case "":
+		cfg.format = NDJSONFormat
+	case NDJSONFormat, JSONFormat:
+	case TemplateFormat:
+		if args.Template == "" {
+			return nil, fmt.Errorf("%s is required with the %s %s", TemplateKey, TemplateFormat, FormatKey)
+		}
+	default:
+		return nil, fmt.Errorf("unknown %s: %s", FormatKey, args.Format)
+	}
+	if args.Template != "" {
+		if cfg.format != TemplateFormat {
+			return nil, fmt.Errorf("%s cannot be used with the %s %s", TemplateKey, cfg.format, FormatKey)
+		}
+		cfg.template, err = template.New("body").Option("missingkey=error").Funcs(templateFuncs).Parse(args.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", TemplateKey, args.Template, err)
+		}
+		// Render the template once, so that templates referring to unknown fields are rejected.
+		if err := cfg.template.Execute(&strings.Builder{}, templateFields{Records: []record{{}}}); err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", TemplateKey, args.Template, err)
+		}
+	}
+
+	for name, value := range cfg.headers {
+		if name == "" || strings.ContainsAny(name, " :\r\n") || strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("invalid %s: %q is not a valid header", HeadersKey, name)
+		}
+	}
+
+	if args.Gzip != "" {
+		if cfg.gzip, err = strconv.ParseBool(args.Gzip); err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", GzipKey, args.Gzip, err)
+		}
+	}
+
+	if args.BatchSize != "" {
+		if cfg.batchSize, err = strconv.Atoi(args.BatchSize); err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", BatchSizeKey, args.BatchSize, err)
+		}
+		if cfg.batchSize <= 0 {
+			return nil, fmt.Errorf("invalid %s %s: must be positive", BatchSizeKey, args.BatchSize)
+		}
+	}
+	batchBytes := args.BatchBytes
+	if batchBytes == "" {
+		batchBytes = defaultBatchBytes
+	}
+	if cfg.batchBytes, err = units.RAMInBytes(batchBytes); err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", BatchBytesKey, batchBytes, err)
+	}
+	if cfg.batchBytes <= 0 {
+		return nil, fmt.Errorf("invalid %s %s: must be positive", BatchBytesKey, batchBytes)
+	}
+	if args.BatchWait != "" {
+		if cfg.batchWait, err = time.ParseDuration(args.BatchWait); err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", BatchWaitKey, args.BatchWait, err)
+		}
+		if cfg.batchWait <= 0 {
+			return nil, fmt.Errorf("invalid %s %s: must be positive", BatchWaitKey, args.BatchWait)
+		}
+	}
+
+	if args.MaxRetries != "" {
+		if cfg.maxRetries, err = strconv.Atoi(args.MaxRetries); err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", MaxRetriesKey, args.MaxRetries, err)
+		}
+		if cfg.maxRetries < 0 {
+			return nil, fmt.Errorf("invalid %s %s: must not be negative", MaxRetriesKey, args.MaxRetries)
+		}
+	}
+	if args.RetryBackoff != "" {
+		if cfg.retryBackoff, err = time.ParseDuration(args.RetryBackoff); err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", RetryBackoffKey, args.RetryBackoff, err)
+		}
+		if cfg.retryBackoff <= 0 {
+			return nil, fmt.Errorf("invalid %s %s: must be positive", RetryBackoffKey, args.RetryBackoff)
+		}
+	}
+
+	return cfg, nil
+}
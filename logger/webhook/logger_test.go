@@ -0,0 +1,296 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unit
+// +build unit
+
+package webhook
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	dockerlogger "github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aws/shim-loggers-for-containerd/logger"
+)
+
+const (
+	testContainerID   = "test-container-id"
+	testContainerName = "test-container-name"
+	testImageName     = "test-image-name"
+)
+
+// TestGetHTTPConfig tests that the arguments are validated and the default values are set.
+func TestGetHTTPConfig(t *testing.T) {
+	cfg, err := getHTTPConfig(&Args{URL: "https://collector.example.com/ingest"})
+	require.NoError(t, err)
+	require.Equal(t, "https://collector.example.com/ingest", cfg.url)
+	require.Equal(t, NDJSONFormat, cfg.format)
+	require.False(t, cfg.gzip)
+	require.Equal(t, defaultBatchSize, cfg.batchSize)
+	require.Equal(t, int64(1024*1024), cfg.batchBytes)
+	require.Equal(t, defaultBatchWait, cfg.batchWait)
+	require.Equal(t, defaultMaxRetries, cfg.maxRetries)
+	require.Equal(t, defaultRetryBackoff, cfg.retryBackoff)
+
+	cfg, err = getHTTPConfig(&Args{
+		URL:        "http://localhost:8080",
+		Template:   "{{range .Records}}{{.Line}}{{end}}",
+		MaxRetries: "0",
+	})
+	require.NoError(t, err)
+	require.Equal(t, TemplateFormat, cfg.format)
+	require.Equal(t, 0, cfg.maxRetries)
+
+	for name, args := range map[string]*Args{
+		"url":             {URL: "localhost:8080"},
+		"url scheme":      {URL: "ftp://localhost:8080"},
+		"format":          {URL: "http://localhost:8080", Format: "xml"},
+		"missing tmpl":    {URL: "http://localhost:8080", Format: TemplateFormat},
+		"template format": {URL: "http://localhost:8080", Format: JSONFormat, Template: "{{.Records}}"},
+		"template":        {URL: "http://localhost:8080", Template: "{{range .Records}}"},
+		"template field":  {URL: "http://localhost:8080", Template: "{{range .Records}}{{.Hostname}}{{end}}"},
+		"header":          {URL: "http://localhost:8080", Headers: map[string]string{"X-Token": "a\r\nb"}},
+		"gzip":            {URL: "http://localhost:8080", Gzip: "yes"},
+		"batch size":      {URL: "http://localhost:8080", BatchSize: "0"},
+		"batch bytes":     {URL: "http://localhost:8080", BatchBytes: "lots"},
+		"batch wait":      {URL: "http://localhost:8080", BatchWait: "1"},
+		"max retries":     {URL: "http://localhost:8080", MaxRetries: "-1"},
+		"retry backoff":   {URL: "http://localhost:8080", RetryBackoff: "0s"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := getHTTPConfig(args)
+			require.Error(t, err)
+		})
+	}
+}
+
+// fakeServer records the bodies of the requests, and fails the first ones with the given status
+// codes.
+type fakeServer struct {
+	t        *testing.T
+	failures []int
+
+	lock     sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.requests = append(f.requests, r)
+	if len(f.failures) > 0 {
+		w.WriteHeader(f.failures[0])
+		f.failures = f.failures[1:]
+		return
+	}
+
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		require.NoError(f.t, err)
+		body = zr
+	}
+	b, err := io.ReadAll(body)
+	require.NoError(f.t, err)
+	f.bodies = append(f.bodies, b)
+}
+
+// logLines sends log lines to the stream, alternating stdout and stderr, and closes it.
+func logLines(t *testing.T, stream *client, timestamp time.Time, lines ...string) {
+	for i, line := range lines {
+		msg := dockerlogger.NewMessage()
+		msg.Line = append(msg.Line, line...)
+		msg.Source = []string{"stdout", "stderr"}[i%2]
+		msg.Timestamp = timestamp
+		require.NoError(t, stream.Log(msg))
+	}
+	require.NoError(t, stream.Close())
+	require.ErrorIs(t, stream.Log(dockerlogger.NewMessage()), logger.ErrBatcherClosed)
+}
+
+// TestClientSendsBatches tests that the records are sent in every format, with the headers and
+// compression, and that batches are sent again after retryable failures.
+func TestClientSendsBatches(t *testing.T) {
+	timestamp := time.Date(2020, time.January, 14, 1, 59, 0, 0, time.UTC)
+	expected := []record{
+		{
+			Timestamp: timestamp, Line: "first", Source: "stdout", ContainerID: testContainerID,
+			ContainerName: testContainerName, ImageName: testImageName, Labels: map[string]string{"team": "a"},
+		},
+		{
+			Timestamp: timestamp, Line: "<second>", Source: "stderr", ContainerID: testContainerID,
+			ContainerName: testContainerName, ImageName: testImageName, Labels: map[string]string{"team": "a"},
+		},
+	}
+
+	for _, tc := range []struct {
+		name        string
+		args        Args
+		contentType string
+		decode      func(t *testing.T, body []byte) []record
+	}{
+		{
+			name:        NDJSONFormat,
+			contentType: "application/x-ndjson",
+			decode: func(t *testing.T, body []byte) []record {
+				var records []record
+				scanner := bufio.NewScanner(bytes.NewReader(body))
+				for scanner.Scan() {
+					var r record
+					require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+					records = append(records, r)
+				}
+				return records
+			},
+		},
+		{
+			name:        JSONFormat,
+			args:        Args{Format: JSONFormat, Gzip: "true"},
+			contentType: "application/json",
+			decode: func(t *testing.T, body []byte) []record {
+				var records []record
+				require.NoError(t, json.Unmarshal(body, &records))
+				return records
+			},
+		},
+		{
+			name: TemplateFormat,
+			args: Args{
+				Template: `{"events":[{{range $i, $r := .Records}}{{if $i}},{{end}}` +
+					`{"line":{{json $r.Line}},"source":{{json $r.Source}}}{{end}}]}`,
+				Headers: map[string]string{"Content-Type": "application/vnd.events+json"},
+			},
+			contentType: "application/vnd.events+json",
+			decode: func(t *testing.T, body []byte) []record {
+				var events struct {
+					Events []record `json:"events"`
+				}
+				require.NoError(t, json.Unmarshal(body, &events))
+				// Only the fields of the template are sent.
+				for i := range events.Events {
+					events.Events[i].Timestamp = timestamp
+					events.Events[i].ContainerID = testContainerID
+					events.Events[i].ContainerName = testContainerName
+					events.Events[i].ImageName = testImageName
+					events.Events[i].Labels = map[string]string{"team": "a"}
+				}
+				return events.Events
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeServer{t: t, failures: []int{http.StatusTooManyRequests, http.StatusBadGateway}}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			args := tc.args
+			args.URL = server.URL + "/ingest"
+			args.RetryBackoff = "10ms"
+			if args.Headers == nil {
+				args.Headers = map[string]string{}
+			}
+			args.Headers["Authorization"] = "Bearer secret"
+			la := InitLogger(
+				&logger.GlobalArgs{ContainerID: testContainerID, ContainerName: testContainerName},
+				&logger.DockerConfigs{ContainerImageName: testImageName, ContainerLabels: map[string]string{"team": "a"}},
+				&args,
+			)
+			stream, err := la.newStream()
+			require.NoError(t, err)
+			logLines(t, stream, timestamp, "first", "<second>")
+
+			fake.lock.Lock()
+			defer fake.lock.Unlock()
+			require.Len(t, fake.requests, 3)
+			for _, r := range fake.requests {
+				require.Equal(t, http.MethodPost, r.Method)
+				require.Equal(t, "/ingest", r.URL.Path)
+				require.Equal(t, tc.contentType, r.Header.Get("Content-Type"))
+				require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+			}
+			require.Len(t, fake.bodies, 1)
+			require.Equal(t, expected, tc.decode(t, fake.bodies[0]))
+		})
+	}
+}
+
+// TestClientDropsBatches tests that batches are dropped once they're retried the max number of
+// times, or right away after non-retryable failures.
+func TestClientDropsBatches(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		failures []int
+		requests int
+	}{
+		{name: "retryable", failures: []int{500, 503, 504, 500}, requests: 3},
+		{name: "non-retryable", failures: []int{http.StatusBadRequest}, requests: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeServer{t: t, failures: tc.failures}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			la := InitLogger(&logger.GlobalArgs{ContainerID: testContainerID}, nil, &Args{
+				URL:          server.URL,
+				MaxRetries:   "2",
+				RetryBackoff: "10ms",
+			})
+			stream, err := la.newStream()
+			require.NoError(t, err)
+			logLines(t, stream, time.Now(), "first")
+
+			fake.lock.Lock()
+			defer fake.lock.Unlock()
+			require.Len(t, fake.requests, tc.requests)
+			require.Empty(t, fake.bodies)
+		})
+	}
+}
+
+// TestClientBatchesBySize tests that a batch is sent once it has the max number of log messages,
+// or once the size of its log lines reaches the batch bytes, without waiting for the batch wait.
+func TestClientBatchesBySize(t *testing.T) {
+	fake := &fakeServer{t: t}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	la := InitLogger(&logger.GlobalArgs{ContainerID: testContainerID}, nil, &Args{
+		URL:        server.URL,
+		BatchSize:  "2",
+		BatchBytes: "10b",
+		BatchWait:  "1h",
+	})
+	stream, err := la.newStream()
+	require.NoError(t, err)
+	for _, line := range []string{"a", "b", "0123456789"} {
+		msg := dockerlogger.NewMessage()
+		msg.Line = append(msg.Line, line...)
+		msg.Source = "stdout"
+		msg.Timestamp = time.Now()
+		require.NoError(t, stream.Log(msg))
+	}
+	require.Eventually(t, func() bool {
+		fake.lock.Lock()
+		defer fake.lock.Unlock()
+		return len(fake.bodies) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, stream.Close())
+
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	require.Len(t, fake.bodies, 2)
+	require.Equal(t, 2, bytes.Count(fake.bodies[0], []byte("\n")))
+	require.Equal(t, 1, bytes.Count(fake.bodies[1], []byte("\n")))
+}
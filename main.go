@@ -12,9 +12,20 @@ import (
 	"github.com/aws/shim-loggers-for-containerd/debug"
 	"github.com/aws/shim-loggers-for-containerd/logger"
 	"github.com/aws/shim-loggers-for-containerd/logger/awslogs"
+	"github.com/aws/shim-loggers-for-containerd/logger/firehose"
 	"github.com/aws/shim-loggers-for-containerd/logger/fluentd"
+	"github.com/aws/shim-loggers-for-containerd/logger/gelf"
+	"github.com/aws/shim-loggers-for-containerd/logger/journald"
 	"github.com/aws/shim-loggers-for-containerd/logger/jsonfile"
+	"github.com/aws/shim-loggers-for-containerd/logger/kafka"
+	"github.com/aws/shim-loggers-for-containerd/logger/localfile"
+	"github.com/aws/shim-loggers-for-containerd/logger/loki"
+	"github.com/aws/shim-loggers-for-containerd/logger/opensearch"
+	"github.com/aws/shim-loggers-for-containerd/logger/otlp"
+	"github.com/aws/shim-loggers-for-containerd/logger/s3"
 	"github.com/aws/shim-loggers-for-containerd/logger/splunk"
+	"github.com/aws/shim-loggers-for-containerd/logger/syslog"
+	"github.com/aws/shim-loggers-for-containerd/logger/webhook"
 
 	"github.com/containerd/containerd/runtime/v2/logging"
 	"github.com/spf13/pflag"
@@ -26,9 +37,20 @@ func init() {
 	initWindowsOpts()
 	initDockerConfigOpts()
 	initAWSLogsOpts()
+	initFirehoseOpts()
 	initFluentdOpts()
+	initGELFOpts()
 	initJSONFileOpts()
+	initJournaldOpts()
+	initHTTPOpts()
+	initKafkaOpts()
+	initLocalFileOpts()
+	initLokiOpts()
+	initOpenSearchOpts()
+	initOTLPOpts()
+	initS3Opts()
 	initSplunkOpts()
+	initSyslogOpts()
 }
 
 func main() {
@@ -56,6 +78,9 @@ func run() error {
 	if err != nil {
 		return fmt.Errorf("unable to get global arguments: %w", err)
 	}
+	// Attach the container and the log driver to every event of this process, so that they can be
+	// filtered by them, e.g. `journalctl CONTAINER_ID=<container-id>`.
+	debug.SetDefaultFields(debug.ContainerID(globalArgs.ContainerID), debug.Driver(globalArgs.LogDriver))
 
 	// Read the Windows specific options and set the environment up accordingly
 	if runtime.GOOS == "windows" {
@@ -82,24 +107,92 @@ func run() error {
 	if err = logger.SetUIDAndGID(globalArgs.UID, globalArgs.GID); err != nil {
 		return err
 	}
+	if globalArgs.MetricsAddress != "" {
+		// Metrics are not worth losing container logs for, so keep running without them.
+		server, err := logger.StartMetricsServer(globalArgs)
+		if err != nil {
+			debug.SendEvent(logger.DaemonName, fmt.Sprintf("Unable to start metrics server: %s", err),
+				debug.ERROR, debug.Err(err))
+		} else {
+			defer server.Close() //nolint:errcheck // nothing to do
+		}
+	}
 
 	logDriver := globalArgs.LogDriver
 	debug.SendEventsToLog(logger.DaemonName, "Driver: "+logDriver, debug.INFO, 0)
+	logDrivers, err := getLogDrivers(logDriver)
+	if err != nil {
+		return err
+	}
+	if len(logDrivers) > 1 {
+		if err := runMultipleLogDrivers(globalArgs, logDrivers); err != nil {
+			return fmt.Errorf("unable to run log drivers %s: %w", logDriver, err)
+		}
+		return nil
+	}
 	switch logDriver {
 	case awslogs.DriverName:
 		if err := runAWSLogsDriver(globalArgs); err != nil {
 			return fmt.Errorf("unable to run awslogs driver: %w", err)
 		}
+	case firehose.DriverName:
+		if err := runFirehoseDriver(globalArgs); err != nil {
+			return fmt.Errorf("unable to run firehose driver: %w", err)
+		}
 	case fluentd.DriverName:
 		runFluentdDriver(globalArgs)
+	case gelf.DriverName:
+		if err := runGELFDriver(globalArgs); err != nil {
+			return fmt.Errorf("unable to run gelf driver: %w", err)
+		}
 	case jsonfile.DriverName:
 		if err := runJSONFileDriver(globalArgs); err != nil {
 			return fmt.Errorf("unable to run json-file driver: %w", err)
 		}
+	case localfile.DriverName:
+		if err := runLocalFileDriver(globalArgs); err != nil {
+			return fmt.Errorf("unable to run local-file driver: %w", err)
+		}
+	case journald.DriverName:
+		if err := runJournaldDriver(globalArgs); err != nil {
+			return fmt.Errorf("unable to run journald driver: %w", err)
+		}
+	case firehose.KinesisDriverName:
+		if err := runKinesisDriver(globalArgs); err != nil {
+			return fmt.Errorf("unable to run kinesis driver: %w", err)
+		}
 	case splunk.DriverName:
 		if err := runSplunkDriver(globalArgs); err != nil {
 			return fmt.Errorf("unable to run splunk driver: %w", err)
 		}
+	case webhook.DriverName:
+		if err := runHTTPDriver(globalArgs); err != nil {
+			return fmt.Errorf("unable to run http driver: %w", err)
+		}
+	case kafka.DriverName:
+		if err := runKafkaDriver(globalArgs); err != nil {
+			return fmt.Errorf("unable to run kafka driver: %w", err)
+		}
+	case loki.DriverName:
+		if err := runLokiDriver(globalArgs); err != nil {
+			return fmt.Errorf("unable to run loki driver: %w", err)
+		}
+	case opensearch.DriverName:
+		if err := runOpenSearchDriver(globalArgs); err != nil {
+			return fmt.Errorf("unable to run opensearch driver: %w", err)
+		}
+	case otlp.DriverName:
+		if err := runOTLPDriver(globalArgs); err != nil {
+			return fmt.Errorf("unable to run otlp driver: %w", err)
+		}
+	case s3.DriverName:
+		if err := runS3Driver(globalArgs); err != nil {
+			return fmt.Errorf("unable to run s3 driver: %w", err)
+		}
+	case syslog.DriverName:
+		if err := runSyslogDriver(globalArgs); err != nil {
+			return fmt.Errorf("unable to run syslog driver: %w", err)
+		}
 	default:
 		return fmt.Errorf("unknown log driver: %s", logDriver)
 	}
@@ -118,12 +211,40 @@ func runAWSLogsDriver(globalArgs *logger.GlobalArgs) error {
 	return nil
 }
 
+func runFirehoseDriver(globalArgs *logger.GlobalArgs) error {
+	args, err := getFirehoseArgs()
+	if err != nil {
+		return fmt.Errorf("unable to get firehose specified arguments: %w", err)
+	}
+	loggerArgs := firehose.InitLogger(globalArgs, args)
+	logging.Run(loggerArgs.RunLogDriver)
+
+	return nil
+}
+
 func runFluentdDriver(globalArgs *logger.GlobalArgs) {
 	args := getFluentdArgs()
 	loggerArgs := fluentd.InitLogger(globalArgs, args)
 	logging.Run(loggerArgs.RunLogDriver)
 }
 
+func runGELFDriver(globalArgs *logger.GlobalArgs) error {
+	dockerConfigs, err := getDockerConfigs()
+	if err != nil {
+		return fmt.Errorf("unable to get docker config arguments: %w", err)
+	}
+
+	args, err := getGELFArgs()
+	if err != nil {
+		return fmt.Errorf("unable to get gelf specified arguments: %w", err)
+	}
+
+	loggerArgs := gelf.InitLogger(globalArgs, dockerConfigs, args)
+	logging.Run(loggerArgs.RunLogDriver)
+
+	return nil
+}
+
 func runJSONFileDriver(globalArgs *logger.GlobalArgs) error {
 	args, err := getJSONFileArgs()
 	if err != nil {
@@ -135,6 +256,40 @@ func runJSONFileDriver(globalArgs *logger.GlobalArgs) error {
 	return nil
 }
 
+func runLocalFileDriver(globalArgs *logger.GlobalArgs) error {
+	args, err := getLocalFileArgs()
+	if err != nil {
+		return fmt.Errorf("unable to get local-file specified arguments: %w", err)
+	}
+	loggerArgs := localfile.InitLogger(globalArgs, args)
+	logging.Run(loggerArgs.RunLogDriver)
+
+	return nil
+}
+
+func runJournaldDriver(globalArgs *logger.GlobalArgs) error {
+	dockerConfigs, err := getDockerConfigs()
+	if err != nil {
+		return fmt.Errorf("unable to get docker config arguments: %w", err)
+	}
+
+	loggerArgs := journald.InitLogger(globalArgs, dockerConfigs, getJournaldArgs())
+	logging.Run(loggerArgs.RunLogDriver)
+
+	return nil
+}
+
+func runKinesisDriver(globalArgs *logger.GlobalArgs) error {
+	args, err := getKinesisArgs()
+	if err != nil {
+		return fmt.Errorf("unable to get kinesis specified arguments: %w", err)
+	}
+	loggerArgs := firehose.InitKinesisLogger(globalArgs, args)
+	logging.Run(loggerArgs.RunLogDriver)
+
+	return nil
+}
+
 func runSplunkDriver(globalArgs *logger.GlobalArgs) error {
 	dockerConfigs, err := getDockerConfigs()
 	if err != nil {
@@ -152,6 +307,262 @@ func runSplunkDriver(globalArgs *logger.GlobalArgs) error {
 	return nil
 }
 
+func runHTTPDriver(globalArgs *logger.GlobalArgs) error {
+	dockerConfigs, err := getDockerConfigs()
+	if err != nil {
+		return fmt.Errorf("unable to get docker config arguments: %w", err)
+	}
+
+	args, err := getHTTPArgs()
+	if err != nil {
+		return fmt.Errorf("unable to get http specified arguments: %w", err)
+	}
+
+	loggerArgs := webhook.InitLogger(globalArgs, dockerConfigs, args)
+	logging.Run(loggerArgs.RunLogDriver)
+
+	return nil
+}
+
+func runKafkaDriver(globalArgs *logger.GlobalArgs) error {
+	dockerConfigs, err := getDockerConfigs()
+	if err != nil {
+		return fmt.Errorf("unable to get docker config arguments: %w", err)
+	}
+
+	args, err := getKafkaArgs()
+	if err != nil {
+		return fmt.Errorf("unable to get kafka specified arguments: %w", err)
+	}
+
+	loggerArgs := kafka.InitLogger(globalArgs, dockerConfigs, args)
+	logging.Run(loggerArgs.RunLogDriver)
+
+	return nil
+}
+
+func runLokiDriver(globalArgs *logger.GlobalArgs) error {
+	dockerConfigs, err := getDockerConfigs()
+	if err != nil {
+		return fmt.Errorf("unable to get docker config arguments: %w", err)
+	}
+
+	args, err := getLokiArgs()
+	if err != nil {
+		return fmt.Errorf("unable to get loki specified arguments: %w", err)
+	}
+
+	loggerArgs := loki.InitLogger(globalArgs, dockerConfigs, args)
+	logging.Run(loggerArgs.RunLogDriver)
+
+	return nil
+}
+
+func runOpenSearchDriver(globalArgs *logger.GlobalArgs) error {
+	dockerConfigs, err := getDockerConfigs()
+	if err != nil {
+		return fmt.Errorf("unable to get docker config arguments: %w", err)
+	}
+
+	args, err := getOpenSearchArgs()
+	if err != nil {
+		return fmt.Errorf("unable to get opensearch specified arguments: %w", err)
+	}
+
+	loggerArgs := opensearch.InitLogger(globalArgs, dockerConfigs, args)
+	logging.Run(loggerArgs.RunLogDriver)
+
+	return nil
+}
+
+func runOTLPDriver(globalArgs *logger.GlobalArgs) error {
+	dockerConfigs, err := getDockerConfigs()
+	if err != nil {
+		return fmt.Errorf("unable to get docker config arguments: %w", err)
+	}
+
+	args, err := getOTLPArgs()
+	if err != nil {
+		return fmt.Errorf("unable to get otlp specified arguments: %w", err)
+	}
+
+	loggerArgs := otlp.InitLogger(globalArgs, dockerConfigs, args)
+	logging.Run(loggerArgs.RunLogDriver)
+
+	return nil
+}
+
+func runS3Driver(globalArgs *logger.GlobalArgs) error {
+	args, err := getS3Args()
+	if err != nil {
+		return fmt.Errorf("unable to get s3 specified arguments: %w", err)
+	}
+	loggerArgs := s3.InitLogger(globalArgs, args)
+	logging.Run(loggerArgs.RunLogDriver)
+
+	return nil
+}
+
+func runSyslogDriver(globalArgs *logger.GlobalArgs) error {
+	dockerConfigs, err := getDockerConfigs()
+	if err != nil {
+		return fmt.Errorf("unable to get docker config arguments: %w", err)
+	}
+
+	loggerArgs := syslog.InitLogger(globalArgs, dockerConfigs, getSyslogArgs())
+	logging.Run(loggerArgs.RunLogDriver)
+
+	return nil
+}
+
+// runMultipleLogDrivers sends logs to all the given log drivers, each in its own mode.
+func runMultipleLogDrivers(globalArgs *logger.GlobalArgs, logDrivers []string) error {
+	streams := make([]*logger.MultiStream, 0, len(logDrivers))
+	for _, logDriver := range logDrivers {
+		stream := &logger.MultiStream{
+			DriverName: logDriver,
+			Mode:       globalArgs.DriverModes[logDriver],
+		}
+		switch logDriver {
+		case awslogs.DriverName:
+			args, err := getAWSLogsArgs()
+			if err != nil {
+				return fmt.Errorf("unable to get awslogs specified arguments: %w", err)
+			}
+			stream.New = awslogs.InitLogger(globalArgs, args).NewStream
+			stream.MaxBytesPerEvent = awslogs.MaximumBytesPerEvent
+		case firehose.DriverName:
+			args, err := getFirehoseArgs()
+			if err != nil {
+				return fmt.Errorf("unable to get firehose specified arguments: %w", err)
+			}
+			stream.New = firehose.InitLogger(globalArgs, args).NewStream
+			stream.MaxBytesPerEvent = firehose.MaximumBytesPerEvent
+		case fluentd.DriverName:
+			stream.New = fluentd.InitLogger(globalArgs, getFluentdArgs()).NewStream
+		case gelf.DriverName:
+			dockerConfigs, err := getDockerConfigs()
+			if err != nil {
+				return fmt.Errorf("unable to get docker config arguments: %w", err)
+			}
+			args, err := getGELFArgs()
+			if err != nil {
+				return fmt.Errorf("unable to get gelf specified arguments: %w", err)
+			}
+			loggerArgs := gelf.InitLogger(globalArgs, dockerConfigs, args)
+			stream.New = loggerArgs.NewStream
+			stream.MaxBytesPerEvent = loggerArgs.MaxBytesPerEvent()
+		case jsonfile.DriverName:
+			args, err := getJSONFileArgs()
+			if err != nil {
+				return fmt.Errorf("unable to get json-file specified arguments: %w", err)
+			}
+			stream.New = jsonfile.InitLogger(globalArgs, args).NewStream
+		case localfile.DriverName:
+			args, err := getLocalFileArgs()
+			if err != nil {
+				return fmt.Errorf("unable to get local-file specified arguments: %w", err)
+			}
+			stream.New = localfile.InitLogger(globalArgs, args).NewStream
+		case journald.DriverName:
+			dockerConfigs, err := getDockerConfigs()
+			if err != nil {
+				return fmt.Errorf("unable to get docker config arguments: %w", err)
+			}
+			stream.New = journald.InitLogger(globalArgs, dockerConfigs, getJournaldArgs()).NewStream
+		case firehose.KinesisDriverName:
+			args, err := getKinesisArgs()
+			if err != nil {
+				return fmt.Errorf("unable to get kinesis specified arguments: %w", err)
+			}
+			stream.New = firehose.InitKinesisLogger(globalArgs, args).NewStream
+			stream.MaxBytesPerEvent = firehose.MaximumBytesPerEvent
+		case splunk.DriverName:
+			dockerConfigs, err := getDockerConfigs()
+			if err != nil {
+				return fmt.Errorf("unable to get docker config arguments: %w", err)
+			}
+			args, err := getSplunkArgs()
+			if err != nil {
+				return fmt.Errorf("unable to get splunk specified arguments: %w", err)
+			}
+			stream.New = splunk.InitLogger(globalArgs, dockerConfigs, args).NewStream
+		case webhook.DriverName:
+			dockerConfigs, err := getDockerConfigs()
+			if err != nil {
+				return fmt.Errorf("unable to get docker config arguments: %w", err)
+			}
+			args, err := getHTTPArgs()
+			if err != nil {
+				return fmt.Errorf("unable to get http specified arguments: %w", err)
+			}
+			stream.New = webhook.InitLogger(globalArgs, dockerConfigs, args).NewStream
+		case kafka.DriverName:
+			dockerConfigs, err := getDockerConfigs()
+			if err != nil {
+				return fmt.Errorf("unable to get docker config arguments: %w", err)
+			}
+			args, err := getKafkaArgs()
+			if err != nil {
+				return fmt.Errorf("unable to get kafka specified arguments: %w", err)
+			}
+			stream.New = kafka.InitLogger(globalArgs, dockerConfigs, args).NewStream
+		case loki.DriverName:
+			dockerConfigs, err := getDockerConfigs()
+			if err != nil {
+				return fmt.Errorf("unable to get docker config arguments: %w", err)
+			}
+			args, err := getLokiArgs()
+			if err != nil {
+				return fmt.Errorf("unable to get loki specified arguments: %w", err)
+			}
+			stream.New = loki.InitLogger(globalArgs, dockerConfigs, args).NewStream
+		case opensearch.DriverName:
+			dockerConfigs, err := getDockerConfigs()
+			if err != nil {
+				return fmt.Errorf("unable to get docker config arguments: %w", err)
+			}
+			args, err := getOpenSearchArgs()
+			if err != nil {
+				return fmt.Errorf("unable to get opensearch specified arguments: %w", err)
+			}
+			stream.New = opensearch.InitLogger(globalArgs, dockerConfigs, args).NewStream
+		case otlp.DriverName:
+			dockerConfigs, err := getDockerConfigs()
+			if err != nil {
+				return fmt.Errorf("unable to get docker config arguments: %w", err)
+			}
+			args, err := getOTLPArgs()
+			if err != nil {
+				return fmt.Errorf("unable to get otlp specified arguments: %w", err)
+			}
+			stream.New = otlp.InitLogger(globalArgs, dockerConfigs, args).NewStream
+		case s3.DriverName:
+			args, err := getS3Args()
+			if err != nil {
+				return fmt.Errorf("unable to get s3 specified arguments: %w", err)
+			}
+			stream.New = s3.InitLogger(globalArgs, args).NewStream
+		case syslog.DriverName:
+			dockerConfigs, err := getDockerConfigs()
+			if err != nil {
+				return fmt.Errorf("unable to get docker config arguments: %w", err)
+			}
+			loggerArgs := syslog.InitLogger(globalArgs, dockerConfigs, getSyslogArgs())
+			stream.New = loggerArgs.NewStream
+			stream.MaxBytesPerEvent = loggerArgs.MaxBytesPerEvent()
+		default:
+			return fmt.Errorf("unknown log driver: %s", logDriver)
+		}
+		streams = append(streams, stream)
+	}
+
+	loggerArgs := logger.InitMultiLogger(globalArgs, streams)
+	logging.Run(loggerArgs.RunLogDriver)
+
+	return nil
+}
+
 // setWindowsEnv reads the Windows options and sets them up.
 func setWindowsEnv(logDir, containerName, proxyEnvVar string) error {
 	if logDir != "" {